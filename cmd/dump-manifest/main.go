@@ -22,6 +22,15 @@ import (
 
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/os/android/apk"
+	"github.com/google/gapid/core/os/android/binaryxml"
+)
+
+var (
+	resolve  = flag.Bool("resolve", false, "replace resource references by their values")
+	language = flag.String("language", "en", "language used to resolve resources")
+	region   = flag.String("region", "", "region used to resolve resources")
+	density  = flag.Int("density", 640, "screen density in dpi used to resolve resources")
+	sdk      = flag.Int("sdk", 0, "API level used to resolve resources, 0 for the latest")
 )
 
 func main() {
@@ -40,7 +49,17 @@ func run(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	m, err := apk.GetManifestXML(ctx, files)
+	var m string
+	if *resolve {
+		m, err = apk.GetResolvedManifestXML(ctx, files, binaryxml.ResourceConfig{
+			Language:   *language,
+			Region:     *region,
+			Density:    uint16(*density),
+			SDKVersion: uint16(*sdk),
+		})
+	} else {
+		m, err = apk.GetManifestXML(ctx, files)
+	}
 	if err != nil {
 		return err
 	}
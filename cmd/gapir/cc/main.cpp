@@ -441,7 +441,13 @@ std::unique_ptr<Server> Setup(const char* uri, const char* authToken,
               } else {
                 GAPID_INFO("Already in the correct state");
               }
-              GAPID_INFO("Running %s", req->replay().replay_id().c_str());
+              if (req->replay().trace_id().empty()) {
+                GAPID_INFO("Running %s", req->replay().replay_id().c_str());
+              } else {
+                GAPID_INFO("Running %s (trace %s)",
+                           req->replay().replay_id().c_str(),
+                           req->replay().trace_id().c_str());
+              }
               if (context->initialize(req->replay().replay_id())) {
                 GAPID_INFO("Replay context initialized successfully");
               } else {
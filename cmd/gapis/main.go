@@ -16,6 +16,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"io"
 	"os"
@@ -30,6 +31,7 @@ import (
 	"github.com/google/gapid/core/app/crash"
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/net/grpcutil"
 	"github.com/google/gapid/core/os/android/adb"
 	"github.com/google/gapid/core/os/device/bind"
 	"github.com/google/gapid/core/os/device/remotessh"
@@ -47,7 +49,11 @@ import (
 )
 
 var (
-	rpc              = flag.String("rpc", "localhost:0", "TCP host:port of the server's RPC listener")
+	rpc              = flag.String("rpc", "localhost:0", "TCP host:port of the server's RPC listener, or unix:<path> of a Unix domain socket")
+	rpcSocketMode    = flag.Uint("rpc-socket-mode", 0600, "Permissions of the Unix domain socket of the RPC listener, e.g. 0660 to allow the group to connect")
+	tlsCert          = flag.String("tls-cert", "", "Path to the PEM certificate of the server; enables TLS if set together with -tls-key")
+	tlsKey           = flag.String("tls-key", "", "Path to the PEM private key of the server certificate")
+	tlsClientCA      = flag.String("tls-client-ca", "", "Path to the PEM CA certificates verifying client certificates; requires clients to present one if set")
 	stringsPath      = flag.String("strings", "strings", "_Directory containing string table packages")
 	persist          = flag.Bool("persist", false, "Server will keep running even when no connections remain")
 	gapisAuthToken   = flag.String("gapis-auth-token", "", "_The connection authorization token for gapis")
@@ -60,8 +66,10 @@ var (
 	idleTimeout      = flag.Duration("idle-timeout", 0, "_Closes GAPIS if the server is not repeatedly pinged within this duration (e.g. '30s', '2m'). Default: 0 (no timeout).")
 	adbPath          = flag.String("adb", "", "Path to the adb executable; leave empty to search the environment")
 	enableLocalFiles = flag.Bool("enable-local-files", false, "Allow clients to access local .gfxtrace files by path")
+	bundleDir        = flag.String("bundle-dir", "", "Directory the profiling bundles are saved to and loaded from; if empty, only paths within the working directory are allowed")
 	remoteSSHConfig  = flag.String("ssh-config", "", "_Path to an ssh config file for remote devices")
 	preloadDepGraph  = flag.Bool("preload-dep-graph", true, "_Preload the dependency graph when loading captures")
+	metricsAddr      = flag.String("metrics", "", "TCP host:port of a HTTP listener serving Prometheus metrics on /metrics; disabled if empty")
 )
 
 func main() {
@@ -114,6 +122,14 @@ func run(ctx context.Context) error {
 	ctx = trace.PutManager(ctx, trace.New(ctx))
 	ctx = database.Put(ctx, database.NewInMemory(ctx))
 
+	if *metricsAddr != "" {
+		stop, err := serveMetrics(ctx, *metricsAddr)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
 	// Grpc is very verbose, turn that down
 	grpclog.SetLogger(log.From(ctx).SetFilter(log.SeverityFilter(log.Error)))
 
@@ -158,6 +174,15 @@ func run(ctx context.Context) error {
 		return log.Err(ctx, err, "Failed to retrieve hostname")
 	}
 
+	var tlsConfig *tls.Config
+	if *tlsCert != "" || *tlsKey != "" {
+		if tlsConfig, err = grpcutil.ServerTLSConfig(*tlsCert, *tlsKey, *tlsClientCA); err != nil {
+			return log.Err(ctx, err, "Failed to load the TLS certificate")
+		}
+	} else if *tlsClientCA != "" {
+		return log.Err(ctx, nil, "-tls-client-ca requires -tls-cert and -tls-key")
+	}
+
 	return server.Listen(ctx, *rpc, server.Config{
 		Info: &service.ServerInfo{
 			Name:              hostname,
@@ -169,11 +194,14 @@ func run(ctx context.Context) error {
 		},
 		StringTables:     loadStrings(ctx),
 		EnableLocalFiles: *enableLocalFiles,
+		BundleDir:        *bundleDir,
 		PreloadDepGraph:  *preloadDepGraph,
 		AuthToken:        auth.Token(*gapisAuthToken),
 		DeviceScanDone:   deviceScanDone,
 		LogBroadcaster:   logBroadcaster,
 		IdleTimeout:      *idleTimeout,
+		SocketMode:       os.FileMode(*rpcSocketMode),
+		TLS:              tlsConfig,
 	})
 }
 
@@ -0,0 +1,74 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/replay"
+)
+
+// serveMetrics starts serving the server metrics in the Prometheus format on
+// the /metrics path of a HTTP listener on addr. The returned function stops
+// the listener.
+func serveMetrics(ctx context.Context, addr string) (func(), error) {
+	metrics, unregister := status.RegisterMetrics()
+
+	replays, db := replay.GetManager(ctx), database.Get(ctx)
+	metrics.AddGauge("gapis_replay_queue_length", "Number of replay tasks queued, per device.", "device",
+		func() map[string]float64 {
+			out := map[string]float64{}
+			for device, n := range replay.QueuedReplays(replays) {
+				out[device.String()] = float64(n)
+			}
+			return out
+		})
+	metrics.AddGauge("gapis_database_records", "Number of records in the database.", "",
+		func() map[string]float64 {
+			stats, _ := database.GetStats(db)
+			return map[string]float64{"": float64(stats.Records)}
+		})
+	metrics.AddGauge("gapis_database_size_bytes", "Size of the encoded records held by the database.", "",
+		func() map[string]float64 {
+			stats, _ := database.GetStats(db)
+			return map[string]float64{"": float64(stats.Size)}
+		})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		unregister()
+		return nil, log.Errf(ctx, err, "Could not start the metrics listener on %v", addr)
+	}
+	log.I(ctx, "Serving metrics on http://%v/metrics", listener.Addr())
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	server := &http.Server{Handler: mux}
+	crash.Go(func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.E(ctx, "Metrics listener failed: %v", err)
+		}
+	})
+	return func() {
+		server.Close()
+		unregister()
+	}, nil
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type applyEditsVerb struct{ ApplyEditsFlags }
+
+func init() {
+	verb := &applyEditsVerb{}
+
+	app.AddVerb(&app.Verb{
+		Name:      "apply_edits",
+		ShortHelp: "Applies the edit script of an edited trace to another trace",
+		Action:    verb,
+	})
+}
+
+func (verb *applyEditsVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	if verb.Edits == "" {
+		app.Usage(ctx, "An edit script is required")
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(verb.Edits)
+	if err != nil {
+		return log.Errf(ctx, err, "Reading file: %v", verb.Edits)
+	}
+	script := &service.EditScript{}
+	if err := proto.Unmarshal(data, script); err != nil {
+		return log.Errf(ctx, err, "Parsing edit script: %v", verb.Edits)
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, verb.Gapir, flags.Arg(0), verb.CaptureFileFlags)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	newCapture, err := client.ApplyEdits(ctx, capture, script.Edits)
+	if err != nil {
+		return log.Err(ctx, err, "ApplyEdits")
+	}
+	log.I(ctx, "Applied %d edits; id: %s", len(script.Edits), newCapture.ID)
+
+	output := verb.Out
+	if output == "" {
+		output = "edited.gfxtrace"
+	}
+	return client.SaveCapture(ctx, newCapture, output)
+}
@@ -81,6 +81,9 @@ func (verb *coarseProfileVerb) Run(ctx context.Context, flags flag.FlagSet) erro
 	defer reportWriter.Flush()
 
 	header := []string{"BeginCmd", "EndCmd", "Time(ns)"}
+	if verb.LoopCount > 1 {
+		header = append(header, "Min(ns)", "Median(ns)", "Max(ns)", "StdDev(ns)", "Samples", "Outliers")
+	}
 	if err = reportWriter.Write(header); err != nil {
 		log.Err(ctx, err, "Failed to write header")
 	}
@@ -90,8 +93,9 @@ func (verb *coarseProfileVerb) Run(ctx context.Context, flags flag.FlagSet) erro
 	}
 
 	req := &service.GetTimestampsRequest{
-		Capture: capturePath,
-		Device:  device,
+		Capture:   capturePath,
+		Device:    device,
+		LoopCount: int32(verb.LoopCount),
 	}
 
 	client.GetTimestamps(ctx, req, func(r *service.GetTimestampsResponse) error {
@@ -100,6 +104,15 @@ func (verb *coarseProfileVerb) Run(ctx context.Context, flags flag.FlagSet) erro
 				begin := cmdToString(t.Begin)
 				end := cmdToString(t.End)
 				record := []string{begin, end, fmt.Sprint(t.TimeInNanoseconds)}
+				if s := t.Statistics; s != nil {
+					record = append(record,
+						fmt.Sprint(s.MinInNanoseconds),
+						fmt.Sprint(s.MedianInNanoseconds),
+						fmt.Sprint(s.MaxInNanoseconds),
+						fmt.Sprintf("%.1f", s.StddevInNanoseconds),
+						fmt.Sprint(s.Samples),
+						fmt.Sprint(s.Outliers))
+				}
 				if err := reportWriter.Write(record); err != nil {
 					log.Err(ctx, err, "Failed to write record")
 				}
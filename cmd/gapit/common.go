@@ -16,6 +16,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"math"
@@ -28,9 +29,11 @@ import (
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/app/auth"
 	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/app/status"
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/net/grpcutil"
 	"github.com/google/gapid/core/os/android/adb"
 	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/core/os/device/bind"
@@ -62,8 +65,8 @@ func (c clientCloser) Close() error {
 	return c.Client.Close()
 }
 
-func getGapis(ctx context.Context, gapisFlags GapisFlags, gapirFlags GapirFlags) (client.Client, error) {
-	args := strings.Fields(gapisFlags.Args)
+func getGapis(ctx context.Context, gapisFlags GapisFlags, gapirFlags GapirFlags, extraArgs ...string) (client.Client, error) {
+	args := append(strings.Fields(gapisFlags.Args), extraArgs...)
 
 	args = append(args, "--enable-local-files")
 
@@ -88,21 +91,51 @@ func getGapis(ctx context.Context, gapisFlags GapisFlags, gapirFlags GapirFlags)
 		args = append(args, "--idle-timeout", "1m")
 	}
 
+	if gapisFlags.Host != "" && gapisFlags.Port == 0 {
+		return nil, log.Err(ctx, nil, "-gapis-host requires the -gapis-port of the running gapis")
+	}
+
 	var token auth.Token
-	if gapisFlags.Port == 0 {
+	if gapisFlags.Port == 0 && gapisFlags.Socket == "" {
 		token = auth.GenToken()
 	} else {
 		token = auth.Token(gapisFlags.Token)
 	}
+	// All the requests of this command share a trace identifier, so that the
+	// work done by gapis and gapir to serve them can be followed.
+	traceID := status.NewTraceID()
+	log.D(ctx, "Trace ID: %v", traceID)
+
+	var tlsConfig *tls.Config
+	if gapisFlags.TLS {
+		if gapisFlags.Port == 0 && gapisFlags.Socket == "" {
+			return nil, log.Err(ctx, nil, "TLS requires connecting to a running gapis with -gapis-port or -gapis-socket")
+		}
+		flags := gapisFlags.TLSConfig
+		cfg, err := grpcutil.ClientTLSConfig(flags.CA, flags.Cert, flags.Key)
+		if err != nil {
+			return nil, log.Err(ctx, err, "Failed to load the TLS certificates")
+		}
+		cfg.ServerName = flags.ServerName
+		tlsConfig = cfg
+	}
+
 	client, err := client.Connect(ctx, client.Config{
-		Port:  gapisFlags.Port,
-		Args:  args,
-		Token: token,
+		Host:    gapisFlags.Host,
+		Port:    gapisFlags.Port,
+		Socket:  gapisFlags.Socket,
+		Args:    args,
+		Token:   token,
+		TLS:     tlsConfig,
+		TraceID: traceID,
 	})
 	if err != nil {
 		return nil, log.Err(ctx, err, "Failed to connect to the GAPIS server")
 	}
 
+	// The profiling, heartbeat and logging requests are not traced.
+	untraced := status.PutTraceID(ctx, status.NoTraceID)
+
 	close := []func(){}
 
 	openFile := func(path string) (*os.File, error) {
@@ -131,13 +164,25 @@ func getGapis(ctx context.Context, gapisFlags GapisFlags, gapirFlags GapirFlags)
 		}
 	}
 	if pprof != nil || trace != nil {
-		stop, err := client.Profile(ctx, pprof, trace, 1)
+		stop, err := client.Profile(untraced, pprof, trace, 1)
 		if err != nil {
 			log.E(ctx, "Profile failed: %v", err)
 			return nil, err
 		}
 		close = append(close, func() { stop() })
 	}
+	if gapisFlags.Profile.Requests != "" {
+		requests, err := openFile(gapisFlags.Profile.Requests)
+		if err != nil {
+			return nil, err
+		}
+		stop, err := client.TraceRequests(untraced, traceID, requests)
+		if err != nil {
+			log.E(ctx, "TraceRequests failed: %v", err)
+			return nil, err
+		}
+		close = append(close, func() { stop() })
+	}
 
 	// We start this goroutine to send a heartbeat to gapis.
 	// It has an idle-timeout of 1m, so for long requests,
@@ -149,7 +194,7 @@ func getGapis(ctx context.Context, gapisFlags GapisFlags, gapirFlags GapirFlags)
 			case <-ctx.Done():
 				return
 			case <-hb.C:
-				if err := client.Ping(ctx); err != nil {
+				if err := client.Ping(untraced); err != nil {
 					return
 				}
 			}
@@ -158,7 +203,7 @@ func getGapis(ctx context.Context, gapisFlags GapisFlags, gapirFlags GapirFlags)
 
 	if !gapisFlags.DisableLog {
 		if h := log.GetHandler(ctx); h != nil {
-			crash.Go(func() { client.GetLogStream(ctx, h) })
+			crash.Go(func() { client.GetLogStream(untraced, h) })
 		}
 	}
 
@@ -19,10 +19,15 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/client"
 	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/service/severity"
 )
 
 type dumpVerb struct{ DumpFlags }
@@ -76,7 +81,13 @@ func (verb *dumpVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		fmt.Printf("Trace ABI Information:\n%s\n", string(abi))
 	}
 
-	if verb.ShowDeviceInfo || verb.ShowABIInfo {
+	if verb.Logcat {
+		if err := printLogcat(ctx, client, cp); err != nil {
+			return err
+		}
+	}
+
+	if verb.ShowDeviceInfo || verb.ShowABIInfo || verb.Logcat {
 		return nil // That's all that was requested
 	}
 
@@ -88,3 +99,56 @@ func (verb *dumpVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 
 	return nil
 }
+
+// printLogcat prints the logcat messages stored in the capture, interleaved
+// with the capture messages by timestamp.
+func printLogcat(ctx context.Context, c client.Client, cp *path.Capture) error {
+	boxedLogcat, err := c.Get(ctx, cp.Logcat().Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to acquire the capture's logcat")
+	}
+	boxedMessages, err := c.Get(ctx, cp.Messages().Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to acquire the capture's messages")
+	}
+
+	type line struct {
+		timestamp uint64
+		text      string
+	}
+	lines := []line{}
+	for _, m := range boxedMessages.(*service.Messages).List {
+		lines = append(lines, line{m.Timestamp, fmt.Sprintf("%-14s %s", "[capture]", m.Message)})
+	}
+	for _, m := range boxedLogcat.(*service.LogcatMessages).List {
+		wall := time.Unix(0, m.WallTime).Format("01-02 15:04:05.000")
+		lines = append(lines, line{m.Timestamp, fmt.Sprintf("%-14s %s %5d %5d %c %s: %s",
+			"[logcat]", wall, m.Pid, m.Tid, severityLetter(m.Severity), m.Tag, m.Message)})
+	}
+	if len(lines) == 0 {
+		fmt.Println("The capture has no logcat messages")
+		return nil
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].timestamp < lines[j].timestamp })
+	for _, l := range lines {
+		fmt.Printf("%15.6f %s\n", float64(l.timestamp)/1e9, l.text)
+	}
+	return nil
+}
+
+func severityLetter(s severity.Severity) rune {
+	switch s {
+	case severity.Severity_VerboseLevel:
+		return 'V'
+	case severity.Severity_DebugLevel:
+		return 'D'
+	case severity.Severity_InfoLevel:
+		return 'I'
+	case severity.Severity_WarningLevel:
+		return 'W'
+	case severity.Severity_ErrorLevel:
+		return 'E'
+	default:
+		return 'F'
+	}
+}
@@ -50,6 +50,14 @@ const (
 	ModeList
 )
 
+const (
+	ProfileText ProfileOutputFormat = iota
+	ProfileJson
+	ProfileChrome
+	ProfileCsv
+	ProfileProto
+)
+
 const (
 	OutputDefault PerfettoOutputFormat = iota
 	OutputText
@@ -136,6 +144,23 @@ func (v PerfettoOutputFormat) String() string {
 	return PerfettoOutputFormatNames[v]
 }
 
+type ProfileOutputFormat uint8
+
+var profileOutputFormatNames = map[ProfileOutputFormat]string{
+	ProfileText:   "text",
+	ProfileJson:   "json",
+	ProfileChrome: "chrome",
+	ProfileCsv:    "csv",
+	ProfileProto:  "proto",
+}
+
+func (v *ProfileOutputFormat) Choose(c interface{}) {
+	*v = c.(ProfileOutputFormat)
+}
+func (v ProfileOutputFormat) String() string {
+	return profileOutputFormatNames[v]
+}
+
 type (
 	CaptureFileFlags struct {
 		CaptureID bool `help:"if true then interpret the capture file argument as a capture ID that is already loaded in gapis"`
@@ -161,15 +186,26 @@ type (
 		OS    device.OSKind `help:"Only display devices of the given OS kind"`
 	}
 	ProfileFlags struct {
-		Pprof string `help:"_produce a pprof file"`
-		Trace string `help:"_produce a trace file"`
+		Pprof    string `help:"_produce a pprof file"`
+		Trace    string `help:"_produce a trace file"`
+		Requests string `help:"_produce a trace file of the gapis spans serving the requests of this command"`
+	}
+	GapisTLSFlags struct {
+		CA         string `help:"PEM CA certificates verifying the gapis certificate; the system ones are used if empty."`
+		Cert       string `help:"PEM client certificate presented to gapis, if it requires client certificates."`
+		Key        string `help:"PEM private key of the client certificate."`
+		ServerName string `name:"server-name" help:"name expected in the gapis certificate, if not the connected host."`
 	}
 	GapisFlags struct {
 		Profile    ProfileFlags
-		Port       int    `help:"gapis tcp port to connect to, 0 means start new instance."`
-		Args       string `help:"_The arguments to be passed to gapis"`
-		Token      string `help:"_The auth token to use when connecting to an existing server."`
-		DisableLog bool   `help:"_Disable the log output"`
+		Host       string        `help:"gapis host to connect to with -gapis-port, localhost if empty."`
+		Port       int           `help:"gapis tcp port to connect to, 0 means start new instance."`
+		Socket     string        `help:"gapis unix domain socket to connect to, instead of a tcp port."`
+		TLS        bool          `help:"connect to gapis over TLS."`
+		TLSConfig  GapisTLSFlags `name:"tls"`
+		Args       string        `help:"_The arguments to be passed to gapis"`
+		Token      string        `help:"_The auth token to use when connecting to an existing server."`
+		DisableLog bool          `help:"_Disable the log output"`
 	}
 	GapirFlags struct {
 		DeviceFlags
@@ -202,7 +238,7 @@ type (
 		Gapis GapisFlags
 		Gapir GapirFlags
 		FPS   int    `help:"frames per second"`
-		Out   string `help:"output video path"`
+		Out   string `help:"output video path; the extension selects the format: .mp4 (requires ffmpeg), .avi (Motion-JPEG) or .png (animated PNG)"`
 		Max   struct {
 			Width  int `help:"maximum video width"`
 			Height int `help:"maximum video height"`
@@ -238,6 +274,7 @@ type (
 		Raw            bool `help:"if true then the value of constants, instead of their names, will be dumped."`
 		ShowDeviceInfo bool `help:"if true then show originating device information."`
 		ShowABIInfo    bool `help:"if true then show information of the ABI used for the trace."`
+		Logcat         bool `help:"if true then show the logcat of the traced application, interleaved with the capture messages."`
 		Observations   ObservationFlags
 		CaptureFileFlags
 	}
@@ -262,7 +299,7 @@ type (
 		Gapis                GapisFlags
 		Gapir                GapirFlags
 		Handle               string `help:"required. handle or ID of the resource to replace"`
-		ResourcePath         string `help:"file path for the new resource"`
+		ResourcePath         string `help:"file path for the new resource, GLSL shaders are compiled for .vert, .tesc, .tese, .geom, .frag and .comp files"`
 		At                   int    `help:"command index to replace the resource(s) at, e.g. '1234'"`
 		UpdateResourceBinary string `help:"shaders only. binary to run for every shader; consumes resource data from standard input and writes to standard output"`
 		OutputTraceFile      string `help:"file name for the updated trace"`
@@ -376,6 +413,7 @@ type (
 		NoOpt         bool             `help:"disables optimization of the replay stream"`
 		Attachment    string           `help:"the attachment to show (0-3 for color, d for depth, s for stencil)"`
 		Overdraw      bool             `help:"renders the overdraw instead of the color framebuffer"`
+		DrawMode      string           `help:"renders a debug view instead of the color framebuffer (drawid, depthcomplexity, shadercost, miplevel or texeldensity)"`
 		Max           struct {
 			Overdraw int `help:"the amount of overdraw to map to white in the output"`
 		}
@@ -424,17 +462,38 @@ type (
 	GetTimestampsFlags struct {
 		Gapis     GapisFlags
 		Gapir     GapirFlags
-		LoopCount int    `help:"_The number of times to loop the trace. (experimental)"`
+		LoopCount int    `help:"the number of times to replay the trace, reporting the timing statistics of all replays"`
 		Out       string `help:"output file to save the profiling result"`
 	}
 
+	LoopReplayFlags struct {
+		Gapis      GapisFlags
+		Gapir      GapirFlags
+		StartFrame int    `help:"the first frame of the looped range"`
+		EndFrame   int    `help:"the last frame of the looped range, inclusive"`
+		LoopCount  int    `help:"the number of times to replay the frame range"`
+		Out        string `help:"output file to save the frame spans"`
+	}
+
 	GpuProfileFlags struct {
 		Gapis        GapisFlags
 		Gapir        GapirFlags
-		Out          string           `help:"Output file (optional, if none then output goes to stdout)"`
-		Json         bool             `help:"Return replay profiling data as JSON instead of text"`
-		DisabledCmds []flags.U64Slice `help:"command/subcommand index (e.g. '[123, 0, 0, 4]') for disabling a draw call (repeatable)"`
-		DisableAF    bool             `help:"Disable Anisotropic Filtering for all samplers"`
+		Out          string              `help:"Output file (optional, if none then output goes to stdout)"`
+		Json         bool                `help:"Deprecated, use -format json instead"`
+		Format       ProfileOutputFormat `help:"Output format: text, json, proto, chrome (Chrome trace event JSON) or csv (per-group counter metrics)"`
+		DisabledCmds []flags.U64Slice    `help:"command/subcommand index (e.g. '[123, 0, 0, 4]') for disabling a draw call (repeatable)"`
+		DisableAF    bool                `help:"Disable Anisotropic Filtering for all samplers"`
+		SmallestMip  bool                `help:"Sample only the smallest mip level of every texture, textures without mip levels keep their size"`
+		ConstantFS   bool                `help:"Replace all fragment shaders with a constant color shader"`
+		NullRaster   bool                `help:"Force all viewports and scissors to 1x1"`
+		NoBlending   bool                `help:"Disable blending for all color attachments"`
+		BaseMip      bool                `help:"Clamp the level of detail of all samplers to the base (most detailed) mip level"`
+		Metric       flags.StringSlice   `help:"derived metric to compute per group, e.g. 'ALU Utilization = 100 * alu_cycles / gpu_cycles', or 'Cycles [sum] = alu_cycles + tex_cycles' for a metric aggregated across groups with [sum] or [avg] (repeatable)"`
+		MetricsFile  string              `help:"file of derived metric definitions, one 'name [aggregation] = expression' per line"`
+		Compare      string              `help:"profile to compare against, as written with the proto or text format; prints the top GPU time regressions"`
+		Top          int                 `help:"number of regressions to print when comparing profiles, 0 for all"`
+		Bundle       string              `help:"save the raw profiling data to this bundle file, to be reprocessed with -from-bundle"`
+		FromBundle   string              `help:"process the profiling bundle saved with -bundle instead of profiling a trace on a device"`
 	}
 
 	CreateGraphVisualizationFlags struct {
@@ -484,4 +543,11 @@ type (
 		To   uint64 `help:"The exclusive end index of the command range. Default: 0 (last command)"`
 		Out  string `help:"Output file."`
 	}
+	ApplyEditsFlags struct {
+		Gapis GapisFlags
+		Gapir GapirFlags
+		CaptureFileFlags
+		Edits string `help:"The edit script to apply, saved alongside an edited capture"`
+		Out   string `help:"Output file."`
+	}
 )
@@ -0,0 +1,118 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type loopReplayVerb struct{ LoopReplayFlags }
+
+func init() {
+	verb := &loopReplayVerb{LoopReplayFlags{LoopCount: 10}}
+	app.AddVerb(&app.Verb{
+		Name:      "loop_replay",
+		ShortHelp: "Replay a range of frames repeatedly and report the GPU span of the frames of each repetition.",
+		Action:    verb,
+	})
+}
+
+func (verb *loopReplayVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	if verb.StartFrame < 0 || verb.EndFrame < verb.StartFrame {
+		app.Usage(ctx, "Invalid frame range %d to %d", verb.StartFrame, verb.EndFrame)
+		return nil
+	}
+	capture, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return log.Errf(ctx, err, "Could not find capture file: %v", flags.Arg(0))
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capturePath, err := client.LoadCapture(ctx, capture)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to load the capture file")
+	}
+
+	device, err := getDevice(ctx, client, capturePath, verb.Gapir)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.LoopReplay(ctx, &service.LoopReplayRequest{
+		Capture:    capturePath,
+		Device:     device,
+		StartFrame: uint32(verb.StartFrame),
+		EndFrame:   uint32(verb.EndFrame),
+		LoopCount:  int32(verb.LoopCount),
+	})
+	if err != nil {
+		return log.Err(ctx, err, "Failed to replay the frame range")
+	}
+
+	var out io.Writer = os.Stdout
+	if verb.Out != "" {
+		f, err := os.OpenFile(verb.Out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to open report output file")
+		}
+		defer f.Close()
+		out = f
+	}
+
+	reportWriter := csv.NewWriter(out)
+	defer reportWriter.Flush()
+
+	header := []string{"Iteration"}
+	for frame := verb.StartFrame; frame <= verb.EndFrame; frame++ {
+		header = append(header, fmt.Sprintf("Frame %d span(ns)", frame))
+	}
+	header = append(header, "Total(ns)")
+	if err := reportWriter.Write(header); err != nil {
+		return log.Err(ctx, err, "Failed to write header")
+	}
+
+	for i, iteration := range res.Iterations {
+		record := []string{fmt.Sprint(i)}
+		total := uint64(0)
+		for _, t := range iteration.FrameSpanInNanoseconds {
+			record = append(record, fmt.Sprint(t))
+			total += t
+		}
+		record = append(record, fmt.Sprint(total))
+		if err := reportWriter.Write(record); err != nil {
+			return log.Err(ctx, err, "Failed to write record")
+		}
+	}
+	return nil
+}
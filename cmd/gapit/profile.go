@@ -19,8 +19,12 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"text/tabwriter"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/app"
@@ -36,6 +40,7 @@ func init() {
 	verb := &profileVerb{GpuProfileFlags{
 		DisabledCmds: []flags.U64Slice{},
 		DisableAF:    false,
+		Top:          10,
 	}}
 	app.AddVerb(&app.Verb{
 		Name:      "profile",
@@ -45,50 +50,91 @@ func init() {
 }
 
 func (verb *profileVerb) Run(ctx context.Context, flags flag.FlagSet) error {
-	if flags.NArg() != 1 {
+	if verb.FromBundle != "" {
+		if flags.NArg() != 0 {
+			app.Usage(ctx, "No gfx trace file expected with -from-bundle, got %d", flags.NArg())
+			return nil
+		}
+	} else if flags.NArg() != 1 {
 		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
 		return nil
 	}
-	capture, err := filepath.Abs(flags.Arg(0))
+
+	derived, err := verb.derivedMetrics(ctx)
 	if err != nil {
-		log.Errf(ctx, err, "Could not find capture file: %v", flags.Arg(0))
+		return err
 	}
 
-	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
-	if err != nil {
-		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	var baseline *service.ProfilingData
+	if verb.Compare != "" {
+		if baseline, err = loadProfile(verb.Compare); err != nil {
+			return log.Errf(ctx, err, "Could not load the profile to compare against: %v", verb.Compare)
+		}
 	}
-	defer client.Close()
 
-	capturePath, err := client.LoadCapture(ctx, capture)
+	bundle, gapisArgs, err := verb.bundlePath()
 	if err != nil {
-		return log.Err(ctx, err, "Failed to load the capture file")
+		return log.Err(ctx, err, "Invalid bundle path")
 	}
 
-	device, err := getDevice(ctx, client, capturePath, verb.Gapir)
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir, gapisArgs...)
 	if err != nil {
-		return err
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
 	}
+	defer client.Close()
 
-	var commands []*path.Command
-	if len(verb.DisabledCmds) > 0 {
-		for _, cmd := range verb.DisabledCmds {
-			commands = append(commands, capturePath.Command(cmd[0], cmd[1:]...))
+	var res *service.ProfilingData
+	if verb.FromBundle != "" {
+		res, err = client.GpuProfileFromBundle(ctx, &service.GpuProfileFromBundleRequest{
+			BundlePath:     bundle,
+			DerivedMetrics: derived,
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		capture, err := filepath.Abs(flags.Arg(0))
+		if err != nil {
+			log.Errf(ctx, err, "Could not find capture file: %v", flags.Arg(0))
 		}
-	}
 
-	req := &service.GpuProfileRequest{
-		Capture: capturePath,
-		Device:  device,
-		Experiments: &service.ProfileExperiments{
-			DisabledCommands:            commands,
-			DisableAnisotropicFiltering: verb.DisableAF,
-		},
-	}
+		capturePath, err := client.LoadCapture(ctx, capture)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to load the capture file")
+		}
 
-	res, err := client.GpuProfile(ctx, req)
-	if err != nil {
-		return err
+		device, err := getDevice(ctx, client, capturePath, verb.Gapir)
+		if err != nil {
+			return err
+		}
+
+		var commands []*path.Command
+		if len(verb.DisabledCmds) > 0 {
+			for _, cmd := range verb.DisabledCmds {
+				commands = append(commands, capturePath.Command(cmd[0], cmd[1:]...))
+			}
+		}
+
+		req := &service.GpuProfileRequest{
+			Capture: capturePath,
+			Device:  device,
+			Experiments: &service.ProfileExperiments{
+				DisabledCommands:            commands,
+				DisableAnisotropicFiltering: verb.DisableAF,
+				SampleSmallestMip:           verb.SmallestMip,
+				ConstantFragmentShaders:     verb.ConstantFS,
+				NullRasterization:           verb.NullRaster,
+				DisableBlending:             verb.NoBlending,
+				ForceBaseMipLevel:           verb.BaseMip,
+			},
+			DerivedMetrics: derived,
+			BundlePath:     bundle,
+		}
+
+		res, err = client.GpuProfile(ctx, req)
+		if err != nil {
+			return err
+		}
 	}
 
 	out := os.Stdout
@@ -100,13 +146,47 @@ func (verb *profileVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		defer out.Close()
 	}
 
+	if baseline != nil {
+		cmp, err := client.CompareProfiles(ctx, baseline, res)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to compare the profiles")
+		}
+		printRegressions(out, cmp, verb.Top)
+		return nil
+	}
+
+	format := verb.Format
 	if verb.Json {
+		log.W(ctx, "-json is deprecated, use -format json instead")
+		if format == ProfileText {
+			format = ProfileJson
+		}
+	}
+
+	switch format {
+	case ProfileJson:
 		jsonBytes, err := json.MarshalIndent(res, "", "  ")
 		if err != nil {
 			return log.Err(ctx, err, "Couldn't marshal trace to JSON")
 		}
 		fmt.Fprintln(out, string(jsonBytes))
-	} else {
+	case ProfileProto:
+		data, err := proto.Marshal(res)
+		if err != nil {
+			return log.Err(ctx, err, "Couldn't marshal trace to protobuf")
+		}
+		if _, err := out.Write(data); err != nil {
+			return log.Err(ctx, err, "Couldn't write protobuf")
+		}
+	case ProfileChrome:
+		if err := res.WriteChromeTrace(out); err != nil {
+			return log.Err(ctx, err, "Couldn't write Chrome trace JSON")
+		}
+	case ProfileCsv:
+		if err := res.WriteCounterCSV(out); err != nil {
+			return log.Err(ctx, err, "Couldn't write counter CSV")
+		}
+	default:
 		err = proto.MarshalText(out, res)
 		if err != nil {
 			return log.Err(ctx, err, "Couldn't marshal trace to text")
@@ -114,3 +194,102 @@ func (verb *profileVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 	return nil
 }
+
+// derivedMetrics returns the derived metrics requested by the Metric and
+// MetricsFile flags.
+func (verb *profileVerb) derivedMetrics(ctx context.Context) ([]*service.DerivedMetric, error) {
+	var derived []*service.DerivedMetric
+	if verb.MetricsFile != "" {
+		f, err := os.Open(verb.MetricsFile)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Could not open metrics file: %v", verb.MetricsFile)
+		}
+		derived, err = service.ParseDerivedMetrics(f)
+		f.Close()
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Could not parse metrics file: %v", verb.MetricsFile)
+		}
+	}
+	for _, def := range verb.Metric {
+		metric, err := service.ParseDerivedMetric(def)
+		if err != nil {
+			return nil, log.Err(ctx, err, "Invalid derived metric")
+		}
+		derived = append(derived, metric)
+	}
+	return derived, nil
+}
+
+// bundlePath returns the path of the profiling bundle to pass to gapis and the
+// arguments to start gapis with. A gapis started for the verb is given the
+// directory of the bundle as its bundle directory, while the path is passed as
+// is to an already running gapis.
+func (verb *profileVerb) bundlePath() (string, []string, error) {
+	p := verb.Bundle
+	if verb.FromBundle != "" {
+		p = verb.FromBundle
+	}
+	if p == "" || verb.Gapis.Port != 0 || verb.Gapis.Socket != "" {
+		return p, nil, nil
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Base(abs), []string{"--bundle-dir", filepath.Dir(abs)}, nil
+}
+
+// loadProfile loads a profile written by the proto or text output formats.
+func loadProfile(filename string) (*service.ProfilingData, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	res := &service.ProfilingData{}
+	if err := proto.UnmarshalText(string(data), res); err == nil {
+		return res, nil
+	}
+	res.Reset()
+	if err := proto.Unmarshal(data, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// printRegressions prints the top groups of the comparison with the largest
+// GPU time increase.
+func printRegressions(out io.Writer, cmp *service.ProfileComparison, top int) {
+	w := tabwriter.NewWriter(out, 4, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Group\tCommands\tBaseline (ns)\tCurrent (ns)\tDelta (ns)\tDelta (%)\tLargest counter change")
+	count := 0
+	for _, g := range cmp.Groups {
+		if top > 0 && count >= top {
+			break
+		}
+		t := g.GetGpuTime()
+		if t == nil || t.Delta <= 0 {
+			continue
+		}
+		counter := ""
+		var largest *service.ProfileComparison_MetricDelta
+		for _, c := range g.Counters {
+			if largest == nil || math.Abs(c.RelativeDelta) > math.Abs(largest.RelativeDelta) {
+				largest = c
+			}
+		}
+		if largest != nil {
+			counter = fmt.Sprintf("%s: %.4g -> %.4g (%+.1f%%)", largest.Name, largest.Baseline, largest.Current, largest.RelativeDelta*100)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.0f\t%.0f\t%+.0f\t%+.1f\t%s\n",
+			g.Name, g.CommandRange(), t.Baseline, t.Current, t.Delta, t.RelativeDelta*100, counter)
+		count++
+	}
+	w.Flush()
+	if count == 0 {
+		fmt.Fprintln(out, "No regressions found.")
+	}
+	if len(cmp.BaselineOnly) > 0 || len(cmp.CurrentOnly) > 0 {
+		fmt.Fprintf(out, "%d group(s) only in the baseline, %d group(s) only in the current profile.\n",
+			len(cmp.BaselineOnly), len(cmp.CurrentOnly))
+	}
+}
@@ -33,6 +33,17 @@ import (
 
 type replaceResourceVerb struct{ ReplaceResourceFlags }
 
+// glslShaderTypes maps the file extensions of GLSL shader sources to their
+// shader type.
+var glslShaderTypes = map[string]api.ShaderType{
+	".vert": api.ShaderType_Vertex,
+	".tesc": api.ShaderType_TessControl,
+	".tese": api.ShaderType_TessEvaluation,
+	".geom": api.ShaderType_Geometry,
+	".frag": api.ShaderType_Fragment,
+	".comp": api.ShaderType_Compute,
+}
+
 func init() {
 	verb := &replaceResourceVerb{
 		ReplaceResourceFlags{
@@ -106,8 +117,12 @@ func (verb *replaceResourceVerb) Run(ctx context.Context, flags flag.FlagSet) er
 		if err != nil {
 			return log.Errf(ctx, err, "Could not read resource file %s", verb.ResourcePath)
 		}
+		shaderType := shaderResourceData.GetType()
+		if t, ok := glslShaderTypes[filepath.Ext(verb.ResourcePath)]; ok {
+			shaderType = t
+		}
 		resourceData = api.NewResourceData(&api.Shader{
-			Type:   shaderResourceData.GetType(),
+			Type:   shaderType,
 			Source: string(newResourceBytes),
 		})
 	case verb.UpdateResourceBinary != "":
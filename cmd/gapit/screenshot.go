@@ -153,6 +153,21 @@ func (verb *screenshotVerb) getSingleFrame(ctx context.Context, cmd *path.Comman
 	if verb.Overdraw {
 		settings.DrawMode = path.DrawMode_OVERDRAW
 	}
+	switch verb.DrawMode {
+	case "":
+	case "drawid":
+		settings.DrawMode = path.DrawMode_DRAW_ID
+	case "depthcomplexity":
+		settings.DrawMode = path.DrawMode_DEPTH_COMPLEXITY
+	case "shadercost":
+		settings.DrawMode = path.DrawMode_SHADER_COST
+	case "miplevel":
+		settings.DrawMode = path.DrawMode_MIP_LEVEL
+	case "texeldensity":
+		settings.DrawMode = path.DrawMode_TEXEL_DENSITY
+	default:
+		return nil, log.Errf(ctx, nil, "Invalid draw mode %v", verb.DrawMode)
+	}
 
 	attachment, err := verb.getAttachment(ctx, cmd, device, client)
 	if err != nil {
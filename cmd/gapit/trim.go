@@ -17,7 +17,6 @@ package main
 import (
 	"context"
 	"flag"
-	"io/ioutil"
 
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/log"
@@ -64,17 +63,13 @@ func (verb *trimVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		}
 	}
 
-	data, err := client.ExportCapture(ctx, capture)
-	if err != nil {
-		return log.Errf(ctx, err, "ExportCapture(%v)", capture)
-	}
-
 	output := verb.Out
 	if output == "" {
 		output = "trimmed.gfxtrace"
 	}
-	if err := ioutil.WriteFile(output, data, 0666); err != nil {
-		return log.Errf(ctx, err, "Writing file: %v", output)
+	// The server saves the edit script of the capture alongside it.
+	if err := client.SaveCapture(ctx, capture, output); err != nil {
+		return log.Errf(ctx, err, "SaveCapture(%v, %v)", capture, output)
 	}
 	return nil
 }
@@ -23,7 +23,6 @@ import (
 	"image/color"
 	"image/draw"
 	"image/png"
-	"io"
 	"os"
 	fp "path/filepath"
 	"strings"
@@ -328,33 +327,41 @@ func (verb *videoVerb) writeSingleFrame(frame image.Image, fn string) error {
 }
 
 func (verb *videoVerb) encodeVideo(ctx context.Context, filepath string, vidFun videoFrameWriter) error {
-	// Start an encoder
-	frames, video, err := video.Encode(ctx, video.Settings{FPS: verb.FPS})
-	if err != nil {
-		return err
-	}
-
-	vidDone := make(chan error, 1) // buffered so the goroutine always finishes
-	crash.Go(func() { vidDone <- vidFun(frames) })
-
 	out := verb.Out
+	container := video.DefaultContainer()
 	if out == "" && filepath == "" {
 		return fmt.Errorf("need output file argument")
 	} else if out == "" {
-		out = file.Abs(fp.Base(filepath)).ChangeExt(".mp4").System()
+		out = file.Abs(fp.Base(filepath)).ChangeExt(container.Ext()).System()
+	} else if ext := fp.Ext(out); ext != "" {
+		c, ok := video.ContainerForExt(ext)
+		if !ok {
+			return fmt.Errorf("unsupported video file extension '%s', expected .mp4, .avi or .png", ext)
+		}
+		container = c
+	}
+	if !container.Available() {
+		return fmt.Errorf("%s output requires avconv or ffmpeg, use .avi or .png for built-in encoding", container.Ext())
 	}
+
 	mpg, err := os.Create(out)
 	if err != nil {
 		return fmt.Errorf("Error creating video file: %v", err)
 	}
 	defer mpg.Close()
-	if _, err = io.Copy(mpg, video); err != nil {
-		return fmt.Errorf("Error writing file: %v", err)
+
+	// Start an encoder
+	frames, encoded, err := video.Encode(ctx, video.Settings{FPS: verb.FPS, Container: container}, mpg)
+	if err != nil {
+		return err
 	}
 
-	if vidErr := <-vidDone; vidErr != nil {
+	if vidErr := vidFun(frames); vidErr != nil {
 		return fmt.Errorf("Error encoding frames: %v", vidErr)
 	}
+	if err := <-encoded; err != nil {
+		return fmt.Errorf("Error writing file: %v", err)
+	}
 
 	return nil
 }
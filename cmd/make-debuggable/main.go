@@ -20,21 +20,24 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/android/apk"
+	"github.com/google/gapid/core/os/android/binaryxml"
 	"github.com/google/gapid/core/os/file"
 )
 
 var (
-	jarSignCmd     = flag.String("jarsigner", "jarsigner", "path to jarsigner")
-	zipAlignCmd    = flag.String("zipalign", "zipalign", "path to zipalign")
-	keyPass        = flag.String("keypass", "android", "key passphrase")
+	keyPass        = flag.String("keypass", "", "key passphrase, alias of -storepass as PKCS#12 key stores use the same passphrase for the key")
 	keyAlias       = flag.String("keyalias", "androiddebugkey", "key alias")
 	storePass      = flag.String("storepass", "android", "key store passphrase")
-	keyStore       = flag.String("keystore", "~/.android/debug.keystore", "key store location")
+	keyStore       = flag.String("keystore", "~/.android/debug.keystore", "PKCS#12 key store or PEM key and certificate location, a debug key is generated if missing. JKS key stores, such as debug.keystore files created by older Android SDKs, are not supported and must be converted to PKCS#12 with keytool")
 	forceOverwrite = flag.Bool("y", false, "overwrite existing destination")
+	extractLibs    = flag.Bool("extractnativelibs", false, "set android:extractNativeLibs to true")
+	cleartext      = flag.Bool("cleartext", false, "set android:usesCleartextTraffic to true")
+	permissions    = flag.String("permissions", "", "comma separated list of permissions to add to the manifest")
 )
 
 func main() {
@@ -59,17 +62,37 @@ func run(ctx context.Context) error {
 	if err != nil {
 		log.W(ctx, "%s", err.Error())
 	}
-	if isDebuggable {
+	edits := []binaryxml.Edit{}
+	if *extractLibs {
+		edits = append(edits, binaryxml.SetExtractNativeLibs(true))
+	}
+	if *cleartext {
+		edits = append(edits, binaryxml.SetUsesCleartextTraffic(true))
+	}
+	for _, p := range strings.Split(*permissions, ",") {
+		if p != "" {
+			edits = append(edits, binaryxml.AddUsesPermission(p))
+		}
+	}
+	if isDebuggable && len(edits) == 0 {
 		log.W(ctx, "Source %s is already debuggable, performing regular file copy.", src)
 		return file.Copy(ctx, file.Abs(dst), file.Abs(src))
 	}
 
+	pass := *storePass
+	if *keyPass != "" {
+		storePassSet := false
+		flag.Visit(func(f *flag.Flag) { storePassSet = storePassSet || f.Name == "storepass" })
+		if storePassSet && *keyPass != *storePass {
+			return fmt.Errorf("Different -keypass and -storepass are not supported, PKCS#12 key stores use the same passphrase for the key.")
+		}
+		pass = *keyPass
+	}
+
 	return apk.ApkDebugifier{
-		JarSignCmd:   *jarSignCmd,
-		ZipAlignCmd:  *zipAlignCmd,
-		KeyPass:      *keyPass,
 		KeyAlias:     *keyAlias,
-		StorePass:    *storePass,
+		StorePass:    pass,
 		KeyStorePath: *keyStore,
+		Edits:        edits,
 	}.Run(ctx, src, dst)
 }
@@ -14,7 +14,11 @@
 
 package app
 
-import "github.com/google/gapid/core/log"
+import (
+	"time"
+
+	"github.com/google/gapid/core/log"
+)
 
 type (
 	AppFlags struct {
@@ -28,11 +32,15 @@ type (
 		Args        string `help:"_A single string that will be parsed into extra individual arguments"`
 	}
 	LogFlags struct {
-		Level  log.Severity `help:"_The severity to enable logs at"`
-		Style  log.Style    `help:"_The style to use when printing the log"`
-		Stacks bool         `help:"_If true, stack traces are logged for all errors"`
-		File   string       `help:"_The file to store the logs in"`
-		Status bool         `help:"_Log status updates as they happen"`
+		Level    log.Severity  `help:"_The severity to enable logs at"`
+		Style    log.Style     `help:"_The style to use when printing the log"`
+		Stacks   bool          `help:"_If true, stack traces are logged for all errors"`
+		File     string        `help:"_The file to store the logs in"`
+		Status   bool          `help:"_Log status updates as they happen"`
+		MaxSize  int64         `help:"_Rotate the log file once it would exceed this size in bytes, 0 for no limit"`
+		MaxAge   time.Duration `help:"_Rotate the log file once it is older than this duration, 0 for no limit"`
+		MaxFiles int           `help:"_The number of rotated log files to keep, 0 to keep all of them. Needs -log-maxsize or -log-maxage"`
+		Compress bool          `help:"_If true, rotated log files are compressed with gzip. Needs -log-maxsize or -log-maxage"`
 	}
 	ProfileFlags struct {
 		CPU   string `help:"_write cpu profile to file"`
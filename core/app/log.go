@@ -65,7 +65,26 @@ func updateContext(ctx context.Context, flags *LogFlags) context.Context {
 		ctx = log.PutStacktracer(ctx, log.SeverityStacktracer(log.Error))
 	}
 
-	if flags.File != "" {
+	rotation := log.Rotation{
+		MaxSize:  flags.MaxSize,
+		MaxAge:   flags.MaxAge,
+		MaxFiles: flags.MaxFiles,
+		Compress: flags.Compress,
+	}
+	if rotation != (log.Rotation{}) && !rotation.Rotates() {
+		Usage(ctx, "-log-maxfiles and -log-compress need -log-maxsize or -log-maxage to rotate the log file")
+	}
+	if rotation.Rotates() && flags.File == "" {
+		Usage(ctx, "-log-maxsize and -log-maxage need a -log-file to rotate")
+	}
+
+	if flags.File != "" && rotation.Rotates() {
+		if handler := createRotatingLogHandler(ctx, flags.File, rotation, flags.Style); handler != nil {
+			if old, _ := LogHandler.SetTarget(handler, false); old != nil {
+				old.Close()
+			}
+		}
+	} else if flags.File != "" {
 		if file := createLogFile(ctx, flags); file != nil {
 			// Build the file logging context.
 			handler := flags.Style.Handler(func(s string, _ log.Severity) {
@@ -82,6 +101,23 @@ func updateContext(ctx context.Context, flags *LogFlags) context.Context {
 	return ctx
 }
 
+// createRotatingLogHandler returns a handler writing to the log file at path,
+// which is rotated according to rotation.
+func createRotatingLogHandler(ctx context.Context, p string, rotation log.Rotation, style log.Style) log.Handler {
+	path := file.Abs(p)
+	if _, name, _ := path.Smash(); name == "" {
+		path = path.Join("gapis.log")
+	}
+	f, err := log.OpenRotatingFile(path.System(), rotation)
+	if err != nil {
+		log.E(ctx, "Failed to create log file %v: %v", p, err)
+		return nil
+	}
+	log.I(ctx, "Logging to: %v", path.System())
+	handler := log.OnClosed(style.Handler(f.Writer()), func() { f.Close() })
+	return wrapHandler(handler)
+}
+
 func createLogFile(ctx context.Context, flags *LogFlags) *os.File {
 	path := file.Abs(flags.File)
 	dir, name, ext := path.Smash()
@@ -18,15 +18,21 @@ import (
 	"context"
 
 	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/log"
 )
 
 type taskKeyTy string
 
 const taskKey = taskKeyTy("task")
 
-// PutTask attaches a task to a Context.
+// PutTask attaches a task to a Context. The messages logged with the context
+// are tagged with the task identifier.
 func PutTask(ctx context.Context, t *Task) context.Context {
-	return keys.WithValue(ctx, taskKey, t)
+	id := uint64(0)
+	if t != nil {
+		id = t.ID()
+	}
+	return log.PutTask(keys.WithValue(ctx, taskKey, t), id)
 }
 
 // GetTask retrieves the task from a context previously annotated by PutTask.
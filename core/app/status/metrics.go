@@ -0,0 +1,283 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/gapid/core/log"
+)
+
+// metricsContentType is the content type of the Prometheus text exposition
+// format, which is also accepted by OpenMetrics scrapers.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// taskDurationBuckets are the upper bounds in seconds of the task duration
+// histogram buckets.
+var taskDurationBuckets = []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 60, 300}
+
+// GaugeFunc returns the current values of a gauge, keyed by the value of its
+// label. A gauge without label uses the empty string as key.
+type GaugeFunc func() map[string]float64
+
+// Metrics is a status listener aggregating the application status into
+// metrics, that it serves over HTTP in the Prometheus text exposition format.
+// See https://prometheus.io/docs/instrumenting/exposition_formats/ for
+// documentation on the format.
+type Metrics struct {
+	mutex        sync.Mutex
+	tasks        map[string]*taskHistogram // keyed by task kind
+	running      int
+	blocked      int
+	replays      map[*Replay]uint32 // running replays to finished instructions
+	replayCounts map[string]uint64  // keyed by device
+	instructions map[string]uint64  // keyed by device
+	gauges       []gauge
+}
+
+type taskHistogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+type gauge struct {
+	name, help, label string
+	f                 GaugeFunc
+}
+
+// RegisterMetrics registers and returns a status listener aggregating the
+// application status into metrics.
+func RegisterMetrics() (*Metrics, Unregister) {
+	m := &Metrics{
+		tasks:        map[string]*taskHistogram{},
+		replays:      map[*Replay]uint32{},
+		replayCounts: map[string]uint64{},
+		instructions: map[string]uint64{},
+	}
+	app.Traverse(func(t *Task) {
+		m.running++
+		m.blocked += t.Blocked()
+	})
+	return m, RegisterListener(m)
+}
+
+// AddGauge adds a gauge metric with the given name and help text, whose values
+// are returned by f each time the metrics are written. label is the name of
+// the label distinguishing the values, it is ignored if f returns a single
+// value keyed by the empty string.
+func (m *Metrics) AddGauge(name, help, label string, f GaugeFunc) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.gauges = append(m.gauges, gauge{name, help, label, f})
+}
+
+func (m *Metrics) OnTaskStart(ctx context.Context, t *Task) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.running++
+}
+
+func (m *Metrics) OnTaskProgress(ctx context.Context, t *Task)                      {}
+func (m *Metrics) OnEvent(ctx context.Context, t *Task, n string, scope EventScope) {}
+func (m *Metrics) OnMemorySnapshot(ctx context.Context, stats runtime.MemStats)     {}
+
+func (m *Metrics) OnTaskFinish(ctx context.Context, t *Task) {
+	duration := t.TimeSinceStart().Seconds()
+	kind := t.Kind()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	// Tasks started while the metrics were being registered may be missing.
+	if m.running > 0 {
+		m.running--
+	}
+	h, ok := m.tasks[kind]
+	if !ok {
+		h = &taskHistogram{buckets: make([]uint64, len(taskDurationBuckets))}
+		m.tasks[kind] = h
+	}
+	for i, le := range taskDurationBuckets {
+		if duration <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += duration
+}
+
+func (m *Metrics) OnTaskBlock(ctx context.Context, t *Task) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.blocked++
+}
+
+func (m *Metrics) OnTaskUnblock(ctx context.Context, t *Task) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.blocked > 0 {
+		m.blocked--
+	}
+}
+
+func (m *Metrics) OnReplayStatusUpdate(ctx context.Context, r *Replay, label uint64, totalInstrs, finishedInstrs uint32) {
+	device := r.Device.String()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	switch {
+	case r.Finished():
+		delete(m.replays, r)
+		m.replayCounts[device]++
+	case r.Started():
+		// The number of finished instructions is reset for each replayed
+		// payload, count all of them when it decreases.
+		last := m.replays[r]
+		if finishedInstrs < last {
+			last = 0
+		}
+		m.instructions[device] += uint64(finishedInstrs - last)
+		m.replays[r] = finishedInstrs
+	}
+}
+
+// ServeHTTP writes the metrics in response to a HTTP request.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	if err := m.Write(w); err != nil {
+		log.W(r.Context(), "Failed to write the metrics: %v", err)
+	}
+}
+
+// Write writes the metrics to w in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	m.mutex.Lock()
+	gauges := append([]gauge{}, m.gauges...)
+	b := bufio.NewWriter(w)
+	m.writeTasks(b)
+	m.writeReplays(b)
+	m.mutex.Unlock()
+
+	// Gauge functions may take locks of their own, call them without m locked.
+	for _, g := range gauges {
+		writeHeader(b, g.name, g.help, "gauge")
+		values := g.f()
+		for _, k := range sortedKeys(values) {
+			if k == "" {
+				fmt.Fprintf(b, "%s %v\n", g.name, values[k])
+			} else {
+				fmt.Fprintf(b, "%s{%s=\"%s\"} %v\n", g.name, g.label, escapeLabel(k), values[k])
+			}
+		}
+	}
+
+	writeMemory(b, stats)
+	return b.Flush()
+}
+
+func (m *Metrics) writeTasks(w io.Writer) {
+	writeHeader(w, "gapis_tasks_running", "Number of status tasks running.", "gauge")
+	fmt.Fprintf(w, "gapis_tasks_running %d\n", m.running)
+	writeHeader(w, "gapis_tasks_blocked", "Number of status tasks blocked.", "gauge")
+	fmt.Fprintf(w, "gapis_tasks_blocked %d\n", m.blocked)
+
+	const name = "gapis_task_duration_seconds"
+	writeHeader(w, name, "Duration of the finished status tasks.", "histogram")
+	kinds := make([]string, 0, len(m.tasks))
+	for k := range m.tasks {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		h, task := m.tasks[k], escapeLabel(k)
+		for i, le := range taskDurationBuckets {
+			fmt.Fprintf(w, "%s_bucket{task=\"%s\",le=\"%v\"} %d\n", name, task, le, h.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{task=\"%s\",le=\"+Inf\"} %d\n", name, task, h.count)
+		fmt.Fprintf(w, "%s_sum{task=\"%s\"} %v\n", name, task, h.sum)
+		fmt.Fprintf(w, "%s_count{task=\"%s\"} %d\n", name, task, h.count)
+	}
+}
+
+func (m *Metrics) writeReplays(w io.Writer) {
+	writeHeader(w, "gapis_replays_running", "Number of replays running.", "gauge")
+	fmt.Fprintf(w, "gapis_replays_running %d\n", len(m.replays))
+	writeCounter(w, "gapis_replays_total", "Number of replays finished, per device.", m.replayCounts)
+	writeCounter(w, "gapis_replay_instructions_total", "Number of replay instructions executed, per device.", m.instructions)
+}
+
+func writeCounter(w io.Writer, name, help string, values map[string]uint64) {
+	writeHeader(w, name, help, "counter")
+	devices := make([]string, 0, len(values))
+	for d := range values {
+		devices = append(devices, d)
+	}
+	sort.Strings(devices)
+	for _, d := range devices {
+		fmt.Fprintf(w, "%s{device=\"%s\"} %d\n", name, escapeLabel(d), values[d])
+	}
+}
+
+func writeMemory(w io.Writer, stats runtime.MemStats) {
+	for _, g := range []struct {
+		name, help, ty string
+		value          uint64
+	}{
+		{"go_goroutines", "Number of goroutines.", "gauge", uint64(runtime.NumGoroutine())},
+		{"go_memstats_alloc_bytes", "Bytes of allocated heap objects.", "gauge", stats.Alloc},
+		{"go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", "gauge", stats.Sys},
+		{"go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", "gauge", stats.HeapInuse},
+		{"go_memstats_heap_idle_bytes", "Bytes in idle heap spans.", "gauge", stats.HeapIdle},
+		{"go_memstats_heap_released_bytes", "Bytes of heap memory returned to the OS.", "gauge", stats.HeapReleased},
+		{"go_memstats_heap_objects", "Number of allocated heap objects.", "gauge", stats.HeapObjects},
+		{"go_memstats_gc_sys_bytes", "Bytes of memory used by the garbage collector metadata.", "gauge", stats.GCSys},
+		{"go_gc_cycles_total", "Number of completed garbage collection cycles.", "counter", uint64(stats.NumGC)},
+	} {
+		writeHeader(w, g.name, g.help, g.ty)
+		fmt.Fprintf(w, "%s %d\n", g.name, g.value)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, ty string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, ty)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes the label value s for the text exposition format.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+)
+
+func writeMetrics(a assert.Manager, m *status.Metrics) string {
+	buf := &bytes.Buffer{}
+	a.For("write").ThatError(m.Write(buf)).Succeeded()
+	return buf.String()
+}
+
+func TestMetricsTasks(t *testing.T) {
+	ctx := log.Testing(t)
+	a := assert.To(t)
+
+	// A task blocked before the metrics are registered.
+	before := status.Start(ctx, "before")
+	status.Block(before)
+
+	m, unregister := status.RegisterMetrics()
+	defer unregister()
+	out := writeMetrics(a, m)
+	a.For("running").ThatString(out).Contains("\ngapis_tasks_running 1\n")
+	a.For("blocked").ThatString(out).Contains("\ngapis_tasks_blocked 1\n")
+
+	status.Unblock(before)
+	status.Finish(before)
+	for i := 0; i < 2; i++ {
+		status.Finish(status.Start(ctx, "task %d", i))
+	}
+
+	out = writeMetrics(a, m)
+	a.For("running").ThatString(out).Contains("\ngapis_tasks_running 0\n")
+	a.For("blocked").ThatString(out).Contains("\ngapis_tasks_blocked 0\n")
+	a.For("histogram").ThatString(out).Contains("# TYPE gapis_task_duration_seconds histogram\n")
+	a.For("bucket").ThatString(out).Contains("\ngapis_task_duration_seconds_bucket{task=\"task %d\",le=\"+Inf\"} 2\n")
+	a.For("count").ThatString(out).Contains("\ngapis_task_duration_seconds_count{task=\"task %d\"} 2\n")
+	a.For("before count").ThatString(out).Contains("\ngapis_task_duration_seconds_count{task=\"before\"} 1\n")
+}
+
+func TestMetricsReplays(t *testing.T) {
+	ctx := log.Testing(t)
+	a := assert.To(t)
+	m, unregister := status.RegisterMetrics()
+	defer unregister()
+
+	device := id.ID{1}
+	r := status.ReplayQueued(ctx, 1, device)
+	r.Start(ctx)
+	r.Progress(ctx, 0, 100, 60)
+	out := writeMetrics(a, m)
+	a.For("running").ThatString(out).Contains("\ngapis_replays_running 1\n")
+
+	// The finished instructions are reset by the next payload.
+	r.Progress(ctx, 0, 100, 100)
+	r.Progress(ctx, 1, 50, 30)
+	r.Finish(ctx)
+	out = writeMetrics(a, m)
+	a.For("running").ThatString(out).Contains("\ngapis_replays_running 0\n")
+	a.For("replays").ThatString(out).Contains("\ngapis_replays_total{device=\"" + device.String() + "\"} 1\n")
+	a.For("instructions").ThatString(out).Contains("\ngapis_replay_instructions_total{device=\"" + device.String() + "\"} 130\n")
+}
+
+func TestMetricsGauges(t *testing.T) {
+	a := assert.To(t)
+	m, unregister := status.RegisterMetrics()
+	defer unregister()
+
+	m.AddGauge("gapis_things", "Number of things.", "", func() map[string]float64 {
+		return map[string]float64{"": 3}
+	})
+	m.AddGauge("gapis_sizes", "Size of things.", "thing", func() map[string]float64 {
+		return map[string]float64{"b": 2, "a\"quoted\"": 1.5}
+	})
+	out := writeMetrics(a, m)
+	a.For("help").ThatString(out).Contains("# HELP gapis_things Number of things.\n# TYPE gapis_things gauge\ngapis_things 3\n")
+	a.For("labels").ThatString(out).Contains("gapis_sizes{thing=\"a\\\"quoted\\\"\"} 1.5\ngapis_sizes{thing=\"b\"} 2\n")
+	a.For("memory").ThatString(out).Contains("# TYPE go_goroutines gauge\n")
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("closed") }
+
+func TestMetricsHTTP(t *testing.T) {
+	a := assert.To(t)
+	m, unregister := status.RegisterMetrics()
+	defer unregister()
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	a.For("content type").ThatString(rec.Header().Get("Content-Type")).Equals("text/plain; version=0.0.4; charset=utf-8")
+	a.For("body").That(strings.HasPrefix(rec.Body.String(), "# HELP gapis_tasks_running ")).Equals(true)
+
+	a.For("write error").ThatError(m.Write(failingWriter{})).Failed()
+}
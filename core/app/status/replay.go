@@ -27,10 +27,12 @@ type Replay struct {
 	Device   id.ID
 	started  bool
 	finished bool
+	traceIDs []TraceID
 	mutex    sync.RWMutex
 }
 
-// ReplayQueued notifies listeners that a new replay has been queued.
+// ReplayQueued notifies listeners that a new replay has been queued. The
+// replay is part of the trace of the context, if any.
 func ReplayQueued(ctx context.Context, id uint32, device id.ID) *Replay {
 	r := &Replay{
 		ID:       id,
@@ -38,6 +40,7 @@ func ReplayQueued(ctx context.Context, id uint32, device id.ID) *Replay {
 		started:  false,
 		finished: false,
 	}
+	r.AddTraceID(GetTraceID(ctx))
 	onReplayStatusUpdate(ctx, r, 0, 0, 0)
 	return r
 }
@@ -56,6 +59,29 @@ func (r *Replay) Finished() bool {
 	return r.finished
 }
 
+// AddTraceID adds the replay to the trace with the given identifier. A replay
+// is part of the traces of all the requests it is batching.
+func (r *Replay) AddTraceID(id TraceID) {
+	if id == NoTraceID {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, t := range r.traceIDs {
+		if t == id {
+			return
+		}
+	}
+	r.traceIDs = append(r.traceIDs, id)
+}
+
+// TraceIDs returns the identifiers of the traces the replay is part of.
+func (r *Replay) TraceIDs() []TraceID {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]TraceID{}, r.traceIDs...)
+}
+
 // Start notifies listeners that a replay has started.
 func (r *Replay) Start(ctx context.Context) {
 	r.start()
@@ -37,8 +37,11 @@ var nextID = uint64(1)
 type Task struct {
 	id         uint64
 	name       string
+	kind       string
+	traceID    TraceID
 	begun      time.Time
 	completion float32
+	blocked    int
 	parent     *Task
 	children   map[*Task]struct{}
 	background bool
@@ -87,6 +90,16 @@ func (t *Task) ParentID() uint64 {
 // Name returns the task's name.
 func (t *Task) Name() string { t.mutex.RLock(); defer t.mutex.RUnlock(); return t.name }
 
+// Kind returns the task's name before formatting with its arguments, shared
+// by all the tasks started by the same code.
+func (t *Task) Kind() string { t.mutex.RLock(); defer t.mutex.RUnlock(); return t.kind }
+
+// TraceID returns the identifier of the trace the task is part of.
+func (t *Task) TraceID() TraceID { t.mutex.RLock(); defer t.mutex.RUnlock(); return t.traceID }
+
+// Blocked returns the number of times the task is currently marked as blocked.
+func (t *Task) Blocked() int { t.mutex.RLock(); defer t.mutex.RUnlock(); return t.blocked }
+
 func (t *Task) Background() bool { t.mutex.RLock(); defer t.mutex.RUnlock(); return t.background }
 
 // TimeSinceStart returns the time the task was started.
@@ -128,6 +141,8 @@ func Start(ctx context.Context, name string, args ...interface{}) context.Contex
 	t := &Task{
 		id:         atomic.AddUint64(&nextID, 1),
 		name:       fmt.Sprintf(name, args...),
+		kind:       name,
+		traceID:    GetTraceID(ctx),
 		begun:      time.Now(),
 		parent:     parent,
 		children:   map[*Task]struct{}{},
@@ -151,6 +166,8 @@ func StartBackground(ctx context.Context, name string, args ...interface{}) cont
 	t := &Task{
 		id:         atomic.AddUint64(&nextID, 1),
 		name:       fmt.Sprintf(name, args...),
+		kind:       name,
+		traceID:    GetTraceID(ctx),
 		begun:      time.Now(),
 		parent:     parent,
 		children:   map[*Task]struct{}{},
@@ -187,6 +204,9 @@ func Block(ctx context.Context) {
 	if t == nil {
 		panic("status.Block called with no corresponding status.Start")
 	}
+	t.mutex.Lock()
+	t.blocked++
+	t.mutex.Unlock()
 	onBlock(ctx, t)
 }
 
@@ -196,6 +216,9 @@ func Unblock(ctx context.Context) {
 	if t == nil {
 		panic("status.Unblock called with no corresponding status.Start")
 	}
+	t.mutex.Lock()
+	t.blocked--
+	t.mutex.Unlock()
 	onUnblock(ctx, t)
 }
 
@@ -0,0 +1,69 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/google/gapid/core/context/keys"
+)
+
+// TraceID identifies a request across processes, and the tasks and replays
+// run to serve it.
+type TraceID string
+
+// NoTraceID is the identifier of untraced work.
+const NoTraceID = TraceID("")
+
+// NewTraceID returns a new random trace identifier.
+func NewTraceID() TraceID {
+	b := [16]byte{}
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return TraceID(hex.EncodeToString(b[:]))
+}
+
+type traceIDKeyTy string
+
+const traceIDKey = traceIDKeyTy("traceID")
+
+// PutTraceID attaches the trace identifier to a Context. The tasks started
+// with the context, and their sub-tasks, are part of the trace.
+func PutTraceID(ctx context.Context, id TraceID) context.Context {
+	return keys.WithValue(ctx, traceIDKey, id)
+}
+
+// GetTraceID returns the trace identifier attached to the context with
+// PutTraceID, or else the trace identifier of the task of the context.
+func GetTraceID(ctx context.Context) TraceID {
+	id, _ := LookupTraceID(ctx)
+	return id
+}
+
+// LookupTraceID is like GetTraceID, but also returns false if neither the
+// context nor its task have a trace identifier. Attaching NoTraceID to a
+// context with PutTraceID explicitly leaves the work out of any trace.
+func LookupTraceID(ctx context.Context) (TraceID, bool) {
+	if id, ok := ctx.Value(traceIDKey).(TraceID); ok {
+		return id, true
+	}
+	if t := GetTask(ctx); t != nil && t.TraceID() != NoTraceID {
+		return t.TraceID(), true
+	}
+	return NoTraceID, false
+}
@@ -48,30 +48,58 @@ type traceEvent struct {
 // See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
 // for documentation on the trace event format.
 func RegisterTracer(w io.Writer) Unregister {
+	return registerTracer(w, NoTraceID)
+}
+
+// RegisterRequestTracer registers a status listener that writes the status
+// updates of the tasks and replays of the trace with the given identifier in
+// the Chrome Trace Event Format to the writer w, forming the span tree of the
+// request.
+func RegisterRequestTracer(w io.Writer, id TraceID) Unregister {
+	return registerTracer(w, id)
+}
+
+func registerTracer(w io.Writer, id TraceID) Unregister {
 	l := &statusTracer{
 		writer:    w,
+		traceID:   id,
 		processID: os.Getpid(),
 		start:     time.Now(),
 		taskIDs:   map[*Task]uint64{},
+		roots:     map[*Task]struct{}{},
+		replays:   map[*Replay]*tracedReplay{},
 	}
 	w.Write([]byte("["))
 
-	app.Traverse(l.begin)
+	app.Traverse(func(t *Task) {
+		if l.traced(t) {
+			l.begin(t)
+		}
+	})
 
 	return RegisterListener(l)
 }
 
 type statusTracer struct {
 	writer          io.Writer
+	traceID         TraceID // Only the tasks of this trace are written, if set.
 	start           time.Time
 	processID       int
 	taskIDs         map[*Task]uint64
+	roots           map[*Task]struct{} // Tasks with their own allocated ID.
+	replays         map[*Replay]*tracedReplay
 	freeTaskIDs     []uint64
 	nextAllocTaskID uint64
 	nextMemoryID    uint64
 	mutex           sync.Mutex
 }
 
+// tracedReplay is a replay being traced on its own thread.
+type tracedReplay struct {
+	taskID  uint64
+	started bool
+}
+
 func (s *statusTracer) allocTaskID() uint64 {
 	if len(s.freeTaskIDs) > 0 {
 		tid := s.freeTaskIDs[len(s.freeTaskIDs)-1]
@@ -88,7 +116,28 @@ func (s *statusTracer) freeTaskID(tid uint64) {
 	s.freeTaskIDs = append(s.freeTaskIDs, tid)
 }
 
+// traced returns true if the task t is part of the traced tasks.
+func (s *statusTracer) traced(t *Task) bool {
+	return s.traceID == NoTraceID || t.TraceID() == s.traceID
+}
+
+// tracedReplay returns true if the replay r is part of the traced replays.
+func (s *statusTracer) tracedReplay(r *Replay) bool {
+	if s.traceID == NoTraceID {
+		return true
+	}
+	for _, id := range r.TraceIDs() {
+		if id == s.traceID {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *statusTracer) OnTaskStart(ctx context.Context, t *Task) {
+	if !s.traced(t) {
+		return
+	}
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.begin(t)
@@ -97,18 +146,33 @@ func (s *statusTracer) OnTaskStart(ctx context.Context, t *Task) {
 func (s *statusTracer) OnTaskProgress(ctx context.Context, t *Task) {}
 func (s *statusTracer) OnTaskBlock(ctx context.Context, t *Task)    {}
 func (s *statusTracer) OnTaskUnblock(ctx context.Context, t *Task)  {}
+
 func (s *statusTracer) OnReplayStatusUpdate(ctx context.Context, r *Replay, label uint64, totalInstrs, finishedInstrs uint32) {
+	if !s.tracedReplay(r) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.replay(r)
 }
 
 func (s *statusTracer) OnTaskFinish(ctx context.Context, t *Task) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.end(t)
+	if _, ok := s.taskIDs[t]; ok {
+		s.end(t)
+	}
 }
 
 func (s *statusTracer) OnEvent(ctx context.Context, t *Task, n string, scope EventScope) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	if s.traceID != NoTraceID {
+		// Only the events of the traced tasks are part of the trace.
+		if _, ok := s.taskIDs[t]; !ok || scope != TaskScope {
+			return
+		}
+	}
 	s.event(ctx, t, n, scope)
 }
 
@@ -125,18 +189,20 @@ func (s *statusTracer) begin(t *Task) {
 		Timestamp: time.Since(s.start).Nanoseconds() / 1000,
 		ProcessID: uint64(s.processID),
 	}
+	if t.traceID != NoTraceID {
+		e.Args = map[string]interface{}{"trace_id": t.traceID}
+	}
 
-	if t.parent == &app {
-		e.TaskID = s.allocTaskID()
+	// Tasks whose parent is not traced are shown on their own thread.
+	if tid, ok := s.taskIDs[t.parent]; ok && t.parent != &app {
+		e.TaskID = tid
 	} else {
-		e.TaskID = s.taskIDs[t.parent]
+		e.TaskID = s.allocTaskID()
+		s.roots[t] = struct{}{}
 	}
 	s.taskIDs[t] = e.TaskID
 
-	b, _ := json.Marshal(e)
-	s.writer.Write([]byte("\n"))
-	s.writer.Write(b)
-	s.writer.Write([]byte(","))
+	s.write(e)
 }
 
 func (s *statusTracer) end(t *Task) {
@@ -149,14 +215,60 @@ func (s *statusTracer) end(t *Task) {
 	}
 	delete(s.taskIDs, t)
 
-	if t.parent == &app {
+	if _, ok := s.roots[t]; ok {
+		delete(s.roots, t)
 		s.freeTaskID(e.TaskID)
 	}
 
-	b, _ := json.Marshal(e)
-	s.writer.Write([]byte("\n"))
-	s.writer.Write(b)
-	s.writer.Write([]byte(","))
+	s.write(e)
+}
+
+// replay writes the events of the replay r being queued, started or finished.
+// The replays are shown on their own thread, with a span for the time they
+// are queued, followed by a span for their execution.
+func (s *statusTracer) replay(r *Replay) {
+	e := traceEvent{
+		Timestamp: time.Since(s.start).Nanoseconds() / 1000,
+		ProcessID: uint64(s.processID),
+	}
+	tr, ok := s.replays[r]
+	switch {
+	case r.Finished():
+		if !ok {
+			return
+		}
+		e.TaskID, e.EventType = tr.taskID, eventDurtationEnd
+		s.write(e)
+		delete(s.replays, r)
+		s.freeTaskID(tr.taskID)
+		return
+	case r.Started():
+		if ok && tr.started {
+			return // Progress update.
+		}
+		if ok {
+			e.TaskID, e.EventType = tr.taskID, eventDurtationEnd
+			s.write(e)
+		} else {
+			tr = &tracedReplay{taskID: s.allocTaskID()}
+			s.replays[r] = tr
+		}
+		tr.started = true
+		e.Name = fmt.Sprintf("Replay %d", r.ID)
+	default:
+		if ok {
+			return
+		}
+		tr = &tracedReplay{taskID: s.allocTaskID()}
+		s.replays[r] = tr
+		e.Name = fmt.Sprintf("Replay %d queued", r.ID)
+	}
+	e.TaskID, e.EventType = tr.taskID, eventDurtationStart
+	e.Args = map[string]interface{}{
+		"device":    r.Device.String(),
+		"trace_ids": r.TraceIDs(),
+	}
+	s.write(e)
 }
 
 func (s *statusTracer) event(ctx context.Context, t *Task, n string, scope EventScope) {
@@ -178,10 +290,7 @@ func (s *statusTracer) event(ctx context.Context, t *Task, n string, scope Event
 		ProcessID: uint64(s.processID),
 		Scope:     sc,
 	}
-	b, _ := json.Marshal(e)
-	s.writer.Write([]byte("\n"))
-	s.writer.Write(b)
-	s.writer.Write([]byte(","))
+	s.write(e)
 }
 
 func (s *statusTracer) memorySnapshot(ctx context.Context, stats runtime.MemStats) {
@@ -204,6 +313,10 @@ func (s *statusTracer) memorySnapshot(ctx context.Context, stats runtime.MemStat
 		ID:        fmt.Sprintf("mem%+v", id),
 		Args:      map[string]interface{}{"dumps": dumps},
 	}
+	s.write(e)
+}
+
+func (s *statusTracer) write(e traceEvent) {
 	b, _ := json.Marshal(e)
 	s.writer.Write([]byte("\n"))
 	s.writer.Write(b)
@@ -0,0 +1,110 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+)
+
+type traceEvent struct {
+	Name string                 `json:"name"`
+	TID  uint64                 `json:"tid"`
+	Ph   string                 `json:"ph"`
+	Args map[string]interface{} `json:"args"`
+}
+
+func parseTrace(a assert.Manager, s string) []traceEvent {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ",") + "]"
+	events := []traceEvent{}
+	a.For("json").ThatError(json.Unmarshal([]byte(s), &events)).Succeeded()
+	return events
+}
+
+func TestTraceID(t *testing.T) {
+	ctx := log.Testing(t)
+	a := assert.To(t)
+
+	_, ok := status.LookupTraceID(ctx)
+	a.For("untraced").That(ok).Equals(false)
+
+	traced := status.PutTraceID(ctx, "trace-a")
+	task := status.Start(traced, "task")
+	defer status.Finish(task)
+	a.For("inherited").That(status.GetTraceID(task)).Equals(status.TraceID("trace-a"))
+	subtask := status.Start(task, "subtask")
+	defer status.Finish(subtask)
+	a.For("subtask").That(status.GetTask(subtask).TraceID()).Equals(status.TraceID("trace-a"))
+	unrelated := status.Start(ctx, "unrelated")
+	defer status.Finish(unrelated)
+	a.For("unrelated").That(status.GetTraceID(unrelated)).Equals(status.NoTraceID)
+
+	// Attaching NoTraceID leaves the work out of the task's trace.
+	id, ok := status.LookupTraceID(status.PutTraceID(task, status.NoTraceID))
+	a.For("explicit id").That(id).Equals(status.NoTraceID)
+	a.For("explicit ok").That(ok).Equals(true)
+}
+
+func TestRequestTracer(t *testing.T) {
+	ctx := log.Testing(t)
+	a := assert.To(t)
+
+	buf := &bytes.Buffer{}
+	unregister := status.RegisterRequestTracer(buf, "trace-a")
+
+	traced := status.Start(status.PutTraceID(ctx, "trace-a"), "traced")
+	other := status.Start(status.PutTraceID(ctx, "trace-b"), "other")
+	sub := status.Start(traced, "sub")
+	status.Finish(sub)
+
+	// A replay batching requests of both traces is part of both.
+	r := status.ReplayQueued(status.PutTraceID(ctx, "trace-b"), 7, id.ID{})
+	ignored := status.ReplayQueued(status.PutTraceID(ctx, "trace-b"), 8, id.ID{})
+	r.AddTraceID("trace-a")
+	r.Start(ctx)
+	r.Progress(ctx, 0, 10, 5)
+	r.Finish(ctx)
+	ignored.Start(ctx)
+	ignored.Finish(ctx)
+
+	status.Finish(other)
+	status.Finish(traced)
+	unregister()
+
+	events := parseTrace(a, buf.String())
+	got := []string{}
+	for _, e := range events {
+		got = append(got, e.Ph+" "+e.Name)
+	}
+	a.For("events").ThatSlice(got).Equals([]string{
+		"B traced",
+		"B sub",
+		"E ",
+		"B Replay 7",
+		"E ",
+		"E ",
+	})
+	a.For("trace id").That(events[0].Args["trace_id"]).Equals("trace-a")
+	a.For("sub thread").That(events[1].TID).Equals(events[0].TID)
+	a.For("replay thread").That(events[3].TID == events[0].TID).Equals(false)
+	a.For("replay trace ids").That(events[3].Args["trace_ids"]).DeepEquals([]interface{}{"trace-b", "trace-a"})
+}
@@ -17,6 +17,7 @@ package pack_test
 import (
 	"bytes"
 	"context"
+	"io"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
@@ -148,3 +149,114 @@ func TestReaderWriter(t *testing.T) {
 	err = pack.Read(ctx, bytes.NewBuffer(buf.Bytes()), &got, true)
 	assert.For(ctx, "Read (force-dynamic)").ThatError(err).Succeeded()
 }
+
+func TestAppender(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+
+	var id0, id1 uint64
+	expected := events{
+		eventObject{&testprotos.MsgA{F32: 1, U32: 2, S32: 3, Str: "four"}},
+		eventBeginGroup{&testprotos.MsgB{F64: 2, U64: 3, S64: 4, Bool: false}, &id0},
+		eventChildObject{&testprotos.MsgA{F32: 3, U32: 4, S32: 5, Str: "six"}, &id0},
+		eventEndGroup{&id0},
+	}
+	appended := events{
+		eventObject{&testprotos.MsgA{F32: 5, U32: 6, S32: 7, Str: "eight"}},
+		eventObject{&testprotos.MsgC{Entries: []*testprotos.MsgC_Entry{
+			&testprotos.MsgC_Entry{Value: 1},
+		}}},
+		eventBeginGroup{&testprotos.MsgB{F64: 6, U64: 7, S64: 8, Bool: true}, &id1},
+		eventChildObject{&testprotos.MsgA{F32: 7, U32: 8, S32: 9, Str: "ten"}, &id1},
+		eventEndGroup{&id1},
+	}
+
+	w, err := pack.NewWriter(buf)
+	assert.For(ctx, "NewWriter").ThatError(err).Succeeded()
+	for _, e := range expected {
+		e.write(ctx, w)
+	}
+	complete := int64(buf.Len())
+
+	// Simulate a writer interrupted in the middle of a chunk.
+	buf.Write([]byte{0x40, 1, 2, 3})
+
+	w, size, err := pack.NewAppender(bytes.NewReader(buf.Bytes()), buf)
+	assert.For(ctx, "NewAppender").ThatError(err).Succeeded()
+	assert.For(ctx, "size").That(size).Equals(complete)
+	buf.Truncate(int(size))
+	for _, e := range appended {
+		e.write(ctx, w)
+	}
+
+	got := events{}
+	err = pack.Read(ctx, bytes.NewBuffer(buf.Bytes()), &got, false)
+	assert.For(ctx, "Read").ThatError(err).Succeeded()
+	assert.For(ctx, "events").ThatSlice(got).DeepEquals(append(expected, appended...))
+
+	_, _, err = pack.NewAppender(bytes.NewReader([]byte("not a pack file!")), buf)
+	assert.For(ctx, "NewAppender").ThatError(err).Failed()
+}
+
+// byteWriter writes the data to w a byte at a time.
+type byteWriter struct{ w io.Writer }
+
+func (b byteWriter) Write(data []byte) (int, error) {
+	for i := range data {
+		if _, err := b.w.Write(data[i : i+1]); err != nil {
+			return i, err
+		}
+	}
+	return len(data), nil
+}
+
+func TestScanner(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	scanner := pack.NewScanner()
+
+	var id0, id1 uint64
+	expected := events{
+		eventBeginGroup{&testprotos.MsgB{F64: 2, U64: 3, S64: 4, Bool: false}, &id0},
+		eventChildObject{&testprotos.MsgA{F32: 3, U32: 4, S32: 5, Str: "six"}, &id0},
+		eventEndGroup{&id0},
+		eventObject{&testprotos.MsgA{F32: 1, U32: 2, S32: 3, Str: "four"}},
+	}
+	appended := events{
+		eventObject{&testprotos.MsgA{F32: 5, U32: 6, S32: 7, Str: "eight"}},
+		eventBeginGroup{&testprotos.MsgB{F64: 6, U64: 7, S64: 8, Bool: true}, &id1},
+		eventChildObject{&testprotos.MsgA{F32: 7, U32: 8, S32: 9, Str: "ten"}, &id1},
+		eventEndGroup{&id1},
+	}
+
+	// Follow the pack file as it is written, in the smallest possible writes.
+	w, err := pack.NewWriter(io.MultiWriter(buf, byteWriter{scanner}))
+	assert.For(ctx, "NewWriter").ThatError(err).Succeeded()
+	for _, e := range expected {
+		e.write(ctx, w)
+	}
+	complete := int64(buf.Len())
+
+	// Simulate a writer interrupted in the middle of a chunk.
+	partial := []byte{0x40, 1, 2, 3}
+	buf.Write(partial)
+	scanner.Write(partial)
+
+	w, size, err := scanner.Appender(buf)
+	assert.For(ctx, "Appender").ThatError(err).Succeeded()
+	assert.For(ctx, "size").That(size).Equals(complete)
+	buf.Truncate(int(size))
+	for _, e := range appended {
+		e.write(ctx, w)
+	}
+
+	got := events{}
+	err = pack.Read(ctx, bytes.NewBuffer(buf.Bytes()), &got, false)
+	assert.For(ctx, "Read").ThatError(err).Succeeded()
+	assert.For(ctx, "events").ThatSlice(got).DeepEquals(append(expected, appended...))
+
+	scanner = pack.NewScanner()
+	scanner.Write([]byte("ProtoPack"))
+	_, _, err = scanner.Appender(buf)
+	assert.For(ctx, "incomplete header").ThatError(err).Failed()
+}
@@ -16,10 +16,13 @@ package pack
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/google/gapid/core/math/sint"
 )
 
 // Writer is the type for a pack file writer.
@@ -49,6 +52,158 @@ func NewWriter(to io.Writer) (*Writer, error) {
 	return w, nil
 }
 
+// NewAppender constructs and returns a new Writer that continues the pack file
+// read from existing, writing the new chunks to the supplied output stream.
+// It reads the whole of existing to restore the type registry and chunk
+// identifiers, and returns the size in bytes of the complete chunks of
+// existing. The stream may end with a partially written chunk if the writer of
+// existing was interrupted, so the new chunks must be written after that size
+// and not after the end of existing.
+// Nothing is written to the output stream until a chunk is added.
+// Use a Scanner instead to follow a pack file while it is written, rather
+// than reading it back.
+func NewAppender(existing io.Reader, to io.Writer) (*Writer, int64, error) {
+	s := NewScanner()
+	if _, err := io.Copy(s, existing); err != nil {
+		return nil, 0, err
+	}
+	return s.Appender(to)
+}
+
+// Scanner is an io.Writer that follows the chunks of a pack file written to
+// it, keeping the type registry and chunk identifiers needed to append to the
+// pack file, but not the content of the objects.
+// It should only be constructed by NewScanner.
+type Scanner struct {
+	types   *types
+	id      uint64
+	size    int64  // size of the header and of the complete chunks
+	header  []byte // header, until complete
+	varint  []byte // size of the current chunk, until complete
+	chunk   []byte // content of the current type chunk
+	length  int64  // size of the current chunk
+	left    int64  // bytes of the current chunk not written yet
+	isType  bool   // whether the current chunk is a type chunk
+	inChunk bool   // whether the size of the current chunk is complete
+	end     bool   // whether the end of the pack file was reached
+	err     error
+}
+
+// NewScanner returns a new Scanner expecting the pack file from its header.
+func NewScanner() *Scanner {
+	return &Scanner{
+		types:  newTypes(false),
+		header: make([]byte, 0, maxHeaderSize),
+		varint: make([]byte, 0, maxVarintSize),
+	}
+}
+
+// Write follows the chunks of data. It never fails, so that the Scanner can
+// be used along the actual destination of the pack file in an
+// io.MultiWriter. Errors are returned by Appender instead.
+func (s *Scanner) Write(data []byte) (int, error) {
+	n := len(data)
+	for len(data) > 0 && s.err == nil && !s.end {
+		switch {
+		case len(s.header) < maxHeaderSize:
+			c := maxHeaderSize - len(s.header)
+			if c > len(data) {
+				c = len(data)
+			}
+			s.header, data = append(s.header, data[:c]...), data[c:]
+			if len(s.header) == maxHeaderSize {
+				s.err = s.checkHeader()
+				s.size = maxHeaderSize
+			}
+		case !s.inChunk:
+			b := data[0]
+			s.varint, data = append(s.varint, b), data[1:]
+			if b&0x80 != 0 {
+				if len(s.varint) == maxVarintSize {
+					s.err = fmt.Errorf("Invalid pack chunk size")
+				}
+				continue
+			}
+			zigzag, _ := binary.Uvarint(s.varint)
+			if zigzag == 0 {
+				s.end = true
+				break
+			}
+			chunkSize := int64(zigzag>>1) ^ -int64(zigzag&1) // Decode zig-zag encoding
+			s.length, s.isType, s.inChunk = int64(sint.Abs(int(chunkSize))), chunkSize < 0, true
+			s.left = s.length
+		default:
+			c := len(data)
+			if int64(c) > s.left {
+				c = int(s.left)
+			}
+			if s.isType {
+				s.chunk = append(s.chunk, data[:c]...)
+			}
+			s.left, data = s.left-int64(c), data[c:]
+		}
+		if s.inChunk && s.left == 0 && s.err == nil {
+			s.err = s.endChunk()
+		}
+	}
+	return n, nil
+}
+
+func (s *Scanner) checkHeader() error {
+	version, err := parseVersion(s.header)
+	if err != nil {
+		return err
+	}
+	if !(MinMajorVersion <= version.Major && version.Major <= MaxMajorVersion) {
+		return ErrUnsupportedVersion{Version: version}
+	}
+	return nil
+}
+
+// endChunk registers the type of the chunk that was completed, if it is a
+// type chunk.
+func (s *Scanner) endChunk() error {
+	if s.isType {
+		pb := proto.NewBuffer(s.chunk)
+		name, err := pb.DecodeStringBytes()
+		if err != nil {
+			return err
+		}
+		desc := &descriptor.DescriptorProto{}
+		if err := pb.Unmarshal(desc); err != nil {
+			return err
+		}
+		s.types.add(name, desc)
+	}
+	s.id++
+	s.size += int64(len(s.varint)) + s.length
+	s.varint, s.chunk, s.inChunk = s.varint[:0], nil, false
+	return nil
+}
+
+// Appender returns a new Writer that appends chunks to the pack file written
+// to the Scanner so far, writing them to the supplied output stream. It also
+// returns the size in bytes of the complete chunks written so far, after which
+// the new chunks must be written as the pack file may end with a partially
+// written chunk.
+// Nothing is written to the output stream until a chunk is added, and the
+// Scanner must not be written to anymore.
+func (s *Scanner) Appender(to io.Writer) (*Writer, int64, error) {
+	if s.err != nil {
+		return nil, 0, s.err
+	}
+	if len(s.header) < maxHeaderSize {
+		return nil, 0, ErrIncorrectMagic
+	}
+	return &Writer{
+		types:   s.types,
+		id:      s.id,
+		buf:     proto.NewBuffer(make([]byte, 0, initalBufferSize)),
+		sizebuf: proto.NewBuffer(make([]byte, 0, maxVarintSize)),
+		to:      to,
+	}, s.size, nil
+}
+
 // BeginGroup is called to start a new root group.
 func (w *Writer) BeginGroup(ctx context.Context, msg proto.Message) (id uint64, err error) {
 	return w.writeMessage(ctx, msg, true, nil)
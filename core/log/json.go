@@ -0,0 +1,83 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// jsonMessage is the JSON representation of a Message.
+type jsonMessage struct {
+	Time     string                     `json:"time,omitempty"`
+	Severity string                     `json:"severity,omitempty"`
+	Tag      string                     `json:"tag,omitempty"`
+	Process  string                     `json:"process,omitempty"`
+	Trace    []string                   `json:"trace,omitempty"`
+	Task     uint64                     `json:"task,omitempty"`
+	Text     string                     `json:"text"`
+	Values   map[string]json.RawMessage `json:"values,omitempty"`
+}
+
+// printJSON returns the message msg as a JSON object with the parts enabled by
+// the style s. The task identifier is printed along with the trace.
+func (s Style) printJSON(msg *Message) string {
+	m := jsonMessage{Text: msg.Text}
+	if s.Timestamp && !msg.Time.IsZero() {
+		m.Time = msg.Time.Format(time.RFC3339Nano)
+	}
+	if s.Severity != NoSeverity {
+		m.Severity = s.Severity.print(msg.Severity)
+	}
+	if s.Tag {
+		m.Tag = msg.Tag
+	}
+	if s.Process {
+		m.Process = msg.Process
+	}
+	if s.Trace {
+		m.Trace, m.Task = msg.Trace, msg.Task
+	}
+	if s.Values != NoValues && len(msg.Values) > 0 {
+		m.Values = make(map[string]json.RawMessage, len(msg.Values))
+		for _, v := range msg.Values {
+			m.Values[v.Name] = jsonValue(v.Value)
+		}
+	}
+	// All the fields are strings, numbers or already encoded values.
+	out, _ := json.Marshal(m)
+	return string(out)
+}
+
+// jsonValue returns the JSON encoding of the value v. Errors, stringers and
+// values that cannot be encoded are encoded as strings.
+func jsonValue(v interface{}) json.RawMessage {
+	switch v := v.(type) {
+	case error:
+		return jsonString(v.Error())
+	case fmt.Stringer:
+		return jsonString(v.String())
+	}
+	if out, err := json.Marshal(v); err == nil {
+		return out
+	}
+	return jsonString(fmt.Sprint(v))
+}
+
+func jsonString(s string) json.RawMessage {
+	out, _ := json.Marshal(s)
+	return out
+}
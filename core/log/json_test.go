@@ -0,0 +1,64 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+)
+
+func TestJSONStyle(t *testing.T) {
+	assert := assert.To(t)
+	w, b := log.Buffer()
+	ctx := context.Background()
+	ctx = log.PutHandler(ctx, log.JSON.Handler(w))
+	ctx = log.PutTag(ctx, "tag")
+	ctx = log.PutProcess(ctx, "gapis")
+	ctx = log.PutClock(ctx, testClock)
+	ctx = log.PutTask(ctx, 42)
+	ctx = log.Enter(ctx, "outer")
+	ctx = log.V{"count": 3, "err": errors.New("oops"), "name": "a \"b\""}.Bind(ctx)
+	log.W(ctx, "json %s", "message")
+
+	var got struct {
+		Time     string
+		Severity string
+		Tag      string
+		Process  string
+		Trace    []string
+		Task     uint64
+		Text     string
+		Values   map[string]interface{}
+	}
+	assert.For("err").ThatError(json.Unmarshal(b.Bytes(), &got)).Succeeded()
+	ts, err := time.Parse(time.RFC3339Nano, got.Time)
+	assert.For("time err").ThatError(err).Succeeded()
+	assert.For("time").That(ts.Equal(testClock.Time())).Equals(true)
+	assert.For("severity").ThatString(got.Severity).Equals("Warning")
+	assert.For("tag").ThatString(got.Tag).Equals("tag")
+	assert.For("process").ThatString(got.Process).Equals("gapis")
+	assert.For("trace").ThatSlice(got.Trace).Equals([]string{"outer"})
+	assert.For("task").That(got.Task).Equals(uint64(42))
+	assert.For("text").ThatString(got.Text).Equals("json message")
+	assert.For("count").That(got.Values["count"]).Equals(3.0)
+	assert.For("err").That(got.Values["err"]).Equals("oops")
+	assert.For("name").That(got.Values["name"]).Equals("a \"b\"")
+}
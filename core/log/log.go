@@ -33,6 +33,7 @@ type Logger struct {
 	tag         string
 	process     string
 	trace       []string
+	task        uint64
 	values      *values
 }
 
@@ -52,6 +53,7 @@ func From(ctx context.Context) *Logger {
 		GetTag(ctx),
 		GetProcess(ctx),
 		GetTrace(ctx),
+		GetTask(ctx),
 		getValues(ctx),
 	}
 }
@@ -157,6 +159,7 @@ func (l *Logger) Message(s Severity, stopProcess bool, text string) *Message {
 		Process:     l.process,
 		// Callstack: callstack(), // TODO: Callstack
 		Trace: l.trace,
+		Task:  l.task,
 	}
 
 	for n := l.values; n != nil; n = n.parent {
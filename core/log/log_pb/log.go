@@ -32,6 +32,7 @@ func From(m *log.Message) *Message {
 		Tag:      m.Tag,
 		Process:  m.Process,
 		Trace:    m.Trace,
+		Task:     m.Task,
 	}
 	for _, v := range m.Callstack {
 		out.Callstack = append(out.Callstack, &SourceLocation{
@@ -57,6 +58,7 @@ func (m *Message) Message() *log.Message {
 		Tag:      m.Tag,
 		Process:  m.Process,
 		Trace:    m.Trace,
+		Task:     m.Task,
 	}
 	for _, v := range m.Callstack {
 		out.Callstack = append(out.Callstack, &log.SourceLocation{
@@ -44,6 +44,9 @@ type Message struct {
 	// The stack of enter() calls at the time the message was logged.
 	Trace Trace
 
+	// The identifier of the task the message was logged from, 0 if none.
+	Task uint64
+
 	// The key-value pairs of extra data.
 	Values Values
 }
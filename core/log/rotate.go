@@ -0,0 +1,295 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gapid/core/app/crash"
+)
+
+const (
+	rotatedTimeFormat = "20060102-150405.000"
+	gzipExt           = ".gz"
+)
+
+// Rotation configures when a RotatingFile is rotated and which of the rotated
+// files are kept.
+type Rotation struct {
+	MaxSize  int64         // Size in bytes above which the file is rotated, 0 for no limit.
+	MaxAge   time.Duration // Age after which the file is rotated, 0 for no limit.
+	MaxFiles int           // Number of rotated files kept, 0 to keep all of them.
+	Compress bool          // If true, the rotated files are compressed with gzip.
+}
+
+// Rotates returns true if the configuration rotates the file, that is if it
+// has a size or age limit. MaxFiles and Compress only apply to rotated files.
+func (r Rotation) Rotates() bool {
+	return r.MaxSize > 0 || r.MaxAge > 0
+}
+
+// RotatingFile is a log file which is moved aside and replaced by a new file
+// once it is too large or too old. The rotated files are named after the file
+// with the time of their rotation appended to the name, before the extension.
+type RotatingFile struct {
+	path    string
+	cfg     Rotation
+	mutex   sync.Mutex
+	file    *os.File
+	size    int64
+	opened  time.Time
+	pending sync.WaitGroup // compressions in progress
+	cleanup sync.Mutex     // serializes compressions and pruning
+}
+
+// OpenRotatingFile opens the log file at path for appending, creating it if
+// needed, and rotates it according to cfg. It fails if cfg does not rotate
+// the file.
+func OpenRotatingFile(path string, cfg Rotation) (*RotatingFile, error) {
+	if !cfg.Rotates() {
+		return nil, fmt.Errorf("Log file rotation needs a maximum size or age")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f := &RotatingFile{path: path, cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Writer returns a Writer writing each message on a line of the file.
+func (f *RotatingFile) Writer() Writer {
+	return func(text string, severity Severity) {
+		f.write(text + "\n")
+	}
+}
+
+// Close closes the file, once the rotated files have been compressed.
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.pending.Wait()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+func (f *RotatingFile) write(s string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return
+	}
+	if f.needsRotation(int64(len(s))) {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file %v: %v\n", f.path, err)
+			if f.file == nil {
+				return
+			}
+		}
+	}
+	n, _ := f.file.WriteString(s)
+	f.size += int64(n)
+}
+
+func (f *RotatingFile) needsRotation(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.cfg.MaxSize > 0 && f.size+n > f.cfg.MaxSize {
+		return true
+	}
+	return f.cfg.MaxAge > 0 && time.Since(f.opened) >= f.cfg.MaxAge
+}
+
+// rotate moves the file aside and opens a new one in its place. If the file
+// cannot be moved, writing continues to it.
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	rotated := f.rotatedPath(time.Now())
+	err := os.Rename(f.path, rotated)
+	if openErr := f.open(); openErr != nil {
+		return openErr
+	}
+	if err != nil {
+		return err
+	}
+
+	f.pending.Add(1)
+	crash.Go(func() {
+		defer f.pending.Done()
+		f.cleanup.Lock()
+		defer f.cleanup.Unlock()
+		// The file may have been pruned by the cleanup of a later rotation.
+		if f.cfg.Compress && exists(rotated) {
+			if err := compressFile(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to compress log file %v: %v\n", rotated, err)
+			}
+		}
+		f.prune()
+	})
+	return nil
+}
+
+// rotatedPath returns the path of the file rotated at time t.
+func (f *RotatingFile) rotatedPath(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext)
+	path := fmt.Sprintf("%s-%s%s", base, t.Format(rotatedTimeFormat), ext)
+	for i := 1; exists(path) || exists(path+gzipExt); i++ {
+		path = fmt.Sprintf("%s-%s-%d%s", base, t.Format(rotatedTimeFormat), i, ext)
+	}
+	return path
+}
+
+// rotatedFile is a rotated file, identified by the time of its rotation and
+// the suffix added to its name if several files were rotated at that time.
+type rotatedFile struct {
+	time   time.Time
+	suffix int
+	paths  []string // with and without the compression extension
+}
+
+// parseRotated returns the time and suffix of the rotated file named name, or
+// false if the name does not match the name of a rotated file.
+func (f *RotatingFile) parseRotated(name string) (time.Time, int, bool) {
+	ext := filepath.Ext(f.path)
+	s := strings.TrimPrefix(name, strings.TrimSuffix(f.path, ext)+"-")
+	s = strings.TrimSuffix(s, ext)
+	if len(s) < len(rotatedTimeFormat) {
+		return time.Time{}, 0, false
+	}
+	t, err := time.Parse(rotatedTimeFormat, s[:len(rotatedTimeFormat)])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	suffix := 0
+	if s = s[len(rotatedTimeFormat):]; s != "" {
+		if !strings.HasPrefix(s, "-") {
+			return time.Time{}, 0, false
+		}
+		if suffix, err = strconv.Atoi(s[1:]); err != nil || suffix <= 0 {
+			return time.Time{}, 0, false
+		}
+	}
+	return t, suffix, true
+}
+
+// prune removes the oldest rotated files, keeping at most MaxFiles of them.
+func (f *RotatingFile) prune() {
+	if f.cfg.MaxFiles <= 0 {
+		return
+	}
+	ext := filepath.Ext(f.path)
+	pattern := strings.TrimSuffix(f.path, ext) + "-*" + ext
+	matches, _ := filepath.Glob(pattern)
+	compressed, _ := filepath.Glob(pattern + gzipExt)
+
+	// A file being compressed is listed twice, with and without extension.
+	byName := map[string]*rotatedFile{}
+	files := []*rotatedFile{}
+	for _, m := range append(matches, compressed...) {
+		name := strings.TrimSuffix(m, gzipExt)
+		if file, ok := byName[name]; ok {
+			file.paths = append(file.paths, m)
+			continue
+		}
+		t, suffix, ok := f.parseRotated(name)
+		if !ok {
+			continue // Not a rotated file.
+		}
+		file := &rotatedFile{time: t, suffix: suffix, paths: []string{m}}
+		byName[name] = file
+		files = append(files, file)
+	}
+	if len(files) <= f.cfg.MaxFiles {
+		return
+	}
+	// The names do not sort chronologically, as the suffixed names of files
+	// rotated at the same time sort before the name without suffix.
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].time.Equal(files[j].time) {
+			return files[i].time.Before(files[j].time)
+		}
+		return files[i].suffix < files[j].suffix
+	})
+	for _, file := range files[:len(files)-f.cfg.MaxFiles] {
+		for _, path := range file.paths {
+			os.Remove(path)
+		}
+	}
+}
+
+// compressFile replaces the file at path by its gzip compressed version, with
+// the .gz extension appended.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(path + gzipExt)
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(out)
+	_, err = io.Copy(w, in)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + gzipExt)
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
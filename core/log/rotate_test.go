@@ -0,0 +1,113 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+)
+
+func TestRotatingFile(t *testing.T) {
+	assert := assert.To(t)
+	dir, err := ioutil.TempDir("", "rotate")
+	assert.For("err").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.log")
+	f, err := log.OpenRotatingFile(path, log.Rotation{MaxSize: 20, MaxFiles: 2, Compress: true})
+	assert.For("err").ThatError(err).Succeeded()
+	w := f.Writer()
+	for _, line := range []string{"first line", "second line", "third line", "fourth line"} {
+		w(line, log.Info)
+		// Rotated files are named after the time they were rotated at.
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.For("close").ThatError(f.Close()).Succeeded()
+
+	current, err := ioutil.ReadFile(path)
+	assert.For("err").ThatError(err).Succeeded()
+	assert.For("current").ThatString(string(current)).Equals("fourth line\n")
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "test-*.log.gz"))
+	assert.For("err").ThatError(err).Succeeded()
+	assert.For("rotated").ThatSlice(rotated).IsLength(2)
+	uncompressed, err := filepath.Glob(filepath.Join(dir, "test-*.log"))
+	assert.For("err").ThatError(err).Succeeded()
+	assert.For("uncompressed").ThatSlice(uncompressed).IsEmpty()
+
+	// The oldest rotated file was removed.
+	contents := []string{}
+	for _, path := range rotated {
+		file, err := os.Open(path)
+		assert.For("err").ThatError(err).Succeeded()
+		r, err := gzip.NewReader(file)
+		assert.For("err").ThatError(err).Succeeded()
+		data, err := ioutil.ReadAll(r)
+		assert.For("err").ThatError(err).Succeeded()
+		file.Close()
+		contents = append(contents, strings.TrimSpace(string(data)))
+	}
+	assert.For("contents").ThatSlice(contents).Equals([]string{"second line", "third line"})
+}
+
+func TestRotatingFileSameTime(t *testing.T) {
+	assert := assert.To(t)
+	dir, err := ioutil.TempDir("", "rotate")
+	assert.For("err").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	// Files rotated within the same millisecond get a numbered suffix, which
+	// must not make pruning remove the newest files.
+	path := filepath.Join(dir, "test.log")
+	f, err := log.OpenRotatingFile(path, log.Rotation{MaxSize: 20, MaxFiles: 2})
+	assert.For("err").ThatError(err).Succeeded()
+	w := f.Writer()
+	for _, line := range []string{"first line", "second line", "third line", "fourth line", "fifth line"} {
+		w(line, log.Info)
+	}
+	assert.For("close").ThatError(f.Close()).Succeeded()
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "test-*.log"))
+	assert.For("err").ThatError(err).Succeeded()
+	contents := []string{}
+	for _, path := range rotated {
+		data, err := ioutil.ReadFile(path)
+		assert.For("err").ThatError(err).Succeeded()
+		contents = append(contents, strings.TrimSpace(string(data)))
+	}
+	sort.Strings(contents)
+	assert.For("contents").ThatSlice(contents).Equals([]string{"fourth line", "third line"})
+}
+
+func TestRotatingFileNeedsLimit(t *testing.T) {
+	assert := assert.To(t)
+	dir, err := ioutil.TempDir("", "rotate")
+	assert.For("err").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	_, err = log.OpenRotatingFile(filepath.Join(dir, "test.log"), log.Rotation{MaxFiles: 2, Compress: true})
+	assert.For("err").ThatError(err).Failed()
+	_, err = os.Stat(filepath.Join(dir, "test.log"))
+	assert.For("created").That(os.IsNotExist(err)).Equals(true)
+}
@@ -61,6 +61,20 @@ var (
 		Severity:  SeverityLong,
 		Values:    ValuesMultiLine,
 	}
+
+	// JSON is a style that prints each message as a JSON object on a single
+	// line, with the timestamp, tag, trace, task, process, long severity and
+	// values. It is meant to be read by log aggregation systems.
+	JSON = Style{
+		Name:      "json",
+		Timestamp: true,
+		Tag:       true,
+		Trace:     true,
+		Process:   true,
+		Severity:  SeverityLong,
+		Values:    ValuesSingleLine,
+		JSON:      true,
+	}
 )
 
 func init() {
@@ -68,4 +82,5 @@ func init() {
 	RegisterStyle(Brief)
 	RegisterStyle(Normal)
 	RegisterStyle(Detailed)
+	RegisterStyle(JSON)
 }
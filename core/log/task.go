@@ -0,0 +1,37 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/context/keys"
+)
+
+type taskKeyTy string
+
+const taskKey taskKeyTy = "log.taskKey"
+
+// PutTask returns a new context with the identifier of the task the messages
+// are logged from assigned to id. An id of 0 means no task.
+func PutTask(ctx context.Context, id uint64) context.Context {
+	return keys.WithValue(ctx, taskKey, id)
+}
+
+// GetTask returns the task identifier assigned to ctx.
+func GetTask(ctx context.Context) uint64 {
+	out, _ := ctx.Value(taskKey).(uint64)
+	return out
+}
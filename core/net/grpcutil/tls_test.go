@@ -0,0 +1,133 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcutil_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/net/grpcutil"
+)
+
+// writeCert writes a certificate for name, signed by parent, and its key to
+// dir. It returns the paths of the files and the certificate.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (certFile, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile, cert, key
+}
+
+// handshake returns the errors of a TLS handshake between server and client.
+func handshake(server, client *tls.Config) (serverErr, clientErr error) {
+	s, c := net.Pipe()
+	defer s.Close()
+	defer c.Close()
+	done := make(chan error)
+	go func() {
+		tlsServer := tls.Server(s, server)
+		err := tlsServer.Handshake()
+		if err == nil {
+			// Client certificates are verified once the client reads.
+			_, err = tlsServer.Write([]byte{0})
+		}
+		s.Close()
+		done <- err
+	}()
+	tlsClient := tls.Client(c, client)
+	clientErr = tlsClient.Handshake()
+	if clientErr == nil {
+		_, clientErr = tlsClient.Read(make([]byte, 1))
+	}
+	c.Close()
+	return <-done, clientErr
+}
+
+func TestTLSConfig(t *testing.T) {
+	assert := assert.To(t)
+	dir, err := ioutil.TempDir("", "grpcutil")
+	assert.For("temp dir").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	caFile, _, ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	serverCert, serverKey, _, _ := writeCert(t, dir, "gapis", ca, caKey)
+	clientCert, clientKey, _, _ := writeCert(t, dir, "gapit", ca, caKey)
+
+	server, err := grpcutil.ServerTLSConfig(serverCert, serverKey, "")
+	assert.For("server").ThatError(err).Succeeded()
+	mutual, err := grpcutil.ServerTLSConfig(serverCert, serverKey, caFile)
+	assert.For("mutual server").ThatError(err).Succeeded()
+	client, err := grpcutil.ClientTLSConfig(caFile, "", "")
+	assert.For("client").ThatError(err).Succeeded()
+	client.ServerName = "gapis"
+	authClient, err := grpcutil.ClientTLSConfig(caFile, clientCert, clientKey)
+	assert.For("authenticated client").ThatError(err).Succeeded()
+	authClient.ServerName = "gapis"
+
+	serverErr, clientErr := handshake(server, client)
+	assert.For("tls server").ThatError(serverErr).Succeeded()
+	assert.For("tls client").ThatError(clientErr).Succeeded()
+
+	serverErr, clientErr = handshake(mutual, authClient)
+	assert.For("mtls server").ThatError(serverErr).Succeeded()
+	assert.For("mtls client").ThatError(clientErr).Succeeded()
+
+	serverErr, _ = handshake(mutual, client)
+	assert.For("mtls without client cert").ThatError(serverErr).Failed()
+
+	_, err = grpcutil.ClientTLSConfig(serverKey, "", "")
+	assert.For("no CA certificate").ThatError(err).Failed()
+}
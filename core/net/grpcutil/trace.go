@@ -0,0 +1,95 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcutil
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/app/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// traceIDHeader is the metadata key of the trace identifier of a request.
+const traceIDHeader = "gapid-trace-id"
+
+// withTraceID returns the context with the trace identifier of ctx added to
+// the outgoing metadata, or else fallback if ctx has none.
+func withTraceID(ctx context.Context, fallback status.TraceID) context.Context {
+	id, ok := status.LookupTraceID(ctx)
+	if !ok {
+		id = fallback
+	}
+	if id == status.NoTraceID {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, traceIDHeader, string(id))
+}
+
+// fromTraceID returns the context with the trace identifier of the incoming
+// metadata of ctx attached, if any.
+func fromTraceID(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if got := md.Get(traceIDHeader); len(got) == 1 && got[0] != "" {
+		return status.PutTraceID(ctx, status.TraceID(got[0]))
+	}
+	return ctx
+}
+
+// UnaryClientTraceInterceptor returns a grpc.UnaryClientInterceptor that
+// forwards the trace identifier of the call context, or else fallback, to the
+// server.
+func UnaryClientTraceInterceptor(fallback status.TraceID) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withTraceID(ctx, fallback), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientTraceInterceptor returns a grpc.StreamClientInterceptor that
+// forwards the trace identifier of the call context, or else fallback, to the
+// server.
+func StreamClientTraceInterceptor(fallback status.TraceID) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withTraceID(ctx, fallback), desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerTraceInterceptor returns a grpc.UnaryServerInterceptor that
+// attaches the trace identifier sent by the client to the call context.
+func UnaryServerTraceInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(fromTraceID(ctx), req)
+	}
+}
+
+// StreamServerTraceInterceptor returns a grpc.StreamServerInterceptor that
+// attaches the trace identifier sent by the client to the stream context.
+func StreamServerTraceInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &tracedServerStream{ss, fromTraceID(ss.Context())})
+	}
+}
+
+// tracedServerStream is a grpc.ServerStream with the trace identifier
+// attached to its context.
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,65 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcutil_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/net/grpcutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// traceCall returns the trace identifier received by the server for a unary
+// call made with ctx through the trace interceptors.
+func traceCall(ctx context.Context, fallback status.TraceID) status.TraceID {
+	got := status.TraceID("unset")
+	server := grpcutil.UnaryServerTraceInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = status.GetTraceID(ctx)
+		return nil, nil
+	}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewIncomingContext(context.Background(), md)
+		_, err := server(ctx, req, &grpc.UnaryServerInfo{}, handler)
+		return err
+	}
+	client := grpcutil.UnaryClientTraceInterceptor(fallback)
+	client(ctx, "/test", nil, nil, nil, invoker)
+	return got
+}
+
+func TestTraceInterceptors(t *testing.T) {
+	ctx := log.Testing(t)
+	assert := assert.To(t)
+
+	assert.For("no trace").That(traceCall(ctx, status.NoTraceID)).Equals(status.NoTraceID)
+	assert.For("fallback").That(traceCall(ctx, "fallback")).Equals(status.TraceID("fallback"))
+
+	traced := status.PutTraceID(ctx, "request")
+	assert.For("context").That(traceCall(traced, "fallback")).Equals(status.TraceID("request"))
+
+	task := status.Start(traced, "Task")
+	defer status.Finish(task)
+	assert.For("task").That(traceCall(status.PutTask(ctx, status.GetTask(task)), "fallback")).Equals(status.TraceID("request"))
+
+	untraced := status.PutTraceID(ctx, status.NoTraceID)
+	assert.For("untraced").That(traceCall(untraced, "fallback")).Equals(status.NoTraceID)
+}
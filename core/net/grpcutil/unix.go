@@ -0,0 +1,128 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// unixScheme is the prefix of the addresses of Unix domain sockets, as
+// understood by grpc.Dial.
+const unixScheme = "unix:"
+
+// UnixAddress returns the address of the Unix domain socket at path.
+func UnixAddress(path string) string {
+	return unixScheme + path
+}
+
+// UnixSocketPath returns the path of the Unix domain socket of addr, and
+// whether addr is the address of a Unix domain socket.
+func UnixSocketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, unixScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(addr, unixScheme), "//"), true
+}
+
+// ListenUnix listens on a Unix domain socket created at path, that only
+// processes with the permissions given by mode can connect to. A stale socket
+// left at path by a previous server is replaced.
+//
+// The socket is created in a private directory, and only moved to path once
+// its permissions are set, so that it is never reachable with the default
+// permissions. Once it is moved, the permissions of the socket protect it,
+// thus the directory containing it must not be writable by other users,
+// unless it has the sticky bit set.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	if err := checkSocketDir(dir); err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%v exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The name of a socket is limited to about a hundred bytes, keep the
+	// private path short.
+	private, err := ioutil.TempDir(dir, ".s")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(private)
+	created := filepath.Join(private, "s")
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: created, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+	if err := os.Chmod(created, mode.Perm()); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(created, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &unixListener{l, path}, nil
+}
+
+// unixListener is a listener on a Unix domain socket, removing the socket
+// when closed.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// checkSocketDir returns an error if other users could replace a socket in
+// dir.
+func checkSocketDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%v is not a directory", dir)
+	}
+	if runtime.GOOS == "windows" {
+		// The permission bits do not reflect the ACLs of the directory.
+		return nil
+	}
+	if info.Mode().Perm()&0022 != 0 && info.Mode()&os.ModeSticky == 0 {
+		return fmt.Errorf("The socket directory %v is writable by other users (mode %v)", dir, info.Mode())
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcutil_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/net/grpcutil"
+)
+
+func TestUnixSocketPath(t *testing.T) {
+	assert := assert.To(t)
+	for _, test := range []struct {
+		addr string
+		path string
+		ok   bool
+	}{
+		{"localhost:1234", "", false},
+		{"unix:/tmp/gapis.sock", "/tmp/gapis.sock", true},
+		{"unix:///tmp/gapis.sock", "/tmp/gapis.sock", true},
+		{"unix:gapis.sock", "gapis.sock", true},
+	} {
+		path, ok := grpcutil.UnixSocketPath(test.addr)
+		assert.For("%v ok", test.addr).That(ok).Equals(test.ok)
+		assert.For("%v path", test.addr).That(path).Equals(test.path)
+	}
+	path, _ := grpcutil.UnixSocketPath(grpcutil.UnixAddress("/a/b"))
+	assert.For("round trip").That(path).Equals("/a/b")
+}
+
+func TestListenUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix socket permissions are not supported on Windows")
+	}
+	assert := assert.To(t)
+	dir, err := ioutil.TempDir("", "grpcutil")
+	assert.For("temp dir").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+	assert.For("chmod").ThatError(os.Chmod(dir, 0700)).Succeeded()
+	path := filepath.Join(dir, "test.sock")
+
+	// A stale socket is replaced.
+	stale, err := net.Listen("unix", path)
+	assert.For("stale").ThatError(err).Succeeded()
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := grpcutil.ListenUnix(path, 0600)
+	assert.For("listen").ThatError(err).Succeeded()
+	info, err := os.Stat(path)
+	assert.For("stat").ThatError(err).Succeeded()
+	assert.For("mode").That(info.Mode().Perm()).Equals(os.FileMode(0600))
+
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+	c, err := net.Dial("unix", path)
+	assert.For("dial").ThatError(err).Succeeded()
+	c.Close()
+	l.Close()
+
+	// The socket is removed on close, along with the private directory it
+	// was created in.
+	files, err := ioutil.ReadDir(dir)
+	assert.For("read dir").ThatError(err).Succeeded()
+	assert.For("files").ThatSlice(files).IsEmpty()
+
+	// Other files are not replaced.
+	assert.For("file").ThatError(ioutil.WriteFile(path, nil, 0600)).Succeeded()
+	_, err = grpcutil.ListenUnix(path, 0600)
+	assert.For("listen on file").ThatError(err).Failed()
+	os.Remove(path)
+
+	// Directories writable by others are rejected.
+	assert.For("chmod").ThatError(os.Chmod(dir, 0777)).Succeeded()
+	_, err = grpcutil.ListenUnix(path, 0600)
+	assert.For("listen in shared dir").ThatError(err).Failed()
+}
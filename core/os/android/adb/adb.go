@@ -15,14 +15,68 @@
 package adb
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/gapid/core/os/file"
 	"github.com/google/gapid/core/os/shell"
 )
 
+const serverProbeInterval = 10 * time.Second
+
+var (
+	serverAddress   = DefaultServerAddress()
+	serverClient    *Client
+	serverReachable bool
+	serverProbedAt  time.Time
+	serverMutex     sync.Mutex
+)
+
+// ServerAddress returns the address of the adb server used to talk to devices
+// without spawning the adb executable. If it is empty, or if no adb server is
+// listening on it, all device requests go through the adb executable.
+func ServerAddress() string {
+	serverMutex.Lock()
+	defer serverMutex.Unlock()
+	return serverAddress
+}
+
+// SetServerAddress changes the address of the adb server used by all the
+// devices of the process, and returns the previous address.
+func SetServerAddress(address string) string {
+	serverMutex.Lock()
+	defer serverMutex.Unlock()
+	old := serverAddress
+	serverAddress = address
+	return old
+}
+
+// server returns the client to use to talk to the adb server, or nil if the
+// adb server is not reachable and the adb executable must be used instead.
+// The reachability of the server is probed at most every serverProbeInterval.
+func server(ctx context.Context) *Client {
+	serverMutex.Lock()
+	defer serverMutex.Unlock()
+	if serverAddress == "" {
+		return nil
+	}
+	if serverClient == nil || serverClient.Address != serverAddress {
+		serverClient, serverProbedAt = NewClient(serverAddress), time.Time{}
+	}
+	if time.Since(serverProbedAt) > serverProbeInterval {
+		serverReachable, serverProbedAt = serverClient.Reachable(ctx), time.Now()
+	}
+	if !serverReachable {
+		return nil
+	}
+	return serverClient
+}
+
 // ADB is the path to the adb executable, or an empty string if the adb
 // executable was not found.
 var ADB file.Path
@@ -86,9 +140,30 @@ func (b *binding) prepareADBCommand(cmd shell.Cmd, useShell bool) (shell.Process
 	return shell.LocalTarget.Start(cmd)
 }
 
+// startNativeShell runs command on the device through the adb server.
+// Cancelling ctx closes the connection to the adb server, killing the command.
+func (b *binding) startNativeShell(ctx context.Context, c *Client, cmd shell.Cmd, command string) (shell.Process, error) {
+	p, err := c.startShell(ctx, b.To.Serial, command, cmd.Stdin, cmd.Stdout, cmd.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 type deviceTarget struct{ b *binding }
 
+var _ shell.ContextTarget = deviceTarget{}
+
 func (t deviceTarget) Start(cmd shell.Cmd) (shell.Process, error) {
+	return t.StartContext(context.Background(), cmd)
+}
+
+func (t deviceTarget) StartContext(ctx context.Context, cmd shell.Cmd) (shell.Process, error) {
+	if cmd.Name == "shell" {
+		if c := server(ctx); c != nil {
+			return t.b.startNativeShell(ctx, c, cmd, strings.Join(cmd.Args, " "))
+		}
+	}
 	return t.b.prepareADBCommand(cmd, false)
 }
 
@@ -98,7 +173,17 @@ func (t deviceTarget) String() string {
 
 type shellTarget struct{ b *binding }
 
+var _ shell.ContextTarget = shellTarget{}
+
 func (t shellTarget) Start(cmd shell.Cmd) (shell.Process, error) {
+	return t.StartContext(context.Background(), cmd)
+}
+
+func (t shellTarget) StartContext(ctx context.Context, cmd shell.Cmd) (shell.Process, error) {
+	if c := server(ctx); c != nil {
+		command := strings.Join(append([]string{cmd.Name}, cmd.Args...), " ")
+		return t.b.startNativeShell(ctx, c, cmd, command)
+	}
 	return t.b.prepareADBCommand(cmd, true)
 }
 
@@ -78,6 +78,7 @@ production_device        invalid
 
 func init() {
 	adb.ADB = file.Abs("/adb")
+	adb.SetServerAddress("")
 
 	shell.LocalTarget = stub.OneOf(
 		devices,
@@ -202,6 +203,17 @@ untagSocket(48) failed with errno -22
 
 [ 03-29 15:16:32.219 31608:31608 F/Finsky   ]
 [1] PackageVerificationReceiver.onReceive: Verification requested, id = 331
+`),
+		stub.RespondTo(adbPath.System()+` -s logcat_device logcat -v long,epoch -T 0 --pid=31608 *:V`, `
+[ 1648566989.761 31608:31608 I/Finsky   ]
+[1] PackageVerificationReceiver.onReceive: Verification requested, id = 331
+
+[ 1648566992.205 31608:31655 D/vulkan   ]
+Loaded layer VkGraphicsSpy
+second line
+
+[ 1648566992.219042 31608:31655 W/vulkan   ]
+Timestamp printed with -v usec
 `),
 
 		// Common responses to all devices
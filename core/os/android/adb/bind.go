@@ -37,6 +37,10 @@ type Device interface {
 	Forward(ctx context.Context, local, device Port) error
 	// RemoveForward removes a port forward made by Forward.
 	RemoveForward(ctx context.Context, local Port) error
+	// Reverse will forward the specified local Port to the specified device Port.
+	Reverse(ctx context.Context, device, local Port) error
+	// RemoveReverse removes a reverse port forward made by Reverse.
+	RemoveReverse(ctx context.Context, device Port) error
 	// GraphicsDriver queries and returns info about the prerelease graphics driver.
 	GraphicsDriver(ctx context.Context) (Driver, error)
 	// PrepareGpuProfiling queries GPU profiling support, and when profiling is supported it sets up
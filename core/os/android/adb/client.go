@@ -0,0 +1,513 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adb
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/core/os/shell"
+)
+
+const (
+	// ErrServerFailed is returned when the adb server responds to a request
+	// with a FAIL status.
+	ErrServerFailed = fault.Const("adb server request failed")
+	// ErrProtocol is returned when the adb server sends an unexpected response.
+	ErrProtocol = fault.Const("Unexpected adb protocol response")
+
+	defaultServerPort = 5037
+	dialTimeout       = time.Second
+
+	// Packet identifiers of the shell v2 protocol.
+	shellStdin      = 0
+	shellStdout     = 1
+	shellStderr     = 2
+	shellExit       = 3
+	shellCloseStdin = 4
+
+	shellV2Feature = "shell_v2"
+)
+
+// DefaultServerAddress returns the address of the adb server, honoring the
+// ANDROID_ADB_SERVER_ADDRESS and ANDROID_ADB_SERVER_PORT environment variables
+// in the same way as the adb executable does.
+func DefaultServerAddress() string {
+	host := os.Getenv("ANDROID_ADB_SERVER_ADDRESS")
+	if host == "" {
+		host = "localhost"
+	}
+	port := defaultServerPort
+	if p, err := strconv.Atoi(os.Getenv("ANDROID_ADB_SERVER_PORT")); err == nil && p > 0 {
+		port = p
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// DeviceInfo describes a device as listed by the adb server.
+type DeviceInfo struct {
+	// Serial is the serial of the device.
+	Serial string
+	// State is the raw connection state reported by the server.
+	State string
+	// Properties holds the key:value details reported by host:devices-l,
+	// such as product, model, device and transport_id.
+	Properties map[string]string
+}
+
+// Status returns the bind.Status matching the device's connection state.
+func (i DeviceInfo) Status(ctx context.Context) (bind.Status, error) {
+	return parseStatus(ctx, i.State)
+}
+
+// ShellExitError is returned by a shell command run through a Client when
+// the command terminated with a non-zero exit code.
+type ShellExitError struct {
+	Code int
+}
+
+func (e ShellExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Client talks to the adb server directly using its wire protocol, instead of
+// invoking the adb executable.
+type Client struct {
+	// Address is the host:port address of the adb server.
+	Address string
+
+	mutex    sync.Mutex
+	features map[string][]string // serial -> device features
+}
+
+// NewClient returns a new client connecting to the adb server at address.
+func NewClient(address string) *Client {
+	return &Client{Address: address, features: map[string][]string{}}
+}
+
+// Reachable returns true if a connection to the adb server can be opened.
+func (c *Client) Reachable(ctx context.Context) bool {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Version returns the internal version number of the adb server.
+func (c *Client) Version(ctx context.Context) (int, error) {
+	res, err := c.query(ctx, "host:version")
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(res, 16, 32)
+	if err != nil {
+		return 0, log.Errf(ctx, ErrProtocol, "Invalid version: %v", res)
+	}
+	return int(v), nil
+}
+
+// Devices returns the list of devices known to the adb server.
+func (c *Client) Devices(ctx context.Context) ([]DeviceInfo, error) {
+	res, err := c.query(ctx, "host:devices-l")
+	if err != nil {
+		return nil, err
+	}
+	return parseDevicesLong(ctx, res)
+}
+
+// Features returns the list of adb features supported by the device.
+func (c *Client) Features(ctx context.Context, serial string) ([]string, error) {
+	c.mutex.Lock()
+	features, ok := c.features[serial]
+	c.mutex.Unlock()
+	if ok {
+		return features, nil
+	}
+	res, err := c.query(ctx, "host-serial:"+serial+":features")
+	if err != nil {
+		return nil, err
+	}
+	features = strings.Split(strings.TrimSpace(res), ",")
+	c.mutex.Lock()
+	c.features[serial] = features
+	c.mutex.Unlock()
+	return features, nil
+}
+
+func (c *Client) hasFeature(ctx context.Context, serial, feature string) bool {
+	features, err := c.Features(ctx, serial)
+	if err != nil {
+		return false
+	}
+	for _, f := range features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Shell runs command on the device with the given serial, and returns its
+// exit code. Standard output and error of the command are written to stdout
+// and stderr, which may be nil. If stdin is not nil, it is forwarded to the
+// command. The exit code is only available on devices supporting the shell v2
+// protocol, it is always 0 on older devices.
+func (c *Client) Shell(ctx context.Context, serial, command string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	p, err := c.startShell(ctx, serial, command, stdin, stdout, stderr)
+	if err != nil {
+		return 0, err
+	}
+	if err := p.Wait(ctx); err != nil {
+		if exit, ok := err.(ShellExitError); ok {
+			return exit.Code, nil
+		}
+		return 0, err
+	}
+	return 0, nil
+}
+
+// Forward forwards connections to local on the host to remote on the device.
+func (c *Client) Forward(ctx context.Context, serial, local, remote string) error {
+	return c.exec(ctx, "host-serial:"+serial+":forward:"+local+";"+remote)
+}
+
+// RemoveForward removes a forward previously set up with Forward.
+func (c *Client) RemoveForward(ctx context.Context, serial, local string) error {
+	return c.exec(ctx, "host-serial:"+serial+":killforward:"+local)
+}
+
+// Reverse forwards connections to remote on the device to local on the host.
+func (c *Client) Reverse(ctx context.Context, serial, remote, local string) error {
+	conn, err := c.transport(ctx, serial)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return execOn(ctx, conn, "reverse:forward:"+remote+";"+local)
+}
+
+// RemoveReverse removes a reverse forward previously set up with Reverse.
+func (c *Client) RemoveReverse(ctx context.Context, serial, remote string) error {
+	conn, err := c.transport(ctx, serial)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return execOn(ctx, conn, "reverse:killforward:"+remote)
+}
+
+// dial opens a new connection to the adb server.
+// The cached device features are dropped if the server cannot be reached, as
+// the devices may have changed by the time a server is listening again.
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", c.Address)
+	if err != nil {
+		c.mutex.Lock()
+		c.features = map[string][]string{}
+		c.mutex.Unlock()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// query sends a host request and returns the length-prefixed response.
+func (c *Client) query(ctx context.Context, request string) (string, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := sendRequest(ctx, conn, request); err != nil {
+		return "", err
+	}
+	return readString(conn)
+}
+
+// exec sends a host request that replies with a second status once the
+// request has been fulfilled.
+func (c *Client) exec(ctx context.Context, request string) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return execOn(ctx, conn, request)
+}
+
+// transport returns a connection switched to the device with the given serial.
+// Any further request on the connection is handled by the device.
+func (c *Client) transport(ctx context.Context, serial string) (net.Conn, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := sendRequest(ctx, conn, "host:transport:"+serial); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// open returns a connection to the given service on the device.
+func (c *Client) open(ctx context.Context, serial, service string) (net.Conn, error) {
+	conn, err := c.transport(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+	if err := sendRequest(ctx, conn, service); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func execOn(ctx context.Context, conn net.Conn, request string) error {
+	if err := sendRequest(ctx, conn, request); err != nil {
+		return err
+	}
+	// The server acknowledges the request first, and then reports whether it
+	// succeeded. Some requests close the connection without the second status.
+	if err := readStatus(ctx, conn, request); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// sendRequest writes a length-prefixed request and reads its status.
+func sendRequest(ctx context.Context, conn net.Conn, request string) error {
+	if _, err := fmt.Fprintf(conn, "%04x%s", len(request), request); err != nil {
+		return err
+	}
+	return readStatus(ctx, conn, request)
+}
+
+func readStatus(ctx context.Context, r io.Reader, request string) error {
+	status := make([]byte, 4)
+	if _, err := io.ReadFull(r, status); err != nil {
+		return err
+	}
+	switch string(status) {
+	case "OKAY":
+		return nil
+	case "FAIL":
+		msg, err := readString(r)
+		if err != nil {
+			return err
+		}
+		return log.Errf(ctx, ErrServerFailed, "%v: %v", request, msg)
+	default:
+		return log.Errf(ctx, ErrProtocol, "%v: status %q", request, status)
+	}
+}
+
+// readString reads a string prefixed with its length as four hex digits.
+func readString(r io.Reader) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	length, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return "", ErrProtocol
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func parseDevicesLong(ctx context.Context, out string) ([]DeviceInfo, error) {
+	devices := []DeviceInfo{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, ErrInvalidDeviceList
+		}
+		info := DeviceInfo{
+			Serial:     fields[0],
+			State:      fields[1],
+			Properties: map[string]string{},
+		}
+		for _, f := range fields[2:] {
+			if kv := strings.SplitN(f, ":", 2); len(kv) == 2 {
+				info.Properties[kv[0]] = kv[1]
+			}
+		}
+		devices = append(devices, info)
+	}
+	return devices, nil
+}
+
+// shellProcess is a shell.Process running a command through a Client.
+type shellProcess struct {
+	conn net.Conn
+	done chan struct{}
+	err  error
+}
+
+var _ shell.Process = (*shellProcess)(nil)
+
+func (c *Client) startShell(ctx context.Context, serial, command string, stdin io.Reader, stdout, stderr io.Writer) (*shellProcess, error) {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	v2 := c.hasFeature(ctx, serial, shellV2Feature)
+	service := "shell:" + command
+	if v2 {
+		service = "shell,v2,raw:" + command
+	}
+	conn, err := c.open(ctx, serial, service)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &shellProcess{conn: conn, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-p.done:
+		}
+	}()
+	if !v2 {
+		if stdin != nil {
+			go io.Copy(conn, stdin)
+		}
+		go func() {
+			defer close(p.done)
+			if _, err := io.Copy(stdout, conn); err != nil && !isClosed(err) {
+				p.err = err
+			}
+		}()
+		return p, nil
+	}
+
+	var writeMutex sync.Mutex
+	write := func(id byte, data []byte) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		return writeShellPacket(conn, id, data)
+	}
+	if stdin == nil {
+		write(shellCloseStdin, nil)
+	} else {
+		go func() {
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := stdin.Read(buf)
+				if n > 0 {
+					if write(shellStdin, buf[:n]) != nil {
+						return
+					}
+				}
+				if err != nil {
+					write(shellCloseStdin, nil)
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.done)
+		p.err = readShellPackets(conn, stdout, stderr)
+	}()
+	return p, nil
+}
+
+func (p *shellProcess) Kill() error {
+	return p.conn.Close()
+}
+
+func (p *shellProcess) Wait(ctx context.Context) error {
+	select {
+	case <-p.done:
+		p.conn.Close()
+		return p.err
+	case <-task.ShouldStop(ctx):
+		p.conn.Close()
+		return task.StopReason(ctx)
+	}
+}
+
+func writeShellPacket(w io.Writer, id byte, data []byte) error {
+	header := make([]byte, 5)
+	header[0] = id
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(data)))
+	if _, err := w.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readShellPackets demultiplexes shell v2 packets until the exit packet is
+// received, returning a ShellExitError for non-zero exit codes.
+func readShellPackets(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		switch header[0] {
+		case shellStdout:
+			if _, err := stdout.Write(data); err != nil {
+				return err
+			}
+		case shellStderr:
+			if _, err := stderr.Write(data); err != nil {
+				return err
+			}
+		case shellExit:
+			if len(data) != 1 {
+				return ErrProtocol
+			}
+			if data[0] != 0 {
+				return ShellExitError{int(data[0])}
+			}
+			return nil
+		}
+	}
+}
+
+func isClosed(err error) bool {
+	return err == io.EOF || strings.Contains(err.Error(), "use of closed network connection")
+}
@@ -0,0 +1,58 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adb_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
+	"github.com/google/gapid/core/os/android/adb/fake"
+)
+
+func TestClientFeaturesInvalidated(t *testing.T) {
+	ctx := log.Testing(t)
+	start := func(features ...string) *fake.Server {
+		s, err := fake.NewServer(&fake.Script{
+			Devices: []*fake.Device{{Serial: "emulator-5554", Features: features}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to start fake adb server: %v", err)
+		}
+		return s
+	}
+
+	old := start("cmd")
+	c := adb.NewClient(old.Address())
+	features, err := c.Features(ctx, "emulator-5554")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "features").ThatSlice(features).Equals([]string{"cmd"})
+
+	// Restart the server, with a device supporting more features.
+	old.Close()
+	restarted := start("cmd", "shell_v2")
+	defer restarted.Close()
+
+	features, err = c.Features(ctx, "emulator-5554")
+	assert.For(ctx, "cached err").ThatError(err).Succeeded()
+	assert.For(ctx, "cached").ThatSlice(features).Equals([]string{"cmd"})
+
+	assert.For(ctx, "reachable").That(c.Reachable(ctx)).Equals(false)
+	c.Address = restarted.Address()
+	features, err = c.Features(ctx, "emulator-5554")
+	assert.For(ctx, "restarted err").ThatError(err).Succeeded()
+	assert.For(ctx, "restarted").ThatSlice(features).Equals([]string{"cmd", "shell_v2"})
+}
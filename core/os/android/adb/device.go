@@ -315,15 +315,7 @@ func allZero(bytes []byte) bool {
 // scanDevices returns the list of attached Android devices. It is impacted by
 // previous calls to LimitToSerial().
 func scanDevices(ctx context.Context) error {
-	exe, err := adb()
-	if err != nil {
-		return log.Err(ctx, err, "")
-	}
-	stdout, err := shell.Command(exe.System(), "devices").Call(ctx)
-	if err != nil {
-		return err
-	}
-	parsed, err := parseDevices(ctx, stdout)
+	parsed, err := listDevices(ctx)
 	if err != nil {
 		return err
 	}
@@ -362,6 +354,36 @@ func scanDevices(ctx context.Context) error {
 	return nil
 }
 
+// listDevices returns the status of the devices attached to the adb server,
+// asking the server directly when it is reachable.
+func listDevices(ctx context.Context) (map[string]bind.Status, error) {
+	if c := server(ctx); c != nil {
+		infos, err := c.Devices(ctx)
+		if err != nil {
+			return nil, err
+		}
+		devices := make(map[string]bind.Status, len(infos))
+		for _, info := range infos {
+			status, err := info.Status(ctx)
+			if err != nil {
+				return nil, err
+			}
+			devices[info.Serial] = status
+		}
+		return devices, nil
+	}
+
+	exe, err := adb()
+	if err != nil {
+		return nil, log.Err(ctx, err, "")
+	}
+	stdout, err := shell.Command(exe.System(), "devices").Call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseDevices(ctx, stdout)
+}
+
 func parseDevices(ctx context.Context, out string) (map[string]bind.Status, error) {
 	a := strings.SplitAfter(out, "List of devices attached")
 	if len(a) != 2 {
@@ -381,19 +403,11 @@ func parseDevices(ctx context.Context, out string) (map[string]bind.Status, erro
 		case 0:
 			continue
 		case 2:
-			serial, status := fields[0], fields[1]
-			switch status {
-			case "unknown":
-				devices[serial] = bind.UnknownStatus
-			case "offline":
-				devices[serial] = bind.Offline
-			case "device":
-				devices[serial] = bind.Online
-			case "unauthorized":
-				devices[serial] = bind.Unauthorized
-			default:
-				return nil, log.Errf(ctx, ErrInvalidStatus, "value: %v", status)
+			status, err := parseStatus(ctx, fields[1])
+			if err != nil {
+				return nil, err
 			}
+			devices[fields[0]] = status
 		default:
 			return nil, ErrInvalidDeviceList
 		}
@@ -401,6 +415,21 @@ func parseDevices(ctx context.Context, out string) (map[string]bind.Status, erro
 	return devices, nil
 }
 
+func parseStatus(ctx context.Context, status string) (bind.Status, error) {
+	switch status {
+	case "unknown":
+		return bind.UnknownStatus, nil
+	case "offline":
+		return bind.Offline, nil
+	case "device":
+		return bind.Online, nil
+	case "unauthorized":
+		return bind.Unauthorized, nil
+	default:
+		return bind.UnknownStatus, log.Errf(ctx, ErrInvalidStatus, "value: %v", status)
+	}
+}
+
 // NativeBridgeABI returns the native ABI for the given emulated ABI for the
 // device by consulting the ro.dalvik.vm.isa.<emulated_isa>=<native_isa>
 // system properties.
@@ -0,0 +1,150 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
+	"github.com/google/gapid/core/os/android/adb/fake"
+	"github.com/google/gapid/core/os/device/bind"
+)
+
+func newFakeServer(t *testing.T) *fake.Server {
+	s, err := fake.NewServer(&fake.Script{
+		Devices: []*fake.Device{{
+			Serial:     "emulator-5554",
+			Properties: map[string]string{"ro.product.model": "Pixel"},
+			Files:      map[string]string{"/sdcard/readme.txt": "hello"},
+		}, {
+			Serial: "0123456789ABCDEF",
+			State:  "unauthorized",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start fake adb server: %v", err)
+	}
+	return s
+}
+
+func TestClientDevices(t *testing.T) {
+	ctx := log.Testing(t)
+	s := newFakeServer(t)
+	defer s.Close()
+	c := adb.NewClient(s.Address())
+
+	assert.For(ctx, "reachable").That(c.Reachable(ctx)).Equals(true)
+
+	version, err := c.Version(ctx)
+	assert.For(ctx, "version err").ThatError(err).Succeeded()
+	assert.For(ctx, "version").That(version).Equals(41)
+
+	devices, err := c.Devices(ctx)
+	assert.For(ctx, "devices err").ThatError(err).Succeeded()
+	assert.For(ctx, "devices").ThatSlice(devices).IsLength(2)
+	assert.For(ctx, "serial").That(devices[0].Serial).Equals("emulator-5554")
+	assert.For(ctx, "model").That(devices[0].Properties["model"]).Equals("Pixel")
+	status, err := devices[1].Status(ctx)
+	assert.For(ctx, "status err").ThatError(err).Succeeded()
+	assert.For(ctx, "status").That(status).Equals(bind.Unauthorized)
+
+	_, err = c.Features(ctx, "missing")
+	assert.For(ctx, "failure").ThatError(err).HasCause(adb.ErrServerFailed)
+}
+
+func TestClientShell(t *testing.T) {
+	ctx := log.Testing(t)
+	s := newFakeServer(t)
+	defer s.Close()
+	c := adb.NewClient(s.Address())
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code, err := c.Shell(ctx, "emulator-5554", "echo hello world", nil, stdout, stderr)
+	assert.For(ctx, "echo err").ThatError(err).Succeeded()
+	assert.For(ctx, "echo code").That(code).Equals(0)
+	assert.For(ctx, "echo stdout").ThatString(stdout.String()).Equals("hello world\n")
+
+	stdout.Reset()
+	code, err = c.Shell(ctx, "emulator-5554", "cat", strings.NewReader("piped"), stdout, stderr)
+	assert.For(ctx, "cat err").ThatError(err).Succeeded()
+	assert.For(ctx, "cat stdout").ThatString(stdout.String()).Equals("piped")
+
+	code, err = c.Shell(ctx, "emulator-5554", "frobnicate", nil, stdout, stderr)
+	assert.For(ctx, "missing err").ThatError(err).Succeeded()
+	assert.For(ctx, "missing code").That(code).Equals(127)
+	assert.For(ctx, "missing stderr").ThatString(stderr.String()).Equals("/system/bin/sh: frobnicate: not found\n")
+}
+
+func TestClientSync(t *testing.T) {
+	ctx := log.Testing(t)
+	s := newFakeServer(t)
+	defer s.Close()
+	c := adb.NewClient(s.Address())
+
+	dir, err := ioutil.TempDir("", "adb_sync")
+	assert.For(ctx, "tempdir").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "data.bin")
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	assert.For(ctx, "write").ThatError(ioutil.WriteFile(local, content, 0644)).Succeeded()
+
+	err = c.Push(ctx, "emulator-5554", local, "/sdcard")
+	assert.For(ctx, "push err").ThatError(err).Succeeded()
+
+	st, err := c.Stat(ctx, "emulator-5554", "/sdcard/data.bin")
+	assert.For(ctx, "stat err").ThatError(err).Succeeded()
+	assert.For(ctx, "regular").That(st.IsRegular()).Equals(true)
+	assert.For(ctx, "size").That(int(st.Size)).Equals(len(content))
+
+	st, err = c.Stat(ctx, "emulator-5554", "/sdcard/missing")
+	assert.For(ctx, "stat missing err").ThatError(err).Succeeded()
+	assert.For(ctx, "exists").That(st.Exists()).Equals(false)
+
+	pulled := filepath.Join(dir, "pulled.bin")
+	err = c.Pull(ctx, "emulator-5554", "/sdcard/data.bin", pulled)
+	assert.For(ctx, "pull err").ThatError(err).Succeeded()
+	got, err := ioutil.ReadFile(pulled)
+	assert.For(ctx, "read").ThatError(err).Succeeded()
+	assert.For(ctx, "content").That(bytes.Equal(got, content)).Equals(true)
+
+	err = c.Pull(ctx, "emulator-5554", "/sdcard/missing", pulled)
+	assert.For(ctx, "pull missing").ThatError(err).HasCause(adb.ErrServerFailed)
+}
+
+func TestClientForward(t *testing.T) {
+	ctx := log.Testing(t)
+	s := newFakeServer(t)
+	defer s.Close()
+	c := adb.NewClient(s.Address())
+
+	assert.For(ctx, "forward").ThatError(c.Forward(ctx, "emulator-5554", "tcp:1234", "localabstract:foo")).Succeeded()
+	assert.For(ctx, "killforward").ThatError(c.RemoveForward(ctx, "emulator-5554", "tcp:1234")).Succeeded()
+	assert.For(ctx, "reverse").ThatError(c.Reverse(ctx, "emulator-5554", "tcp:80", "tcp:8080")).Succeeded()
+	assert.For(ctx, "killreverse").ThatError(c.RemoveReverse(ctx, "emulator-5554", "tcp:80")).Succeeded()
+	assert.For(ctx, "requests").ThatSlice(s.Forwards()).Equals([]string{
+		"forward:tcp:1234;localabstract:foo",
+		"killforward:tcp:1234",
+		"reverse:forward:tcp:80;tcp:8080",
+		"reverse:killforward:tcp:80",
+	})
+}
@@ -0,0 +1,22 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake provides a fake adb server serving scripted Android devices.
+//
+// The server speaks the adb wire protocol, so the devices it serves are
+// driven by the real adb package bindings. Shell commands, system properties
+// and settings, installed packages, files and Perfetto data sources are
+// declared by a Script, allowing the Android tracing and device validation
+// flows to run without a physical device.
+package fake
@@ -0,0 +1,200 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
+	"github.com/google/gapid/core/os/android/adb/fake"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/core/os/device/bind"
+)
+
+const script = `{
+  "devices": [{
+    "serial": "fake-pixel",
+    "properties": {
+      "ro.build.product": "redfin",
+      "ro.build.version.release": "11",
+      "ro.build.version.sdk": "30",
+      "ro.build.description": "redfin-user 11 RQ3A.210805.001.A1 release-keys",
+      "ro.product.cpu.abilist": "arm64-v8a,armeabi-v7a",
+      "graphics.gpu.profiler.support": "true",
+      "graphics.gpu.profiler.vulkan_layer_apk": "com.example.gpuprofiling"
+    },
+    "settings": {"global": {"angle_debug_package": "null"}},
+    "packages": [{
+      "name": "com.example.game",
+      "abi": "arm64-v8a",
+      "versionCode": 42,
+      "versionName": "4.2",
+      "minSdk": 24,
+      "targetSdk": 30,
+      "debuggable": true,
+      "activities": {"android.intent.action.MAIN": ".MainActivity"}
+    }, {
+      "name": "org.chromium.angle",
+      "versionCode": 7
+    }],
+    "files": {"/sdcard/readme.txt": "hello"},
+    "perfetto": {
+      "renderStages": true,
+      "powerRail": true,
+      "counters": [
+        {"id": 1, "name": "GPU Frequency", "selectByDefault": true},
+        {"id": 2, "name": "Fragments"}
+      ]
+    },
+    "commands": [
+      {"regex": "pidof .*", "stdout": "1234"}
+    ]
+  }]
+}`
+
+func start(t *testing.T) (*fake.Server, *bind.Registry, func()) {
+	ctx := log.Testing(t)
+	s, err := fake.ReadScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("Failed to read script: %v", err)
+	}
+	server, err := fake.NewServer(s)
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	r := bind.NewRegistry()
+	cleanup, err := fake.Register(ctx, server, r)
+	if err != nil {
+		server.Close()
+		t.Fatalf("Failed to register devices: %v", err)
+	}
+	return server, r, func() {
+		cleanup(ctx)
+		server.Close()
+	}
+}
+
+func TestDeviceConfiguration(t *testing.T) {
+	ctx := log.Testing(t)
+	server, r, stop := start(t)
+	defer stop()
+
+	assert.For(ctx, "devices").ThatSlice(r.Devices()).IsLength(1)
+	d := r.Devices()[0].(adb.Device)
+	i := d.Instance()
+	assert.For(ctx, "serial").ThatString(i.Serial).Equals("fake-pixel")
+	assert.For(ctx, "name").ThatString(i.Name).Equals("redfin")
+	assert.For(ctx, "api").That(i.Configuration.OS.APIVersion).Equals(int32(30))
+	assert.For(ctx, "abis").ThatSlice(i.Configuration.ABIs).DeepEquals([]*device.ABI{
+		device.AndroidARM64v8a, device.AndroidARMv7a,
+	})
+
+	perfetto := i.Configuration.PerfettoCapability
+	assert.For(ctx, "render stages").That(perfetto.GpuProfiling.HasRenderStage).Equals(true)
+	assert.For(ctx, "power rail").That(perfetto.HasPowerRail).Equals(true)
+	assert.For(ctx, "counters").ThatSlice(perfetto.GpuProfiling.GpuCounterDescriptor.Specs).IsLength(2)
+	assert.For(ctx, "angle").ThatString(i.Configuration.Angle.Package).Equals("org.chromium.angle")
+
+	assert.For(ctx, "traced").ThatString(server.Property("fake-pixel", "persist.traced.enable")).Equals("1")
+}
+
+func TestInstalledPackages(t *testing.T) {
+	ctx := log.Testing(t)
+	_, r, stop := start(t)
+	defer stop()
+	d := r.Devices()[0].(adb.Device)
+
+	packages, err := d.InstalledPackages(ctx)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "packages").ThatSlice(packages).IsLength(2)
+
+	game := packages.FindByName("com.example.game")
+	assert.For(ctx, "debuggable").That(game.Debuggable).Equals(true)
+	assert.For(ctx, "version").That(game.VersionCode).Equals(42)
+	assert.For(ctx, "abi").That(game.ABI).Equals(device.AndroidARM64v8a)
+	assert.For(ctx, "activity").ThatString(game.ActivityActions[0].Activity).Equals("com.example.game.MainActivity")
+}
+
+func TestPrepareGpuProfiling(t *testing.T) {
+	ctx := log.Testing(t)
+	server, r, stop := start(t)
+	defer stop()
+	d := r.Devices()[0].(adb.Device)
+
+	game, err := d.InstalledPackage(ctx, "com.example.game")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	supported, layers, cleanup, err := d.PrepareGpuProfiling(ctx, game)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "supported").That(supported).Equals(true)
+	assert.For(ctx, "layers").ThatString(layers).Equals("com.example.gpuprofiling")
+	assert.For(ctx, "debug property").ThatString(server.Property("fake-pixel", "debug.graphics.gpu.profiler.perfetto")).Equals("1")
+
+	cleanup(ctx)
+	assert.For(ctx, "debug property").ThatString(server.Property("fake-pixel", "debug.graphics.gpu.profiler.perfetto")).Equals("")
+}
+
+func TestShellAndFiles(t *testing.T) {
+	ctx := log.Testing(t)
+	server, r, stop := start(t)
+	defer stop()
+	d := r.Devices()[0].(adb.Device)
+
+	pid, err := d.Shell("pidof", "com.example.game").Call(ctx)
+	assert.For(ctx, "scripted err").ThatError(err).Succeeded()
+	assert.For(ctx, "scripted").ThatString(pid).Equals("1234")
+
+	out, err := d.Shell("echo", "hi", "|", "base64").Call(ctx)
+	assert.For(ctx, "pipe err").ThatError(err).Succeeded()
+	assert.For(ctx, "pipe").ThatString(out).Equals("aGkK")
+
+	_, err = d.Shell("frobnicate").Call(ctx)
+	assert.For(ctx, "unknown").ThatError(err).Failed()
+
+	dir, err := ioutil.TempDir("", "fake_adb")
+	assert.For(ctx, "tempdir").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "readme.txt")
+	assert.For(ctx, "pull").ThatError(d.Pull(ctx, "/sdcard/readme.txt", local)).Succeeded()
+	content, err := ioutil.ReadFile(local)
+	assert.For(ctx, "read").ThatError(err).Succeeded()
+	assert.For(ctx, "content").ThatString(string(content)).Equals("hello")
+
+	assert.For(ctx, "push").ThatError(d.Push(ctx, local, "/data/local/tmp/copy.txt")).Succeeded()
+	pushed, ok := server.File("fake-pixel", "/data/local/tmp/copy.txt")
+	assert.For(ctx, "pushed").That(ok).Equals(true)
+	assert.For(ctx, "pushed content").ThatString(string(pushed)).Equals("hello")
+
+	ls, err := d.Shell("ls", "/data/local/tmp").Call(ctx)
+	assert.For(ctx, "ls err").ThatError(err).Succeeded()
+	assert.For(ctx, "ls").ThatString(ls).Equals("copy.txt")
+}
+
+func TestRegisterTwice(t *testing.T) {
+	ctx := log.Testing(t)
+	server, _, stop := start(t)
+	defer stop()
+
+	_, err := fake.Register(ctx, server, bind.NewRegistry())
+	assert.For(ctx, "err").ThatError(err).Failed()
+	assert.For(ctx, "address").That(adb.ServerAddress()).Equals(server.Address())
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
+	"github.com/google/gapid/core/os/device/bind"
+)
+
+var (
+	registered      *Server
+	registeredMutex sync.Mutex
+)
+
+// Register points the adb package to the server, and adds the devices it
+// serves to the registry r. The returned cleanup removes the devices from r
+// and restores the previous adb server address.
+//
+// The adb server address is global to the process, so while a server is
+// registered every adb device of the process talks to it. Only one server can
+// be registered at a time, Register fails if another one is registered.
+func Register(ctx context.Context, s *Server, r *bind.Registry) (app.Cleanup, error) {
+	registeredMutex.Lock()
+	defer registeredMutex.Unlock()
+	if registered != nil {
+		return nil, log.Errf(ctx, nil, "Fake adb server %v is already registered", registered.Address())
+	}
+
+	old := adb.SetServerAddress(s.Address())
+	devices, err := adb.Devices(ctx)
+	if err != nil {
+		adb.SetServerAddress(old)
+		return nil, err
+	}
+	for _, d := range devices {
+		r.AddDevice(ctx, d)
+	}
+	registered = s
+
+	return func(ctx context.Context) {
+		for _, d := range devices {
+			r.RemoveDevice(ctx, d)
+		}
+		// Scan the devices while unplugged to evict them from the adb cache.
+		s.setUnplugged(true)
+		adb.Devices(ctx)
+		s.setUnplugged(false)
+		adb.SetServerAddress(old)
+
+		registeredMutex.Lock()
+		registered = nil
+		registeredMutex.Unlock()
+	}, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+)
+
+// Script declares the devices served by a fake adb server.
+type Script struct {
+	Devices []*Device `json:"devices"`
+}
+
+// Device declares the state of a fake Android device.
+type Device struct {
+	// Serial is the serial of the device.
+	Serial string `json:"serial"`
+	// State is the connection state reported by the adb server, such as
+	// "device", "offline" or "unauthorized". Defaults to "device".
+	State string `json:"state"`
+	// Features lists the adb features supported by the device. Defaults to
+	// DefaultFeatures.
+	Features []string `json:"features"`
+	// Properties holds the system properties returned by getprop.
+	Properties map[string]string `json:"properties"`
+	// Settings holds the system settings, indexed by namespace then key.
+	Settings map[string]map[string]string `json:"settings"`
+	// Packages lists the installed packages.
+	Packages []*Package `json:"packages"`
+	// Files holds the content of the files on the device, indexed by path.
+	Files map[string]string `json:"files"`
+	// Services lists the names returned by "service list".
+	Services []string `json:"services"`
+	// Perfetto describes the Perfetto data sources available on the device.
+	Perfetto *Perfetto `json:"perfetto"`
+	// Commands lists scripted shell commands. They take precedence over the
+	// commands emulated by the fake device.
+	Commands []*Command `json:"commands"`
+}
+
+// Package declares an installed package.
+type Package struct {
+	Name        string `json:"name"`
+	ABI         string `json:"abi"`
+	VersionCode int    `json:"versionCode"`
+	VersionName string `json:"versionName"`
+	MinSDK      int    `json:"minSdk"`
+	TargetSDK   int    `json:"targetSdk"`
+	Debuggable  bool   `json:"debuggable"`
+	// Path is the path of the package's APK. Defaults to
+	// /data/app/<name>/base.apk.
+	Path string `json:"path"`
+	// Activities maps intent action names to activity names.
+	Activities map[string]string `json:"activities"`
+	// Services maps intent action names to service names.
+	Services map[string]string `json:"services"`
+}
+
+// Perfetto declares the Perfetto data sources registered on the device.
+type Perfetto struct {
+	// RenderStages registers the gpu.renderstages data source.
+	RenderStages bool `json:"renderStages"`
+	// GpuMemTotal registers the android.gpu.memory data source.
+	GpuMemTotal bool `json:"gpuMemTotal"`
+	// PowerRail registers the power stats HAL service.
+	PowerRail bool `json:"powerRail"`
+	// Counters lists the GPU counters of the gpu.counters data source.
+	Counters []*Counter `json:"counters"`
+	// DataSources lists additional data source names.
+	DataSources []string `json:"dataSources"`
+	// Trace is the content of the trace file written by a Perfetto tracing
+	// session. It is base64 encoded in JSON scripts.
+	Trace []byte `json:"trace"`
+}
+
+// Counter declares a GPU counter.
+type Counter struct {
+	ID              uint32 `json:"id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	SelectByDefault bool   `json:"selectByDefault"`
+}
+
+// Command declares the result of a shell command.
+type Command struct {
+	// Command is the full command line to match.
+	Command string `json:"command"`
+	// Regex, if set, is matched against the full command line instead of
+	// Command.
+	Regex    string `json:"regex"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exitCode"`
+
+	re *regexp.Regexp
+}
+
+// DefaultFeatures are the adb features of a device that does not declare any.
+var DefaultFeatures = []string{"shell_v2", "cmd", "stat_v2"}
+
+// ReadScript reads a JSON encoded Script from r.
+func ReadScript(r io.Reader) (*Script, error) {
+	s := &Script{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *Command) compile() error {
+	if c.Regex == "" {
+		return nil
+	}
+	re, err := regexp.Compile("^(?:" + c.Regex + ")$")
+	if err != nil {
+		return err
+	}
+	c.re = re
+	return nil
+}
+
+func (c *Command) matches(command string) bool {
+	if c.re != nil {
+		return c.re.MatchString(command)
+	}
+	return c.Command == command
+}
@@ -0,0 +1,469 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// serverVersion is the adb server version reported by host:version.
+	serverVersion = 41
+
+	// Packet identifiers of the shell v2 protocol.
+	shellStdin      = 0
+	shellStdout     = 1
+	shellStderr     = 2
+	shellExit       = 3
+	shellCloseStdin = 4
+
+	syncModeDir     = 0040755
+	syncModeRegular = 0100644
+)
+
+// Server is a fake adb server speaking the adb wire protocol on a local TCP
+// port, serving the devices declared by a Script.
+type Server struct {
+	listener net.Listener
+	devices  []*device
+
+	mutex     sync.Mutex
+	forwards  []string
+	unplugged bool
+}
+
+// device is the mutable state of a scripted Device.
+type device struct {
+	decl Device
+
+	mutex      sync.Mutex
+	properties map[string]string
+	settings   map[string]map[string]string
+	files      map[string][]byte
+	commands   []string
+}
+
+// NewServer starts a fake adb server listening on a free local port, serving
+// the devices of script. The server runs until Close is called.
+func NewServer(script *Script) (*Server, error) {
+	s := &Server{}
+	for _, decl := range script.Devices {
+		d, err := newDevice(decl)
+		if err != nil {
+			return nil, err
+		}
+		s.devices = append(s.devices, d)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s.listener = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, nil
+}
+
+func newDevice(decl *Device) (*device, error) {
+	d := &device{
+		decl:       *decl,
+		properties: map[string]string{},
+		settings:   map[string]map[string]string{},
+		files:      map[string][]byte{},
+	}
+	if d.decl.State == "" {
+		d.decl.State = "device"
+	}
+	if d.decl.Features == nil {
+		d.decl.Features = DefaultFeatures
+	}
+	for k, v := range decl.Properties {
+		d.properties[k] = v
+	}
+	for ns, kv := range decl.Settings {
+		d.settings[ns] = map[string]string{}
+		for k, v := range kv {
+			d.settings[ns][k] = v
+		}
+	}
+	for path, content := range decl.Files {
+		d.files[path] = []byte(content)
+	}
+	for _, c := range decl.Commands {
+		if err := c.compile(); err != nil {
+			return nil, fmt.Errorf("Invalid command regex %q: %v", c.Regex, err)
+		}
+	}
+	return d, nil
+}
+
+// Address returns the host:port address the server is listening on.
+func (s *Server) Address() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// Commands returns the shell commands run on the device with the given
+// serial, in order.
+func (s *Server) Commands(serial string) []string {
+	d := s.device(serial)
+	if d == nil {
+		return nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]string{}, d.commands...)
+}
+
+// Property returns the current value of a system property of the device with
+// the given serial.
+func (s *Server) Property(serial, name string) string {
+	d := s.device(serial)
+	if d == nil {
+		return ""
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.properties[name]
+}
+
+// Setting returns the current value of a system setting of the device with
+// the given serial.
+func (s *Server) Setting(serial, namespace, key string) (string, bool) {
+	d := s.device(serial)
+	if d == nil {
+		return "", false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	v, ok := d.settings[namespace][key]
+	return v, ok
+}
+
+// File returns the content of a file on the device with the given serial.
+func (s *Server) File(serial, path string) ([]byte, bool) {
+	d := s.device(serial)
+	if d == nil {
+		return nil, false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	content, ok := d.files[path]
+	return content, ok
+}
+
+// Forwards returns the forward and reverse requests received by the server,
+// in order.
+func (s *Server) Forwards() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.forwards...)
+}
+
+func (s *Server) setUnplugged(unplugged bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unplugged = unplugged
+}
+
+func (s *Server) listed() []*device {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.unplugged {
+		return nil
+	}
+	return s.devices
+}
+
+func (s *Server) device(serial string) *device {
+	for _, d := range s.devices {
+		if d.decl.Serial == serial {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *Server) recordForward(request string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.forwards = append(s.forwards, request)
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	req, err := readRequest(conn)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case req == "host:version":
+		okay(conn, fmt.Sprintf("%04x", serverVersion))
+	case req == "host:devices", req == "host:devices-l":
+		buf := &bytes.Buffer{}
+		for _, d := range s.listed() {
+			fmt.Fprintf(buf, "%-22s %s", d.decl.Serial, d.decl.State)
+			if req == "host:devices-l" {
+				d.mutex.Lock()
+				fmt.Fprintf(buf, " product:%s model:%s device:%s",
+					d.properties["ro.product.name"], d.properties["ro.product.model"], d.properties["ro.product.device"])
+				d.mutex.Unlock()
+			}
+			buf.WriteString("\n")
+		}
+		okay(conn, buf.String())
+	case strings.HasPrefix(req, "host-serial:"):
+		parts := strings.SplitN(strings.TrimPrefix(req, "host-serial:"), ":", 2)
+		d := s.device(parts[0])
+		if d == nil || len(parts) != 2 {
+			fail(conn, fmt.Sprintf("device '%s' not found", parts[0]))
+			return
+		}
+		switch service := parts[1]; {
+		case service == "features":
+			okay(conn, strings.Join(d.decl.Features, ","))
+		case service == "get-state":
+			okay(conn, d.decl.State)
+		case strings.HasPrefix(service, "forward:"), strings.HasPrefix(service, "killforward:"):
+			s.recordForward(service)
+			conn.Write([]byte("OKAYOKAY"))
+		default:
+			fail(conn, "unsupported service "+service)
+		}
+	case strings.HasPrefix(req, "host:transport:"):
+		d := s.device(strings.TrimPrefix(req, "host:transport:"))
+		if d == nil {
+			fail(conn, fmt.Sprintf("device '%s' not found", strings.TrimPrefix(req, "host:transport:")))
+			return
+		}
+		conn.Write([]byte("OKAY"))
+		s.serveDevice(conn, d)
+	default:
+		fail(conn, "unsupported request "+req)
+	}
+}
+
+func (s *Server) serveDevice(conn net.Conn, d *device) {
+	req, err := readRequest(conn)
+	if err != nil {
+		return
+	}
+	switch {
+	case strings.HasPrefix(req, "shell,v2,raw:"), strings.HasPrefix(req, "shell,v2:"):
+		conn.Write([]byte("OKAY"))
+		d.serveShellV2(conn, req[strings.Index(req, ":")+1:])
+	case strings.HasPrefix(req, "shell:"):
+		conn.Write([]byte("OKAY"))
+		stdout, stderr, _ := d.run(strings.TrimPrefix(req, "shell:"), nil)
+		conn.Write(stdout)
+		conn.Write(stderr)
+	case req == "sync:":
+		conn.Write([]byte("OKAY"))
+		d.serveSync(conn)
+	case strings.HasPrefix(req, "reverse:"):
+		s.recordForward(req)
+		conn.Write([]byte("OKAYOKAY"))
+	default:
+		fail(conn, "unsupported service "+req)
+	}
+}
+
+func (d *device) serveShellV2(conn net.Conn, command string) {
+	stdin := &bytes.Buffer{}
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		if header[0] == shellCloseStdin {
+			break
+		}
+		if header[0] == shellStdin {
+			stdin.Write(data)
+		}
+	}
+	stdout, stderr, code := d.run(command, stdin.Bytes())
+	if len(stdout) > 0 {
+		writePacket(conn, shellStdout, stdout)
+	}
+	if len(stderr) > 0 {
+		writePacket(conn, shellStderr, stderr)
+	}
+	writePacket(conn, shellExit, []byte{byte(code)})
+}
+
+func (d *device) serveSync(conn net.Conn) {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		id, length := string(header[:4]), binary.LittleEndian.Uint32(header[4:])
+		data := make([]byte, length)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		switch id {
+		case "STAT":
+			mode, size := d.stat(string(data))
+			res := make([]byte, 16)
+			copy(res, "STAT")
+			binary.LittleEndian.PutUint32(res[4:], mode)
+			binary.LittleEndian.PutUint32(res[8:], size)
+			binary.LittleEndian.PutUint32(res[12:], uint32(time.Now().Unix()))
+			conn.Write(res)
+		case "SEND":
+			path := strings.SplitN(string(data), ",", 2)[0]
+			content := &bytes.Buffer{}
+			for {
+				if _, err := io.ReadFull(conn, header); err != nil {
+					return
+				}
+				if string(header[:4]) == "DONE" {
+					break
+				}
+				if _, err := io.CopyN(content, conn, int64(binary.LittleEndian.Uint32(header[4:]))); err != nil {
+					return
+				}
+			}
+			d.mutex.Lock()
+			d.files[path] = content.Bytes()
+			d.mutex.Unlock()
+			conn.Write(syncPacket("OKAY", nil))
+		case "RECV":
+			d.mutex.Lock()
+			content, ok := d.files[string(data)]
+			d.mutex.Unlock()
+			if !ok {
+				conn.Write(syncPacket("FAIL", []byte("No such file or directory")))
+				continue
+			}
+			conn.Write(syncPacket("DATA", content))
+			conn.Write(syncPacket("DONE", nil))
+		case "QUIT":
+			return
+		default:
+			conn.Write(syncPacket("FAIL", []byte("unsupported sync request "+id)))
+			return
+		}
+	}
+}
+
+// stat returns the sync mode and size of the file at path, or zeros if it
+// does not exist. Any path prefixing an existing file is a directory.
+func (d *device) stat(path string) (uint32, uint32) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if content, ok := d.files[path]; ok {
+		return syncModeRegular, uint32(len(content))
+	}
+	if d.isDir(path) {
+		return syncModeDir, 0
+	}
+	return 0, 0
+}
+
+func (d *device) isDir(path string) bool {
+	if path == "/" {
+		return true
+	}
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	for f := range d.files {
+		if strings.HasPrefix(f, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the names of the entries of the directory at path.
+func (d *device) list(path string) []string {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	seen := map[string]bool{}
+	names := []string{}
+	for f := range d.files {
+		if !strings.HasPrefix(f, prefix) {
+			continue
+		}
+		name := strings.SplitN(strings.TrimPrefix(f, prefix), "/", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readRequest(r io.Reader) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	n, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, n)
+	_, err = io.ReadFull(r, data)
+	return string(data), err
+}
+
+func okay(w io.Writer, s string) {
+	fmt.Fprintf(w, "OKAY%04x%s", len(s), s)
+}
+
+func fail(w io.Writer, s string) {
+	fmt.Fprintf(w, "FAIL%04x%s", len(s), s)
+}
+
+func writePacket(w io.Writer, id byte, data []byte) {
+	header := make([]byte, 5)
+	header[0] = id
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(data)))
+	w.Write(append(header, data...))
+}
+
+func syncPacket(id string, data []byte) []byte {
+	header := make([]byte, 8)
+	copy(header, id)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(data)))
+	return append(header, data...)
+}
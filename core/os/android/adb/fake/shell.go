@@ -0,0 +1,441 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	common_pb "protos/perfetto/common"
+)
+
+const (
+	exitNotFound = 127
+
+	powerStatsService = "android.hardware.power.stats.IPowerStats/default"
+)
+
+// builtin emulates a shell command of the device. It is called with the
+// device mutex held.
+type builtin func(d *device, args []string, stdin []byte) (stdout, stderr []byte, code int)
+
+var builtins map[string]builtin
+
+func init() {
+	builtins = map[string]builtin{
+		"am":       silent,
+		"base64":   (*device).base64,
+		"cat":      (*device).cat,
+		"cmd":      silent,
+		"dumpsys":  (*device).dumpsys,
+		"echo":     (*device).echo,
+		"getprop":  (*device).getprop,
+		"id":       (*device).id,
+		"input":    silent,
+		"ls":       (*device).ls,
+		"perfetto": (*device).perfetto,
+		"pm":       (*device).pm,
+		"rm":       (*device).rm,
+		"service":  (*device).service,
+		"setprop":  (*device).setprop,
+		"settings": (*device).systemSettings,
+		"wm":       silent,
+	}
+}
+
+// run executes command on the device, returning its output and exit code.
+// Scripted commands are matched against the full command line first, then
+// the command line is split into a pipeline of emulated commands.
+func (d *device) run(command string, stdin []byte) (stdout, stderr []byte, code int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.commands = append(d.commands, command)
+
+	for _, c := range d.decl.Commands {
+		if c.matches(command) {
+			return []byte(c.Stdout), []byte(c.Stderr), c.ExitCode
+		}
+	}
+
+	errs := &bytes.Buffer{}
+	for _, stage := range strings.Split(command, "|") {
+		args := splitArgs(stage)
+		redirect := ""
+		if n := len(args); n >= 2 && args[n-2] == ">" {
+			redirect, args = args[n-1], args[:n-2]
+		}
+		if len(args) == 0 {
+			continue
+		}
+		f, ok := builtins[args[0]]
+		if !ok {
+			fmt.Fprintf(errs, "/system/bin/sh: %s: not found\n", args[0])
+			return nil, errs.Bytes(), exitNotFound
+		}
+		out, err, c := f(d, args[1:], stdin)
+		errs.Write(err)
+		if c != 0 {
+			return out, errs.Bytes(), c
+		}
+		if redirect != "" {
+			d.files[redirect] = out
+			out = nil
+		}
+		stdin = out
+	}
+	return stdin, errs.Bytes(), 0
+}
+
+// splitArgs splits a command line on whitespace, honoring simple quoting.
+func splitArgs(s string) []string {
+	args := []string{}
+	cur, quote, inArg := &strings.Builder{}, rune(0), false
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+func lines(l ...string) []byte {
+	if len(l) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(l, "\n") + "\n")
+}
+
+func failure(code int, format string, args ...interface{}) ([]byte, []byte, int) {
+	return nil, []byte(fmt.Sprintf(format+"\n", args...)), code
+}
+
+func silent(d *device, args []string, stdin []byte) ([]byte, []byte, int) {
+	return nil, nil, 0
+}
+
+func (d *device) echo(args []string, stdin []byte) ([]byte, []byte, int) {
+	return lines(strings.Join(args, " ")), nil, 0
+}
+
+func (d *device) id(args []string, stdin []byte) ([]byte, []byte, int) {
+	return lines("uid=2000(shell) gid=2000(shell) groups=2000(shell)"), nil, 0
+}
+
+func (d *device) cat(args []string, stdin []byte) ([]byte, []byte, int) {
+	if len(args) == 0 {
+		return stdin, nil, 0
+	}
+	out := []byte{}
+	for _, path := range args {
+		content, ok := d.files[path]
+		if !ok {
+			return failure(1, "cat: %s: No such file or directory", path)
+		}
+		out = append(out, content...)
+	}
+	return out, nil, 0
+}
+
+func (d *device) ls(args []string, stdin []byte) ([]byte, []byte, int) {
+	out := []string{}
+	for _, path := range args {
+		if strings.HasPrefix(path, "-") {
+			continue
+		}
+		switch {
+		case d.hasFile(path):
+			out = append(out, path)
+		case d.isDir(path):
+			out = append(out, d.list(path)...)
+		default:
+			return failure(1, "ls: %s: No such file or directory", path)
+		}
+	}
+	return lines(out...), nil, 0
+}
+
+func (d *device) hasFile(path string) bool {
+	_, ok := d.files[path]
+	return ok
+}
+
+func (d *device) rm(args []string, stdin []byte) ([]byte, []byte, int) {
+	force := false
+	for _, path := range args {
+		if strings.HasPrefix(path, "-") {
+			force = force || strings.Contains(path, "f")
+			continue
+		}
+		if _, ok := d.files[path]; !ok && !force {
+			return failure(1, "rm: %s: No such file or directory", path)
+		}
+		delete(d.files, path)
+	}
+	return nil, nil, 0
+}
+
+func (d *device) base64(args []string, stdin []byte) ([]byte, []byte, int) {
+	if len(args) > 0 && args[0] == "-d" {
+		out, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(stdin)))
+		if err != nil {
+			return failure(1, "base64: %v", err)
+		}
+		return out, nil, 0
+	}
+	return lines(base64.StdEncoding.EncodeToString(stdin)), nil, 0
+}
+
+func (d *device) getprop(args []string, stdin []byte) ([]byte, []byte, int) {
+	if len(args) > 0 {
+		return lines(d.properties[args[0]]), nil, 0
+	}
+	names := make([]string, 0, len(d.properties))
+	for name := range d.properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = fmt.Sprintf("[%s]: [%s]", name, d.properties[name])
+	}
+	return lines(out...), nil, 0
+}
+
+func (d *device) setprop(args []string, stdin []byte) ([]byte, []byte, int) {
+	if len(args) != 2 {
+		return failure(1, "usage: setprop NAME VALUE")
+	}
+	d.properties[args[0]] = args[1]
+	return nil, nil, 0
+}
+
+func (d *device) systemSettings(args []string, stdin []byte) ([]byte, []byte, int) {
+	if len(args) < 3 {
+		return failure(1, "usage: settings get|put|delete NAMESPACE KEY [VALUE]")
+	}
+	verb, ns, key := args[0], args[1], args[2]
+	switch {
+	case verb == "get":
+		if v, ok := d.settings[ns][key]; ok {
+			return lines(v), nil, 0
+		}
+		return lines("null"), nil, 0
+	case verb == "put" && len(args) == 4:
+		if d.settings[ns] == nil {
+			d.settings[ns] = map[string]string{}
+		}
+		d.settings[ns][key] = args[3]
+		return nil, nil, 0
+	case verb == "delete":
+		if _, ok := d.settings[ns][key]; !ok {
+			return lines("Deleted 0 rows"), nil, 0
+		}
+		delete(d.settings[ns], key)
+		return lines("Deleted 1 rows"), nil, 0
+	default:
+		return failure(1, "settings: invalid command %v", strings.Join(args, " "))
+	}
+}
+
+func (d *device) service(args []string, stdin []byte) ([]byte, []byte, int) {
+	if len(args) == 0 || args[0] != "list" {
+		return failure(1, "usage: service list")
+	}
+	services := append([]string{}, d.decl.Services...)
+	if d.decl.Perfetto != nil && d.decl.Perfetto.PowerRail {
+		services = append(services, powerStatsService)
+	}
+	out := []string{fmt.Sprintf("Found %d services:", len(services))}
+	for i, s := range services {
+		out = append(out, fmt.Sprintf("%d\t%s: []", i, s))
+	}
+	return lines(out...), nil, 0
+}
+
+func (d *device) pm(args []string, stdin []byte) ([]byte, []byte, int) {
+	switch {
+	case len(args) == 2 && args[0] == "path":
+		if p := d.findPackage(args[1]); p != nil {
+			return lines("package:" + p.path()), nil, 0
+		}
+		return nil, nil, 1
+	case len(args) >= 2 && args[0] == "list" && args[1] == "packages":
+		out := []string{}
+		for _, p := range d.decl.Packages {
+			out = append(out, "package:"+p.Name)
+		}
+		return lines(out...), nil, 0
+	default:
+		return failure(1, "pm: unsupported command %v", strings.Join(args, " "))
+	}
+}
+
+func (d *device) findPackage(name string) *Package {
+	for _, p := range d.decl.Packages {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (p *Package) path() string {
+	if p.Path != "" {
+		return p.Path
+	}
+	return "/data/app/" + p.Name + "/base.apk"
+}
+
+// dumpsys emulates "dumpsys package [name]" in the format parsed by
+// adb.Device.InstalledPackages. Other services produce no output.
+func (d *device) dumpsys(args []string, stdin []byte) ([]byte, []byte, int) {
+	if len(args) == 0 || args[0] != "package" {
+		return nil, nil, 0
+	}
+	packages := d.decl.Packages
+	if len(args) > 1 {
+		packages = nil
+		if p := d.findPackage(args[1]); p != nil {
+			packages = []*Package{p}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	resolverTable := func(title string, get func(p *Package) map[string]string) {
+		actions := map[string][]string{}
+		for i, p := range packages {
+			for action, component := range get(p) {
+				if !strings.Contains(component, "/") {
+					component = p.Name + "/" + component
+				}
+				actions[action] = append(actions[action], fmt.Sprintf("%08x %s filter %08x", i+1, component, i+1))
+			}
+		}
+		if len(actions) == 0 {
+			return
+		}
+		names := make([]string, 0, len(actions))
+		for name := range actions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(buf, "%s\n  Non-Data Actions:\n", title)
+		for _, name := range names {
+			fmt.Fprintf(buf, "    %s:\n", name)
+			for _, entry := range actions[name] {
+				fmt.Fprintf(buf, "      %s\n", entry)
+			}
+		}
+		buf.WriteString("\n")
+	}
+	resolverTable("Activity Resolver Table:", func(p *Package) map[string]string { return p.Activities })
+	resolverTable("Service Resolver Table:", func(p *Package) map[string]string { return p.Services })
+
+	buf.WriteString("Packages:\n")
+	for i, p := range packages {
+		abi := p.ABI
+		if abi == "" {
+			abi = "null"
+		}
+		flags := "HAS_CODE ALLOW_CLEAR_USER_DATA"
+		if p.Debuggable {
+			flags = "DEBUGGABLE " + flags
+		}
+		fmt.Fprintf(buf, "  Package [%s] (%08x):\n", p.Name, i+1)
+		fmt.Fprintf(buf, "    userId=%d\n", 10000+i)
+		fmt.Fprintf(buf, "    codePath=%s\n", p.path())
+		fmt.Fprintf(buf, "    primaryCpuAbi=%s\n", abi)
+		fmt.Fprintf(buf, "    versionCode=%d minSdk=%d targetSdk=%d\n", p.VersionCode, p.MinSDK, p.TargetSDK)
+		fmt.Fprintf(buf, "    versionName=%s\n", p.VersionName)
+		fmt.Fprintf(buf, "    flags=[ %s ]\n", flags)
+	}
+	return buf.Bytes(), nil, 0
+}
+
+// perfetto emulates "perfetto --query-raw", returning the serialized
+// TracingServiceState of the scripted data sources, and "perfetto -c - -o
+// <path>", writing the scripted trace to path.
+func (d *device) perfetto(args []string, stdin []byte) ([]byte, []byte, int) {
+	if len(args) == 4 && args[0] == "-c" && args[1] == "-" && args[2] == "-o" {
+		trace := []byte{}
+		if d.decl.Perfetto != nil {
+			trace = d.decl.Perfetto.Trace
+		}
+		d.files[args[3]] = trace
+		return nil, nil, 0
+	}
+	if len(args) == 0 || args[0] != "--query-raw" {
+		return failure(1, "perfetto: unsupported arguments %v", strings.Join(args, " "))
+	}
+	state := &common_pb.TracingServiceState{}
+	add := func(desc *common_pb.DataSourceDescriptor) {
+		state.DataSources = append(state.DataSources, &common_pb.TracingServiceState_DataSource{
+			DsDescriptor: desc,
+		})
+	}
+	if p := d.decl.Perfetto; p != nil {
+		if p.RenderStages {
+			add(&common_pb.DataSourceDescriptor{Name: proto.String("gpu.renderstages")})
+		}
+		if p.GpuMemTotal {
+			add(&common_pb.DataSourceDescriptor{Name: proto.String("android.gpu.memory")})
+		}
+		if len(p.Counters) > 0 {
+			counters := &common_pb.GpuCounterDescriptor{}
+			for _, c := range p.Counters {
+				counters.Specs = append(counters.Specs, &common_pb.GpuCounterDescriptor_GpuCounterSpec{
+					CounterId:       proto.Uint32(c.ID),
+					Name:            proto.String(c.Name),
+					Description:     proto.String(c.Description),
+					SelectByDefault: proto.Bool(c.SelectByDefault),
+				})
+			}
+			add(&common_pb.DataSourceDescriptor{
+				Name:                 proto.String("gpu.counters"),
+				GpuCounterDescriptor: counters,
+			})
+		}
+		for _, name := range p.DataSources {
+			add(&common_pb.DataSourceDescriptor{Name: proto.String(name)})
+		}
+	}
+	out, err := proto.Marshal(state)
+	if err != nil {
+		return failure(1, "perfetto: %v", err)
+	}
+	return out, nil, 0
+}
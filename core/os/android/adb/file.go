@@ -14,14 +14,31 @@
 
 package adb
 
-import "context"
+import (
+	"context"
+	"os"
+)
 
 // Pushes the local file to the remote one.
 func (b *binding) Push(ctx context.Context, local, remote string) error {
+	if c := server(ctx); c != nil && isRegularFile(local) {
+		return c.Push(ctx, b.To.Serial, local, remote)
+	}
 	return b.Command("push", local, remote).Run(ctx)
 }
 
 // Pulls the remote file to the local one.
 func (b *binding) Pull(ctx context.Context, remote, local string) error {
+	if c := server(ctx); c != nil {
+		// Directories are pulled recursively by the adb executable.
+		if st, err := c.Stat(ctx, b.To.Serial, remote); err == nil && st.IsRegular() {
+			return c.Pull(ctx, b.To.Serial, remote, local)
+		}
+	}
 	return b.Command("pull", remote, local).Run(ctx)
 }
+
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -76,6 +76,9 @@ func (p NamedFileSystemSocket) adbForwardString() string {
 
 // Forward will forward the specified device Port to the specified local Port.
 func (b *binding) Forward(ctx context.Context, local, device Port) error {
+	if c := server(ctx); c != nil {
+		return c.Forward(ctx, b.To.Serial, local.adbForwardString(), device.adbForwardString())
+	}
 	return b.Command("forward", local.adbForwardString(), device.adbForwardString()).Run(ctx)
 }
 
@@ -83,5 +86,26 @@ func (b *binding) Forward(ctx context.Context, local, device Port) error {
 func (b *binding) RemoveForward(ctx context.Context, local Port) error {
 	// Clone context to ignore cancellation.
 	ctx = keys.Clone(context.Background(), ctx)
+	if c := server(ctx); c != nil {
+		return c.RemoveForward(ctx, b.To.Serial, local.adbForwardString())
+	}
 	return b.Command("forward", "--remove", local.adbForwardString()).Run(ctx)
 }
+
+// Reverse will forward the specified local Port to the specified device Port.
+func (b *binding) Reverse(ctx context.Context, device, local Port) error {
+	if c := server(ctx); c != nil {
+		return c.Reverse(ctx, b.To.Serial, device.adbForwardString(), local.adbForwardString())
+	}
+	return b.Command("reverse", device.adbForwardString(), local.adbForwardString()).Run(ctx)
+}
+
+// RemoveReverse removes a reverse port forward made by Reverse.
+func (b *binding) RemoveReverse(ctx context.Context, device Port) error {
+	// Clone context to ignore cancellation.
+	ctx = keys.Clone(context.Background(), ctx)
+	if c := server(ctx); c != nil {
+		return c.RemoveReverse(ctx, b.To.Serial, device.adbForwardString())
+	}
+	return b.Command("reverse", "--remove", device.adbForwardString()).Run(ctx)
+}
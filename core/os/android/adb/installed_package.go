@@ -169,6 +169,8 @@ func (b *binding) parsePackages(str string) (android.InstalledPackages, error) {
 						ip.MinSDK, _ = strconv.Atoi(match[2])
 						ip.TargetSdk, _ = strconv.Atoi(match[3])
 					}
+				case strings.HasPrefix(av, "userId="):
+					ip.UserID, _ = strconv.Atoi(splits[1])
 				case strings.HasPrefix(av, "versionName="):
 					ip.VersionName = splits[1]
 				case strings.HasPrefix(av, "primaryCpuAbi="):
@@ -34,6 +34,7 @@ func TestParsePackages(t_ *testing.T) {
 		VersionCode:    902107,
 		MinSDK:         14,
 		TargetSdk:      15,
+		UserID:         12345,
 		ServiceActions: android.ServiceActions{},
 	}
 	p0.ActivityActions = android.ActivityActions{
@@ -60,6 +61,7 @@ func TestParsePackages(t_ *testing.T) {
 		VersionCode:    123456,
 		MinSDK:         0,
 		TargetSdk:      15,
+		UserID:         34567,
 		ServiceActions: android.ServiceActions{},
 	}
 	p1.ActivityActions = android.ActivityActions{
@@ -31,7 +31,13 @@ import (
 // "[ MM-DD HH:MM:SS.FFF  PID: TID P/TAG ]"
 var logcatMsgRegex = regexp.MustCompile(`\[\s*([0-9]*)-([0-9]*)\s*([0-9]*):([0-9]*):([0-9]*).([0-9]*)\s*([0-9]*):\s*([0-9]*)\s*([VDIWEF])\/([^\s]*)\s*\]`)
 
+// "[ SSSSSSSSSS.FFF  PID: TID P/TAG ]", as printed with "-v long,epoch"
+var logcatEpochMsgRegex = regexp.MustCompile(`^\[\s*([0-9]+)\.([0-9]+)\s+([0-9]+):\s*([0-9]+)\s*([VDIWEF])\/([^\s]*)\s*\]`)
+
 func parseLogcatMsg(s string) (android.LogcatMessage, bool) {
+	if m, ok := parseLogcatEpochMsg(s); ok {
+		return m, true
+	}
 	parts := logcatMsgRegex.FindStringSubmatch(s)
 	if parts == nil {
 		return android.LogcatMessage{}, false
@@ -56,6 +62,27 @@ func parseLogcatMsg(s string) (android.LogcatMessage, bool) {
 	}, true
 }
 
+func parseLogcatEpochMsg(s string) (android.LogcatMessage, bool) {
+	parts := logcatEpochMsgRegex.FindStringSubmatch(s)
+	if parts == nil {
+		return android.LogcatMessage{}, false
+	}
+	seconds, _ := strconv.ParseInt(parts[1], 10, 64)
+	// The fraction is in milliseconds, or microseconds with "-v usec".
+	fraction := (parts[2] + "000000000")[:9]
+	nanoseconds, _ := strconv.ParseInt(fraction, 10, 64)
+	pid, _ := strconv.Atoi(parts[3])
+	tid, _ := strconv.Atoi(parts[4])
+
+	return android.LogcatMessage{
+		Timestamp: time.Unix(seconds, nanoseconds),
+		ProcessID: pid,
+		ThreadID:  tid,
+		Priority:  parseLogcatPriority(parts[5][0]),
+		Tag:       parts[6],
+	}, true
+}
+
 func parseLogcatPriority(r byte) android.LogcatPriority {
 	switch r {
 	case 'V':
@@ -78,6 +105,27 @@ func parseLogcatPriority(r byte) android.LogcatPriority {
 // Logcat writes all logcat messages reported by the device to the chan msgs,
 // blocking until the context is stopped.
 func (b *binding) Logcat(ctx context.Context, msgs chan<- android.LogcatMessage) error {
+	return b.logcat(ctx, msgs, "-v", "long", "-T", "0", "GAPID:V", "*:W")
+}
+
+// LogcatFiltered writes the logcat messages of all priorities matching the
+// filter to the chan msgs, blocking until the context is stopped.
+func (b *binding) LogcatFiltered(ctx context.Context, filter android.LogcatFilter, msgs chan<- android.LogcatMessage) error {
+	since := "0"
+	if !filter.Since.IsZero() {
+		since = fmt.Sprintf("%d.%03d", filter.Since.Unix(), filter.Since.Nanosecond()/1e6)
+	}
+	args := []string{"-v", "long,epoch", "-T", since}
+	if filter.ProcessID != 0 {
+		args = append(args, fmt.Sprintf("--pid=%d", filter.ProcessID))
+	}
+	if filter.UserID != 0 {
+		args = append(args, fmt.Sprintf("--uid=%d", filter.UserID))
+	}
+	return b.logcat(ctx, msgs, append(args, "*:V")...)
+}
+
+func (b *binding) logcat(ctx context.Context, msgs chan<- android.LogcatMessage, args ...string) error {
 	reader, stdout := io.Pipe()
 	buf := bufio.NewReader(reader)
 	err := make(chan error, 1)
@@ -123,7 +171,7 @@ func (b *binding) Logcat(ctx context.Context, msgs chan<- android.LogcatMessage)
 		}
 	})
 
-	if err := b.Command("logcat", "-v", "long", "-T", "0", "GAPID:V", "*:W").Capture(stdout, nil).Run(ctx); err != nil {
+	if err := b.Command("logcat", args...).Capture(stdout, nil).Run(ctx); err != nil {
 		stdout.Close()
 		return err
 	}
@@ -91,3 +91,46 @@ func TestLogcat(t_ *testing.T) {
 	assert.For(ctx, "msg").That(<-msgs).Equals(android.LogcatMessage{})
 	<-done
 }
+
+func TestLogcatFiltered(t_ *testing.T) {
+	ctx, _ := task.WithDeadline(log.Testing(t_), time.Now().Add(3*time.Second))
+	d := mustConnect(ctx, "logcat_device")
+	msgs := make(chan android.LogcatMessage, 32)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := d.LogcatFiltered(ctx, android.LogcatFilter{ProcessID: 31608}, msgs)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+	}()
+	expected := []android.LogcatMessage{
+		{
+			Timestamp: time.Unix(1648566989, 761*1e6),
+			ProcessID: 31608,
+			ThreadID:  31608,
+			Priority:  android.Info,
+			Tag:       "Finsky",
+			Message:   "[1] PackageVerificationReceiver.onReceive: Verification requested, id = 331",
+		},
+		{
+			Timestamp: time.Unix(1648566992, 205*1e6),
+			ProcessID: 31608,
+			ThreadID:  31655,
+			Priority:  android.Debug,
+			Tag:       "vulkan",
+			Message:   "Loaded layer VkGraphicsSpy\nsecond line",
+		},
+		{
+			Timestamp: time.Unix(1648566992, 219042*1e3),
+			ProcessID: 31608,
+			ThreadID:  31655,
+			Priority:  android.Warning,
+			Tag:       "vulkan",
+			Message:   "Timestamp printed with -v usec",
+		},
+	}
+	for _, msg := range expected {
+		assert.For(ctx, "msg").That(<-msgs).Equals(msg)
+	}
+	assert.For(ctx, "msg").That(<-msgs).Equals(android.LogcatMessage{})
+	<-done
+}
@@ -0,0 +1,252 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adb
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/gapid/core/log"
+)
+
+const (
+	// Maximum payload of a sync DATA packet.
+	syncMaxChunk = 64 * 1024
+
+	// Mask of the file type bits in a sync STAT mode.
+	syncModeTypeMask = 0170000
+	syncModeDir      = 0040000
+	syncModeRegular  = 0100000
+)
+
+// FileStat holds the file information returned by the sync STAT request.
+type FileStat struct {
+	// Mode holds the unix file type and permission bits.
+	Mode uint32
+	// Size is the size of the file in bytes.
+	Size uint32
+	// ModTime is the last modification time of the file.
+	ModTime time.Time
+}
+
+// Exists returns true if the file exists on the device.
+func (s FileStat) Exists() bool { return s.Mode != 0 }
+
+// IsDir returns true if the file is a directory.
+func (s FileStat) IsDir() bool { return s.Mode&syncModeTypeMask == syncModeDir }
+
+// IsRegular returns true if the file is a regular file.
+func (s FileStat) IsRegular() bool { return s.Mode&syncModeTypeMask == syncModeRegular }
+
+// syncConn is a connection to the sync service of a device.
+type syncConn struct {
+	net.Conn
+}
+
+func (c *Client) sync(ctx context.Context, serial string) (syncConn, error) {
+	conn, err := c.open(ctx, serial, "sync:")
+	if err != nil {
+		return syncConn{}, err
+	}
+	return syncConn{conn}, nil
+}
+
+func (s syncConn) Close() error {
+	s.send("QUIT", nil)
+	return s.Conn.Close()
+}
+
+// send writes a sync request made of a 4 character id and a payload.
+func (s syncConn) send(id string, data []byte) error {
+	header := make([]byte, 8)
+	copy(header, id)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(data)))
+	_, err := s.Write(append(header, data...))
+	return err
+}
+
+// sendValue writes a sync request whose length field carries a value.
+func (s syncConn) sendValue(id string, value uint32) error {
+	header := make([]byte, 8)
+	copy(header, id)
+	binary.LittleEndian.PutUint32(header[4:], value)
+	_, err := s.Write(header)
+	return err
+}
+
+// recv reads a sync response id and its length field.
+func (s syncConn) recv() (string, uint32, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(s, header); err != nil {
+		return "", 0, err
+	}
+	return string(header[:4]), binary.LittleEndian.Uint32(header[4:]), nil
+}
+
+// failure reads the message of a FAIL response of the given length.
+func (s syncConn) failure(ctx context.Context, request string, length uint32) error {
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(s, msg); err != nil {
+		return err
+	}
+	return log.Errf(ctx, ErrServerFailed, "%v: %v", request, string(msg))
+}
+
+// Stat returns information about the file at remote on the device.
+// A missing file is reported with a zero FileStat.
+func (c *Client) Stat(ctx context.Context, serial, remote string) (FileStat, error) {
+	s, err := c.sync(ctx, serial)
+	if err != nil {
+		return FileStat{}, err
+	}
+	defer s.Close()
+	return s.stat(ctx, remote)
+}
+
+func (s syncConn) stat(ctx context.Context, remote string) (FileStat, error) {
+	if err := s.send("STAT", []byte(remote)); err != nil {
+		return FileStat{}, err
+	}
+	res := make([]byte, 16)
+	if _, err := io.ReadFull(s, res); err != nil {
+		return FileStat{}, err
+	}
+	if string(res[:4]) != "STAT" {
+		return FileStat{}, log.Errf(ctx, ErrProtocol, "STAT %v: %q", remote, res[:4])
+	}
+	return FileStat{
+		Mode:    binary.LittleEndian.Uint32(res[4:]),
+		Size:    binary.LittleEndian.Uint32(res[8:]),
+		ModTime: time.Unix(int64(binary.LittleEndian.Uint32(res[12:])), 0),
+	}, nil
+}
+
+// Push copies the local file to remote on the device. If remote is an
+// existing directory, the file is copied into it.
+func (c *Client) Push(ctx context.Context, serial, local, remote string) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return log.Errf(ctx, nil, "Cannot push directory %v", local)
+	}
+
+	s, err := c.sync(ctx, serial)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if st, err := s.stat(ctx, remote); err != nil {
+		return err
+	} else if st.IsDir() {
+		remote = path.Join(remote, filepath.Base(local))
+	}
+
+	spec := remote + "," + strconv.FormatUint(uint64(info.Mode().Perm())|syncModeRegular, 10)
+	if err := s.send("SEND", []byte(spec)); err != nil {
+		return err
+	}
+	buf := make([]byte, syncMaxChunk)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := s.send("DATA", buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.sendValue("DONE", uint32(info.ModTime().Unix())); err != nil {
+		return err
+	}
+	id, length, err := s.recv()
+	if err != nil {
+		return err
+	}
+	switch id {
+	case "OKAY":
+		return nil
+	case "FAIL":
+		return s.failure(ctx, "SEND "+remote, length)
+	default:
+		return log.Errf(ctx, ErrProtocol, "SEND %v: %q", remote, id)
+	}
+}
+
+// Pull copies the file at remote on the device to local.
+func (c *Client) Pull(ctx context.Context, serial, remote, local string) error {
+	s, err := c.sync(ctx, serial)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local = filepath.Join(local, path.Base(remote))
+	}
+	f, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+	if err := s.recvFile(ctx, remote, f); err != nil {
+		f.Close()
+		os.Remove(local)
+		return err
+	}
+	return f.Close()
+}
+
+func (s syncConn) recvFile(ctx context.Context, remote string, w io.Writer) error {
+	if err := s.send("RECV", []byte(remote)); err != nil {
+		return err
+	}
+	for {
+		id, length, err := s.recv()
+		if err != nil {
+			return err
+		}
+		switch id {
+		case "DATA":
+			if _, err := io.CopyN(w, s, int64(length)); err != nil {
+				return err
+			}
+		case "DONE":
+			return nil
+		case "FAIL":
+			return s.failure(ctx, "RECV "+remote, length)
+		default:
+			return log.Errf(ctx, ErrProtocol, "RECV %v: %q", remote, id)
+		}
+	}
+}
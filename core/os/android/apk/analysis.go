@@ -20,8 +20,20 @@ import (
 	"path/filepath"
 
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/binaryxml"
+	"github.com/google/gapid/core/os/android/manifest"
 )
 
+// analysisConfig is the device configuration used to resolve the resources
+// referenced by the manifest. It is a high density device running Android N,
+// so that a bitmap launcher icon is picked over an adaptive icon, which is an
+// XML file only available from Android O.
+var analysisConfig = binaryxml.ResourceConfig{
+	Language:   "en",
+	Density:    640,
+	SDKVersion: 25,
+}
+
 // engineSignatures is used to identify the middleware engine used based on
 // files found in the APK.
 var engineSignatures = map[string]string{
@@ -35,7 +47,7 @@ func Analyze(ctx context.Context, apkData []byte) (*Information, error) {
 	if err != nil {
 		return nil, err
 	}
-	m, err := GetManifest(ctx, files)
+	m, err := resolvedManifest(ctx, files)
 	if err != nil {
 		return nil, err
 	}
@@ -44,8 +56,12 @@ func Analyze(ctx context.Context, apkData []byte) (*Information, error) {
 	if err != nil {
 		return nil, log.Err(ctx, err, "Finding launch activity")
 	}
+	name := m.Application.Label
+	if name == "" {
+		name = m.Package
+	}
 	return &Information{
-		Name:        m.Package, // TODO
+		Name:        name,
 		VersionCode: int32(m.VersionCode),
 		VersionName: m.VersionName,
 		Package:     m.Package,
@@ -54,9 +70,22 @@ func Analyze(ctx context.Context, apkData []byte) (*Information, error) {
 		Engine:      engine(files),
 		ABI:         GatherABIs(files),
 		Debuggable:  m.Application.Debuggable,
+		Icon:        m.Application.Icon,
 	}, nil
 }
 
+// resolvedManifest returns the manifest of the APK with its resource
+// references resolved. If the resource table cannot be decoded, the manifest
+// is returned with the references left unresolved.
+func resolvedManifest(ctx context.Context, files []*zip.File) (manifest.Manifest, error) {
+	manifestXML, err := GetResolvedManifestXML(ctx, files, analysisConfig)
+	if err != nil {
+		log.W(ctx, "Couldn't resolve the manifest resources, using the unresolved manifest: %v", err)
+		return GetManifest(ctx, files)
+	}
+	return manifest.Parse(ctx, manifestXML)
+}
+
 func engine(files []*zip.File) string {
 	for _, file := range files {
 		_, name := filepath.Split(file.Name)
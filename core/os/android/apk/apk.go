@@ -30,6 +30,7 @@ import (
 
 const (
 	mainfestPath       = "AndroidManifest.xml"
+	resourcesPath      = "resources.arsc"
 	ErrMissingManifest = fault.Const("Couldn't find APK's manifest file.")
 	ErrInvalidAPK      = fault.Const("File is not an APK.")
 )
@@ -44,19 +45,67 @@ func Read(ctx context.Context, apkData []byte) ([]*zip.File, error) {
 }
 
 func GetManifestXML(ctx context.Context, files []*zip.File) (string, error) {
-	manifestZipFile := findManifest(files)
-	if manifestZipFile == nil {
-		return "", log.Err(ctx, ErrMissingManifest, "")
+	manifestData, err := readManifest(ctx, files)
+	if err != nil {
+		return "", err
+	}
+	return binaryxml.Decode(ctx, manifestData)
+}
+
+// GetResolvedManifestXML returns the manifest of the APK, with the references
+// to resources replaced by their values for the given configuration.
+func GetResolvedManifestXML(ctx context.Context, files []*zip.File, config binaryxml.ResourceConfig) (string, error) {
+	manifestData, err := readManifest(ctx, files)
+	if err != nil {
+		return "", err
+	}
+	resources, err := GetResources(ctx, files)
+	if err != nil {
+		return "", err
+	}
+	if resources == nil {
+		return binaryxml.Decode(ctx, manifestData)
+	}
+	return binaryxml.DecodeWithResources(ctx, manifestData, resources, config)
+}
+
+// GetResources returns the decoded resource table of the APK, or nil if the
+// APK has no resource table.
+func GetResources(ctx context.Context, files []*zip.File) (*binaryxml.ResourceTable, error) {
+	file := findFile(files, resourcesPath)
+	if file == nil {
+		return nil, nil
+	}
+	data, err := readFile(file)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Couldn't read APK's resource table")
 	}
-	manifestFile, err := manifestZipFile.Open()
+	resources, err := binaryxml.DecodeResourceTable(data)
 	if err != nil {
-		return "", log.Err(ctx, err, "Couldn't open APK's manifest")
+		return nil, log.Err(ctx, err, "Decoding APK's resource table")
 	}
-	defer manifestFile.Close()
+	return resources, nil
+}
 
-	manifestData, _ := ioutil.ReadAll(manifestFile)
+func readManifest(ctx context.Context, files []*zip.File) ([]byte, error) {
+	manifestZipFile := findFile(files, mainfestPath)
+	if manifestZipFile == nil {
+		return nil, log.Err(ctx, ErrMissingManifest, "")
+	}
+	manifestData, err := readFile(manifestZipFile)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Couldn't open APK's manifest")
+	}
+	return manifestData, nil
+}
 
-	return binaryxml.Decode(ctx, manifestData)
+func readFile(file *zip.File) ([]byte, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
 }
 
 func GetManifest(ctx context.Context, files []*zip.File) (manifest.Manifest, error) {
@@ -67,9 +116,9 @@ func GetManifest(ctx context.Context, files []*zip.File) (manifest.Manifest, err
 	return manifest.Parse(ctx, manifestXML)
 }
 
-func findManifest(files []*zip.File) *zip.File {
+func findFile(files []*zip.File, name string) *zip.File {
 	for _, file := range files {
-		if file.Name == mainfestPath {
+		if file.Name == name {
 			return file
 		}
 	}
@@ -20,10 +20,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"os/user"
 	"path/filepath"
-	"regexp"
 	"strings"
 
 	"github.com/google/gapid/core/log"
@@ -31,21 +29,27 @@ import (
 )
 
 // ApkDebugifier makes an APK debuggable. The fields in the struct
-// are used to configure the various paths and passwords required,
-// as well as providing a log context.
-// Intended use is ApkDebugifier{Ctx: ..., JarSignCmd: "jarsigner", ..., KeyStorePath: "..."}.Run(...).
+// are used to configure the key used to re-sign the APK, and further
+// modifications of the manifest.
+// Intended use is ApkDebugifier{KeyStorePath: "...", StorePass: "..."}.Run(ctx, ...).
 type ApkDebugifier struct {
-	JarSignCmd   string // path to the jarsigner binary
-	ZipAlignCmd  string // path to the zipalign binary
-	KeyPass      string // key passphrase
-	KeyAlias     string // key alias for signing
-	StorePass    string // keystore passphrase
-	KeyStorePath string // path to keystore (e.g. /path/to/debug.keystore)
+	KeyAlias     string           // key alias for signing
+	StorePass    string           // keystore passphrase, also protecting the key
+	KeyStorePath string           // path to PKCS#12 keystore or PEM file (e.g. /path/to/debug.keystore)
+	Signer       *Signer          // if not nil, used instead of the keystore
+	Edits        []binaryxml.Edit // applied to the manifest after setting the debuggable flag
 }
 
 // Run takes the path (src) to an APK, sets the debuggable flag in its manifest,
-// re-signs and aligns it, and saves it to a different path (dst).
+// applies the edits to the manifest, re-signs and aligns it, and saves it to a
+// different path (dst).
+// If the keystore does not exist, the APK is signed with a generated debug key.
 func (a ApkDebugifier) Run(ctx context.Context, src string, dst string) error {
+	signer, err := a.signer(ctx)
+	if err != nil {
+		return err
+	}
+
 	tempFile, err := ioutil.TempFile("", "debuggable.apk")
 	if err != nil {
 		return err
@@ -58,19 +62,20 @@ func (a ApkDebugifier) Run(ctx context.Context, src string, dst string) error {
 		return err
 	}
 
-	log.I(ctx, "Signing apk %s", tempFile.Name())
-	err = a.jarSign(ctx, tempFile.Name())
-	if err != nil {
-		return err
-	}
+	log.I(ctx, "Signing and zipaligning %s to %s", tempFile.Name(), dst)
+	return SignApk(ctx, tempFile.Name(), dst, signer)
+}
 
-	log.I(ctx, "Zipaligning %s to %s", tempFile.Name(), dst)
-	err = a.zipAlign(ctx, tempFile.Name(), dst)
-	if err != nil {
-		return err
+func (a ApkDebugifier) signer(ctx context.Context) (*Signer, error) {
+	if a.Signer != nil {
+		return a.Signer, nil
 	}
-
-	return nil
+	path := expandHomeDir(a.KeyStorePath)
+	if _, err := os.Stat(path); path == "" || os.IsNotExist(err) {
+		log.W(ctx, "Keystore %s not found, signing with a generated debug key", path)
+		return GenerateDebugSigner()
+	}
+	return LoadSigner(ctx, path, a.StorePass, a.KeyAlias)
 }
 
 func expandHomeDir(p string) string {
@@ -84,35 +89,6 @@ func expandHomeDir(p string) string {
 	return filepath.Join(user.HomeDir, strings.TrimLeft(p, "~"))
 }
 
-func (a ApkDebugifier) execCommand(ctx context.Context, name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	log.I(ctx, "Executing %v", cmd.Args)
-	out, err := cmd.CombinedOutput()
-	logger := log.From(ctx).Writer(log.Debug)
-	if err != nil {
-		logger = log.From(ctx).Writer(log.Error)
-	}
-	logger.Write(out)
-	return err
-}
-
-func (a ApkDebugifier) jarSign(ctx context.Context, apk string) error {
-	return a.execCommand(ctx,
-		expandHomeDir(a.JarSignCmd),
-		"-sigalg", "SHA1withRSA",
-		"-digestalg", "SHA1",
-		"-keystore", expandHomeDir(a.KeyStorePath),
-		"-storepass", a.StorePass,
-		"-keypass", a.KeyPass,
-		apk,
-		a.KeyAlias,
-	)
-}
-
-func (a ApkDebugifier) zipAlign(ctx context.Context, src string, dst string) error {
-	return a.execCommand(ctx, expandHomeDir(a.ZipAlignCmd), "-v", "-f", "4", src, dst)
-}
-
 func (a ApkDebugifier) makeApkDebuggableAndRemoveSignatureFiles(ctx context.Context, src string, outFile *os.File) error {
 	inZip, err := zip.OpenReader(src)
 	if err != nil {
@@ -124,8 +100,6 @@ func (a ApkDebugifier) makeApkDebuggableAndRemoveSignatureFiles(ctx context.Cont
 	w := zip.NewWriter(outFile)
 	defer w.Close()
 
-	jarSignatureFilePattern := regexp.MustCompile(`META-INF/([^/]*(DSA|RSA|SF)|MANIFEST\.MF)`)
-
 	for _, zf := range inZip.File {
 		if jarSignatureFilePattern.MatchString(zf.Name) {
 			log.I(ctx, "Skipping file %s", zf.Name)
@@ -150,7 +124,8 @@ func (a ApkDebugifier) makeApkDebuggableAndRemoveSignatureFiles(ctx context.Cont
 
 		if zf.Name == "AndroidManifest.xml" {
 			log.I(ctx, "Modifying manifest file")
-			err := binaryxml.SetDebuggableFlag(fr, fw)
+			edits := append([]binaryxml.Edit{binaryxml.SetDebuggable(true)}, a.Edits...)
+			err := binaryxml.Apply(fr, fw, edits...)
 			if err != nil {
 				return err
 			}
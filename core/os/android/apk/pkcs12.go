@@ -0,0 +1,296 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"hash"
+	"unicode/utf16"
+
+	"github.com/google/gapid/core/fault"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	errUnsupportedEncryption = fault.Const("Unsupported PKCS#12 encryption algorithm")
+	errInvalidPadding        = fault.Const("Invalid PKCS#12 padding, wrong password?")
+	errTrailingData          = fault.Const("Trailing data after ASN.1 value")
+)
+
+var (
+	oidEncryptedData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidShroudedKeyBag      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBES2               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1        = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidX509CertificateType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+)
+
+type pfxPDU struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  asn1.RawValue `asn1:"optional"`
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm algorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     algorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc algorithmIdentifier
+	EncryptionScheme  algorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                 `asn1:"optional"`
+	PRF        algorithmIdentifier `asn1:"optional"`
+}
+
+// decodePBES2KeyStore returns the keys and certificates of the PBES2
+// encrypted PKCS#12 key store as PEM blocks, in the same form as
+// pkcs12.ToPEM. The golang.org/x/crypto/pkcs12 package only supports the
+// legacy PKCS#12 encryption algorithms, while recent versions of keytool and
+// openssl default to PBES2 with AES.
+func decodePBES2KeyStore(data []byte, password string) ([]*pem.Block, error) {
+	pfx := pfxPDU{}
+	if err := unmarshalDER(data, &pfx); err != nil {
+		return nil, err
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidData) {
+		return nil, errUnsupportedEncryption
+	}
+	var authSafe []byte
+	if err := unmarshalDER(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, err
+	}
+	contents := []contentInfo{}
+	if err := unmarshalDER(authSafe, &contents); err != nil {
+		return nil, err
+	}
+
+	blocks := []*pem.Block{}
+	for _, ci := range contents {
+		var safeContents []byte
+		switch {
+		case ci.ContentType.Equal(oidData):
+			if err := unmarshalDER(ci.Content.Bytes, &safeContents); err != nil {
+				return nil, err
+			}
+		case ci.ContentType.Equal(oidEncryptedData):
+			ed := encryptedData{}
+			if err := unmarshalDER(ci.Content.Bytes, &ed); err != nil {
+				return nil, err
+			}
+			var err error
+			info := ed.EncryptedContentInfo
+			if safeContents, err = pbes2Decrypt(info.ContentEncryptionAlgorithm, info.EncryptedContent, password); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errUnsupportedEncryption
+		}
+
+		bags := []safeBag{}
+		if err := unmarshalDER(safeContents, &bags); err != nil {
+			return nil, err
+		}
+		for _, bag := range bags {
+			block, err := convertSafeBag(bag, password)
+			if err != nil {
+				return nil, err
+			}
+			if block != nil {
+				blocks = append(blocks, block)
+			}
+		}
+	}
+	return blocks, nil
+}
+
+func convertSafeBag(bag safeBag, password string) (*pem.Block, error) {
+	block := &pem.Block{Headers: map[string]string{}}
+	switch {
+	case bag.ID.Equal(oidCertBag):
+		cert := certBag{}
+		if err := unmarshalDER(bag.Value.Bytes, &cert); err != nil {
+			return nil, err
+		}
+		if !cert.ID.Equal(oidX509CertificateType) {
+			return nil, nil
+		}
+		block.Type, block.Bytes = "CERTIFICATE", cert.Data
+	case bag.ID.Equal(oidShroudedKeyBag):
+		info := encryptedPrivateKeyInfo{}
+		if err := unmarshalDER(bag.Value.Bytes, &info); err != nil {
+			return nil, err
+		}
+		key, err := pbes2Decrypt(info.Algorithm, info.EncryptedData, password)
+		if err != nil {
+			return nil, err
+		}
+		block.Type, block.Bytes = "PRIVATE KEY", key
+	case bag.ID.Equal(oidKeyBag):
+		block.Type, block.Bytes = "PRIVATE KEY", bag.Value.Bytes
+	default:
+		return nil, nil
+	}
+
+	for _, attr := range bag.Attributes {
+		switch {
+		case attr.ID.Equal(oidFriendlyName):
+			var name asn1.RawValue
+			if err := unmarshalDER(attr.Value.Bytes, &name); err != nil {
+				return nil, err
+			}
+			block.Headers["friendlyName"] = decodeBMPString(name.Bytes)
+		case attr.ID.Equal(oidLocalKeyID):
+			var id []byte
+			if err := unmarshalDER(attr.Value.Bytes, &id); err != nil {
+				return nil, err
+			}
+			block.Headers["localKeyId"] = hex.EncodeToString(id)
+		}
+	}
+	return block, nil
+}
+
+// pbes2Decrypt decrypts the data encrypted with the PBES2 scheme using
+// PBKDF2 and AES-CBC.
+func pbes2Decrypt(alg algorithmIdentifier, data []byte, password string) ([]byte, error) {
+	if !alg.Algorithm.Equal(oidPBES2) {
+		return nil, errUnsupportedEncryption
+	}
+	params := pbes2Params{}
+	if err := unmarshalDER(alg.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errUnsupportedEncryption
+	}
+	kdf := pbkdf2Params{}
+	if err := unmarshalDER(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, errUnsupportedEncryption
+	}
+	var keyLen int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLen = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLen = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, errUnsupportedEncryption
+	}
+	var iv []byte
+	if err := unmarshalDER(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	key := pbkdf2.Key([]byte(password), kdf.Salt, kdf.Iterations, keyLen, prf)
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != c.BlockSize() || len(data) == 0 || len(data)%c.BlockSize() != 0 {
+		return nil, errInvalidPadding
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(out, data)
+
+	// Remove the PKCS#7 padding.
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > c.BlockSize() {
+		return nil, errInvalidPadding
+	}
+	for _, b := range out[len(out)-padding:] {
+		if int(b) != padding {
+			return nil, errInvalidPadding
+		}
+	}
+	return out[:len(out)-padding], nil
+}
+
+func unmarshalDER(data []byte, out interface{}) error {
+	rest, err := asn1.Unmarshal(data, out)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errTrailingData
+	}
+	return nil
+}
+
+func decodeBMPString(b []byte) string {
+	s := make([]uint16, len(b)/2)
+	for i := range s {
+		s[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(s))
+}
@@ -0,0 +1,483 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+)
+
+const ErrInvalidZip = fault.Const("Couldn't find the zip central directory.")
+
+const (
+	// apkSigningBlockMagic ends the APK signing block.
+	apkSigningBlockMagic = "APK Sig Block 42"
+	// v2BlockID and v3BlockID are the IDs of the APK signature scheme v2 and
+	// v3 blocks in the APK signing block.
+	v2BlockID = 0x7109871a
+	v3BlockID = 0xf05368c0
+	// strippingProtectionID is the ID of the v2 signer attribute declaring
+	// that the APK is also signed with the v3 scheme.
+	strippingProtectionID = 0xbeeff00d
+	// v3MinSDK is the first API level verifying v3 signatures.
+	v3MinSDK = 28
+	// digestChunkSize is the size of the chunks the APK contents are split
+	// into for computing their digest.
+	digestChunkSize = 1 << 20
+	// eocdLen is the length of the zip end of central directory record,
+	// without its comment.
+	eocdLen   = 22
+	eocdMagic = 0x06054b50
+)
+
+var (
+	// jarSignatureFilePattern matches the files of v1 (JAR) signatures.
+	jarSignatureFilePattern = regexp.MustCompile(`^META-INF/([^/]*\.(DSA|RSA|EC|SF)|MANIFEST\.MF)$`)
+
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// SignApk signs the APK at src with the v1 (JAR), v2 and v3 APK signature
+// schemes, and saves the zip aligned result to dst. Any previous signature
+// is removed.
+// The v1 signature only holds SHA-256 digests, which are verified from API
+// level 18, so the signed APK cannot be installed on older devices.
+func SignApk(ctx context.Context, src, dst string, signer *Signer) error {
+	in, err := zip.OpenReader(src)
+	if err != nil {
+		return log.Errf(ctx, err, "Couldn't open %s", src)
+	}
+	defer in.Close()
+
+	aligned, err := ioutil.TempFile("", "aligned.apk")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(aligned.Name())
+	defer aligned.Close()
+
+	if err := writeJarSigned(ctx, aligned, &in.Reader, signer); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := writeSchemeSigned(ctx, out, aligned, signer); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// writeJarSigned writes the zip aligned copy of r signed with the v1 (JAR)
+// signature scheme to w, using SHA-256 digests.
+func writeJarSigned(ctx context.Context, w io.Writer, r *zip.Reader, signer *Signer) error {
+	files := []*zip.File{}
+	for _, f := range r.File {
+		if jarSignatureFilePattern.MatchString(f.Name) {
+			log.D(ctx, "Skipping signature file %s", f.Name)
+			continue
+		}
+		files = append(files, f)
+	}
+
+	manifest, signatureFile, err := jarManifests(files)
+	if err != nil {
+		return err
+	}
+	signature, err := jarSignature(signatureFile, signer)
+	if err != nil {
+		return err
+	}
+	signatureName := "META-INF/CERT.RSA"
+	if _, ok := signer.Key.(*ecdsa.PrivateKey); ok {
+		signatureName = "META-INF/CERT.EC"
+	}
+
+	a := newZipAligner(w)
+	if err := a.store("META-INF/MANIFEST.MF", manifest); err != nil {
+		return err
+	}
+	if err := a.store("META-INF/CERT.SF", signatureFile); err != nil {
+		return err
+	}
+	if err := a.store(signatureName, signature); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := a.copy(f); err != nil {
+			return err
+		}
+	}
+	return a.close()
+}
+
+// jarManifests returns the JAR manifest holding the digests of the files,
+// and the signature file holding the digests of the manifest.
+func jarManifests(files []*zip.File) (manifest, signatureFile []byte, err error) {
+	mf, sf := &bytes.Buffer{}, &bytes.Buffer{}
+	mf.WriteString("Manifest-Version: 1.0\r\nCreated-By: 1.0 (Android)\r\n\r\n")
+	sections := &bytes.Buffer{}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		digest, err := fileDigest(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		section := jarAttribute("Name", f.Name) + jarAttribute("SHA-256-Digest", digest) + "\r\n"
+		mf.WriteString(section)
+		sections.WriteString(jarAttribute("Name", f.Name))
+		sections.WriteString(jarAttribute("SHA-256-Digest", base64Digest([]byte(section))))
+		sections.WriteString("\r\n")
+	}
+	sf.WriteString("Signature-Version: 1.0\r\nCreated-By: 1.0 (Android)\r\n")
+	sf.WriteString(jarAttribute("SHA-256-Digest-Manifest", base64Digest(mf.Bytes())))
+	// Tell v2 aware platforms to reject the APK if the v2 and v3 signatures
+	// have been stripped.
+	sf.WriteString("X-Android-APK-Signed: 2, 3\r\n\r\n")
+	sf.Write(sections.Bytes())
+	return mf.Bytes(), sf.Bytes(), nil
+}
+
+// jarAttribute returns the manifest line for the given attribute, wrapped at
+// 72 bytes as required by the JAR specification.
+func jarAttribute(name, value string) string {
+	line := name + ": " + value
+	out := &strings.Builder{}
+	// Continuation lines start with a space.
+	for max := 72; len(line) > max; max = 71 {
+		out.WriteString(line[:max])
+		out.WriteString("\r\n ")
+		line = line[max:]
+	}
+	out.WriteString(line)
+	out.WriteString("\r\n")
+	return out.String()
+}
+
+func fileDigest(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+func base64Digest(data []byte) string {
+	digest := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           algorithmIdentifier
+	DigestEncryptionAlgorithm algorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []algorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+// jarSignature returns the detached PKCS#7 signature of the signature file.
+func jarSignature(signatureFile []byte, signer *Signer) ([]byte, error) {
+	signature, err := signer.sign(signatureFile)
+	if err != nil {
+		return nil, err
+	}
+	null := asn1.RawValue{Tag: asn1.TagNull}
+	encryption := algorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: null}
+	if _, ok := signer.Key.(*ecdsa.PrivateKey); ok {
+		encryption = algorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	}
+	digest := algorithmIdentifier{Algorithm: oidSHA256, Parameters: null}
+	cert := signer.Certificate
+	data, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []algorithmIdentifier{digest},
+		ContentInfo:      contentInfo{ContentType: oidData},
+		Certificates: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw,
+		},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+				SerialNumber: cert.SerialNumber,
+			},
+			DigestAlgorithm:           digest,
+			DigestEncryptionAlgorithm: encryption,
+			EncryptedDigest:           signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data,
+		},
+	})
+}
+
+// zipSections holds the offsets of the sections of a zip file covered by the
+// APK signature scheme digests.
+type zipSections struct {
+	cdOffset int64  // offset of the central directory
+	cdSize   int64  // size of the central directory
+	eocd     []byte // end of central directory record
+}
+
+func readZipSections(r io.ReaderAt, size int64) (zipSections, error) {
+	// The record is followed by a comment of at most 64KiB.
+	start := size - eocdLen - math.MaxUint16
+	if start < 0 {
+		start = 0
+	}
+	tail := make([]byte, size-start)
+	if _, err := r.ReadAt(tail, start); err != nil {
+		return zipSections{}, err
+	}
+	for i := len(tail) - eocdLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) != eocdMagic {
+			continue
+		}
+		if commentLen := int(binary.LittleEndian.Uint16(tail[i+20:])); i+eocdLen+commentLen != len(tail) {
+			continue
+		}
+		s := zipSections{
+			cdSize:   int64(binary.LittleEndian.Uint32(tail[i+12:])),
+			cdOffset: int64(binary.LittleEndian.Uint32(tail[i+16:])),
+			eocd:     tail[i:],
+		}
+		if s.cdOffset+s.cdSize != start+int64(i) {
+			return zipSections{}, ErrInvalidZip
+		}
+		return s, nil
+	}
+	return zipSections{}, ErrInvalidZip
+}
+
+// writeSchemeSigned copies the zip file f to w, inserting an APK signing block
+// holding the v2 and v3 signatures before the central directory.
+func writeSchemeSigned(ctx context.Context, w io.Writer, f *os.File, signer *Signer) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	sections, err := readZipSections(f, info.Size())
+	if err != nil {
+		return log.Err(ctx, err, "Couldn't read aligned APK")
+	}
+
+	digest, err := contentDigest(
+		io.NewSectionReader(f, 0, sections.cdOffset),
+		io.NewSectionReader(f, sections.cdOffset, sections.cdSize),
+		bytes.NewReader(sections.eocd),
+	)
+	if err != nil {
+		return err
+	}
+
+	v3, err := schemeSigner(signer, digest, true)
+	if err != nil {
+		return err
+	}
+	v2, err := schemeSigner(signer, digest, false)
+	if err != nil {
+		return err
+	}
+	block := signingBlock(
+		signingBlockValue{v2BlockID, lengthPrefixed(lengthPrefixed(v2))},
+		signingBlockValue{v3BlockID, lengthPrefixed(lengthPrefixed(v3))},
+	)
+
+	// The central directory now follows the signing block.
+	eocd := append([]byte{}, sections.eocd...)
+	binary.LittleEndian.PutUint32(eocd[16:], uint32(sections.cdOffset+int64(len(block))))
+
+	if _, err := io.Copy(w, io.NewSectionReader(f, 0, sections.cdOffset)); err != nil {
+		return err
+	}
+	if _, err := w.Write(block); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(f, sections.cdOffset, sections.cdSize)); err != nil {
+		return err
+	}
+	_, err = w.Write(eocd)
+	return err
+}
+
+// contentDigest returns the chunked SHA-256 digest of the given sections, as
+// defined by the APK signature scheme v2.
+func contentDigest(sections ...io.Reader) ([]byte, error) {
+	digests := []byte{}
+	chunks := uint32(0)
+	chunk := make([]byte, digestChunkSize)
+	for _, section := range sections {
+		for {
+			n, err := io.ReadFull(section, chunk)
+			if n > 0 {
+				h := sha256.New()
+				h.Write([]byte{0xa5})
+				binary.Write(h, binary.LittleEndian, uint32(n))
+				h.Write(chunk[:n])
+				digests = h.Sum(digests)
+				chunks++
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	h := sha256.New()
+	h.Write([]byte{0x5a})
+	binary.Write(h, binary.LittleEndian, chunks)
+	h.Write(digests)
+	return h.Sum(nil), nil
+}
+
+// schemeSigner returns the v2 or v3 signer block for the content digest.
+func schemeSigner(signer *Signer, digest []byte, v3 bool) ([]byte, error) {
+	algorithm, err := signer.algorithm()
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Key.Public())
+	if err != nil {
+		return nil, err
+	}
+	digests := lengthPrefixed(lengthPrefixed(uint32Bytes(algorithm), lengthPrefixed(digest)))
+	certificates := lengthPrefixed(lengthPrefixed(signer.Certificate.Raw))
+	sdks := concat(uint32Bytes(v3MinSDK), uint32Bytes(math.MaxInt32))
+
+	var data []byte
+	if v3 {
+		data = concat(digests, certificates, sdks, lengthPrefixed())
+	} else {
+		attribute := lengthPrefixed(uint32Bytes(strippingProtectionID), uint32Bytes(3))
+		data = concat(digests, certificates, lengthPrefixed(attribute))
+	}
+	signature, err := signer.sign(data)
+	if err != nil {
+		return nil, err
+	}
+	signatures := lengthPrefixed(lengthPrefixed(uint32Bytes(algorithm), lengthPrefixed(signature)))
+
+	if v3 {
+		return concat(lengthPrefixed(data), sdks, signatures, lengthPrefixed(publicKey)), nil
+	}
+	return concat(lengthPrefixed(data), signatures, lengthPrefixed(publicKey)), nil
+}
+
+type signingBlockValue struct {
+	id    uint32
+	value []byte
+}
+
+// signingBlock returns the APK signing block holding the given values.
+func signingBlock(values ...signingBlockValue) []byte {
+	pairs := []byte{}
+	for _, v := range values {
+		pairs = append(pairs, uint64Bytes(uint64(4+len(v.value)))...)
+		pairs = append(pairs, uint32Bytes(v.id)...)
+		pairs = append(pairs, v.value...)
+	}
+	size := uint64Bytes(uint64(len(pairs) + 8 + len(apkSigningBlockMagic)))
+	return concat(size, pairs, size, []byte(apkSigningBlockMagic))
+}
+
+func concat(parts ...[]byte) []byte {
+	out := []byte{}
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// lengthPrefixed returns the concatenation of parts, prefixed with its
+// 32-bit length.
+func lengthPrefixed(parts ...[]byte) []byte {
+	data := concat(parts...)
+	return append(uint32Bytes(uint32(len(data))), data...)
+}
+
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func uint64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,309 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+)
+
+var testEntries = []struct {
+	name   string
+	method uint16
+	data   string
+}{
+	{"AndroidManifest.xml", zip.Deflate, "<manifest/>"},
+	{"META-INF/OLD.RSA", zip.Store, "stale signature"},
+	{"a", zip.Store, "odd"},
+	{"assets/", zip.Store, ""},
+	{"assets/data.bin", zip.Store, strings.Repeat("data", 1000)},
+	{"lib/arm64-v8a/libfoo.so", zip.Store, "\x7fELF"},
+	{"resources.arsc", zip.Store, "arsc"},
+	{"classes.dex", zip.Deflate, strings.Repeat("dex\n", 1000)},
+}
+
+func writeTestZip(t *testing.T, path string) {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for _, e := range testEntries {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: e.name, Method: e.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(e.data))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkAligned(t *testing.T, path string) map[string]string {
+	ctx := log.Testing(t)
+	r, err := zip.OpenReader(path)
+	assert.For(ctx, "open").ThatError(err).Succeeded()
+	defer r.Close()
+	contents := map[string]string{}
+	for _, f := range r.File {
+		if f.Method == zip.Store && !strings.HasSuffix(f.Name, "/") {
+			offset, err := f.DataOffset()
+			assert.For(ctx, "offset").ThatError(err).Succeeded()
+			alignment := int64(zipAlignment)
+			if strings.HasSuffix(f.Name, ".so") {
+				alignment = libraryAlignment
+			}
+			assert.For(ctx, "%s alignment", f.Name).That(offset % alignment).Equals(int64(0))
+		}
+		fr, err := f.Open()
+		assert.For(ctx, "open %s", f.Name).ThatError(err).Succeeded()
+		data, err := ioutil.ReadAll(fr)
+		assert.For(ctx, "read %s", f.Name).ThatError(err).Succeeded()
+		fr.Close()
+		contents[f.Name] = string(data)
+	}
+	return contents
+}
+
+func TestZipAlign(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "zipalign")
+	assert.For(ctx, "tempdir").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	src, dst := filepath.Join(dir, "src.zip"), filepath.Join(dir, "dst.zip")
+	writeTestZip(t, src)
+	r, err := zip.OpenReader(src)
+	assert.For(ctx, "open").ThatError(err).Succeeded()
+	defer r.Close()
+
+	out := &bytes.Buffer{}
+	assert.For(ctx, "align").ThatError(ZipAlign(out, &r.Reader)).Succeeded()
+	assert.For(ctx, "write").ThatError(ioutil.WriteFile(dst, out.Bytes(), 0644)).Succeeded()
+
+	contents := checkAligned(t, dst)
+	for _, e := range testEntries {
+		assert.For(ctx, "content of %s", e.name).ThatString(contents[e.name]).Equals(e.data)
+	}
+}
+
+func TestJarAttribute(t *testing.T) {
+	ctx := log.Testing(t)
+	line := jarAttribute("Name", strings.Repeat("x", 200))
+	lines := strings.Split(strings.TrimSuffix(line, "\r\n"), "\r\n")
+	assert.For(ctx, "lines").ThatSlice(lines).IsLength(3)
+	for i, l := range lines {
+		assert.For(ctx, "length").That(len(l) <= 72).Equals(true)
+		assert.For(ctx, "continuation").That(strings.HasPrefix(l, " ")).Equals(i > 0)
+	}
+}
+
+func readLengthPrefixed(t *testing.T, b []byte) (value, rest []byte) {
+	if len(b) < 4 {
+		t.Fatalf("Truncated length prefixed value")
+	}
+	n := binary.LittleEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		t.Fatalf("Truncated length prefixed value")
+	}
+	return b[4 : 4+n], b[4+n:]
+}
+
+// verifySchemeSigner checks the v2 or v3 signer block and returns the content
+// digest it signs.
+func verifySchemeSigner(t *testing.T, block []byte, signer *Signer, v3 bool) []byte {
+	ctx := log.Testing(t)
+	signers, _ := readLengthPrefixed(t, block)
+	s, rest := readLengthPrefixed(t, signers)
+	assert.For(ctx, "single signer").That(len(rest)).Equals(0)
+
+	data, s := readLengthPrefixed(t, s)
+	if v3 {
+		assert.For(ctx, "min sdk").That(binary.LittleEndian.Uint32(s)).Equals(uint32(v3MinSDK))
+		s = s[8:]
+	}
+	signatures, s := readLengthPrefixed(t, s)
+	publicKey, _ := readLengthPrefixed(t, s)
+
+	expected, err := x509.MarshalPKIXPublicKey(signer.Key.Public())
+	assert.For(ctx, "marshal").ThatError(err).Succeeded()
+	assert.For(ctx, "public key").That(bytes.Equal(publicKey, expected)).Equals(true)
+
+	signature, _ := readLengthPrefixed(t, signatures)
+	assert.For(ctx, "algorithm").That(binary.LittleEndian.Uint32(signature)).Equals(uint32(rsaPKCS1v15WithSHA256))
+	sig, _ := readLengthPrefixed(t, signature[4:])
+	hash := sha256.Sum256(data)
+	err = rsa.VerifyPKCS1v15(signer.Key.Public().(*rsa.PublicKey), crypto.SHA256, hash[:], sig)
+	assert.For(ctx, "signature").ThatError(err).Succeeded()
+
+	digests, data := readLengthPrefixed(t, data)
+	certificates, _ := readLengthPrefixed(t, data)
+	cert, _ := readLengthPrefixed(t, certificates)
+	assert.For(ctx, "certificate").That(bytes.Equal(cert, signer.Certificate.Raw)).Equals(true)
+	digest, _ := readLengthPrefixed(t, digests)
+	value, _ := readLengthPrefixed(t, digest[4:])
+	return value
+}
+
+func TestSignApk(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "signapk")
+	assert.For(ctx, "tempdir").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	signer, err := GenerateDebugSigner()
+	assert.For(ctx, "generate").ThatError(err).Succeeded()
+
+	src, dst := filepath.Join(dir, "src.apk"), filepath.Join(dir, "dst.apk")
+	writeTestZip(t, src)
+	assert.For(ctx, "sign").ThatError(SignApk(ctx, src, dst, signer)).Succeeded()
+
+	contents := checkAligned(t, dst)
+	_, stale := contents["META-INF/OLD.RSA"]
+	assert.For(ctx, "stale signature").That(stale).Equals(false)
+	assert.For(ctx, "signature").That(contents["META-INF/CERT.RSA"] != "").Equals(true)
+	manifest := contents["META-INF/MANIFEST.MF"]
+	assert.For(ctx, "manifest").ThatString(manifest).Contains("Name: classes.dex\r\nSHA-256-Digest: ")
+	assert.For(ctx, "signature file").ThatString(contents["META-INF/CERT.SF"]).Contains(
+		"SHA-256-Digest-Manifest: " + base64Digest([]byte(manifest)) + "\r\n")
+
+	apk, err := ioutil.ReadFile(dst)
+	assert.For(ctx, "read").ThatError(err).Succeeded()
+	sections, err := readZipSections(bytes.NewReader(apk), int64(len(apk)))
+	assert.For(ctx, "sections").ThatError(err).Succeeded()
+
+	// Parse the signing block preceding the central directory.
+	end := sections.cdOffset
+	assert.For(ctx, "magic").ThatString(string(apk[end-16 : end])).Equals(apkSigningBlockMagic)
+	size := int64(binary.LittleEndian.Uint64(apk[end-24:]))
+	start := end - size - 8
+	assert.For(ctx, "size").That(int64(binary.LittleEndian.Uint64(apk[start:]))).Equals(size)
+	blocks := map[uint32][]byte{}
+	for pairs := apk[start+8 : end-24]; len(pairs) > 0; {
+		n := binary.LittleEndian.Uint64(pairs)
+		blocks[binary.LittleEndian.Uint32(pairs[8:])] = pairs[12 : 8+n]
+		pairs = pairs[8+n:]
+	}
+
+	// The digest covers the APK without the signing block.
+	eocd := append([]byte{}, sections.eocd...)
+	binary.LittleEndian.PutUint32(eocd[16:], uint32(start))
+	expected, err := contentDigest(
+		bytes.NewReader(apk[:start]),
+		bytes.NewReader(apk[sections.cdOffset:sections.cdOffset+sections.cdSize]),
+		bytes.NewReader(eocd),
+	)
+	assert.For(ctx, "digest").ThatError(err).Succeeded()
+
+	v2 := verifySchemeSigner(t, blocks[v2BlockID], signer, false)
+	assert.For(ctx, "v2 digest").That(bytes.Equal(v2, expected)).Equals(true)
+	v3 := verifySchemeSigner(t, blocks[v3BlockID], signer, true)
+	assert.For(ctx, "v3 digest").That(bytes.Equal(v3, expected)).Equals(true)
+}
+
+func TestLoadSigner(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "signer")
+	assert.For(ctx, "tempdir").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	signer, err := GenerateDebugSigner()
+	assert.For(ctx, "generate").ThatError(err).Succeeded()
+	key, err := x509.MarshalPKCS8PrivateKey(signer.Key)
+	assert.For(ctx, "marshal").ThatError(err).Succeeded()
+
+	path := filepath.Join(dir, "debug.pem")
+	data := append(
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signer.Certificate.Raw})...)
+	assert.For(ctx, "write").ThatError(ioutil.WriteFile(path, data, 0600)).Succeeded()
+
+	loaded, err := LoadSigner(ctx, path, "", "")
+	assert.For(ctx, "load").ThatError(err).Succeeded()
+	assert.For(ctx, "certificate").That(loaded.Certificate.Equal(signer.Certificate)).Equals(true)
+	assert.For(ctx, "key").That(loaded.Key.(*rsa.PrivateKey).Equal(signer.Key)).Equals(true)
+
+	jks := filepath.Join(dir, "debug.keystore")
+	assert.For(ctx, "write").ThatError(ioutil.WriteFile(jks, []byte{0xfe, 0xed, 0xfe, 0xed, 0, 0, 0, 2}, 0600)).Succeeded()
+	_, err = LoadSigner(ctx, jks, "android", "")
+	assert.For(ctx, "jks").ThatError(err).HasCause(ErrJKSKeyStore)
+}
+
+// pbes2KeyStore is a PKCS#12 key store holding an ECDSA key with the alias
+// androiddebugkey, encrypted with PBES2 and AES-256 using the password
+// "android", as created by recent versions of openssl and keytool.
+const pbes2KeyStore = "" +
+	"MIIEqwIBAzCCBGEGCSqGSIb3DQEHAaCCBFIEggROMIIESjCCAtIGCSqGSIb3DQEHBqCCAsMwggK/" +
+	"AgEAMIICuAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAjyPnL5knEg" +
+	"SwICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEEAKSgteaQXar5/9Ym2vvqQaAggJQvIjp" +
+	"MIIyDgAN0WoGhZvKtpsRlVjjqmUcvn4q3EjGrDPU2ZzDTpZARZz5JACNGxMFgifMFGpaU8A7vTnB" +
+	"6Iy/i6wOhm3JZQ0GzXshOdAV+IHIa0VmEi0pHFK/bIZgad1rV/bP9Pqo/Ocav9ZDIzKhQ8kOCT0E" +
+	"FjngyUeQtW76pUXCTW6nm3WdwIkB4FZ9TvI8tkajyIBUgOIHIENzJII3Sljli8F934R/JrZ9vtrk" +
+	"py4xc4Lj7bxV6ndnpIWUOtEfsW1qnMr3ixQ7RiTOYOspZBip+y9MNLhnqIalyU+ujDSWgmqtqa4A" +
+	"1+wMe6BQzk8oF074Uc1TQDBl0bG6b9c5Qn0NGGaBOhzmej2GUCF5YUso07PcsVoBnZjqq/KO2Rii" +
+	"3MzwWyEwJAiAjpbxtdDyG7Ikp430P8txqxL4r4UCTWBLhvaOI+I5GB2vyZaoShsNgCGCgLhzZ8Hd" +
+	"7e+vd2c5kOP7regormZfdjOVSlvmJ9zGnzlxoua44CV125qlR3QmDNhq1rMey3hS9kni+Vxb+FIS" +
+	"D/TRyTTa5qBdqRSvbv9lD/J6zKAzfo2IzcdNuZgVRAUJdJP5/Ze76ve3XgCLlwdZfOB5l5jjfXW5" +
+	"pANbh2Gvpx5f/E3rtR03rfqJRgOQGhjcXoLyiAgYpoeNvt+fAt4wJTMPMEvlf8sP+j9bKQVeB6bJ" +
+	"FjZKZsooe53df/0eaSTC98n2h728WFWLuXzdoKr0+HWNZm3LbCuXTW2IwhBD9I8Gj1OwEChkLCWJ" +
+	"K6ObW4Ig7z3s8Z7ioevlU4QoizCCAXAGCSqGSIb3DQEHAaCCAWEEggFdMIIBWTCCAVUGCyqGSIb3" +
+	"DQEMCgECoIHvMIHsMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAiAd/zi30XyBwICCAAw" +
+	"DAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEECHiMJ6ZioRx5O2+G3Zcs+sEgZCMGWBMa96d9vdb" +
+	"tF9rdM6O1xLqW5Xn6DQr+5YgKKZG9hshWbS0VZSQZf9jVdVDDzIG0nsMqLmOIe0aNr2r41PgoOgJ" +
+	"aGKGbm8Rxygp5zLy4l3xbG/c00wj+Vg0VYGJDST+241TMrqMLIpxv/EWaOdmZ18kzvVTo2LmG/3U" +
+	"ymPGQuzR04qL+auVtWeEZ8f/Wd0xVDAjBgkqhkiG9w0BCRUxFgQUzj9kNofs0IctgIshHmPhJ40p" +
+	"QnwwLQYJKoZIhvcNAQkUMSAeHgBhAG4AZAByAG8AaQBkAGQAZQBiAHUAZwBrAGUAeTBBMDEwDQYJ" +
+	"YIZIAWUDBAIBBQAEIHJ2ZCPBT9HeUQgsHsJED1VPthhOI6bgd9yQRDvHG2Q/BAgpSv280WNzSAIC" +
+	"CAA="
+
+func TestLoadPBES2KeyStore(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "signer")
+	assert.For(ctx, "tempdir").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	data, err := base64.StdEncoding.DecodeString(pbes2KeyStore)
+	assert.For(ctx, "decode").ThatError(err).Succeeded()
+	path := filepath.Join(dir, "debug.p12")
+	assert.For(ctx, "write").ThatError(ioutil.WriteFile(path, data, 0600)).Succeeded()
+
+	signer, err := LoadSigner(ctx, path, "android", "AndroidDebugKey")
+	assert.For(ctx, "load").ThatError(err).Succeeded()
+	assert.For(ctx, "subject").ThatString(signer.Certificate.Subject.CommonName).Equals("Android Debug")
+	_, isECDSA := signer.Key.(*ecdsa.PrivateKey)
+	assert.For(ctx, "ecdsa").That(isECDSA).Equals(true)
+
+	_, err = LoadSigner(ctx, path, "android", "missing")
+	assert.For(ctx, "alias").ThatError(err).HasCause(ErrMissingKey)
+	_, err = LoadSigner(ctx, path, "wrong", "")
+	assert.For(ctx, "password").ThatError(err).Failed()
+}
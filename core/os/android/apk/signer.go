@@ -0,0 +1,197 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/gapid/core/fault"
+	"github.com/google/gapid/core/log"
+	"golang.org/x/crypto/pkcs12"
+)
+
+const (
+	ErrUnsupportedKey = fault.Const("Unsupported signing key type.")
+	ErrMissingKey     = fault.Const("Couldn't find the signing key.")
+	ErrMissingCert    = fault.Const("Couldn't find the signing certificate.")
+	ErrJKSKeyStore    = fault.Const("JKS key stores are not supported, including debug.keystore files created by older Android SDKs. Convert it to PKCS#12 with 'keytool -importkeystore -srckeystore <keystore> -destkeystore <keystore>.p12 -deststoretype pkcs12', or remove the debug.keystore to sign with a generated debug key.")
+)
+
+// jksMagic is the magic number of Java key stores.
+var jksMagic = []byte{0xfe, 0xed, 0xfe, 0xed}
+
+// Signer holds the private key and certificate used to sign APKs.
+type Signer struct {
+	Key         crypto.Signer
+	Certificate *x509.Certificate
+}
+
+// LoadSigner loads the private key and certificate from the PKCS#12 key store
+// or PEM file at path. Java key stores (JKS) are not supported. password decrypts the PKCS#12 key store, and alias
+// selects the key in it, if not empty.
+func LoadSigner(ctx context.Context, path, password, alias string) (*Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Couldn't read key store %s", path)
+	}
+	var blocks []*pem.Block
+	switch {
+	case bytes.HasPrefix(data, jksMagic):
+		return nil, log.Err(ctx, ErrJKSKeyStore, path)
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		for rest := data; ; {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+	default:
+		if blocks, err = pkcs12.ToPEM(data, password); err != nil {
+			var pbes2Err error
+			if blocks, pbes2Err = decodePBES2KeyStore(data, password); pbes2Err != errUnsupportedEncryption {
+				err = pbes2Err
+			}
+		}
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Couldn't decode key store %s", path)
+		}
+	}
+
+	s := &Signer{}
+	keyID := ""
+	for _, block := range blocks {
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		if name, ok := block.Headers["friendlyName"]; ok && alias != "" && !strings.EqualFold(name, alias) {
+			continue
+		}
+		if s.Key, err = parsePrivateKey(block.Bytes); err != nil {
+			return nil, log.Errf(ctx, err, "Couldn't parse private key in %s", path)
+		}
+		keyID = block.Headers["localKeyId"]
+		break
+	}
+	if s.Key == nil {
+		return nil, log.Errf(ctx, ErrMissingKey, "Key store: %s, alias: %s", path, alias)
+	}
+	for _, block := range blocks {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if id, ok := block.Headers["localKeyId"]; ok && keyID != "" && id != keyID {
+			continue
+		}
+		if s.Certificate, err = x509.ParseCertificate(block.Bytes); err != nil {
+			return nil, log.Errf(ctx, err, "Couldn't parse certificate in %s", path)
+		}
+		break
+	}
+	if s.Certificate == nil {
+		return nil, log.Errf(ctx, ErrMissingCert, "Key store: %s", path)
+	}
+	if _, err := s.algorithm(); err != nil {
+		return nil, log.Err(ctx, err, path)
+	}
+	return s, nil
+}
+
+// GenerateDebugSigner returns a signer using a new RSA key and a self-signed
+// certificate, like the debug key generated by the Android SDK.
+func GenerateDebugSigner() (*Signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "Android Debug",
+			Organization: []string{"Android"},
+			Country:      []string{"US"},
+		},
+		NotBefore: now,
+		NotAfter:  now.AddDate(30, 0, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{Key: key, Certificate: cert}, nil
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		return signer, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// APK signature scheme algorithm IDs.
+const (
+	rsaPKCS1v15WithSHA256 = 0x0103
+	ecdsaWithSHA256       = 0x0201
+)
+
+// algorithm returns the APK signature scheme algorithm ID of the signer.
+func (s *Signer) algorithm() (uint32, error) {
+	switch s.Key.(type) {
+	case *rsa.PrivateKey:
+		return rsaPKCS1v15WithSHA256, nil
+	case *ecdsa.PrivateKey:
+		return ecdsaWithSHA256, nil
+	default:
+		return 0, ErrUnsupportedKey
+	}
+}
+
+// sign returns the signature of the SHA-256 digest of data.
+func (s *Signer) sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return s.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
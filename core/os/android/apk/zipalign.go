@@ -0,0 +1,147 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// zipAlignment is the alignment of the data of uncompressed entries.
+	zipAlignment = 4
+	// libraryAlignment is the alignment of the data of uncompressed shared
+	// libraries, so they can be memory mapped straight from the APK.
+	libraryAlignment = 4096
+	// alignmentExtraID is the ID of the zip extra field used to pad local
+	// file headers, as written by apksigner.
+	alignmentExtraID = 0xd935
+	// fileHeaderLen is the length of a zip local file header, without its
+	// name and extra field.
+	fileHeaderLen = 30
+	// dataDescriptorFlag is the zip header flag signaling the presence of a
+	// data descriptor after the entry data.
+	dataDescriptorFlag = 0x8
+)
+
+// zipEpoch is the modification time of the entries added to APKs. A fixed
+// time keeps the output reproducible.
+var zipEpoch = time.Date(1981, 1, 1, 1, 1, 2, 0, time.UTC)
+
+// ZipAlign copies the entries of the zip file r to w, aligning the data of
+// uncompressed entries to 4 bytes and the data of uncompressed shared
+// libraries to 4096 bytes, like "zipalign -p 4" does.
+func ZipAlign(w io.Writer, r *zip.Reader) error {
+	a := newZipAligner(w)
+	for _, f := range r.File {
+		if err := a.copy(f); err != nil {
+			return err
+		}
+	}
+	return a.close()
+}
+
+// zipAligner writes zip files whose uncompressed entries are aligned.
+type zipAligner struct {
+	out *countingWriter
+	zip *zip.Writer
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newZipAligner(w io.Writer) *zipAligner {
+	out := &countingWriter{w: w}
+	return &zipAligner{out: out, zip: zip.NewWriter(out)}
+}
+
+// copy copies the zip entry f, without recompressing it.
+func (a *zipAligner) copy(f *zip.File) error {
+	r, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	fh := f.FileHeader
+	return a.write(&fh, r)
+}
+
+// store adds an uncompressed entry with the given name and content.
+func (a *zipAligner) store(name string, data []byte) error {
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(data)),
+	}
+	fh.SetModTime(zipEpoch)
+	return a.write(fh, bytes.NewReader(data))
+}
+
+func (a *zipAligner) write(fh *zip.FileHeader, r io.Reader) error {
+	// The sizes and checksum are known, so there is no need for a data
+	// descriptor. The extra fields are dropped, as they may contain the
+	// padding of a previous alignment.
+	fh.Flags &^= dataDescriptorFlag
+	fh.Extra = nil
+	if fh.Method == zip.Store && !strings.HasSuffix(fh.Name, "/") {
+		// Flush the zip writer so the offset of the local header is known.
+		if err := a.zip.Flush(); err != nil {
+			return err
+		}
+		alignment := zipAlignment
+		if strings.HasSuffix(fh.Name, ".so") {
+			alignment = libraryAlignment
+		}
+		fh.Extra = alignmentExtra(a.out.n+fileHeaderLen+int64(len(fh.Name)), alignment)
+	}
+	w, err := a.zip.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (a *zipAligner) close() error {
+	return a.zip.Close()
+}
+
+// alignmentExtra returns the extra field padding data starting after the
+// extra field at offset to the given alignment.
+func alignmentExtra(offset int64, alignment int) []byte {
+	// The field holds its ID, its size and the alignment, followed by the
+	// padding.
+	const headerLen = 6
+	padding := (alignment - int((offset+headerLen)%int64(alignment))) % alignment
+	extra := make([]byte, headerLen+padding)
+	binary.LittleEndian.PutUint16(extra[0:], alignmentExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], uint16(2+padding))
+	binary.LittleEndian.PutUint16(extra[4:], uint16(alignment))
+	return extra
+}
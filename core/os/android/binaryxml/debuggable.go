@@ -15,56 +15,18 @@
 package binaryxml
 
 import (
-	"fmt"
 	"io"
 )
 
-const debuggableAttr uint32 = 0x0101000f
-
-func startElementVisitor(path string, f func(*xmlContext, *xmlStartElement)) chunkVisitor {
-	return func(ctx *xmlContext, c chunk, when int) {
-		xse, ok := c.(*xmlStartElement)
-		if ok && when == afterContextChange && ctx.path() == path {
-			f(ctx, xse)
-		}
-	}
-}
-
 // setManifestApplicationDebuggable sets android:debuggable="true" under the <application/> element of the manifest.
 // The function returns true on success. It will fail if it cannot find the application element.
 func setManifestApplicationDebuggableAttributeToTrue(xml *xmlTree) (success bool) {
-	success = false
-	xml.visit(startElementVisitor("manifest/application", func(ctx *xmlContext, xse *xmlStartElement) {
-		refDebuggable := xml.ensureAttributeNameMapsToResource(debuggableAttr, "debuggable")
-
-		if at, ok := xse.attributes.forName(refDebuggable); ok {
-			at.typedValue = valIntBoolean(true)
-		} else {
-			xse.addAttribute(&xmlAttribute{
-				namespace:  ctx.strings.ref("http://schemas.android.com/apk/res/android"),
-				name:       refDebuggable,
-				rawValue:   invalidStringPoolRef,
-				typedValue: valIntBoolean(true),
-			})
-		}
-		success = true
-	}))
-	return success
+	return SetDebuggable(true)(&Document{xml}) == nil
 }
 
 // SetDebuggableFlag takes a Reader that produces a manifest binary xml,
 // modifies it to set android:debuggable="true" under the <application/> element
 // and writes it to the provided Writer.
 func SetDebuggableFlag(r io.Reader, w io.Writer) error {
-	tree, err := decodeXmlTree(r)
-	if err != nil {
-		return err
-
-	}
-
-	if !setManifestApplicationDebuggableAttributeToTrue(tree) {
-		return fmt.Errorf("error modifying manifest")
-	}
-	_, err = w.Write(tree.encode())
-	return err
+	return Apply(r, w, SetDebuggable(true))
 }
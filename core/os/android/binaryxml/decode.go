@@ -70,6 +70,17 @@ func Decode(ctx context.Context, data []byte) (string, error) {
 	return xmlTree.toXmlString(), nil
 }
 
+// DecodeWithResources decodes a binary Android XML file to a string, replacing
+// the references to resources by their values from the resource table, for the
+// given configuration. References that cannot be resolved are left as is.
+func DecodeWithResources(ctx context.Context, data []byte, resources *ResourceTable, config ResourceConfig) (string, error) {
+	xmlTree, err := decodeXmlTree(bytes.NewReader(data))
+	if err != nil {
+		return "", log.Err(ctx, err, "Decoding binary XML")
+	}
+	return xmlTree.toResolvedXmlString(resources, config), nil
+}
+
 type rootHolder struct {
 	rootNode *xmlTree
 }
@@ -153,8 +164,7 @@ func decodeChunk(r binary.Reader, x *xmlTree) (chunk, error) {
 func decodeLength(r binary.Reader) uint32 {
 	length := uint32(r.Uint16())
 	if length&0x8000 != 0 {
-		panic("UNTESTED CODE")
-		length = (length << 16) | uint32(r.Uint16())
+		length = ((length & 0x7fff) << 16) | uint32(r.Uint16())
 	}
 	return length
 }
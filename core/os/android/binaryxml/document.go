@@ -0,0 +1,318 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binaryxml
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// AndroidNamespace is the namespace of the attributes defined by the Android
+// platform.
+const AndroidNamespace = "http://schemas.android.com/apk/res/android"
+
+// Attribute identifies an attribute of an element.
+type Attribute struct {
+	Namespace  string // Namespace URI, empty for attributes without namespace.
+	Name       string
+	ResourceID uint32 // Resource ID of the attribute, 0 if it has none.
+}
+
+// Attributes defined by the Android platform, used in manifests.
+var (
+	AttrName                 = AndroidAttribute("name", 0x01010003)
+	AttrDebuggable           = AndroidAttribute("debuggable", 0x0101000f)
+	AttrValue                = AndroidAttribute("value", 0x01010024)
+	AttrResource             = AndroidAttribute("resource", 0x01010025)
+	AttrExtractNativeLibs    = AndroidAttribute("extractNativeLibs", 0x010104ea)
+	AttrUsesCleartextTraffic = AndroidAttribute("usesCleartextTraffic", 0x010104ec)
+)
+
+// AndroidAttribute returns the attribute of the Android namespace with the
+// given name and resource ID.
+func AndroidAttribute(name string, resourceID uint32) Attribute {
+	return Attribute{Namespace: AndroidNamespace, Name: name, ResourceID: resourceID}
+}
+
+// Value is the value of an attribute. It is one of StringValue, BoolValue,
+// IntValue or ReferenceValue.
+type Value interface {
+	fmt.Stringer
+	// encode returns the raw and typed values stored in the attribute.
+	encode(x *xmlTree) (stringPoolRef, typedValue)
+}
+
+// StringValue is a string attribute value.
+type StringValue string
+
+// BoolValue is a boolean attribute value.
+type BoolValue bool
+
+// IntValue is an integer attribute value.
+type IntValue int32
+
+// ReferenceValue is an attribute value referencing a resource by its ID.
+type ReferenceValue uint32
+
+func (v StringValue) String() string    { return string(v) }
+func (v BoolValue) String() string      { return valIntBoolean(v).String() }
+func (v IntValue) String() string       { return valIntDec(v).String() }
+func (v ReferenceValue) String() string { return valReference(v).String() }
+
+func (v StringValue) encode(x *xmlTree) (stringPoolRef, typedValue) {
+	ref := x.strings.ref(string(v))
+	return ref, valStringID(ref)
+}
+func (v BoolValue) encode(x *xmlTree) (stringPoolRef, typedValue) {
+	return invalidStringPoolRef, valIntBoolean(v)
+}
+func (v IntValue) encode(x *xmlTree) (stringPoolRef, typedValue) {
+	return invalidStringPoolRef, valIntDec(v)
+}
+func (v ReferenceValue) encode(x *xmlTree) (stringPoolRef, typedValue) {
+	return invalidStringPoolRef, valReference(v)
+}
+
+// Document is a binary XML document that can be edited and encoded back to
+// its binary form.
+//
+// Strings that are no longer used after removing elements or attributes are
+// kept in the string pool.
+type Document struct {
+	tree *xmlTree
+}
+
+// Element is an element of a Document.
+type Element struct {
+	doc   *Document
+	start *xmlStartElement
+}
+
+// DecodeDocument decodes the binary XML document read from r.
+func DecodeDocument(r io.Reader) (*Document, error) {
+	tree, err := decodeXmlTree(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{tree}, nil
+}
+
+// Encode returns the binary form of the document.
+func (d *Document) Encode() []byte {
+	return d.tree.encode()
+}
+
+// String returns the document as text XML.
+func (d *Document) String() string {
+	return d.tree.toXmlString()
+}
+
+// Find returns the elements at the given path, formed of the element names
+// separated by slashes, starting from the root element. For example
+// "manifest/application/activity".
+func (d *Document) Find(path string) []*Element {
+	out := []*Element{}
+	names := []string{}
+	for _, c := range d.tree.chunks {
+		switch c := c.(type) {
+		case *xmlStartElement:
+			names = append(names, c.name.get())
+			if strings.Join(names, "/") == path {
+				out = append(out, &Element{d, c})
+			}
+		case *xmlEndElement:
+			names = names[:len(names)-1]
+		}
+	}
+	return out
+}
+
+// Name returns the name of the element.
+func (e *Element) Name() string {
+	return e.start.name.get()
+}
+
+// Attribute returns the value of the attribute of the element as a string, and
+// whether the element has the attribute.
+func (e *Element) Attribute(attr Attribute) (string, bool) {
+	if a := e.attribute(attr); a != nil {
+		if a.rawValue.isValid() {
+			return a.rawValue.get(), true
+		}
+		return a.typedValue.String(), true
+	}
+	return "", false
+}
+
+// SetAttribute sets the attribute of the element, adding the attribute if the
+// element does not have it yet.
+func (e *Element) SetAttribute(attr Attribute, value Value) {
+	raw, typed := value.encode(e.doc.tree)
+	if a := e.attribute(attr); a != nil {
+		a.rawValue, a.typedValue = raw, typed
+		return
+	}
+	namespace := invalidStringPoolRef
+	if attr.Namespace != "" {
+		namespace = e.doc.tree.strings.ref(attr.Namespace)
+	}
+	var name stringPoolRef
+	if attr.ResourceID != 0 {
+		name = e.doc.tree.ensureAttributeNameMapsToResource(attr.ResourceID, attr.Name)
+	} else {
+		name = e.doc.tree.unmappedString(attr.Name)
+	}
+	e.start.addAttribute(&xmlAttribute{
+		namespace:  namespace,
+		name:       name,
+		rawValue:   raw,
+		typedValue: typed,
+	})
+}
+
+// RemoveAttribute removes the attribute from the element. It returns false if
+// the element does not have the attribute.
+func (e *Element) RemoveAttribute(attr Attribute) bool {
+	for i := range e.start.attributes {
+		if e.matches(&e.start.attributes[i], attr) {
+			e.start.attributes = append(e.start.attributes[:i], e.start.attributes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddChild adds a new element with the given name and no attributes after the
+// last child of the element, and returns it. It fails if the element has been
+// removed from the document.
+func (e *Element) AddChild(name string) (*Element, error) {
+	end, err := e.doc.end(e)
+	if err != nil {
+		return nil, err
+	}
+	x := e.doc.tree
+	start := &xmlStartElement{
+		lineNumber: e.start.lineNumber,
+		comment:    invalidStringPoolRef,
+		namespace:  invalidStringPoolRef,
+		name:       x.strings.ref(name),
+	}
+	start.setRoot(x)
+	endElement := &xmlEndElement{
+		lineNumber: e.start.lineNumber,
+		comment:    invalidStringPoolRef,
+		namespace:  invalidStringPoolRef,
+		name:       start.name,
+	}
+	endElement.setRoot(x)
+	chunks := append([]chunk{start, endElement}, x.chunks[end:]...)
+	x.chunks = append(x.chunks[:end], chunks...)
+	return &Element{e.doc, start}, nil
+}
+
+// Remove removes the element and all its children from the document. It fails
+// if the element has already been removed.
+func (e *Element) Remove() error {
+	x := e.doc.tree
+	start, err := e.doc.index(e)
+	if err != nil {
+		return err
+	}
+	end, err := e.doc.end(e)
+	if err != nil {
+		return err
+	}
+	x.chunks = append(x.chunks[:start], x.chunks[end+1:]...)
+	return nil
+}
+
+func (e *Element) attribute(attr Attribute) *xmlAttribute {
+	for i := range e.start.attributes {
+		if a := &e.start.attributes[i]; e.matches(a, attr) {
+			return a
+		}
+	}
+	return nil
+}
+
+// matches returns true if the attribute a is attr. Attributes with a resource
+// ID are matched by ID, the others by namespace and name.
+func (e *Element) matches(a *xmlAttribute, attr Attribute) bool {
+	id, ok := e.doc.tree.resourceID(a.name)
+	if attr.ResourceID != 0 || ok {
+		return ok && id == attr.ResourceID
+	}
+	namespace := ""
+	if a.namespace.isValid() {
+		namespace = a.namespace.get()
+	}
+	return namespace == attr.Namespace && a.name.get() == attr.Name
+}
+
+// index returns the index of the start chunk of the element.
+func (d *Document) index(e *Element) (int, error) {
+	for i, c := range d.tree.chunks {
+		if c == e.start {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("Element %s is not in the document", e.Name())
+}
+
+// end returns the index of the end chunk of the element.
+func (d *Document) end(e *Element) (int, error) {
+	start, err := d.index(e)
+	if err != nil {
+		return 0, err
+	}
+	depth := 0
+	for i, c := range d.tree.chunks[start:] {
+		switch c.(type) {
+		case *xmlStartElement:
+			depth++
+		case *xmlEndElement:
+			if depth--; depth == 0 {
+				return start + i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("Element %s is not terminated", e.Name())
+}
+
+// resourceID returns the resource ID associated to the string by the resource
+// map, if any.
+func (x *xmlTree) resourceID(s stringPoolRef) (uint32, bool) {
+	if !s.isValid() {
+		return 0, false
+	}
+	if idx := s.stringPoolIndex(); idx < uint32(len(x.resourceMap.ids)) {
+		return x.resourceMap.ids[idx], true
+	}
+	return 0, false
+}
+
+// unmappedString returns a reference to the string, in the part of the pool
+// not associated to resource IDs, adding the string if needed. Attribute names
+// must not be associated to a resource ID unless they are the corresponding
+// attribute.
+func (x *xmlTree) unmappedString(str string) stringPoolRef {
+	for i, ptr := range x.strings.ptrs {
+		if ptr >= len(x.resourceMap.ids) && x.strings.strings[ptr] == str {
+			return stringPoolRef{x.strings, uint32(i)}
+		}
+	}
+	return x.strings.insertStringAtIndex(str, len(x.strings.strings))
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binaryxml
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	manifestPath    = "manifest"
+	applicationPath = "manifest/application"
+)
+
+// Edit is a modification of a binary XML document.
+type Edit func(*Document) error
+
+// Apply decodes the binary XML document read from r, applies the edits in
+// order and writes the modified document to w.
+func Apply(r io.Reader, w io.Writer, edits ...Edit) error {
+	doc, err := DecodeDocument(r)
+	if err != nil {
+		return err
+	}
+	for _, edit := range edits {
+		if err := edit(doc); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(doc.Encode())
+	return err
+}
+
+// SetAttribute returns an edit setting the attribute on all the elements at
+// path. The edit fails if there is no element at path.
+func SetAttribute(path string, attr Attribute, value Value) Edit {
+	return func(d *Document) error {
+		elements := d.Find(path)
+		if len(elements) == 0 {
+			return fmt.Errorf("No element %s to set %s on", path, attr.Name)
+		}
+		for _, e := range elements {
+			e.SetAttribute(attr, value)
+		}
+		return nil
+	}
+}
+
+// RemoveAttribute returns an edit removing the attribute from all the elements
+// at path.
+func RemoveAttribute(path string, attr Attribute) Edit {
+	return func(d *Document) error {
+		for _, e := range d.Find(path) {
+			e.RemoveAttribute(attr)
+		}
+		return nil
+	}
+}
+
+// AttributeValue is an attribute with its value.
+type AttributeValue struct {
+	Attribute Attribute
+	Value     Value
+}
+
+// AddElement returns an edit adding an element with the given name and
+// attributes as the last child of the element at parent. The edit fails if
+// there is not exactly one element at parent.
+func AddElement(parent, name string, attrs ...AttributeValue) Edit {
+	return func(d *Document) error {
+		elements := d.Find(parent)
+		if len(elements) != 1 {
+			return fmt.Errorf("Expected one element %s to add %s to, found %d", parent, name, len(elements))
+		}
+		e, err := elements[0].AddChild(name)
+		if err != nil {
+			return err
+		}
+		for _, a := range attrs {
+			e.SetAttribute(a.Attribute, a.Value)
+		}
+		return nil
+	}
+}
+
+// RemoveElements returns an edit removing the elements at path for which
+// the predicate returns true.
+func RemoveElements(path string, pred func(*Element) bool) Edit {
+	return func(d *Document) error {
+		for _, e := range d.Find(path) {
+			if pred(e) {
+				if err := e.Remove(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// SetDebuggable returns an edit setting android:debuggable on the application
+// element of a manifest.
+func SetDebuggable(debuggable bool) Edit {
+	return SetAttribute(applicationPath, AttrDebuggable, BoolValue(debuggable))
+}
+
+// SetExtractNativeLibs returns an edit setting android:extractNativeLibs on
+// the application element of a manifest.
+func SetExtractNativeLibs(extract bool) Edit {
+	return SetAttribute(applicationPath, AttrExtractNativeLibs, BoolValue(extract))
+}
+
+// SetUsesCleartextTraffic returns an edit setting android:usesCleartextTraffic
+// on the application element of a manifest.
+func SetUsesCleartextTraffic(cleartext bool) Edit {
+	return SetAttribute(applicationPath, AttrUsesCleartextTraffic, BoolValue(cleartext))
+}
+
+// AddUsesPermission returns an edit adding a <uses-permission> element for
+// the permission to a manifest, unless it already requests it.
+func AddUsesPermission(permission string) Edit {
+	return func(d *Document) error {
+		for _, e := range d.Find(manifestPath + "/uses-permission") {
+			if name, _ := e.Attribute(AttrName); name == permission {
+				return nil
+			}
+		}
+		return AddElement(manifestPath, "uses-permission",
+			AttributeValue{AttrName, StringValue(permission)},
+		)(d)
+	}
+}
+
+// SetMetaData returns an edit setting the value of the <meta-data> element
+// with the given name under the application element of a manifest, adding
+// the element if needed.
+func SetMetaData(name string, value Value) Edit {
+	return func(d *Document) error {
+		for _, e := range d.Find(applicationPath + "/meta-data") {
+			if n, _ := e.Attribute(AttrName); n == name {
+				e.RemoveAttribute(AttrResource)
+				e.SetAttribute(AttrValue, value)
+				return nil
+			}
+		}
+		return AddElement(applicationPath, "meta-data",
+			AttributeValue{AttrName, StringValue(name)},
+			AttributeValue{AttrValue, value},
+		)(d)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binaryxml
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+)
+
+func TestEditManifest(t *testing.T) {
+	assert := assert.To(t)
+	for _, fn := range []string{
+		"testdata/manifest1.binxml",
+		"testdata/manifest2.binxml",
+		"testdata/manifest4.binxml",
+		"testdata/manifest6.binxml",
+	} {
+		f, err := os.Open(fn)
+		assert.For("err").ThatError(err).Succeeded()
+		defer f.Close()
+
+		var out bytes.Buffer
+		err = Apply(f, &out,
+			SetDebuggable(true),
+			SetExtractNativeLibs(true),
+			SetUsesCleartextTraffic(false),
+			AddUsesPermission("android.permission.INTERNET"),
+			AddUsesPermission("android.permission.INTERNET"),
+			SetMetaData("com.example.key", StringValue("some value")),
+			SetMetaData("com.example.number", IntValue(42)),
+			AddElement("manifest", "queries"),
+		)
+		assert.For("%s apply err", fn).ThatError(err).Succeeded()
+
+		// Re-decode the encoded document to check the round-trip.
+		doc, err := DecodeDocument(bytes.NewReader(out.Bytes()))
+		assert.For("%s decode err", fn).ThatError(err).Succeeded()
+		xml := doc.String()
+		assert.For("%s xml", fn).ThatString(xml).Contains(`android:debuggable="true"`)
+		assert.For("%s xml", fn).ThatString(xml).Contains(`android:extractNativeLibs="true"`)
+		assert.For("%s xml", fn).ThatString(xml).Contains(`android:usesCleartextTraffic="false"`)
+		assert.For("%s xml", fn).ThatString(xml).Contains(`<queries>`)
+
+		app := doc.Find("manifest/application")
+		assert.For("%s applications", fn).That(len(app)).Equals(1)
+		debuggable, ok := app[0].Attribute(AttrDebuggable)
+		assert.For("%s debuggable", fn).That(ok).Equals(true)
+		assert.For("%s debuggable", fn).ThatString(debuggable).Equals("true")
+
+		internet := 0
+		for _, e := range doc.Find("manifest/uses-permission") {
+			if name, _ := e.Attribute(AttrName); name == "android.permission.INTERNET" {
+				internet++
+			}
+		}
+		assert.For("%s INTERNET permissions", fn).That(internet).Equals(1)
+
+		metadata := map[string]string{}
+		for _, e := range doc.Find("manifest/application/meta-data") {
+			name, _ := e.Attribute(AttrName)
+			value, _ := e.Attribute(AttrValue)
+			metadata[name] = value
+		}
+		assert.For("%s key", fn).ThatString(metadata["com.example.key"]).Equals("some value")
+		assert.For("%s number", fn).ThatString(metadata["com.example.number"]).Equals("42")
+
+		// Attribute names must map to their resource IDs for Android to find them.
+		for _, e := range doc.Find("manifest/application") {
+			for _, a := range e.start.attributes {
+				if a.name.get() == "extractNativeLibs" {
+					id, ok := doc.tree.resourceID(a.name)
+					assert.For("%s resource ID", fn).That(ok).Equals(true)
+					assert.For("%s resource ID", fn).That(id).Equals(AttrExtractNativeLibs.ResourceID)
+				}
+			}
+		}
+	}
+}
+
+func TestRemoveFromManifest(t *testing.T) {
+	assert := assert.To(t)
+	f, err := os.Open("testdata/manifest1.binxml")
+	assert.For("err").ThatError(err).Succeeded()
+	defer f.Close()
+
+	doc, err := DecodeDocument(f)
+	assert.For("err").ThatError(err).Succeeded()
+	activities := len(doc.Find("manifest/application/activity"))
+	assert.For("activities").That(activities > 1).Equals(true)
+
+	err = RemoveElements("manifest/application/activity", func(e *Element) bool {
+		_, hasTheme := e.Attribute(AndroidAttribute("theme", 0x01010000))
+		return !hasTheme
+	})(doc)
+	assert.For("err").ThatError(err).Succeeded()
+	for _, e := range doc.Find("manifest/application/activity") {
+		_, hasTheme := e.Attribute(AndroidAttribute("theme", 0x01010000))
+		assert.For("theme").That(hasTheme).Equals(true)
+	}
+
+	app := doc.Find("manifest/application")[0]
+	_, hasIcon := app.Attribute(AndroidAttribute("icon", 0x01010002))
+	assert.For("icon").That(hasIcon).Equals(true)
+	assert.For("removed").That(app.RemoveAttribute(AndroidAttribute("icon", 0x01010002))).Equals(true)
+	assert.For("removed twice").That(app.RemoveAttribute(AndroidAttribute("icon", 0x01010002))).Equals(false)
+
+	redecoded, err := DecodeDocument(bytes.NewReader(doc.Encode()))
+	assert.For("err").ThatError(err).Succeeded()
+	assert.For("xml").ThatString(redecoded.String()).Equals(doc.String())
+	_, hasIcon = redecoded.Find("manifest/application")[0].Attribute(AndroidAttribute("icon", 0x01010002))
+	assert.For("icon").That(hasIcon).Equals(false)
+}
+
+func TestRemovedElement(t *testing.T) {
+	assert := assert.To(t)
+	f, err := os.Open("testdata/manifest1.binxml")
+	assert.For("err").ThatError(err).Succeeded()
+	defer f.Close()
+
+	doc, err := DecodeDocument(f)
+	assert.For("err").ThatError(err).Succeeded()
+	app := doc.Find("manifest/application")[0]
+	child, err := app.AddChild("queries")
+	assert.For("add err").ThatError(err).Succeeded()
+	assert.For("remove").ThatError(app.Remove()).Succeeded()
+
+	assert.For("remove twice").ThatError(app.Remove()).Failed()
+	_, err = app.AddChild("queries")
+	assert.For("add to removed").ThatError(err).Failed()
+	assert.For("remove child").ThatError(child.Remove()).Failed()
+}
@@ -0,0 +1,168 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binaryxml
+
+import (
+	"bytes"
+
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/os/device"
+)
+
+// Special screen densities.
+const (
+	DensityDefault = 0
+	DensityMedium  = 160
+	DensityAny     = 0xfffe
+	DensityNone    = 0xffff
+)
+
+// ResourceConfig is the device configuration used to select between the
+// alternative values of a resource. Zero fields match any value.
+//
+// Only the locale, screen density and platform version are supported.
+// Alternative values using other qualifiers, such as the screen orientation
+// or night mode, are only used when no other value is available.
+type ResourceConfig struct {
+	Language   string // ISO 639 language code, such as "en".
+	Region     string // ISO 3166-1 region code, such as "US".
+	Density    uint16 // Screen density in dots per inch.
+	SDKVersion uint16 // Android API level.
+
+	// otherQualifiers is true for resource values using qualifiers that are
+	// not supported.
+	otherQualifiers bool
+}
+
+// decodeResourceConfig decodes a ResTable_config structure.
+func decodeResourceConfig(data []byte) ResourceConfig {
+	r := endian.Reader(bytes.NewReader(data), device.LittleEndian)
+	size := r.Uint32()
+	if int(size) < len(data) {
+		data = data[:size]
+	}
+	// Pad to the largest known size, so that older, smaller, structures read
+	// zeros for the missing fields.
+	padded := make([]byte, 64)
+	copy(padded, data)
+	r = endian.Reader(bytes.NewReader(padded[4:]), device.LittleEndian)
+
+	c := ResourceConfig{}
+	other := uint64(r.Uint32()) // mcc, mnc
+	language, region := [2]byte{}, [2]byte{}
+	r.Data(language[:])
+	r.Data(region[:])
+	c.Language = unpackLocale(language, 'a')
+	c.Region = unpackLocale(region, '0')
+	other |= uint64(r.Uint8()) // orientation
+	other |= uint64(r.Uint8()) // touchscreen
+	c.Density = r.Uint16()
+	other |= uint64(r.Uint32()) // keyboard, navigation, inputFlags, pad
+	other |= uint64(r.Uint32()) // screenWidth, screenHeight
+	c.SDKVersion = r.Uint16()
+	r.Uint16()                  // minorVersion, always 0
+	other |= uint64(r.Uint32()) // screenLayout, uiMode, smallestScreenWidthDp
+	other |= uint64(r.Uint32()) // screenWidthDp, screenHeightDp
+	r.Data(make([]byte, 12))    // localeScript, localeVariant
+	other |= uint64(r.Uint16()) // screenLayout2, colorMode
+	c.otherQualifiers = other != 0
+	return c
+}
+
+// unpackLocale returns the language or region code packed in in.
+func unpackLocale(in [2]byte, base byte) string {
+	switch {
+	case in[0] == 0:
+		return ""
+	case in[0]&0x80 != 0:
+		// Three letter code, packed on 5 bits per letter.
+		first := in[1] & 0x1f
+		second := ((in[1] & 0xe0) >> 5) | ((in[0] & 0x03) << 3)
+		third := (in[0] & 0x7c) >> 2
+		return string([]byte{first + base, second + base, third + base})
+	default:
+		return string(in[:])
+	}
+}
+
+// matches returns true if the resource values for the configuration c can be
+// used on a device with the requested configuration.
+func (c ResourceConfig) matches(requested ResourceConfig) bool {
+	if c.Language != "" && requested.Language != "" && c.Language != requested.Language {
+		return false
+	}
+	if c.Region != "" && requested.Region != "" && c.Region != requested.Region {
+		return false
+	}
+	if c.SDKVersion != 0 && requested.SDKVersion != 0 && c.SDKVersion > requested.SDKVersion {
+		return false
+	}
+	return true
+}
+
+// isBetterThan returns true if the resource values for the configuration c
+// are a better match than the ones for o, on a device with the requested
+// configuration. Both c and o must match the requested configuration.
+func (c ResourceConfig) isBetterThan(o, requested ResourceConfig) bool {
+	if c.otherQualifiers != o.otherQualifiers {
+		return !c.otherQualifiers
+	}
+	if c.Language != o.Language && requested.Language != "" {
+		return c.Language != ""
+	}
+	if c.Region != o.Region && requested.Region != "" {
+		return c.Region != ""
+	}
+	if c.Density != o.Density {
+		return isBetterDensity(c.Density, o.Density, requested.Density)
+	}
+	return c.SDKVersion > o.SDKVersion
+}
+
+// isBetterDensity returns true if the resources for density a are a better
+// match than the ones for density b on a device with the requested density.
+// Resources for a higher density, to be scaled down, are preferred over
+// resources for a lower density, to be scaled up.
+func isBetterDensity(a, b, requested uint16) bool {
+	switch {
+	case a == DensityAny:
+		return true
+	case b == DensityAny:
+		return false
+	}
+	if requested == DensityDefault {
+		requested = DensityMedium
+	}
+	if a == DensityDefault {
+		a = DensityMedium
+	}
+	if b == DensityDefault {
+		b = DensityMedium
+	}
+	switch {
+	case a == b:
+		return false
+	case a == DensityNone || a == requested:
+		return true
+	case b == DensityNone || b == requested:
+		return false
+	case a > requested && b > requested:
+		return a < b
+	case a < requested && b < requested:
+		return a > b
+	default:
+		return a > requested
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binaryxml
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"unicode/utf16"
+
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/os/device"
+)
+
+// AOSP references:
+// https://android.googlesource.com/platform/frameworks/base/+/master/libs/androidfw/include/androidfw/ResourceTypes.h
+// https://android.googlesource.com/platform/frameworks/base/+/master/tools/aapt2/format/binary/TableFlattener.cpp
+
+const (
+	// Flags of the type chunks.
+	typeFlagSparse   = 0x01
+	typeFlagOffset16 = 0x02
+
+	// Flags of the entries.
+	entryFlagComplex = 0x01
+	entryFlagCompact = 0x08
+
+	noEntry   = 0xffffffff
+	noEntry16 = 0xffff
+
+	// maxReferenceDepth limits the chains of references followed when
+	// resolving a resource, to detect cycles.
+	maxReferenceDepth = 32
+)
+
+// ResourceTable is a decoded resources.arsc file, mapping resource IDs to
+// their values for each configuration.
+type ResourceTable struct {
+	strings  *stringPool
+	packages map[uint8]*resourcePackage
+}
+
+type resourcePackage struct {
+	id       uint8
+	name     string
+	typeName *stringPool
+	keyName  *stringPool
+	types    map[uint8][]*resourceType
+}
+
+// resourceType holds the entries of a resource type for one configuration.
+type resourceType struct {
+	config  ResourceConfig
+	entries map[uint16]resourceEntry
+}
+
+type resourceEntry struct {
+	key     uint32
+	complex bool
+	value   resourceValue
+}
+
+type resourceValue struct {
+	ty   valueType
+	data uint32
+}
+
+// DecodeResourceTable decodes the resources.arsc file of an APK.
+func DecodeResourceTable(data []byte) (*ResourceTable, error) {
+	// The header only holds the package count.
+	ty, _, body, _, err := splitChunk(data)
+	if err != nil {
+		return nil, err
+	}
+	if ty != resTableType {
+		return nil, fmt.Errorf("Expected resource table, found chunk type 0x%x", ty)
+	}
+
+	t := &ResourceTable{packages: map[uint8]*resourcePackage{}}
+	for len(body) > 0 {
+		ty, header, data, rest, err := splitChunk(body)
+		if err != nil {
+			return nil, err
+		}
+		switch ty {
+		case resStringPoolType:
+			if t.strings != nil {
+				return nil, fmt.Errorf("Unexpected second global string pool")
+			}
+			t.strings = &stringPool{}
+			if err := t.strings.decode(header, data); err != nil {
+				return nil, err
+			}
+		case resTablePackageType:
+			p, err := decodeResourcePackage(header, data)
+			if err != nil {
+				return nil, err
+			}
+			t.packages[p.id] = p
+		}
+		body = rest
+	}
+	if t.strings == nil {
+		return nil, fmt.Errorf("Resource table has no string pool")
+	}
+	return t, nil
+}
+
+// splitChunk splits the chunk at the start of data into its type, header and
+// body, and returns the data following the chunk.
+func splitChunk(data []byte) (ty uint16, header, body, rest []byte, err error) {
+	r := endian.Reader(bytes.NewReader(data), device.LittleEndian)
+	ty = r.Uint16()
+	headerSize := uint32(r.Uint16())
+	size := r.Uint32()
+	if err := r.Error(); err != nil {
+		return 0, nil, nil, nil, fmt.Errorf("Truncated chunk header: %v", err)
+	}
+	if headerSize < 8 || headerSize > size || size > uint32(len(data)) {
+		return 0, nil, nil, nil, fmt.Errorf("Invalid chunk of type 0x%x: header size %d, size %d, %d bytes available",
+			ty, headerSize, size, len(data))
+	}
+	return ty, data[8:headerSize], data[headerSize:size], data[size:], nil
+}
+
+func decodeResourcePackage(header, data []byte) (*resourcePackage, error) {
+	r := endian.Reader(bytes.NewReader(header), device.LittleEndian)
+	p := &resourcePackage{types: map[uint8][]*resourceType{}}
+	p.id = uint8(r.Uint32())
+	name := make([]uint16, 128)
+	for i := range name {
+		name[i] = r.Uint16()
+	}
+	for i, c := range name {
+		if c == 0 {
+			name = name[:i]
+			break
+		}
+	}
+	p.name = string(utf16.Decode(name))
+	typeStrings := r.Uint32()
+	r.Uint32() // lastPublicType
+	keyStrings := r.Uint32()
+	if err := r.Error(); err != nil {
+		return nil, fmt.Errorf("Truncated package header: %v", err)
+	}
+
+	// Offsets are relative to the start of the package chunk.
+	offset := uint32(8 + len(header))
+	for len(data) > 0 {
+		ty, header, body, rest, err := splitChunk(data)
+		if err != nil {
+			return nil, err
+		}
+		switch ty {
+		case resStringPoolType:
+			pool := &stringPool{}
+			if err := pool.decode(header, body); err != nil {
+				return nil, err
+			}
+			switch offset {
+			case typeStrings:
+				p.typeName = pool
+			case keyStrings:
+				p.keyName = pool
+			}
+		case resTableTypeType:
+			id, t, err := decodeResourceType(header, body)
+			if err != nil {
+				return nil, err
+			}
+			p.types[id] = append(p.types[id], t)
+		}
+		offset += uint32(len(data) - len(rest))
+		data = rest
+	}
+	if p.typeName == nil || p.keyName == nil {
+		return nil, fmt.Errorf("Package %s is missing its type or key string pool", p.name)
+	}
+	return p, nil
+}
+
+func decodeResourceType(header, data []byte) (uint8, *resourceType, error) {
+	r := endian.Reader(bytes.NewReader(header), device.LittleEndian)
+	id := r.Uint8()
+	flags := r.Uint8()
+	r.Uint16() // reserved
+	entryCount := r.Uint32()
+	entriesStart := r.Uint32()
+	if err := r.Error(); err != nil {
+		return 0, nil, fmt.Errorf("Truncated type header: %v", err)
+	}
+	t := &resourceType{entries: map[uint16]resourceEntry{}}
+	t.config = decodeResourceConfig(header[12:])
+
+	// entriesStart is relative to the start of the chunk.
+	start := int(entriesStart) - 8 - len(header)
+	if start < 0 || start > len(data) {
+		return 0, nil, fmt.Errorf("Invalid entries start %d", entriesStart)
+	}
+	entries := data[start:]
+
+	r = endian.Reader(bytes.NewReader(data), device.LittleEndian)
+	for i := uint32(0); i < entryCount; i++ {
+		idx, offset := uint16(i), uint32(0)
+		switch {
+		case flags&typeFlagSparse != 0:
+			idx, offset = r.Uint16(), uint32(r.Uint16())*4
+		case flags&typeFlagOffset16 != 0:
+			if offset = uint32(r.Uint16()); offset == noEntry16 {
+				continue
+			}
+			offset *= 4
+		default:
+			if offset = r.Uint32(); offset == noEntry {
+				continue
+			}
+		}
+		if err := r.Error(); err != nil {
+			return 0, nil, fmt.Errorf("Truncated entry offsets: %v", err)
+		}
+		if int(offset) >= len(entries) {
+			return 0, nil, fmt.Errorf("Invalid entry offset %d", offset)
+		}
+		e, err := decodeResourceEntry(entries[offset:])
+		if err != nil {
+			return 0, nil, err
+		}
+		t.entries[idx] = e
+	}
+	return id, t, nil
+}
+
+func decodeResourceEntry(data []byte) (resourceEntry, error) {
+	r := endian.Reader(bytes.NewReader(data), device.LittleEndian)
+	size := r.Uint16()
+	flags := r.Uint16()
+	key := r.Uint32()
+	e := resourceEntry{key: key}
+	switch {
+	case flags&entryFlagCompact != 0:
+		// The key is stored in the size, the value type in the high bits of
+		// the flags and the value data in the key.
+		e.key = uint32(size)
+		e.value = resourceValue{ty: valueType(flags >> 8), data: key}
+	case flags&entryFlagComplex != 0:
+		// Bags (styles, arrays, plurals...) are not decoded.
+		e.complex = true
+	default:
+		if int(size) > len(data) {
+			return e, fmt.Errorf("Invalid entry size %d", size)
+		}
+		r = endian.Reader(bytes.NewReader(data[size:]), device.LittleEndian)
+		r.Uint16() // size
+		r.Uint8()  // res0
+		e.value.ty = valueType(r.Uint8())
+		e.value.data = r.Uint32()
+	}
+	if err := r.Error(); err != nil {
+		return e, fmt.Errorf("Truncated entry: %v", err)
+	}
+	return e, nil
+}
+
+// Resolve returns the value of the resource with the given ID for the
+// configuration, following references to other resources.
+func (t *ResourceTable) Resolve(id uint32, config ResourceConfig) (string, error) {
+	for depth := 0; depth < maxReferenceDepth; depth++ {
+		e, err := t.lookup(id, config)
+		if err != nil {
+			return "", err
+		}
+		if e.complex {
+			return "", fmt.Errorf("Resource %s is not a simple value", t.ResourceName(id))
+		}
+		if e.value.ty != typeReference {
+			return t.format(e.value), nil
+		}
+		id = e.value.data
+	}
+	return "", fmt.Errorf("Too many levels of references resolving resource %s", t.ResourceName(id))
+}
+
+// ResourceName returns the name of the resource with the given ID, in the
+// @[package:]type/name form, or the ID itself if the resource is unknown.
+func (t *ResourceTable) ResourceName(id uint32) string {
+	p, ok := t.packages[uint8(id>>24)]
+	if !ok {
+		return valReference(id).String()
+	}
+	typeID, entryID := uint8(id>>16), uint16(id)
+	for _, ty := range p.types[typeID] {
+		if e, ok := ty.entries[entryID]; ok && typeID > 0 && int(typeID) <= len(p.typeName.strings) && int(e.key) < len(p.keyName.strings) {
+			name := p.typeName.strings[typeID-1] + "/" + p.keyName.strings[e.key]
+			if len(t.packages) > 1 {
+				return "@" + p.name + ":" + name
+			}
+			return "@" + name
+		}
+	}
+	return valReference(id).String()
+}
+
+func (t *ResourceTable) lookup(id uint32, config ResourceConfig) (resourceEntry, error) {
+	p, ok := t.packages[uint8(id>>24)]
+	if !ok {
+		return resourceEntry{}, fmt.Errorf("Resource 0x%x belongs to an unknown package", id)
+	}
+	var best *resourceType
+	var bestEntry resourceEntry
+	for _, ty := range p.types[uint8(id>>16)] {
+		e, ok := ty.entries[uint16(id)]
+		if !ok || !ty.config.matches(config) {
+			continue
+		}
+		if best == nil || ty.config.isBetterThan(best.config, config) {
+			best, bestEntry = ty, e
+		}
+	}
+	if best == nil {
+		return resourceEntry{}, fmt.Errorf("No value for resource 0x%x", id)
+	}
+	return bestEntry, nil
+}
+
+func (t *ResourceTable) format(v resourceValue) string {
+	switch v.ty {
+	case typeString:
+		if int(v.data) < len(t.strings.strings) {
+			return t.strings.strings[v.data]
+		}
+		return fmt.Sprintf("String<0x%x>", v.data)
+	case typeNull:
+		return ""
+	case typeIntDec:
+		return valIntDec(int32(v.data)).String()
+	case typeIntHex:
+		return valIntHex(v.data).String()
+	case typeIntBoolean:
+		return valIntBoolean(v.data != 0).String()
+	case typeFloat:
+		return valFloat(math.Float32frombits(v.data)).String()
+	case typeIntColorARGB8, typeIntColorRGB8, typeIntColorARGB4, typeIntColorRGB4:
+		return fmt.Sprintf("#%08x", v.data)
+	case typeAttribute:
+		return fmt.Sprintf("?0x%x", v.data)
+	case typeDimension:
+		var b bytes.Buffer
+		endian.Writer(&b, device.LittleEndian).Uint32(v.data)
+		if d, err := decodeDimension(endian.Reader(&b, device.LittleEndian)); err == nil {
+			return d.String()
+		}
+	}
+	return fmt.Sprintf("%v<0x%x>", v.ty, v.data)
+}
@@ -0,0 +1,219 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binaryxml
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/os/device"
+)
+
+// IDs of the resources referenced by testdata/manifest1.binxml.
+const (
+	testPackageID = 0x7f
+	testStringID  = 0x0b
+	testMipmapID  = 0x03
+	appNameID     = 0x7f0b03fd
+	appAliasID    = 0x7f0b0000
+	iconID        = 0x7f030000
+)
+
+type testEntry struct {
+	id    uint16
+	key   uint32
+	ty    valueType
+	value uint32
+}
+
+func encodeTestConfig(w binary.Writer, language string, density, sdk uint16) {
+	w.Uint32(64)
+	w.Uint32(0) // mcc, mnc
+	lang := [4]byte{}
+	copy(lang[:], language)
+	w.Data(lang[:]) // language, country
+	w.Uint16(0)     // orientation, touchscreen
+	w.Uint16(density)
+	w.Uint32(0) // keyboard, navigation, inputFlags, pad
+	w.Uint32(0) // screenWidth, screenHeight
+	w.Uint16(sdk)
+	w.Data(make([]byte, 64-26))
+}
+
+func encodeTestType(id uint8, language string, density, sdk uint16, entries ...testEntry) []byte {
+	const headerSize = 8 + 12 + 64
+	return encodeChunk(resTableTypeType, func(w binary.Writer) {
+		w.Uint8(id)
+		w.Uint8(typeFlagSparse)
+		w.Uint16(0)
+		w.Uint32(uint32(len(entries)))
+		w.Uint32(uint32(headerSize + 4*len(entries)))
+		encodeTestConfig(w, language, density, sdk)
+	}, func(w binary.Writer) {
+		for i, e := range entries {
+			w.Uint16(e.id)
+			w.Uint16(uint16(i * 16 / 4))
+		}
+		for _, e := range entries {
+			w.Uint16(8) // size
+			w.Uint16(0) // flags
+			w.Uint32(e.key)
+			w.Uint16(8) // size
+			w.Uint8(0)  // res0
+			w.Uint8(uint8(e.ty))
+			w.Uint32(e.value)
+		}
+	})
+}
+
+func encodeTestPool(strings ...string) []byte {
+	p := &stringPool{strings: strings}
+	return p.encode()
+}
+
+func encodeTestResourceTable() []byte {
+	globalStrings := encodeTestPool(
+		"My App",
+		"Mon App",
+		"res/mipmap-mdpi/ic_launcher.png",
+		"res/mipmap-xxxhdpi/ic_launcher.png",
+		"res/mipmap-anydpi-v26/ic_launcher.xml",
+	)
+	typeNames := make([]string, testStringID)
+	typeNames[testMipmapID-1] = "mipmap"
+	typeNames[testStringID-1] = "string"
+	typeStrings := encodeTestPool(typeNames...)
+	keyStrings := encodeTestPool("app_name", "app_alias", "ic_launcher")
+	types := [][]byte{
+		encodeTestType(testStringID, "", 0, 0,
+			testEntry{0x0000, 1, typeReference, appNameID},
+			testEntry{0x03fd, 0, typeString, 0}),
+		encodeTestType(testStringID, "fr", 0, 0,
+			testEntry{0x03fd, 0, typeString, 1}),
+		encodeTestType(testMipmapID, "", DensityMedium, 4,
+			testEntry{0x0000, 2, typeString, 2}),
+		encodeTestType(testMipmapID, "", 640, 4,
+			testEntry{0x0000, 2, typeString, 3}),
+		encodeTestType(testMipmapID, "", DensityAny, 26,
+			testEntry{0x0000, 2, typeString, 4}),
+	}
+
+	pkg := encodeChunk(resTablePackageType, func(w binary.Writer) {
+		const headerSize = 8 + 4 + 256 + 5*4
+		w.Uint32(testPackageID)
+		name := make([]uint16, 128)
+		for i, c := range "com.example" {
+			name[i] = uint16(c)
+		}
+		for _, c := range name {
+			w.Uint16(c)
+		}
+		w.Uint32(headerSize)                            // typeStrings
+		w.Uint32(0)                                     // lastPublicType
+		w.Uint32(uint32(headerSize + len(typeStrings))) // keyStrings
+		w.Uint32(0)                                     // lastPublicKey
+		w.Uint32(0)                                     // typeIdOffset
+	}, func(w binary.Writer) {
+		w.Data(typeStrings)
+		w.Data(keyStrings)
+		for _, t := range types {
+			w.Data(t)
+		}
+	})
+
+	return encodeChunk(resTableType, func(w binary.Writer) {
+		w.Uint32(1) // packageCount
+	}, func(w binary.Writer) {
+		w.Data(globalStrings)
+		w.Data(pkg)
+	})
+}
+
+func TestResourceTable(t *testing.T) {
+	assert := assert.To(t)
+	table, err := DecodeResourceTable(encodeTestResourceTable())
+	assert.For("err").ThatError(err).Succeeded()
+
+	for _, test := range []struct {
+		id       uint32
+		config   ResourceConfig
+		expected string
+	}{
+		{appNameID, ResourceConfig{}, "My App"},
+		{appNameID, ResourceConfig{Language: "en"}, "My App"},
+		{appNameID, ResourceConfig{Language: "fr", Region: "CA"}, "Mon App"},
+		{appAliasID, ResourceConfig{Language: "fr"}, "Mon App"},
+		{iconID, ResourceConfig{}, "res/mipmap-anydpi-v26/ic_launcher.xml"},
+		{iconID, ResourceConfig{Density: 640, SDKVersion: 25}, "res/mipmap-xxxhdpi/ic_launcher.png"},
+		{iconID, ResourceConfig{Density: 320, SDKVersion: 25}, "res/mipmap-xxxhdpi/ic_launcher.png"},
+		{iconID, ResourceConfig{Density: 120, SDKVersion: 25}, "res/mipmap-mdpi/ic_launcher.png"},
+		{iconID, ResourceConfig{Density: 120, SDKVersion: 26}, "res/mipmap-anydpi-v26/ic_launcher.xml"},
+	} {
+		value, err := table.Resolve(test.id, test.config)
+		assert.For("err").ThatError(err).Succeeded()
+		assert.For("0x%x %+v", test.id, test.config).ThatString(value).Equals(test.expected)
+	}
+
+	_, err = table.Resolve(0x7f0b0001, ResourceConfig{})
+	assert.For("missing err").ThatError(err).Failed()
+
+	assert.For("name").ThatString(table.ResourceName(appNameID)).Equals("@string/app_name")
+	assert.For("name").ThatString(table.ResourceName(iconID)).Equals("@mipmap/ic_launcher")
+	assert.For("name").ThatString(table.ResourceName(0x01010000)).Equals("@0x1010000")
+}
+
+func TestDecodeWithResources(t *testing.T) {
+	assert := assert.To(t)
+	table, err := DecodeResourceTable(encodeTestResourceTable())
+	assert.For("err").ThatError(err).Succeeded()
+
+	data, err := ioutil.ReadFile("testdata/manifest1.binxml")
+	assert.For("err").ThatError(err).Succeeded()
+
+	xml, err := DecodeWithResources(context.Background(), data, table, ResourceConfig{Language: "fr", Density: 480, SDKVersion: 23})
+	assert.For("err").ThatError(err).Succeeded()
+	assert.For("xml").ThatString(xml).Contains(`android:label="Mon App"`)
+	assert.For("xml").ThatString(xml).Contains(`android:icon="res/mipmap-xxxhdpi/ic_launcher.png"`)
+	// Unknown resources are left as references.
+	assert.For("xml").ThatString(xml).Contains(`android:theme="@0x1030010"`)
+}
+
+func TestUTF8StringPool(t *testing.T) {
+	assert := assert.To(t)
+	chunk := encodeChunk(resStringPoolType, func(w binary.Writer) {
+		w.Uint32(2)        // stringCount
+		w.Uint32(0)        // styleCount
+		w.Uint32(utf8Flag) // flags
+		w.Uint32(8 + 20 + 2*4)
+		w.Uint32(0) // stylesStart
+	}, func(w binary.Writer) {
+		w.Uint32(0)
+		w.Uint32(6)
+		w.Data([]byte{3, 3, 'a', 'b', 'c', 0})
+		w.Data([]byte{1, 2, 0xc3, 0xa9, 0, 0})
+	})
+
+	tree := &xmlTree{}
+	c, err := decodeChunk(endian.Reader(bytes.NewReader(chunk), device.LittleEndian), tree)
+	assert.For("err").ThatError(err).Succeeded()
+	pool, ok := c.(*stringPool)
+	assert.For("pool").That(ok).Equals(true)
+	assert.For("strings").ThatSlice(pool.strings).Equals([]string{"abc", "é"})
+}
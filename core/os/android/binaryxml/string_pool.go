@@ -61,15 +61,27 @@ func (r stringPoolRef) get() string {
 type stringPool struct {
 	rootHolder
 	strings []string
-	styles  []string
+	styles  [][]stringPoolSpan // styles[i] are the spans of strings[i].
 	flags   uint32
 	ptrs    []int // ptrs maps indices in stringPoolRefs to indices in the raw strings array.
 }
 
-func (c *stringPool) decode(header, data []byte) error {
-	const sortedFlag = 1 << 0
-	const utf8Flag = 1 << 8
+// stringPoolSpan is a span of characters of a styled string, with the style
+// named by a string of the pool applied to it.
+type stringPoolSpan struct {
+	name      uint32 // index of the style name in the raw strings array.
+	firstChar uint32
+	lastChar  uint32 // inclusive
+}
 
+const (
+	sortedFlag = 1 << 0
+	utf8Flag   = 1 << 8
+
+	spanEnd = 0xffffffff
+)
+
+func (c *stringPool) decode(header, data []byte) error {
 	// dataOffset is the offset of data relative to the start of the chunk.
 	dataOffset := 8 + uint32(len(header))
 
@@ -85,15 +97,22 @@ func (c *stringPool) decode(header, data []byte) error {
 	for i := range indices {
 		indices[i] = r.Uint32()
 	}
+	styleIndices := make([]uint32, styleCount)
+	for i := range styleIndices {
+		styleIndices[i] = r.Uint32()
+	}
 
 	c.ptrs = make([]int, stringCount)
 	c.strings = make([]string, stringCount)
-	c.styles = make([]string, styleCount)
+	c.styles = make([][]stringPoolSpan, styleCount)
 	for i := range c.strings {
 		offset := stringsStart + indices[i]
 		r = endian.Reader(bytes.NewReader(data[offset:]), device.LittleEndian)
 		if c.flags&utf8Flag != 0 {
-			panic("TODO: UTF8 encoded xml support.")
+			decodeUTF8Length(r) // Length in UTF-16 code units.
+			str := make([]byte, decodeUTF8Length(r))
+			r.Data(str)
+			c.strings[i] = string(str)
 		} else {
 			runeCount := decodeLength(r)
 			str := make([]uint16, runeCount)
@@ -101,12 +120,22 @@ func (c *stringPool) decode(header, data []byte) error {
 				str[i] = r.Uint16()
 			}
 			c.strings[i] = string(utf16.Decode(str))
-			c.ptrs[i] = i
 		}
+		c.ptrs[i] = i
 	}
-	if styleCount > 0 {
-		_ = stylesStart
-		panic("TODO: Style decoding")
+	for i := range c.styles {
+		offset := stylesStart + styleIndices[i]
+		r = endian.Reader(bytes.NewReader(data[offset:]), device.LittleEndian)
+		for {
+			name := r.Uint32()
+			if name == spanEnd || r.Error() != nil {
+				break
+			}
+			c.styles[i] = append(c.styles[i], stringPoolSpan{name, r.Uint32(), r.Uint32()})
+		}
+		if err := r.Error(); err != nil {
+			return fmt.Errorf("Failed to decode the style of string %d: %v", i, err)
+		}
 	}
 
 	return nil
@@ -114,6 +143,14 @@ func (c *stringPool) decode(header, data []byte) error {
 
 func (stringPool) xml(*xmlContext) string { return "" }
 
+func decodeUTF8Length(r binary.Reader) uint32 {
+	length := uint32(r.Uint8())
+	if length&0x80 != 0 {
+		length = ((length & 0x7f) << 8) | uint32(r.Uint8())
+	}
+	return length
+}
+
 func utf16EncodeStringPoolEntry(str string) []byte {
 	var b bytes.Buffer
 	w := endian.Writer(&b, device.LittleEndian)
@@ -127,35 +164,44 @@ func utf16EncodeStringPoolEntry(str string) []byte {
 }
 
 func (c *stringPool) encode() []byte {
-	if len(c.styles) > 0 {
-		panic("TODO: implement style encoding support.")
+	encodedStrings := make([][]byte, len(c.strings))
+	stringsLength := 0
+	for i, str := range c.strings {
+		encodedStrings[i] = utf16EncodeStringPoolEntry(str)
+		stringsLength += len(encodedStrings[i])
+	}
+	// compute padding (copied logic in bin_xml.py)
+	padding := stringsLength % 4
+	if padding == 3 {
+		padding = 1
+	} else if padding == 1 {
+		padding = 3
 	}
 
 	return encodeChunk(resStringPoolType, func(w binary.Writer) {
 		totalHeaderLength := 8 + 5*4 // 8 for the basic header + the five uint32s below
+		// strings start after header and indices, followed by the styles.
+		stringsStart := totalHeaderLength + len(c.strings)*4 + len(c.styles)*4
+		stylesStart := 0
+		if len(c.styles) > 0 {
+			stylesStart = stringsStart + stringsLength + padding
+		}
 		w.Uint32(uint32(len(c.strings)))
 		w.Uint32(uint32(len(c.styles)))
-		w.Uint32(c.flags)
-		w.Uint32(uint32(totalHeaderLength + len(c.strings)*4)) // strings start after header and indices
-		w.Uint32(0)                                            // stylesStart
+		w.Uint32(c.flags &^ utf8Flag) // Strings are always encoded as UTF-16.
+		w.Uint32(uint32(stringsStart))
+		w.Uint32(uint32(stylesStart))
 	}, func(w binary.Writer) {
-		encodedStrings := make([][]byte, len(c.strings))
-		for i, str := range c.strings {
-			encodedStrings[i] = utf16EncodeStringPoolEntry(str)
-		}
-
 		// encode indices
 		index := 0
 		for _, es := range encodedStrings {
 			w.Uint32(uint32(index))
 			index += len(es)
 		}
-		// compute padding (copied logic in bin_xml.py)
-		padding := index % 4
-		if padding == 3 {
-			padding = 1
-		} else if padding == 1 {
-			padding = 3
+		index = 0
+		for _, spans := range c.styles {
+			w.Uint32(uint32(index))
+			index += (len(spans)*3 + 1) * 4
 		}
 
 		// encode actual strings
@@ -166,6 +212,21 @@ func (c *stringPool) encode() []byte {
 		for p := 0; p < padding; p++ {
 			w.Uint8(0)
 		}
+
+		if len(c.styles) > 0 {
+			for _, spans := range c.styles {
+				for _, span := range spans {
+					w.Uint32(span.name)
+					w.Uint32(span.firstChar)
+					w.Uint32(span.lastChar)
+				}
+				w.Uint32(spanEnd)
+			}
+			// The styles end with a whole span worth of spanEnd, of which the
+			// name has been written by the last style.
+			w.Uint32(spanEnd)
+			w.Uint32(spanEnd)
+		}
 	})
 }
 
@@ -198,15 +259,28 @@ func (p *stringPool) ref(str string) stringPoolRef {
 }
 
 // insertStringAtIndex inserts a string at a given index in the pool and then
-// updates the ptrs array, so that existing pool references continue to work.
-// This index is the final position of the string in the encoded string pool.
+// updates the ptrs array and the styles, so that existing pool references and
+// styles continue to work. This index is the final position of the string in
+// the encoded string pool. The pool is no longer sorted after the insertion.
 func (p *stringPool) insertStringAtIndex(str string, index int) stringPoolRef {
 	p.strings = append(p.strings[0:index], append([]string{str}, p.strings[index:]...)...)
+	p.flags &^= sortedFlag
 	for i, ptr := range p.ptrs {
 		if ptr >= index && ptr != missingString {
 			p.ptrs[i] = ptr + 1
 		}
 	}
+	for _, spans := range p.styles {
+		for i := range spans {
+			if spans[i].name >= uint32(index) {
+				spans[i].name++
+			}
+		}
+	}
+	if index < len(p.styles) {
+		// The styles apply to the strings at the same index.
+		p.styles = append(p.styles[0:index], append([][]stringPoolSpan{nil}, p.styles[index:]...)...)
+	}
 	p.ptrs = append(p.ptrs, index)
 	return stringPoolRef{p, uint32(len(p.ptrs) - 1)}
 }
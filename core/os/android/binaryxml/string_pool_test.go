@@ -0,0 +1,89 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binaryxml
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/binary"
+	"github.com/google/gapid/core/data/endian"
+	"github.com/google/gapid/core/os/device"
+)
+
+// encodeStyledTestPool returns a sorted pool of the strings "bold text",
+// "plain" and "b", the first of which has its first word styled with "b".
+func encodeStyledTestPool() []byte {
+	strings := [][]byte{
+		utf16EncodeStringPoolEntry("bold text"),
+		utf16EncodeStringPoolEntry("plain"),
+		utf16EncodeStringPoolEntry("b"),
+	}
+	const stringsStart = 8 + 20 + 3*4 + 1*4
+	return encodeChunk(resStringPoolType, func(w binary.Writer) {
+		w.Uint32(3)          // stringCount
+		w.Uint32(1)          // styleCount
+		w.Uint32(sortedFlag) // flags
+		w.Uint32(stringsStart)
+		w.Uint32(stringsStart + 22 + 14 + 6 + 2) // stylesStart
+	}, func(w binary.Writer) {
+		w.Uint32(0)
+		w.Uint32(22)
+		w.Uint32(22 + 14)
+		w.Uint32(0) // style of "bold text"
+		for _, s := range strings {
+			w.Data(s)
+		}
+		w.Uint16(0) // padding
+		w.Uint32(2) // name
+		w.Uint32(0) // firstChar
+		w.Uint32(3) // lastChar
+		w.Uint32(spanEnd)
+		w.Uint32(spanEnd)
+		w.Uint32(spanEnd)
+	})
+}
+
+func decodeTestPool(assert assert.Manager, data []byte) *stringPool {
+	c, err := decodeChunk(endian.Reader(bytes.NewReader(data), device.LittleEndian), &xmlTree{})
+	assert.For("err").ThatError(err).Succeeded()
+	pool, ok := c.(*stringPool)
+	assert.For("pool").That(ok).Equals(true)
+	return pool
+}
+
+func TestStringPoolStyles(t *testing.T) {
+	assert := assert.To(t)
+	data := encodeStyledTestPool()
+	pool := decodeTestPool(assert, data)
+	assert.For("strings").ThatSlice(pool.strings).Equals([]string{"bold text", "plain", "b"})
+	assert.For("styles").That(pool.styles).DeepEquals([][]stringPoolSpan{{{2, 0, 3}}})
+	assert.For("encoded").ThatSlice(pool.encode()).Equals(data)
+}
+
+func TestStringPoolInsert(t *testing.T) {
+	assert := assert.To(t)
+	pool := decodeTestPool(assert, encodeStyledTestPool())
+	ref := pool.insertStringAtIndex("a", 0)
+	assert.For("ref").ThatString(ref.get()).Equals("a")
+	assert.For("sorted").That(pool.flags & sortedFlag).Equals(uint32(0))
+
+	// The style stays with its string and refers to the moved style name.
+	pool = decodeTestPool(assert, pool.encode())
+	assert.For("strings").ThatSlice(pool.strings).Equals([]string{"a", "bold text", "plain", "b"})
+	assert.For("styles").That(pool.styles).DeepEquals([][]stringPoolSpan{nil, {{3, 0, 3}}})
+	assert.For("sorted").That(pool.flags & sortedFlag).Equals(uint32(0))
+}
@@ -16,6 +16,7 @@ package binaryxml
 
 import (
 	"bytes"
+	"encoding/xml"
 	"strings"
 
 	"github.com/google/gapid/core/data/binary"
@@ -65,6 +66,8 @@ func (a xmlAttribute) xml(ctx *xmlContext) string {
 	b.WriteRune('"')
 	if a.rawValue.isValid() {
 		b.WriteString(a.rawValue.get())
+	} else if v, ok := a.resolve(ctx); ok {
+		xml.EscapeText(&b, []byte(v))
 	} else {
 		b.WriteString(a.typedValue.String())
 	}
@@ -72,6 +75,17 @@ func (a xmlAttribute) xml(ctx *xmlContext) string {
 	return b.String()
 }
 
+// resolve returns the value of the resource referenced by the attribute, if
+// the context has a resource table holding it.
+func (a xmlAttribute) resolve(ctx *xmlContext) (string, bool) {
+	ref, ok := a.typedValue.(valReference)
+	if !ok || ctx.resources == nil {
+		return "", false
+	}
+	v, err := ctx.resources.Resolve(uint32(ref), ctx.config)
+	return v, err == nil
+}
+
 const xmlAttributeSize = 20
 
 func (a *xmlAttribute) decode(r binary.Reader, root *xmlTree) error {
@@ -25,6 +25,11 @@ type xmlContext struct {
 	namespaces map[string]string
 	indent     int
 	tab        string
+
+	// resources, if not nil, is used to resolve the resource references in
+	// attribute values for config.
+	resources *ResourceTable
+	config    ResourceConfig
 }
 
 type stack []chunk
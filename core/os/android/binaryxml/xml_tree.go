@@ -113,6 +113,16 @@ func (c *xmlTree) toXmlString() string {
 	})
 }
 
+func (c *xmlTree) toResolvedXmlString(resources *ResourceTable, config ResourceConfig) string {
+	return c.xml(&xmlContext{
+		strings:    c.strings,
+		namespaces: map[string]string{},
+		tab:        "  ",
+		resources:  resources,
+		config:     config,
+	})
+}
+
 func (c *xmlTree) decodeString(r binary.Reader) stringPoolRef {
 	idx := r.Uint32()
 	if idx != missingString {
@@ -71,6 +71,9 @@ type Device interface {
 	// Logcat writes all logcat messages reported by the device to the chan msgs,
 	// blocking until the context is stopped.
 	Logcat(ctx context.Context, msgs chan<- LogcatMessage) error
+	// LogcatFiltered writes the logcat messages of all priorities matching the
+	// filter to the chan msgs, blocking until the context is stopped.
+	LogcatFiltered(ctx context.Context, filter LogcatFilter, msgs chan<- LogcatMessage) error
 	// NativeBridgeABI returns the native ABI for the given emulated ABI for the
 	// device by consulting the ro.dalvik.vm.isa.<emulated_isa>=<native_isa>
 	// system properties. If there is no native ABI for the given ABI, then abi
@@ -98,6 +101,19 @@ type Device interface {
 	SetFixedPerformanceMode(ctx context.Context, value bool) error
 }
 
+// LogcatFilter selects the logcat messages to report. Zero fields match all
+// the messages.
+type LogcatFilter struct {
+	// ProcessID is the identifier of the process that logged the messages.
+	ProcessID int
+	// UserID is the Linux user identifier of the application that logged the
+	// messages. It requires Android P (API 28) or newer.
+	UserID int
+	// Since is the device time of the oldest message to report. If zero, only
+	// the messages logged after the start of the logcat are reported.
+	Since time.Time
+}
+
 // LogcatMessage represents a single logcat message.
 type LogcatMessage struct {
 	Timestamp time.Time
@@ -40,6 +40,7 @@ type InstalledPackage struct {
 	VersionName     string          // The version name as reported by the manifest.
 	MinSDK          int             // The minimum SDK reported by the manifest.
 	TargetSdk       int             // The target SDK reported by the manifest.
+	UserID          int             // The Linux user ID of the package, or 0 if unknown.
 }
 
 // InstalledPackages is a list of installed packages.
@@ -62,6 +62,8 @@ func Parse(ctx context.Context, s string) (Manifest, error) {
 type Application struct {
 	Activities []Activity `xml:"activity"`
 	Debuggable bool       `xml:"debuggable,attr"`
+	Label      string     `xml:"label,attr"`
+	Icon       string     `xml:"icon,attr"`
 }
 
 // Activity represents an activity declared in an Application.
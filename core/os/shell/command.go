@@ -143,6 +143,9 @@ func (cmd Cmd) Start(ctx context.Context) (Process, error) {
 		}
 		log.I(ctx, "Exec: %v%s", cmd, extra)
 	}
+	if t, ok := cmd.Target.(ContextTarget); ok {
+		return t.StartContext(ctx, cmd)
+	}
 	return cmd.Target.Start(cmd)
 }
 
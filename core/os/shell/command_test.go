@@ -18,6 +18,7 @@ package shell_test
 
 import (
 	"bytes"
+	"context"
 	"testing"
 
 	"github.com/google/gapid/core/assert"
@@ -121,3 +122,18 @@ func TestCommandOn(t *testing.T) {
 	assert.For(ctx, "err").ThatError(err).HasMessage(`Failed to start process
    Cause: AlwaysFail`)
 }
+
+type contextTarget struct{ errorTarget }
+
+func (t contextTarget) StartContext(ctx context.Context, cmd shell.Cmd) (shell.Process, error) {
+	return nil, task.StopReason(ctx)
+}
+
+func TestCommandOnContextTarget(t *testing.T) {
+	ctx := log.Testing(t)
+	child, cancel := task.WithCancel(ctx)
+	cancel()
+	_, err := shell.Command("echo", "echo to stdout").On(contextTarget{}).Call(child)
+	assert.For(ctx, "err").ThatError(err).HasMessage(`Failed to start process
+   Cause: context canceled`)
+}
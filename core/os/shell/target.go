@@ -14,9 +14,19 @@
 
 package shell
 
+import "context"
+
 // Target is the interface for an object that supports execution of Commands.
 type Target interface {
 	// Start is invoked to execute the supplied command.
 	// It must return either a Process object that can be used to control the command, or an error.
 	Start(cmd Cmd) (Process, error)
 }
+
+// ContextTarget is implemented by Targets that need the context the command
+// was started with, for instance to honour its cancellation and deadline.
+type ContextTarget interface {
+	Target
+	// StartContext is invoked instead of Start to execute the supplied command.
+	StartContext(ctx context.Context, cmd Cmd) (Process, error)
+}
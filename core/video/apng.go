@@ -0,0 +1,185 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package video
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+)
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// apngEncoder is a frameEncoder that produces an animated PNG.
+// See https://wiki.mozilla.org/APNG_Specification.
+// Each frame is stored as a full 8-bit RGBA image, so that frames with and
+// without transparency can be mixed freely.
+type apngEncoder struct {
+	out    *pngChunkWriter
+	fps    int
+	width  int
+	height int
+	start  int64 // offset of the PNG signature in the output.
+	frames int
+	seq    uint32
+}
+
+func newAPNGEncoder(settings Settings, out io.WriteSeeker) *apngEncoder {
+	return &apngEncoder{out: &pngChunkWriter{out: out}, fps: settings.FPS}
+}
+
+func (e *apngEncoder) AddFrame(frame *image.NRGBA) error {
+	w, h := frame.Bounds().Dx(), frame.Bounds().Dy()
+	if w == 0 || h == 0 {
+		return fmt.Errorf("Frame %d has zero dimensions", e.frames)
+	}
+	if e.frames == 0 {
+		e.width, e.height = w, h
+	} else if w > e.width || h > e.height {
+		return fmt.Errorf("Frame %d (%dx%d) is larger than the first frame (%dx%d)",
+			e.frames, w, h, e.width, e.height)
+	}
+
+	buf := &bytes.Buffer{}
+	z := zlib.NewWriter(buf)
+	stride := w * 4
+	row := make([]byte, 1+stride)
+	for y := 0; y < h; y++ {
+		cur := frame.Pix[y*frame.Stride : y*frame.Stride+stride]
+		if y == 0 {
+			row[0] = 0 // None
+			copy(row[1:], cur)
+		} else {
+			// The Up filter compresses well for the mostly smooth content of
+			// rendered frames.
+			prev := frame.Pix[(y-1)*frame.Stride : (y-1)*frame.Stride+stride]
+			row[0] = 2 // Up
+			for i := range cur {
+				row[1+i] = cur[i] - prev[i]
+			}
+		}
+		if _, err := z.Write(row); err != nil {
+			return err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return err
+	}
+
+	if e.frames == 0 {
+		// The header is written again with the frame count by Finish.
+		start, err := e.out.out.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		e.start = start
+		e.writeHeader()
+	}
+
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], e.seq)
+	binary.BigEndian.PutUint32(fctl[4:], uint32(w))
+	binary.BigEndian.PutUint32(fctl[8:], uint32(h))
+	binary.BigEndian.PutUint32(fctl[12:], 0) // x offset
+	binary.BigEndian.PutUint32(fctl[16:], 0) // y offset
+	binary.BigEndian.PutUint16(fctl[20:], 1) // delay numerator
+	binary.BigEndian.PutUint16(fctl[22:], uint16(e.fps))
+	fctl[24] = 1 // Dispose op: background
+	fctl[25] = 0 // Blend op: source
+	e.out.chunk("fcTL", fctl)
+	e.seq++
+
+	if e.frames == 0 {
+		// The first frame is the default image, and is stored as IDAT so
+		// that decoders without APNG support still show something.
+		e.out.chunk("IDAT", buf.Bytes())
+	} else {
+		fdat := make([]byte, 4+buf.Len())
+		binary.BigEndian.PutUint32(fdat, e.seq)
+		copy(fdat[4:], buf.Bytes())
+		e.out.chunk("fdAT", fdat)
+		e.seq++
+	}
+	e.frames++
+	return e.out.err
+}
+
+func (e *apngEncoder) Finish() error {
+	e.out.chunk("IEND", nil)
+	if e.out.err != nil {
+		return e.out.err
+	}
+	// Rewrite the header, now that the number of frames is known.
+	if _, err := e.out.out.Seek(e.start, io.SeekStart); err != nil {
+		return err
+	}
+	e.writeHeader()
+	if e.out.err != nil {
+		return e.out.err
+	}
+	_, err := e.out.out.Seek(0, io.SeekEnd)
+	return err
+}
+
+// writeHeader writes the PNG signature and the chunks preceding the frames,
+// which are of the same size whatever the number of frames.
+func (e *apngEncoder) writeHeader() {
+	e.out.raw(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(e.width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(e.height))
+	ihdr[8] = 8  // Bit depth
+	ihdr[9] = 6  // Color type: RGBA
+	ihdr[10] = 0 // Compression: deflate
+	ihdr[11] = 0 // Filter: adaptive
+	ihdr[12] = 0 // Interlace: none
+	e.out.chunk("IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(e.frames))
+	binary.BigEndian.PutUint32(actl[4:], 0) // Loop forever
+	e.out.chunk("acTL", actl)
+}
+
+// pngChunkWriter writes PNG chunks to out, holding on to the first error.
+type pngChunkWriter struct {
+	out io.WriteSeeker
+	err error
+}
+
+func (w *pngChunkWriter) raw(data []byte) {
+	if w.err == nil {
+		_, w.err = w.out.Write(data)
+	}
+}
+
+func (w *pngChunkWriter) chunk(ty string, data []byte) {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], ty)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+	w.raw(header)
+	w.raw(data)
+	w.raw(footer)
+}
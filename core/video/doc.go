@@ -12,6 +12,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package video contains go-wrappers around the 'avconv' and 'ffmpeg'
-// executables for generating videos from images.
+// Package video contains encoders for generating videos from images.
+//
+// Animated PNG and Motion-JPEG AVI videos are encoded in-process. MP4 videos
+// are encoded with the 'avconv' or 'ffmpeg' executables, if available.
 package video
@@ -18,39 +18,112 @@ import (
 	"context"
 	"fmt"
 	"image"
+	"image/draw"
 	"io"
-	"os/exec"
+	"strings"
 
 	"github.com/google/gapid/core/app/crash"
 	"github.com/google/gapid/core/log"
-	"github.com/google/gapid/core/os/shell"
 )
 
-// Settings for encoding a video with Encode.
-type Settings struct {
-	FPS      int // Frames per second. Default: 30
-	DataRate int // Target bits-per-second. Default: 5000000
+// Container is an enumerator of video container formats supported by Encode.
+type Container int
+
+const (
+	// MP4 is a fragmented H.264 mp4 video. Requires avconv or ffmpeg.
+	MP4 Container = iota
+	// APNG is an animated PNG, encoded in-process.
+	APNG
+	// MJPEG is a Motion-JPEG AVI video, encoded in-process.
+	MJPEG
+)
+
+func (c Container) String() string {
+	switch c {
+	case MP4:
+		return "mp4"
+	case APNG:
+		return "apng"
+	case MJPEG:
+		return "mjpeg"
+	default:
+		return fmt.Sprintf("Container(%d)", int(c))
+	}
 }
 
-var encoder string
+// Ext returns the canonical file extension (including the leading '.') for
+// the container.
+func (c Container) Ext() string {
+	switch c {
+	case APNG:
+		return ".png"
+	case MJPEG:
+		return ".avi"
+	default:
+		return ".mp4"
+	}
+}
+
+// InProcess returns true if the container is encoded without any external
+// executable.
+func (c Container) InProcess() bool {
+	return c == APNG || c == MJPEG
+}
 
-func init() {
-	encoder, _ = exec.LookPath("avconv")
-	if encoder == "" {
-		encoder, _ = exec.LookPath("ffmpeg")
+// Available returns true if videos can be encoded with the given container on
+// this machine.
+func (c Container) Available() bool {
+	return c.InProcess() || encoder != ""
+}
+
+// ContainerForExt returns the container to use for a file with the given
+// extension. The extension is matched case-insensitively and may or may not
+// include the leading '.'.
+func ContainerForExt(ext string) (Container, bool) {
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "mp4":
+		return MP4, true
+	case "png", "apng":
+		return APNG, true
+	case "avi", "mjpeg", "mjpg":
+		return MJPEG, true
+	default:
+		return MP4, false
 	}
 }
 
-// Encode will encode the frames written to the returned chan to a video that
-// can be read from the Reader.
-func Encode(ctx context.Context, settings Settings) (chan<- image.Image, io.Reader, error) {
-	if encoder == "" {
-		return nil, nil, fmt.Errorf("neither avconv or ffmpeg was found")
+// DefaultContainer returns MP4 if avconv or ffmpeg is available, otherwise the
+// in-process MJPEG encoder.
+func DefaultContainer() Container {
+	if MP4.Available() {
+		return MP4
 	}
+	return MJPEG
+}
 
-	in := make(chan image.Image, 64)
-	out, mpg := io.Pipe()
+// Settings for encoding a video with Encode.
+type Settings struct {
+	FPS       int       // Frames per second. Default: 30
+	DataRate  int       // Target bits-per-second. Default: 5000000. MP4 only.
+	Quality   int       // JPEG quality, 1 to 100. Default: 90. MJPEG only.
+	Container Container // Video container format. Default: MP4
+}
+
+// frameEncoder is the interface implemented by the in-process encoders.
+// Frames are passed to AddFrame in display order, which writes them out as
+// they are encoded. Finish completes the video once all the frames have been
+// added.
+type frameEncoder interface {
+	AddFrame(frame *image.NRGBA) error
+	Finish() error
+}
 
+// Encode will encode the frames written to the returned chan to a video
+// written to out. The frames are written as they are encoded, the in-process
+// encoders then seek back to complete the headers of the video once the chan
+// is closed. The returned error chan receives the result of the encoding once
+// the video is complete.
+func Encode(ctx context.Context, settings Settings, out io.WriteSeeker) (chan<- image.Image, <-chan error, error) {
 	// Set defaults
 	if settings.DataRate == 0 {
 		settings.DataRate = 5000000
@@ -58,64 +131,56 @@ func Encode(ctx context.Context, settings Settings) (chan<- image.Image, io.Read
 	if settings.FPS == 0 {
 		settings.FPS = 30
 	}
+	if settings.Quality == 0 {
+		settings.Quality = 90
+	}
 
-	crash.Go(func() {
-		// Get the first frame so we know what we're dealing with.
-		frame, ok := <-in
-		if !ok {
-			mpg.Close()
-			return // Closed before we got the first frame
-		}
-
-		var pixfmt string
-		var data func(image.Image) []byte
-
-		switch frame.(type) {
-		case *image.NRGBA:
-			pixfmt = "rgba"
-			data = func(i image.Image) []byte { return (i.(*image.NRGBA)).Pix }
-		default:
-			mpg.CloseWithError(fmt.Errorf("Unsupported frame type %T", frame))
-			return
-		}
+	switch settings.Container {
+	case MP4:
+		return encodeFFmpeg(ctx, settings, out)
+	case APNG:
+		return encodeInProcess(ctx, newAPNGEncoder(settings, out))
+	case MJPEG:
+		return encodeInProcess(ctx, newMJPEGEncoder(settings, out))
+	default:
+		return nil, nil, fmt.Errorf("Unsupported video container %v", settings.Container)
+	}
+}
 
-		debugWriter := log.From(ctx).Writer(log.Debug)
-		defer debugWriter.Close()
-
-		stdin, pixels := io.Pipe()
-		defer pixels.Close() // Stops the encoder
-
-		crash.Go(func() {
-			err := shell.Command(encoder,
-				"-v", "verbose",
-				"-r", fmt.Sprint(settings.FPS),
-				"-pix_fmt", pixfmt,
-				"-f", "rawvideo",
-				"-s", fmt.Sprintf("%dx%d", frame.Bounds().Dx(), frame.Bounds().Dy()),
-				"-i", "pipe:0", // stdin
-				"-b:v", fmt.Sprint(settings.DataRate),
-				"-f", "mp4", // output should be a mp4
-				"-movflags", "frag_keyframe+empty_moov", // fragmented mp4, required for streaming.
-				"pipe:1", // stdout
-			).Read(stdin).Capture(mpg, debugWriter).Run(ctx)
-
-			if err != nil {
-				log.E(ctx, "%v returned error: %v", encoder, err)
-			}
-			mpg.CloseWithError(err)
-		})
+func encodeInProcess(ctx context.Context, enc frameEncoder) (chan<- image.Image, <-chan error, error) {
+	in := make(chan image.Image, 64)
+	done := make(chan error, 1)
 
+	crash.Go(func() {
 		i := 0
-		log.D(ctx, "Encoding frame 0")
-		pixels.Write(data(frame))
-		i++
 		for frame := range in {
 			log.D(ctx, "Encoding frame %d", i)
-			pixels.Write(data(frame))
+			if err := enc.AddFrame(toNRGBA(frame)); err != nil {
+				done <- err
+				for range in {
+					// Drain the remaining frames so the writer doesn't block.
+				}
+				return
+			}
 			i++
 		}
-
+		if i == 0 {
+			done <- nil
+			return // Closed before we got the first frame
+		}
+		done <- enc.Finish()
 		log.I(ctx, "Done")
 	})
-	return in, out, nil
+	return in, done, nil
+}
+
+// toNRGBA returns the frame as an *image.NRGBA, converting if necessary.
+func toNRGBA(frame image.Image) *image.NRGBA {
+	if nrgba, ok := frame.(*image.NRGBA); ok {
+		return nrgba
+	}
+	b := frame.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), frame, b.Min, draw.Src)
+	return out
 }
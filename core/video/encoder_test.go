@@ -0,0 +1,189 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package video_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/video"
+)
+
+func testFrames(count, w, h int) []image.Image {
+	out := make([]image.Image, count)
+	for i := range out {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{uint8(x * 16), uint8(y * 16), uint8(i * 64), 255})
+			}
+		}
+		out[i] = img
+	}
+	return out
+}
+
+func tempFile(t *testing.T) *os.File {
+	f, err := ioutil.TempFile("", "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		f.Close()
+		os.Remove(f.Name())
+	})
+	return f
+}
+
+func encode(t *testing.T, settings video.Settings, frames []image.Image) []byte {
+	ctx := log.Testing(t)
+	out := tempFile(t)
+	in, encoded, err := video.Encode(ctx, settings, out)
+	if !assert.For(ctx, "Encode").ThatError(err).Succeeded() {
+		return nil
+	}
+	for _, f := range frames {
+		in <- f
+	}
+	close(in)
+	assert.For(ctx, "encoded").ThatError(<-encoded).Succeeded()
+	data, err := ioutil.ReadFile(out.Name())
+	assert.For(ctx, "ReadFile").ThatError(err).Succeeded()
+	return data
+}
+
+func TestContainerForExt(t *testing.T) {
+	assert := assert.To(t)
+	for _, test := range []struct {
+		ext      string
+		expected video.Container
+		ok       bool
+	}{
+		{".mp4", video.MP4, true},
+		{".MP4", video.MP4, true},
+		{".png", video.APNG, true},
+		{"apng", video.APNG, true},
+		{".avi", video.MJPEG, true},
+		{".mov", video.MP4, false},
+	} {
+		c, ok := video.ContainerForExt(test.ext)
+		assert.For("%v ok", test.ext).That(ok).Equals(test.ok)
+		assert.For("%v container", test.ext).That(c).Equals(test.expected)
+	}
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	ctx := log.Testing(t)
+	frames := testFrames(3, 8, 6)
+	data := encode(t, video.Settings{Container: video.APNG}, frames)
+
+	// Decoders without APNG support show the first frame.
+	img, err := png.Decode(bytes.NewReader(data))
+	if !assert.For(ctx, "Decode").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "bounds").That(img.Bounds()).Equals(frames[0].Bounds())
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			got := color.NRGBAModel.Convert(img.At(x, y))
+			assert.For(ctx, "pixel (%d, %d)", x, y).That(got).Equals(frames[0].At(x, y))
+		}
+	}
+
+	assert.For(ctx, "acTL").That(bytes.Count(data, []byte("acTL"))).Equals(1)
+	assert.For(ctx, "fcTL").That(bytes.Count(data, []byte("fcTL"))).Equals(3)
+	assert.For(ctx, "fdAT").That(bytes.Count(data, []byte("fdAT"))).Equals(2)
+}
+
+func TestEncodeMJPEG(t *testing.T) {
+	ctx := log.Testing(t)
+	frames := testFrames(4, 16, 16)
+	data := encode(t, video.Settings{Container: video.MJPEG, FPS: 10}, frames)
+
+	assert.For(ctx, "RIFF").ThatString(string(data[0:4])).Equals("RIFF")
+	assert.For(ctx, "RIFF size").That(int(binary.LittleEndian.Uint32(data[4:]))).Equals(len(data) - 8)
+	assert.For(ctx, "form").ThatString(string(data[8:12])).Equals("AVI ")
+	assert.For(ctx, "frames").That(bytes.Count(data, []byte("00dc"))).Equals(8) // chunks + index
+
+	movi := bytes.Index(data, []byte("movi"))
+	chunk := data[movi+4:]
+	assert.For(ctx, "chunk id").ThatString(string(chunk[0:4])).Equals("00dc")
+	size := binary.LittleEndian.Uint32(chunk[4:])
+	img, err := jpeg.Decode(bytes.NewReader(chunk[8 : 8+size]))
+	if assert.For(ctx, "Decode").ThatError(err).Succeeded() {
+		assert.For(ctx, "bounds").That(img.Bounds()).Equals(frames[0].Bounds())
+	}
+}
+
+func TestEncodeMismatchedFrames(t *testing.T) {
+	ctx := log.Testing(t)
+	in, encoded, err := video.Encode(ctx, video.Settings{Container: video.MJPEG}, tempFile(t))
+	if !assert.For(ctx, "Encode").ThatError(err).Succeeded() {
+		return
+	}
+	in <- testFrames(1, 8, 8)[0]
+	in <- testFrames(1, 4, 4)[0]
+	close(in)
+	assert.For(ctx, "encoded").ThatError(<-encoded).Failed()
+}
+
+// writeNotifier is a file that sends a copy of the data of every write to
+// writes.
+type writeNotifier struct {
+	*os.File
+	writes chan []byte
+}
+
+func (w writeNotifier) Write(data []byte) (int, error) {
+	w.writes <- append([]byte{}, data...)
+	return w.File.Write(data)
+}
+
+func TestEncodeStreamsFrames(t *testing.T) {
+	for _, test := range []struct {
+		container video.Container
+		frameID   string
+	}{
+		{video.APNG, "fcTL"},
+		{video.MJPEG, "00dc"},
+	} {
+		ctx := log.Testing(t)
+		out := writeNotifier{tempFile(t), make(chan []byte, 100)}
+		in, encoded, err := video.Encode(ctx, video.Settings{Container: test.container}, out)
+		if !assert.For(ctx, "Encode").ThatError(err).Succeeded() {
+			return
+		}
+		// Each frame is written out before the next one is sent.
+		written := 0
+		for i, f := range testFrames(3, 8, 8) {
+			in <- f
+			for written <= i {
+				written += bytes.Count(<-out.writes, []byte(test.frameID))
+			}
+		}
+		close(in)
+		assert.For(ctx, "%v encoded", test.container).ThatError(<-encoded).Succeeded()
+		assert.For(ctx, "%v frames", test.container).That(written).Equals(3)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+const (
+	aviHasIndex    = 0x10 // AVIF_HASINDEX
+	aviKeyFrame    = 0x10 // AVIIF_KEYFRAME
+	aviMaxFileSize = 1<<32 - 1
+)
+
+// mjpegEncoder is a frameEncoder that produces a Motion-JPEG AVI video.
+// Each frame is stored as an independent baseline JPEG.
+type mjpegEncoder struct {
+	out        io.WriteSeeker
+	fps        int
+	quality    int
+	width      int
+	height     int
+	start      int64 // offset of the RIFF chunk in the output.
+	headerSize int
+	moviSize   int // size of the 'movi' list, from its fourcc.
+	maxFrame   int
+	index      []mjpegIndexEntry
+}
+
+// mjpegIndexEntry is the entry of a frame in the idx1 index.
+type mjpegIndexEntry struct {
+	offset int // relative to the 'movi' fourcc.
+	size   int
+}
+
+func newMJPEGEncoder(settings Settings, out io.WriteSeeker) *mjpegEncoder {
+	return &mjpegEncoder{out: out, fps: settings.FPS, quality: settings.Quality}
+}
+
+func (e *mjpegEncoder) AddFrame(frame *image.NRGBA) error {
+	w, h := frame.Bounds().Dx(), frame.Bounds().Dy()
+	if w == 0 || h == 0 {
+		return fmt.Errorf("Frame %d has zero dimensions", len(e.index))
+	}
+	if len(e.index) == 0 {
+		e.width, e.height = w, h
+	} else if w != e.width || h != e.height {
+		return fmt.Errorf("Frame %d (%dx%d) has different dimensions to the first frame (%dx%d)",
+			len(e.index), w, h, e.width, e.height)
+	}
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, frame, &jpeg.Options{Quality: e.quality}); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+
+	if len(e.index) == 0 {
+		// The header is written again with the sizes and frame count by Finish.
+		start, err := e.out.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		header := e.header()
+		if _, err := e.out.Write(header); err != nil {
+			return err
+		}
+		e.start, e.headerSize, e.moviSize = start, len(header), 4
+	}
+	if e.size(len(e.index)+1, e.moviSize+8+pad2(len(data))) > aviMaxFileSize {
+		return fmt.Errorf("Video exceeds the maximum AVI file size")
+	}
+
+	chunk := &riffWriter{}
+	chunk.chunk("00dc", func() { chunk.buf.Write(data) })
+	if _, err := e.out.Write(chunk.buf.Bytes()); err != nil {
+		return err
+	}
+	e.index = append(e.index, mjpegIndexEntry{e.moviSize, len(data)})
+	e.moviSize += chunk.buf.Len()
+	if len(data) > e.maxFrame {
+		e.maxFrame = len(data)
+	}
+	return nil
+}
+
+func (e *mjpegEncoder) Finish() error {
+	w := &riffWriter{}
+	w.chunk("idx1", func() {
+		for _, entry := range e.index {
+			w.fourcc("00dc")
+			w.u32(aviKeyFrame)
+			w.u32(uint32(entry.offset))
+			w.u32(uint32(entry.size))
+		}
+	})
+	if _, err := e.out.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+
+	// Rewrite the header, now that the sizes and number of frames are known.
+	if _, err := e.out.Seek(e.start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := e.out.Write(e.header()); err != nil {
+		return err
+	}
+	_, err := e.out.Seek(0, io.SeekEnd)
+	return err
+}
+
+// size returns the size of the video with count frames and a 'movi' list of
+// moviSize bytes.
+func (e *mjpegEncoder) size(count, moviSize int) int {
+	return e.headerSize - 4 + moviSize + 8 + count*16 // header + movi + idx1
+}
+
+// header returns the start of the video up to the 'movi' fourcc, which is of
+// the same size whatever the number of frames.
+func (e *mjpegEncoder) header() []byte {
+	w := &riffWriter{}
+	count := uint32(len(e.index))
+
+	riff := w.begin("RIFF", "AVI ")
+	hdrl := w.begin("LIST", "hdrl")
+	w.chunk("avih", func() {
+		w.u32(uint32(1000000 / e.fps))    // dwMicroSecPerFrame
+		w.u32(uint32(e.maxFrame * e.fps)) // dwMaxBytesPerSec
+		w.u32(0)                          // dwPaddingGranularity
+		w.u32(aviHasIndex)                // dwFlags
+		w.u32(count)                      // dwTotalFrames
+		w.u32(0)                          // dwInitialFrames
+		w.u32(1)                          // dwStreams
+		w.u32(uint32(e.maxFrame))         // dwSuggestedBufferSize
+		w.u32(uint32(e.width))            // dwWidth
+		w.u32(uint32(e.height))           // dwHeight
+		w.u32(0)                          // dwReserved[4]
+		w.u32(0)
+		w.u32(0)
+		w.u32(0)
+	})
+	strl := w.begin("LIST", "strl")
+	w.chunk("strh", func() {
+		w.fourcc("vids")          // fccType
+		w.fourcc("MJPG")          // fccHandler
+		w.u32(0)                  // dwFlags
+		w.u16(0)                  // wPriority
+		w.u16(0)                  // wLanguage
+		w.u32(0)                  // dwInitialFrames
+		w.u32(1)                  // dwScale
+		w.u32(uint32(e.fps))      // dwRate
+		w.u32(0)                  // dwStart
+		w.u32(count)              // dwLength
+		w.u32(uint32(e.maxFrame)) // dwSuggestedBufferSize
+		w.u32(0xffffffff)         // dwQuality (default)
+		w.u32(0)                  // dwSampleSize
+		w.u16(0)                  // rcFrame
+		w.u16(0)
+		w.u16(uint16(e.width))
+		w.u16(uint16(e.height))
+	})
+	w.chunk("strf", func() {
+		// BITMAPINFOHEADER
+		w.u32(40)                             // biSize
+		w.u32(uint32(e.width))                // biWidth
+		w.u32(uint32(e.height))               // biHeight
+		w.u16(1)                              // biPlanes
+		w.u16(24)                             // biBitCount
+		w.fourcc("MJPG")                      // biCompression
+		w.u32(uint32(e.width * e.height * 3)) // biSizeImage
+		w.u32(0)                              // biXPelsPerMeter
+		w.u32(0)                              // biYPelsPerMeter
+		w.u32(0)                              // biClrUsed
+		w.u32(0)                              // biClrImportant
+	})
+	w.end(strl)
+	w.end(hdrl)
+
+	// The frames and index follow the header, so the sizes of the RIFF chunk
+	// and the 'movi' list are not those of the written data.
+	movi := w.begin("LIST", "movi")
+	data := w.buf.Bytes()
+	binary.LittleEndian.PutUint32(data[riff+4:], uint32(e.size(len(e.index), e.moviSize)-8))
+	binary.LittleEndian.PutUint32(data[movi+4:], uint32(e.moviSize))
+	return data
+}
+
+func pad2(n int) int { return (n + 1) &^ 1 }
+
+// riffWriter builds RIFF chunks in memory.
+type riffWriter struct {
+	buf bytes.Buffer
+}
+
+// begin starts a RIFF or LIST chunk, returning the offset of the chunk to be
+// passed to end.
+func (w *riffWriter) begin(id, ty string) int {
+	start := w.buf.Len()
+	w.fourcc(id)
+	w.u32(0) // Patched by end()
+	w.fourcc(ty)
+	return start
+}
+
+// end patches the size of the chunk started at offset start.
+func (w *riffWriter) end(start int) {
+	size := w.buf.Len() - start - 8
+	binary.LittleEndian.PutUint32(w.buf.Bytes()[start+4:], uint32(size))
+}
+
+// chunk writes a chunk with the given id, whose body is written by body.
+func (w *riffWriter) chunk(id string, body func()) {
+	start := w.buf.Len()
+	w.fourcc(id)
+	w.u32(0)
+	body()
+	w.end(start)
+	if w.buf.Len()%2 != 0 {
+		w.buf.WriteByte(0)
+	}
+}
+
+func (w *riffWriter) fourcc(s string) { w.buf.WriteString(s) }
+
+func (w *riffWriter) u16(v uint16) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *riffWriter) u32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
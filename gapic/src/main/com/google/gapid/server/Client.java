@@ -19,6 +19,7 @@ import static com.google.common.util.concurrent.Futures.immediateFuture;
 import static com.google.gapid.server.GapidClient.Result.error;
 import static com.google.gapid.util.ProtoDebugTextFormat.shortDebugString;
 import static java.util.logging.Level.FINE;
+import static java.util.stream.Collectors.joining;
 
 import com.google.common.util.concurrent.Futures;
 import com.google.common.util.concurrent.ListenableFuture;
@@ -346,6 +347,10 @@ public class Client {
         Service.ErrUnsupportedVersion e = err.getErrUnsupportedVersion();
         throw new UnsupportedVersionException(e.getReason()/*, e.getSuggestUpdate()*/, stack);
       }
+      case ERR_SHADER_COMPILE: {
+        Service.ErrShaderCompile e = err.getErrShaderCompile();
+        throw new ShaderCompileException(e.getDiagnosticsList(), stack);
+      }
       default:
         throw new RuntimeException("Unknown error: " + err.getErrCase(), stack);
     }
@@ -395,6 +400,17 @@ public class Client {
     }
   }
 
+  public static class ShaderCompileException extends RpcException {
+    public final List<Service.ShaderDiagnostic> diagnostics;
+
+    public ShaderCompileException(List<Service.ShaderDiagnostic> diagnostics, Stack stack) {
+      super(diagnostics.stream()
+          .map(d -> d.getStage() + ":" + d.getLine() + ": " + d.getMessage())
+          .collect(joining("\n")), stack);
+      this.diagnostics = diagnostics;
+    }
+  }
+
   public static class Stack extends Exception {
     private final Supplier<String> requestString;
 
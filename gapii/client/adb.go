@@ -52,6 +52,9 @@ type Process struct {
 	// The options used for the capture.
 	Options Options
 
+	// The identifier of the traced process on the device, or 0 if unknown.
+	PID int
+
 	// The connection
 	Conn net.Conn
 }
@@ -195,6 +198,7 @@ func Start(ctx context.Context, p *android.InstalledPackage, a *android.Activity
 		Port:    int(port),
 		Device:  d,
 		Options: o,
+		PID:     pid,
 	}
 
 	return process, cleanup, nil
@@ -210,6 +210,7 @@ func (client *Client) BeginReplay(ctx context.Context, key *ReplayerKey, payload
 			Replay: &replaysrv.Replay{
 				ReplayId:    payload,
 				DependentId: dependent,
+				TraceId:     string(status.GetTraceID(ctx)),
 			},
 		},
 	}
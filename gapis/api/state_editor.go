@@ -0,0 +1,27 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import "context"
+
+// StateEditor is the interface implemented by APIs that can synthesize the
+// commands required to change their state.
+type StateEditor interface {
+	// EditState returns the commands that, when mutated on state, transform
+	// the object named object with the given key into its value in edited.
+	// edited and state must both be copies of the same state, with edited
+	// holding the requested changes.
+	EditState(ctx context.Context, edited, state *GlobalState, object string, key interface{}) ([]Cmd, error)
+}
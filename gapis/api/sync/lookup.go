@@ -17,6 +17,7 @@ package sync
 import (
 	"context"
 	"math"
+	"sort"
 
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
@@ -93,6 +94,43 @@ func (l *RenderPassLookup) Lookup(ctx context.Context, key RenderPassKey) SubCmd
 	return SubCmdRange{}
 }
 
+// CommandBufferMapping is a submitted command buffer start index, as added by
+// AddCommandBuffer.
+type CommandBufferMapping struct {
+	Submission    int
+	CommandBuffer uint64
+	Idx           api.SubCmdIdx
+}
+
+// RenderPassMapping is a submitted render pass range, as added by
+// AddRenderPass.
+type RenderPassMapping struct {
+	Key   RenderPassKey
+	Range SubCmdRange
+}
+
+// Mappings returns all the mappings held by the lookup, sorted by command
+// index. Adding them to a new RenderPassLookup creates an equivalent lookup.
+func (l *RenderPassLookup) Mappings() ([]CommandBufferMapping, []RenderPassMapping) {
+	cbs := []CommandBufferMapping{}
+	for cb, cbl := range l.commandBuffers {
+		for submission, idx := range cbl.submissions {
+			cbs = append(cbs, CommandBufferMapping{submission, cb, idx})
+		}
+	}
+	sort.Slice(cbs, func(i, j int) bool { return cbs[i].Idx.LessThan(cbs[j].Idx) })
+
+	rps := []RenderPassMapping{}
+	for rp, rpl := range l.renderPasses {
+		for key, idx := range rpl.mappings {
+			key.RenderPass = rp
+			rps = append(rps, RenderPassMapping{key, idx})
+		}
+	}
+	sort.Slice(rps, func(i, j int) bool { return rps[i].Range.From.LessThan(rps[j].Range.From) })
+	return cbs, rps
+}
+
 type commandBufferLookup struct {
 	submissions     map[int]api.SubCmdIdx
 	firstSubmission int
@@ -0,0 +1,66 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+)
+
+func TestRenderPassLookupMappings(t *testing.T) {
+	ctx := log.Testing(t)
+	l := NewRenderPassLookup()
+	l.AddCommandBuffer(ctx, 1, 100, api.SubCmdIdx{5, 0, 0})
+	l.AddCommandBuffer(ctx, 2, 100, api.SubCmdIdx{9, 0, 0})
+	l.AddCommandBuffer(ctx, 2, 200, api.SubCmdIdx{9, 0, 1})
+	l.AddRenderPass(ctx, RenderPassKey{1, 100, 10, 20}, SubCmdRange{api.SubCmdIdx{5, 0, 0, 1}, api.SubCmdIdx{5, 0, 0, 3}})
+	// Expands the range of the first render pass.
+	l.AddRenderPass(ctx, RenderPassKey{1, 100, 10, 20}, SubCmdRange{api.SubCmdIdx{5, 0, 0, 4}, api.SubCmdIdx{5, 0, 0, 6}})
+	l.AddRenderPass(ctx, RenderPassKey{2, 200, 11, 21}, SubCmdRange{api.SubCmdIdx{9, 0, 1, 1}, api.SubCmdIdx{9, 0, 1, 2}})
+
+	cbs, rps := l.Mappings()
+	assert.For(ctx, "command buffers").That(cbs).DeepEquals([]CommandBufferMapping{
+		{1, 100, api.SubCmdIdx{5, 0, 0}},
+		{2, 100, api.SubCmdIdx{9, 0, 0}},
+		{2, 200, api.SubCmdIdx{9, 0, 1}},
+	})
+	assert.For(ctx, "render passes").That(rps).DeepEquals([]RenderPassMapping{
+		{RenderPassKey{1, 100, 10, 20}, SubCmdRange{api.SubCmdIdx{5, 0, 0, 1}, api.SubCmdIdx{5, 0, 0, 6}}},
+		{RenderPassKey{2, 200, 11, 21}, SubCmdRange{api.SubCmdIdx{9, 0, 1, 1}, api.SubCmdIdx{9, 0, 1, 2}}},
+	})
+
+	readded := NewRenderPassLookup()
+	for _, cb := range cbs {
+		readded.AddCommandBuffer(ctx, cb.Submission, cb.CommandBuffer, cb.Idx)
+	}
+	for _, rp := range rps {
+		readded.AddRenderPass(ctx, rp.Key, rp.Range)
+	}
+	readdedCbs, readdedRps := readded.Mappings()
+	assert.For(ctx, "re-added command buffers").That(readdedCbs).DeepEquals(cbs)
+	assert.For(ctx, "re-added render passes").That(readdedRps).DeepEquals(rps)
+
+	for _, key := range []RenderPassKey{
+		{1, 100, 10, 20},
+		{2, 0, 11, 0},
+		{2, 100, 0, 0},
+		{0, 200, 0, 0},
+	} {
+		assert.For(ctx, "lookup %v", key).That(readded.Lookup(ctx, key)).DeepEquals(l.Lookup(ctx, key))
+	}
+}
@@ -100,6 +100,12 @@ type loopCallbacks struct {
 	postLoop loopCallbackFunc
 }
 
+// emptyLoopCallbacks returns loop callbacks that do nothing.
+func emptyLoopCallbacks() loopCallbacks {
+	ignore := func(ctx context.Context, request *gapir.FenceReadyRequest) {}
+	return loopCallbacks{preLoop: ignore, postLoop: ignore}
+}
+
 type loopingVulkanControlFlowGenerator struct {
 	ctx context.Context
 
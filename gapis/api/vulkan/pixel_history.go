@@ -0,0 +1,488 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	gosync "sync"
+
+	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/stream"
+	"github.com/google/gapid/core/stream/fmts"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// pixelHistoryDraw is a draw call considered by a pixel history query, along
+// with the relevant state of its graphics pipeline.
+type pixelHistoryDraw struct {
+	idx api.SubCmdIdx
+	// recordedBy is the capture command that recorded the draw call, which
+	// colours it in the DRAW_ID draw mode. It is api.CmdNoID for draw calls
+	// recorded before the start of the capture.
+	recordedBy  api.CmdID
+	depthTest   bool
+	stencilTest bool
+	// blend is true if the pipeline blends into the queried attachment.
+	blend bool
+	// idAttachment is the render pass attachment holding the draw ids of the
+	// draw call in the DRAW_ID draw mode, if hasIDAttachment is true.
+	idAttachment    uint32
+	idSRGB          bool
+	hasIDAttachment bool
+}
+
+// pixelHistoryCandidate is a draw call that rendered to the queried
+// attachment with the pixel in bounds, along with the reads of the pixel.
+type pixelHistoryCandidate struct {
+	draw pixelHistoryDraw
+	info resolve.FramebufferAttachmentInfo
+	// identifiable is true if the fragments of the draw call can be told
+	// apart in the DRAW_ID draw mode, in the attachment described by idInfo.
+	identifiable bool
+	idInfo       resolve.FramebufferAttachmentInfo
+
+	before, after *pixelRead
+	// coverage and test read the draw id of the pixel with the depth and
+	// stencil tests disabled and enabled respectively.
+	coverage, test *pixelRead
+}
+
+// pixelRead is a read back of a pixel of a framebuffer attachment after a
+// command. Reads in the DRAW_ID draw mode decode the draw id of the pixel,
+// other reads its value.
+type pixelRead struct {
+	after api.SubCmdIdx
+	info  resolve.FramebufferAttachmentInfo
+	cfg   drawConfig
+	srgb  bool
+
+	value []float32
+	id    api.CmdID
+	hasID bool
+	err   error
+}
+
+// QueryPixelHistory implements the replay.QueryPixelHistory interface.
+//
+// The fragments of each draw call are identified with the DRAW_ID draw mode:
+// a first replay, with the depth and stencil tests disabled, finds the draw
+// calls covering the pixel. A second replay, with the tests of the pipelines,
+// finds which of them passed the tests, while a third one reads the value of
+// the pixel before and after them. The reads sharing a draw mode are batched
+// into a single replay. As the fragment shaders are replaced, fragments
+// discarded by the shader count as passing, and the tests use the
+// interpolated depth rather than the depth written by the shader.
+//
+// The fragments of draw calls recorded before the start of the capture, or
+// with no color attachment able to hold draw ids, can not be identified. Such
+// draw calls are reported only if they modified the pixel.
+func (a API) QueryPixelHistory(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr replay.Manager,
+	p *path.PixelHistory,
+	r *path.ResolveConfig) (*service.PixelHistory, error) {
+
+	c := p.Commands.Capture
+	from, to := api.SubCmdIdx(p.Commands.From), api.SubCmdIdx(p.Commands.To)
+
+	syncData, err := resolve.SyncData(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	draws := []pixelHistoryDraw{}
+	postSubCmdCb := func(s *api.GlobalState, idx api.SubCmdIdx, cmd api.Cmd, ref interface{}) {
+		if idx.LessThan(from) || to.LessThan(idx) {
+			return
+		}
+		state := GetState(s)
+		switch GetCommandArgs(ctx, ref.(CommandReferenceʳ), state).(type) {
+		case VkCmdDrawArgsʳ,
+			VkCmdDrawIndexedArgsʳ,
+			VkCmdDrawIndirectArgsʳ,
+			VkCmdDrawIndexedIndirectArgsʳ,
+			VkCmdDrawIndirectCountKHRArgsʳ,
+			VkCmdDrawIndexedIndirectCountKHRArgsʳ,
+			VkCmdDrawIndirectCountAMDArgsʳ,
+			VkCmdDrawIndexedIndirectCountAMDArgsʳ:
+		default:
+			// Not a draw call.
+			return
+		}
+
+		draw := pixelHistoryDraw{
+			idx:        append(api.SubCmdIdx{}, idx...),
+			recordedBy: api.CmdNoID,
+		}
+		defer func() { draws = append(draws, draw) }()
+
+		if id, ok := a.FlattenSubcommandIdx(draw.idx, syncData, true); ok {
+			draw.recordedBy = id
+		}
+
+		lastQueue := state.LastBoundQueue()
+		if lastQueue.IsNil() {
+			return
+		}
+		lastDrawInfo, ok := state.LastDrawInfos().Lookup(lastQueue.VulkanHandle())
+		if !ok || lastDrawInfo.GraphicsPipeline().IsNil() {
+			return
+		}
+		pipeline := lastDrawInfo.GraphicsPipeline()
+		if depth := pipeline.DepthState(); !depth.IsNil() {
+			draw.depthTest = depth.DepthTestEnable() != 0 || depth.DepthBoundsTestEnable() != 0
+			draw.stencilTest = depth.StencilTestEnable() != 0
+		}
+		renderPass := pipeline.RenderPass()
+		if renderPass.IsNil() || !renderPass.SubpassDescriptions().Contains(pipeline.Subpass()) {
+			return
+		}
+		draw.idAttachment, draw.hasIDAttachment = drawIDAttachment(renderPass, pipeline.Subpass(), p.Attachment)
+		if draw.hasIDAttachment {
+			draw.idSRGB = isSRGBFormat(renderPass.AttachmentDescriptions().Get(draw.idAttachment).Fmt())
+		}
+		blend := pipeline.ColorBlendState()
+		if blend.IsNil() {
+			return
+		}
+		subpass := renderPass.SubpassDescriptions().Get(pipeline.Subpass())
+		for _, i := range subpass.ColorAttachments().Keys() {
+			if subpass.ColorAttachments().Get(i).Attachment() == p.Attachment && blend.Attachments().Contains(i) {
+				draw.blend = blend.Attachments().Get(i).BlendEnable() != 0
+			}
+		}
+	}
+
+	if err := sync.MutateWithSubcommands(ctx, c, nil, nil, nil, postSubCmdCb); err != nil {
+		return nil, err
+	}
+
+	changes, err := resolve.FramebufferChanges(ctx, c, r)
+	if err != nil {
+		return nil, err
+	}
+	candidates := pixelHistoryCandidates(draws, p.Attachment, p.X, p.Y,
+		func(idx api.SubCmdIdx, attachment uint32) (resolve.FramebufferAttachmentInfo, error) {
+			return changes.Get(ctx, c.Command(idx[0], idx[1:]...), attachment)
+		})
+
+	// Drop the identifiable draw calls that did not cover the pixel.
+	coverage := drawConfig{drawMode: path.DrawMode_DRAW_ID, disableFragmentTests: true}
+	reads := []*pixelRead{}
+	for _, candidate := range candidates {
+		if candidate.identifiable {
+			candidate.coverage = &pixelRead{after: candidate.draw.idx, info: candidate.idInfo, cfg: coverage, srgb: candidate.draw.idSRGB}
+			reads = append(reads, candidate.coverage)
+		}
+	}
+	if err := a.readPixels(ctx, intent, mgr, reads, p.X, p.Y); err != nil {
+		return nil, err
+	}
+	covered := []*pixelHistoryCandidate{}
+	for _, candidate := range candidates {
+		if !candidate.identifiable || candidate.coverage.hasDrawID(candidate.draw.recordedBy) {
+			covered = append(covered, candidate)
+		}
+	}
+
+	test := drawConfig{drawMode: path.DrawMode_DRAW_ID}
+	values := drawConfig{drawMode: path.DrawMode_NORMAL}
+	reads = []*pixelRead{}
+	for _, candidate := range covered {
+		candidate.after = &pixelRead{after: candidate.draw.idx, info: candidate.info, cfg: values}
+		reads = append(reads, candidate.after)
+		if prev, ok := previousCommand(candidate.draw.idx); ok {
+			candidate.before = &pixelRead{after: prev, info: candidate.info, cfg: values}
+			reads = append(reads, candidate.before)
+		}
+		if candidate.identifiable {
+			candidate.test = &pixelRead{after: candidate.draw.idx, info: candidate.idInfo, cfg: test, srgb: candidate.draw.idSRGB}
+			reads = append(reads, candidate.test)
+		}
+	}
+	if err := a.readPixels(ctx, intent, mgr, reads, p.X, p.Y); err != nil {
+		return nil, err
+	}
+
+	out := &service.PixelHistory{}
+	for _, candidate := range covered {
+		var before []float32
+		if candidate.before != nil {
+			before = candidate.before.value
+		}
+		after := candidate.after.value
+		modified := before != nil && !pixelValuesEqual(before, after)
+
+		passed := modified
+		if candidate.identifiable {
+			passed = candidate.test.hasDrawID(candidate.draw.recordedBy)
+		} else if !modified {
+			continue
+		}
+
+		idx := candidate.draw.idx
+		out.Draws = append(out.Draws, &service.PixelHistoryDraw{
+			Command:      c.Command(idx[0], idx[1:]...),
+			Before:       before,
+			After:        after,
+			Modified:     modified,
+			FragmentTest: fragmentTestOutcome(candidate.draw, passed),
+			Blended:      passed && candidate.draw.blend,
+		})
+	}
+	return out, nil
+}
+
+// pixelHistoryCandidates returns the draw calls that rendered to the
+// attachment with the pixel (x, y) in bounds. info returns the description of
+// an attachment after a draw call.
+func pixelHistoryCandidates(draws []pixelHistoryDraw, attachment, x, y uint32,
+	info func(idx api.SubCmdIdx, attachment uint32) (resolve.FramebufferAttachmentInfo, error)) []*pixelHistoryCandidate {
+
+	candidates := []*pixelHistoryCandidate{}
+	for _, draw := range draws {
+		attachmentInfo, err := info(draw.idx, attachment)
+		if err != nil || x >= attachmentInfo.Width || y >= attachmentInfo.Height {
+			// The draw call did not render to the attachment.
+			continue
+		}
+		candidate := &pixelHistoryCandidate{draw: draw, info: attachmentInfo}
+		if draw.recordedBy != api.CmdNoID && draw.hasIDAttachment {
+			idInfo, err := info(draw.idx, draw.idAttachment)
+			candidate.identifiable = err == nil && x < idInfo.Width && y < idInfo.Height
+			candidate.idInfo = idInfo
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// drawIDAttachment returns the render pass attachment holding the draw ids
+// of a draw call in the given subpass: the preferred attachment if it can hold
+// them, the first color attachment of the subpass able to hold them otherwise.
+func drawIDAttachment(renderPass RenderPassObjectʳ, subpass, preferred uint32) (uint32, bool) {
+	colorAttachments := renderPass.SubpassDescriptions().Get(subpass).ColorAttachments()
+	found, attachment := false, uint32(0)
+	for _, i := range colorAttachments.Keys() {
+		idx := colorAttachments.Get(i).Attachment()
+		description, ok := renderPass.AttachmentDescriptions().Lookup(idx)
+		if !ok || !canHoldDrawIDs(description.Fmt()) {
+			continue
+		}
+		if idx == preferred {
+			return idx, true
+		}
+		if !found {
+			found, attachment = true, idx
+		}
+	}
+	return attachment, found
+}
+
+// canHoldDrawIDs returns true if attachments of the given format store the
+// draw id colours exactly: the format must have unsigned red, green and blue
+// channels of at least 8 bits of precision.
+func canHoldDrawIDs(format VkFormat) bool {
+	if debugDrawOutputType(format) != "vec4" {
+		return false
+	}
+	f, err := getImageFormatFromVulkanFormat(format)
+	if err != nil || f.GetUncompressed() == nil {
+		return false
+	}
+	channels := 0
+	for _, c := range f.GetUncompressed().Format.Components {
+		switch c.Channel {
+		case stream.Channel_Red, stream.Channel_Green, stream.Channel_Blue:
+		default:
+			continue
+		}
+		switch {
+		case c.DataType.IsInteger():
+			if c.DataType.Signed || c.DataType.GetInteger().Bits < 8 {
+				return false
+			}
+		case c.DataType.IsFloat():
+			if c.DataType.GetFloat().MantissaBits < 8 {
+				return false
+			}
+		default:
+			return false
+		}
+		channels++
+	}
+	return channels == 3
+}
+
+// previousCommand returns the command preceding idx in its command buffer.
+func previousCommand(idx api.SubCmdIdx) (api.SubCmdIdx, bool) {
+	last := len(idx) - 1
+	if last < 1 || idx[last] == 0 {
+		return nil, false
+	}
+	prev := append(api.SubCmdIdx{}, idx...)
+	prev[last]--
+	return prev, true
+}
+
+// fragmentTestOutcome returns the outcome of the depth and stencil tests for
+// the fragment of a draw call covering the pixel.
+func fragmentTestOutcome(draw pixelHistoryDraw, passed bool) service.PixelHistoryDraw_FragmentTest {
+	switch {
+	case passed:
+		return service.PixelHistoryDraw_PASSED
+	case draw.depthTest && !draw.stencilTest:
+		return service.PixelHistoryDraw_DEPTH_FAILED
+	case draw.stencilTest && !draw.depthTest:
+		return service.PixelHistoryDraw_STENCIL_FAILED
+	default:
+		return service.PixelHistoryDraw_DEPTH_OR_STENCIL_FAILED
+	}
+}
+
+// readPixels performs the reads of the pixel (x, y). The reads are all issued
+// at once, so that the replay manager batches the reads sharing a draw config
+// into a single replay. Each read only keeps the pixel of the attachment.
+func (a API) readPixels(ctx context.Context, intent replay.Intent, mgr replay.Manager, reads []*pixelRead, x, y uint32) error {
+	wg := gosync.WaitGroup{}
+	wg.Add(len(reads))
+	for _, read := range reads {
+		read := read
+		crash.Go(func() {
+			defer wg.Done()
+			r := framebufferRequest{
+				after:            read.after,
+				width:            read.info.Width,
+				height:           read.info.Height,
+				attachment:       read.info.Type,
+				framebufferIndex: read.info.Index,
+				out:              make(chan imgRes, 1),
+			}
+			res, err := mgr.Replay(ctx, intent, read.cfg, r, a, nil, false)
+			if err != nil {
+				read.err = err
+				return
+			}
+			img, _ := res.(*image.Data)
+			if read.cfg.drawMode == path.DrawMode_DRAW_ID {
+				read.id, read.hasID, read.err = pixelDrawID(img, x, y, read.srgb)
+			} else {
+				read.value, read.err = pixelValue(img, x, y, read.info.Type)
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, read := range reads {
+		if read.err != nil {
+			return log.Errf(ctx, read.err, "Reading attachment %v after %v", read.info.Index, read.after)
+		}
+	}
+	return nil
+}
+
+// hasDrawID returns true if the pixel was coloured by the draw call recorded
+// by the given command. Only the lowest 24 bits of the ids are compared, see
+// DrawIDFromColor.
+func (read *pixelRead) hasDrawID(id api.CmdID) bool {
+	return read.hasID && read.id == id&0xffffff
+}
+
+// pixelValue returns the value of the pixel (x, y) of img as floats: the red,
+// green, blue and alpha channels for color attachments, or the depth for depth
+// attachments.
+func pixelValue(img *image.Data, x, y uint32, attachment api.FramebufferAttachmentType) ([]float32, error) {
+	if img == nil {
+		return nil, nil
+	}
+
+	format, channels := image.RGBA_F32, 4
+	switch attachment {
+	case api.FramebufferAttachmentType_OutputDepth, api.FramebufferAttachmentType_InputDepth:
+		format, channels = image.NewUncompressed("D_F32", fmts.D_F32), 1
+	}
+
+	converted, err := img.Convert(format)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := pixelOffset(converted, x, y, channels*4)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]float32, channels)
+	for i := range value {
+		value[i] = math.Float32frombits(binary.LittleEndian.Uint32(converted.Bytes[offset+i*4:]))
+	}
+	return value, nil
+}
+
+// pixelDrawID returns the draw id the pixel (x, y) of img was coloured with
+// in the DRAW_ID draw mode, see DrawIDFromColor. srgb is true if the
+// attachment has an sRGB format, which stores the encoded colour.
+func pixelDrawID(img *image.Data, x, y uint32, srgb bool) (api.CmdID, bool, error) {
+	if img == nil {
+		return 0, false, nil
+	}
+
+	format := image.RGBA_U8_NORM
+	if srgb {
+		format = image.SRGBA_U8_NORM
+	}
+	converted, err := img.Convert(format)
+	if err != nil {
+		return 0, false, err
+	}
+	offset, err := pixelOffset(converted, x, y, 4)
+	if err != nil {
+		return 0, false, err
+	}
+	rgb := converted.Bytes[offset:]
+	id, ok := DrawIDFromColor(rgb[0], rgb[1], rgb[2])
+	return id, ok, nil
+}
+
+// pixelOffset returns the offset of the pixel (x, y) in the bytes of img,
+// which has pixelSize bytes per pixel.
+func pixelOffset(img *image.Data, x, y uint32, pixelSize int) (int, error) {
+	offset := int(y*img.Width+x) * pixelSize
+	if x >= img.Width || offset+pixelSize > len(img.Bytes) {
+		return 0, fmt.Errorf("Pixel (%d, %d) is out of bounds", x, y)
+	}
+	return offset, nil
+}
+
+func pixelValuesEqual(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
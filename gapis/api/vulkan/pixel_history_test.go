@@ -0,0 +1,273 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/stream/fmts"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+)
+
+func floatBytes(values ...float32) []byte {
+	out := make([]byte, len(values)*4)
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(out[i*4:], math.Float32bits(v))
+	}
+	return out
+}
+
+func TestPixelValue(t *testing.T) {
+	ctx := log.Testing(t)
+	depth := image.NewUncompressed("D_F32", fmts.D_F32)
+	for _, test := range []struct {
+		name       string
+		img        *image.Data
+		x, y       uint32
+		attachment api.FramebufferAttachmentType
+		expected   []float32
+		fails      bool
+	}{
+		{"rgba8", &image.Data{Bytes: []byte{0, 0, 0, 0, 255, 0, 255, 255}, Width: 2, Height: 1, Depth: 1, Format: image.RGBA_U8_NORM},
+			1, 0, api.FramebufferAttachmentType_OutputColor, []float32{1, 0, 1, 1}, false},
+		{"srgb8", &image.Data{Bytes: []byte{0, 255, 0, 255}, Width: 1, Height: 1, Depth: 1, Format: image.SRGBA_U8_NORM},
+			0, 0, api.FramebufferAttachmentType_OutputColor, []float32{0, 1, 0, 1}, false},
+		{"rgba32f", &image.Data{Bytes: floatBytes(0.25, 0.5, 0.75, 1, 2, 3, 4, 5), Width: 1, Height: 2, Depth: 1, Format: image.RGBA_F32},
+			0, 1, api.FramebufferAttachmentType_OutputColor, []float32{2, 3, 4, 5}, false},
+		{"depth", &image.Data{Bytes: floatBytes(0.5, 0.125), Width: 2, Height: 1, Depth: 1, Format: depth},
+			1, 0, api.FramebufferAttachmentType_OutputDepth, []float32{0.125}, false},
+		{"out of bounds x", &image.Data{Bytes: floatBytes(0.5, 0.125), Width: 2, Height: 1, Depth: 1, Format: depth},
+			2, 0, api.FramebufferAttachmentType_OutputDepth, nil, true},
+		{"out of bounds y", &image.Data{Bytes: []byte{0, 0, 0, 0}, Width: 1, Height: 1, Depth: 1, Format: image.RGBA_U8_NORM},
+			0, 1, api.FramebufferAttachmentType_OutputColor, nil, true},
+		{"no image", nil, 0, 0, api.FramebufferAttachmentType_OutputColor, nil, false},
+	} {
+		value, err := pixelValue(test.img, test.x, test.y, test.attachment)
+		if test.fails {
+			assert.For(ctx, "%v err", test.name).ThatError(err).Failed()
+			continue
+		}
+		if assert.For(ctx, "%v err", test.name).ThatError(err).Succeeded() {
+			assert.For(ctx, "%v value", test.name).ThatSlice(value).Equals(test.expected)
+		}
+	}
+}
+
+func TestPixelValuesEqual(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		a, b     []float32
+		expected bool
+	}{
+		{nil, nil, true},
+		{[]float32{}, nil, true},
+		{[]float32{1, 0, 0, 1}, []float32{1, 0, 0, 1}, true},
+		{[]float32{1, 0, 0, 1}, []float32{1, 0, 0, 0.5}, false},
+		{[]float32{0.5}, []float32{0.5}, true},
+		{[]float32{0.5}, []float32{0.25}, false},
+		{[]float32{0.5}, []float32{0.5, 0, 0, 1}, false},
+		{[]float32{0.5}, nil, false},
+	} {
+		assert.For(ctx, "%v == %v", test.a, test.b).That(pixelValuesEqual(test.a, test.b)).Equals(test.expected)
+	}
+}
+
+func TestPixelDrawID(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, srgb := range []bool{false, true} {
+		format := image.RGBA_U8_NORM
+		if srgb {
+			format = image.SRGBA_U8_NORM
+		}
+		c := drawIDColor(1234, srgb)
+		img := &image.Data{
+			Bytes: []byte{
+				0, 0, 0, 255,
+				storedByte(c.Get(0), srgb), storedByte(c.Get(1), srgb), storedByte(c.Get(2), srgb), 255,
+			},
+			Width: 1, Height: 2, Depth: 1, Format: format,
+		}
+
+		id, ok, err := pixelDrawID(img, 0, 1, srgb)
+		if assert.For(ctx, "srgb %v err", srgb).ThatError(err).Succeeded() {
+			assert.For(ctx, "srgb %v ok", srgb).That(ok).Equals(true)
+			assert.For(ctx, "srgb %v id", srgb).That(id).Equals(api.CmdID(1234))
+		}
+
+		_, ok, err = pixelDrawID(img, 0, 0, srgb)
+		if assert.For(ctx, "srgb %v background err", srgb).ThatError(err).Succeeded() {
+			assert.For(ctx, "srgb %v background", srgb).That(ok).Equals(false)
+		}
+
+		_, _, err = pixelDrawID(img, 1, 0, srgb)
+		assert.For(ctx, "srgb %v out of bounds", srgb).ThatError(err).Failed()
+	}
+}
+
+func TestCanHoldDrawIDs(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		format   VkFormat
+		expected bool
+	}{
+		{VkFormat_VK_FORMAT_R8G8B8A8_UNORM, true},
+		{VkFormat_VK_FORMAT_B8G8R8A8_SRGB, true},
+		{VkFormat_VK_FORMAT_R16G16B16A16_SFLOAT, true},
+		{VkFormat_VK_FORMAT_R32G32B32A32_SFLOAT, true},
+		{VkFormat_VK_FORMAT_A2B10G10R10_UNORM_PACK32, true},
+		{VkFormat_VK_FORMAT_R8G8B8A8_SNORM, false},
+		{VkFormat_VK_FORMAT_R5G6B5_UNORM_PACK16, false},
+		{VkFormat_VK_FORMAT_B10G11R11_UFLOAT_PACK32, false},
+		{VkFormat_VK_FORMAT_R8G8_UNORM, false},
+		{VkFormat_VK_FORMAT_R8G8B8A8_UINT, false},
+		{VkFormat_VK_FORMAT_D32_SFLOAT, false},
+	} {
+		assert.For(ctx, "%v", test.format).That(canHoldDrawIDs(test.format)).Equals(test.expected)
+	}
+}
+
+func TestDrawIDAttachment(t *testing.T) {
+	ctx := log.Testing(t)
+	// Attachment 0 is a depth attachment, 1 an integer attachment, 2 and 3
+	// can hold draw ids. Only color attachments are considered.
+	renderPass := MakeRenderPassObjectʳ()
+	for i, format := range []VkFormat{
+		VkFormat_VK_FORMAT_D32_SFLOAT,
+		VkFormat_VK_FORMAT_R32_UINT,
+		VkFormat_VK_FORMAT_R8G8B8A8_UNORM,
+		VkFormat_VK_FORMAT_B8G8R8A8_SRGB,
+	} {
+		description := MakeAttachmentDescription()
+		description.SetFmt(format)
+		renderPass.AttachmentDescriptions().Add(uint32(i), description)
+	}
+	subpass := func(colors ...uint32) SubpassDescription {
+		s := MakeSubpassDescription()
+		for i, c := range colors {
+			reference := MakeAttachmentReference()
+			reference.SetAttachment(c)
+			s.ColorAttachments().Add(uint32(i), reference)
+		}
+		return s
+	}
+	renderPass.SubpassDescriptions().Add(0, subpass(1, 2, 3))
+	renderPass.SubpassDescriptions().Add(1, subpass(VK_ATTACHMENT_UNUSED, 1))
+	renderPass.SubpassDescriptions().Add(2, subpass(VK_ATTACHMENT_UNUSED, 3))
+
+	for _, test := range []struct {
+		subpass, preferred uint32
+		expected           uint32
+		found              bool
+	}{
+		{0, 3, 3, true},
+		{0, 2, 2, true},
+		{0, 0, 2, true},
+		{0, 1, 2, true},
+		{1, 1, 0, false},
+		{2, 0, 3, true},
+	} {
+		attachment, found := drawIDAttachment(renderPass, test.subpass, test.preferred)
+		assert.For(ctx, "subpass %v preferred %v found", test.subpass, test.preferred).That(found).Equals(test.found)
+		if test.found {
+			assert.For(ctx, "subpass %v preferred %v", test.subpass, test.preferred).That(attachment).Equals(test.expected)
+		}
+	}
+}
+
+func TestPixelHistoryCandidates(t *testing.T) {
+	ctx := log.Testing(t)
+	// The queried attachment is attachment 1, attachment 0 holds the draw ids.
+	draw := func(i uint64, recordedBy api.CmdID, hasIDAttachment bool) pixelHistoryDraw {
+		return pixelHistoryDraw{
+			idx:             api.SubCmdIdx{10, 0, 0, i},
+			recordedBy:      recordedBy,
+			idAttachment:    0,
+			hasIDAttachment: hasIDAttachment,
+		}
+	}
+	draws := []pixelHistoryDraw{
+		draw(1, 3, true),           // Identifiable.
+		draw(2, 4, true),           // Did not render to the attachment.
+		draw(3, 5, true),           // Rendered to a smaller attachment.
+		draw(4, api.CmdNoID, true), // Recorded before the capture.
+		draw(5, 6, false),          // No attachment holding draw ids.
+		draw(6, 7, true),           // The draw id attachment is too small.
+		draw(7, 8, true),           // Identifiable.
+	}
+	info := func(idx api.SubCmdIdx, attachment uint32) (resolve.FramebufferAttachmentInfo, error) {
+		out := resolve.FramebufferAttachmentInfo{Width: 16, Height: 16, Index: attachment}
+		switch {
+		case idx[3] == 2 && attachment == 1:
+			return resolve.FramebufferAttachmentInfo{}, fmt.Errorf("Not bound")
+		case idx[3] == 3 && attachment == 1, idx[3] == 6 && attachment == 0:
+			out.Width, out.Height = 4, 4
+		}
+		return out, nil
+	}
+
+	candidates := pixelHistoryCandidates(draws, 1, 8, 2, info)
+	type result struct {
+		draw         uint64
+		identifiable bool
+	}
+	got := []result{}
+	for _, c := range candidates {
+		got = append(got, result{c.draw.idx[3], c.identifiable})
+		assert.For(ctx, "draw %v attachment", c.draw.idx[3]).That(c.info.Index).Equals(uint32(1))
+		if c.identifiable {
+			assert.For(ctx, "draw %v id attachment", c.draw.idx[3]).That(c.idInfo.Index).Equals(uint32(0))
+		}
+	}
+	assert.For(ctx, "candidates").ThatSlice(got).Equals([]result{
+		{1, true}, {4, false}, {5, false}, {6, false}, {7, true},
+	})
+}
+
+func TestFragmentTestOutcome(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, test := range []struct {
+		depthTest, stencilTest, passed bool
+		expected                       service.PixelHistoryDraw_FragmentTest
+	}{
+		{false, false, true, service.PixelHistoryDraw_PASSED},
+		{true, true, true, service.PixelHistoryDraw_PASSED},
+		{true, false, false, service.PixelHistoryDraw_DEPTH_FAILED},
+		{false, true, false, service.PixelHistoryDraw_STENCIL_FAILED},
+		{true, true, false, service.PixelHistoryDraw_DEPTH_OR_STENCIL_FAILED},
+	} {
+		draw := pixelHistoryDraw{depthTest: test.depthTest, stencilTest: test.stencilTest}
+		assert.For(ctx, "depth %v stencil %v passed %v", test.depthTest, test.stencilTest, test.passed).
+			That(fragmentTestOutcome(draw, test.passed)).Equals(test.expected)
+	}
+}
+
+func TestPreviousCommand(t *testing.T) {
+	ctx := log.Testing(t)
+	prev, ok := previousCommand(api.SubCmdIdx{10, 0, 1, 4})
+	assert.For(ctx, "ok").That(ok).Equals(true)
+	assert.For(ctx, "prev").ThatSlice(prev).Equals(api.SubCmdIdx{10, 0, 1, 3})
+	_, ok = previousCommand(api.SubCmdIdx{10, 0, 1, 0})
+	assert.For(ctx, "first command").That(ok).Equals(false)
+	_, ok = previousCommand(api.SubCmdIdx{10})
+	assert.For(ctx, "command").That(ok).Equals(false)
+}
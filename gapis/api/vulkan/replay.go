@@ -31,6 +31,7 @@ import (
 	"github.com/google/gapid/gapis/messages"
 	"github.com/google/gapid/gapis/replay"
 	"github.com/google/gapid/gapis/resolve/initialcmds"
+	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
 	"github.com/google/gapid/gapis/stringtable"
 )
@@ -128,6 +129,13 @@ func (a API) Replay(
 	// Melih TODO: DCE probably should be here
 	initialCmds := getInitialCmds(ctx, dependentPayload, intent, out)
 	numOfInitialCmds := api.CmdID(len(initialCmds))
+	loopStart := numOfInitialCmds
+	loopEnd := api.CmdID(len(initialCmds) + len(c.Commands) - 1)
+	if request, ok := firstRequest.(timestampsRequest); ok && request.loopEnd != api.CmdNoID {
+		// Only loop over the requested range of the capture commands.
+		loopStart = numOfInitialCmds + request.loopBegin
+		loopEnd = numOfInitialCmds + request.loopEnd
+	}
 
 	// Due to how replay system works, different types of replays cannot be batched
 	switch firstRequest.(type) {
@@ -148,7 +156,7 @@ func (a API) Replay(
 		}
 		transforms = append(transforms, profileTransforms...)
 	case timestampsRequest:
-		transforms = append(transforms, getTimestampTransforms(ctx, &rrs[0])...)
+		transforms = append(transforms, getTimestampTransforms(ctx, numOfInitialCmds, loopStart, loopEnd, &rrs[0])...)
 	default:
 		panic("Unknown request type")
 	}
@@ -161,8 +169,6 @@ func (a API) Replay(
 	// Handle this if it's a profile request and return
 	if request, ok := firstRequest.(profileRequest); ok {
 
-		loopStart := numOfInitialCmds
-		loopEnd := api.CmdID(len(initialCmds) + len(c.Commands) - 1)
 		nullWriterObj := nullWriter{state: cloneStateWithSharedAllocator(ctx, c, out.State())}
 		chain := transform.CreateTransformChain(ctx, cmdGenerator, transforms, nullWriterObj)
 		loopCallbacks := getPerfettoLoopCallbacks(request.traceOptions, request.handler, request.buffer)
@@ -173,6 +179,19 @@ func (a API) Replay(
 			return err
 		}
 
+	} else if request, ok := firstRequest.(timestampsRequest); ok && request.loopCount > 1 {
+
+		// Repeated timestamp queries loop over the whole capture as well,
+		// unless a range of commands is requested.
+		nullWriterObj := nullWriter{state: cloneStateWithSharedAllocator(ctx, c, out.State())}
+		chain := transform.CreateTransformChain(ctx, cmdGenerator, transforms, nullWriterObj)
+		controlFlow := NewLoopingVulkanControlFlowGenerator(ctx, chain, out, c, loopStart, loopEnd, request.loopCount, emptyLoopCallbacks())
+
+		if err := controlFlow.TransformAll(ctx); err != nil {
+			log.E(ctx, "%v Error: %v", replayType, err)
+			return err
+		}
+
 	} else {
 
 		// Handle all other types of request in the normal way.
@@ -195,6 +214,8 @@ func getFramebufferTransforms(ctx context.Context,
 	rrs []replay.RequestAndResult) ([]transform.Transform, error) {
 
 	shouldRenderWired := false
+	debugDrawMode := path.DrawMode_NORMAL
+	disableFragmentTests := false
 	doDisplayToSurface := false
 	shouldOverDraw := false
 
@@ -236,6 +257,11 @@ func getFramebufferTransforms(ctx context.Context,
 		switch cfg.drawMode {
 		case path.DrawMode_WIREFRAME_ALL:
 			shouldRenderWired = true
+		case path.DrawMode_DRAW_ID, path.DrawMode_DEPTH_COMPLEXITY,
+			path.DrawMode_SHADER_COST, path.DrawMode_MIP_LEVEL,
+			path.DrawMode_TEXEL_DENSITY:
+			debugDrawMode = cfg.drawMode
+			disableFragmentTests = cfg.disableFragmentTests
 		case path.DrawMode_WIREFRAME_OVERLAY:
 			return nil, fmt.Errorf("Overlay wireframe view is not currently supported")
 			// Overdraw is handled above, since it breaks out of the normal read flow.
@@ -261,6 +287,12 @@ func getFramebufferTransforms(ctx context.Context,
 		transforms = append(transforms, newWireframeTransform())
 	}
 
+	if debugDrawMode != path.DrawMode_NORMAL {
+		debugDraw := newDebugDrawTransform(debugDrawMode, numOfInitialCmds)
+		debugDraw.disableFragmentTests = disableFragmentTests
+		transforms = append(transforms, debugDraw)
+	}
+
 	if doDisplayToSurface {
 		transforms = append(transforms, newDisplayToSurface())
 	}
@@ -316,6 +348,17 @@ func getProfileTransforms(ctx context.Context,
 		transforms = append(transforms, newAfDisablerTransform())
 	}
 
+	if request.experiments.SampleSmallestMip || request.experiments.ForceBaseMipLevel ||
+		request.experiments.NullRasterization || request.experiments.DisableBlending {
+		transforms = append(transforms, newProfileExperimentsTransform(request.experiments))
+	}
+
+	if request.experiments.ConstantFragmentShaders {
+		// The normal draw mode replaces the fragment shaders with a constant
+		// colour and leaves the rest of the pipeline untouched.
+		transforms = append(transforms, newDebugDrawTransform(path.DrawMode_NORMAL, numOfInitialCmds))
+	}
+
 	var err error
 	if len(request.experiments.DisabledCmds) > 0 {
 		disablerTransform := newCommandDisabler(ctx, uint64(numOfInitialCmds))
@@ -331,13 +374,44 @@ func getProfileTransforms(ctx context.Context,
 }
 
 func getTimestampTransforms(ctx context.Context,
+	numOfInitialCmds api.CmdID,
+	loopStart api.CmdID,
+	loopEnd api.CmdID,
 	requestAndResult *replay.RequestAndResult) []transform.Transform {
 	request := requestAndResult.Request.(timestampsRequest)
-	timestampTransform := newQueryTimestamps(ctx, request.handler)
+	handler := request.handler
+	if request.loopEnd != api.CmdNoID {
+		// Looped ranges are requested in capture commands, so report them
+		// the same way.
+		handler = func(r *service.GetTimestampsResponse) error {
+			for _, item := range r.GetTimestamps().GetTimestamps() {
+				item.Begin = captureCommand(item.Begin, numOfInitialCmds)
+				item.End = captureCommand(item.End, numOfInitialCmds)
+			}
+			return request.handler(r)
+		}
+	}
+	timestampTransform := newQueryTimestamps(ctx, handler)
+	if request.loopCount > 1 {
+		// Read the results of the commands before the loop once, so that
+		// only the results of the loop are read after each iteration.
+		if loopStart > 0 {
+			timestampTransform.readResultsAfter[loopStart-1] = true
+		}
+		timestampTransform.readResultsAfter[loopEnd] = true
+	}
 	timestampTransform.AddResult(requestAndResult.Result)
 	return []transform.Transform{timestampTransform}
 }
 
+// captureCommand returns a copy of cmd, indexed from the first capture
+// command instead of the first of the initial commands.
+func captureCommand(cmd *path.Command, numOfInitialCmds api.CmdID) *path.Command {
+	indices := append([]uint64{}, cmd.Indices...)
+	indices[0] -= uint64(numOfInitialCmds)
+	return &path.Command{Capture: cmd.Capture, Indices: indices}
+}
+
 func appendLogTransforms(ctx context.Context, tag string, capture *capture.GraphicsCapture, transforms []transform.Transform) []transform.Transform {
 	if config.LogTransformsToFile {
 		newTransforms := make([]transform.Transform, 0)
@@ -32,8 +32,10 @@ var (
 	// Interface compliance tests
 	_ = replay.QueryIssues(API{})
 	_ = replay.QueryFramebufferAttachment(API{})
+	_ = replay.QueryPixelHistory(API{})
 	_ = replay.Support(API{})
 	_ = replay.QueryTimestamps(API{})
+	_ = replay.QueryLoopedTimestamps(API{})
 	_ = replay.Profiler(API{})
 )
 
@@ -45,6 +47,9 @@ type drawConfig struct {
 	subindices                string // drawConfig needs to be comparable, so we cannot use a slice
 	drawMode                  path.DrawMode
 	disableReplayOptimization bool
+	// disableFragmentTests disables the depth and stencil tests of the debug
+	// draw modes, see debugDrawTransform.
+	disableFragmentTests bool
 }
 
 type imgRes struct {
@@ -73,11 +78,20 @@ type issuesRequest struct {
 	displayToSurface bool
 }
 
+// timestampsConfig is a replay.Config used by timestampsRequests. Requests
+// are only batched with the requests of the same loop count, as the replay
+// loops with the count of its first request.
 type timestampsConfig struct {
+	loopCount int32
 }
 
 type timestampsRequest struct {
-	handler service.TimeStampsHandler
+	handler   service.TimeStampsHandler
+	loopCount int32
+	// loopBegin and loopEnd are the first and last capture commands of the
+	// looped range, or api.CmdNoID to loop over the whole capture.
+	loopBegin api.CmdID
+	loopEnd   api.CmdID
 }
 
 // uniqueConfig returns a replay.Config that is guaranteed to be unique.
@@ -127,7 +141,7 @@ func (a API) QueryFramebufferAttachment(
 		}
 	}
 
-	c := drawConfig{beginIndex, endIndex, subcommand, drawMode, disableReplayOptimization}
+	c := drawConfig{beginIndex, endIndex, subcommand, drawMode, disableReplayOptimization, false}
 	out := make(chan imgRes, 1)
 	r := framebufferRequest{after: after, width: width, height: height, framebufferIndex: framebufferIndex, attachment: attachment, out: out, displayToSurface: displayToSurface}
 	res, err := mgr.Replay(ctx, intent, c, r, a, hints, false)
@@ -163,11 +177,15 @@ func (a API) QueryTimestamps(
 	ctx context.Context,
 	intent replay.Intent,
 	mgr replay.Manager,
+	loopCount int32,
 	handler service.TimeStampsHandler,
 	hints *path.UsageHints) error {
 
-	c, r := timestampsConfig{}, timestampsRequest{
-		handler: handler}
+	c, r := timestampsConfig{loopCount}, timestampsRequest{
+		handler:   handler,
+		loopCount: loopCount,
+		loopBegin: api.CmdNoID,
+		loopEnd:   api.CmdNoID}
 	_, err := mgr.Replay(ctx, intent, c, r, a, hints, false)
 	if err != nil {
 		return err
@@ -178,6 +196,27 @@ func (a API) QueryTimestamps(
 	return nil
 }
 
+// QueryLoopedTimestamps replays the capture, repeating the commands from begin
+// to end (inclusive) loopCount times, and reports the timestamps of the
+// command buffers submitted in every repetition to handler.
+func (a API) QueryLoopedTimestamps(
+	ctx context.Context,
+	intent replay.Intent,
+	mgr replay.Manager,
+	begin, end api.CmdID,
+	loopCount int32,
+	handler service.TimeStampsHandler,
+	hints *path.UsageHints) error {
+
+	c, r := uniqueConfig(), timestampsRequest{
+		handler:   handler,
+		loopCount: loopCount,
+		loopBegin: begin,
+		loopEnd:   end}
+	_, err := mgr.Replay(ctx, intent, c, r, a, hints, false)
+	return err
+}
+
 func (a API) QueryProfile(
 	ctx context.Context,
 	intent replay.Intent,
@@ -186,7 +225,8 @@ func (a API) QueryProfile(
 	hints *path.UsageHints,
 	traceOptions *service.TraceOptions,
 	experiments replay.ProfileExperiments,
-	loopCount int32) (*service.ProfilingData, error) {
+	loopCount int32,
+	bundlePath string) (*service.ProfilingData, error) {
 
 	c := uniqueConfig()
 	handler := replay.NewSignalHandler()
@@ -204,6 +244,12 @@ func (a API) QueryProfile(
 		return nil, err
 	}
 
+	if bundlePath != "" {
+		if err := trace.SaveProfilingBundle(ctx, bundlePath, intent.Device, intent.Capture, buffer.Bytes(), handleMappings, s); err != nil {
+			return nil, err
+		}
+	}
+
 	d, err := trace.ProcessProfilingData(ctx, intent.Device, intent.Capture, &buffer, staticAnalysisResult, handleMappings, s)
 	return d, err
 }
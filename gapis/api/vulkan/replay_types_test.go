@@ -0,0 +1,52 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// configRecorder is a replay.Manager that records the configs of the
+// requested replays.
+type configRecorder struct {
+	configs []replay.Config
+}
+
+func (m *configRecorder) Replay(ctx context.Context, intent replay.Intent, cfg replay.Config, req replay.Request, generator replay.Generator, hints *path.UsageHints, forceNonSplitReplay bool) (interface{}, error) {
+	m.configs = append(m.configs, cfg)
+	return nil, nil
+}
+
+func TestTimestampsBatching(t *testing.T) {
+	ctx := log.Testing(t)
+	handler := func(*service.GetTimestampsResponse) error { return nil }
+	mgr := &configRecorder{}
+	for _, loopCount := range []int32{1, 1, 5, 10} {
+		err := API{}.QueryTimestamps(ctx, replay.Intent{}, mgr, loopCount, handler, nil)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+	}
+
+	// Requests are batched by equal configs.
+	assert.For(ctx, "same loop count").That(mgr.configs[0] == mgr.configs[1]).Equals(true)
+	assert.For(ctx, "looped and unlooped").That(mgr.configs[1] == mgr.configs[2]).Equals(false)
+	assert.For(ctx, "different loop counts").That(mgr.configs[2] == mgr.configs[3]).Equals(false)
+}
@@ -16,7 +16,6 @@ package vulkan
 
 import (
 	"context"
-	"encoding/binary"
 	"fmt"
 
 	"github.com/google/gapid/core/data/id"
@@ -909,52 +908,45 @@ func (shader ShaderModuleObjectʳ) SetResourceData(
 	for j := index; j >= 0; j-- {
 		i := resource.Accesses[j].Indices[0] // TODO: Subcommands
 		if cmd, ok := c.Commands[i].(*VkCreateShaderModule); ok {
-			edits(uint64(i), cmd.Replace(ctx, c, data))
+			newCmd, err := cmd.Replace(ctx, c, data)
+			if err != nil {
+				return err
+			}
+			edits(uint64(i), newCmd)
 			return nil
 		}
 	}
 	return fmt.Errorf("No command to set data in")
 }
 
-func (cmd *VkCreateShaderModule) Replace(ctx context.Context, c *capture.GraphicsCapture, data *api.ResourceData) interface{} {
+// Replace returns a copy of cmd creating the shader module from the shader
+// in data. See replacementShaderCode for the supported shader sources.
+func (cmd *VkCreateShaderModule) Replace(ctx context.Context, c *capture.GraphicsCapture, data *api.ResourceData) (api.Cmd, error) {
 	ctx = log.Enter(ctx, "VkCreateShaderModule.Replace()")
 	cb := CommandBuilder{Thread: cmd.Thread()}
 	state := c.NewState(ctx)
 	cmd.Mutate(ctx, api.CmdNoID, state, nil, nil)
 
-	shader := data.GetShader()
-	var codeSlice []uint32
-	var codeSize int
-	if shader.GetType() == api.ShaderType_Spirv {
-		assembledCode := shadertools.AssembleSpirvText(shader.Source)
-		codeSlice = assembledCode
-		codeSize = len(assembledCode) * 4
-	} else {
-		codeSize = len(shader.Source)
-		if codeSize%4 != 0 {
-			log.E(ctx, "Invalid SPIR-V, number of bytes is not a multiple of 4")
-		}
-		cs := []byte(shader.Source)
-		codeSlice = make([]uint32, len(cs)/4)
-		for i := range codeSlice {
-			codeSlice[i] = uint32(binary.LittleEndian.Uint32(cs[i*4 : (i+1)*4]))
-		}
+	createInfo, err := cmd.PCreateInfo().Read(ctx, cmd, state, nil)
+	if err != nil {
+		return nil, err
+	}
+	original, err := createInfo.PCode().Slice(0, uint64(createInfo.CodeSize()/4), state.MemoryLayout).Read(ctx, cmd, state, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(codeSlice) == 0 {
-		log.E(ctx, "Failed at assembling new SPIR-V shader code. Shader module unchanged.")
-		return cmd
+	codeSlice, err := replacementShaderCode(data.GetShader(), original)
+	if err != nil {
+		return nil, err
 	}
+	codeSize := len(codeSlice) * 4
 
 	code := state.AllocDataOrPanic(ctx, codeSlice)
 	device := cmd.Device()
 	pAlloc := memory.Pointer(cmd.PAllocator())
 	pShaderModule := memory.Pointer(cmd.PShaderModule())
 	result := cmd.Result()
-	createInfo, err := cmd.PCreateInfo().Read(ctx, cmd, state, nil)
-	if err != nil {
-		return err
-	}
 
 	createInfo.SetPCode(NewU32ᶜᵖ(code.Ptr()))
 	createInfo.SetCodeSize(memory.Size(codeSize))
@@ -1000,7 +992,7 @@ func (cmd *VkCreateShaderModule) Replace(ctx context.Context, c *capture.Graphic
 	for _, w := range cmd.Extras().Observations().Writes {
 		newCmd.AddWrite(w.Range, w.ID)
 	}
-	return newCmd
+	return newCmd, nil
 }
 
 var _ api.Resource = GraphicsPipelineObjectʳ{}
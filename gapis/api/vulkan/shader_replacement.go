@@ -0,0 +1,178 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/shadertools"
+)
+
+// glslDiagnostic matches the errors reported by the GLSL compiler, for
+// example "ERROR: 0:12: 'foo' : undeclared identifier".
+var glslDiagnostic = regexp.MustCompile(`(?m)^ERROR: [^:]*:(\d+): (.*)$`)
+
+// glslShaderTypes maps the shader types of GLSL sources to the shader types of
+// the compiler.
+var glslShaderTypes = map[api.ShaderType]shadertools.ShaderType{
+	api.ShaderType_Vertex:         shadertools.TypeVertex,
+	api.ShaderType_Geometry:       shadertools.TypeGeometry,
+	api.ShaderType_TessControl:    shadertools.TypeTessControl,
+	api.ShaderType_TessEvaluation: shadertools.TypeTessEvaluation,
+	api.ShaderType_Fragment:       shadertools.TypeFragment,
+	api.ShaderType_Compute:        shadertools.TypeCompute,
+}
+
+// replacementShaderCode returns the SPIR-V words of the shader replacing the
+// shader module with the given original code. The source of the replacement
+// is SPIR-V assembly text for the Spirv type, the SPIR-V binary for the
+// SpirvBinary type and GLSL for the shader stage types. The replacement must
+// only use descriptor bindings that are used by the original, as the pipeline
+// layouts were created for it. Problems are reported as a
+// *service.ErrShaderCompile.
+func replacementShaderCode(shader *api.Shader, original []uint32) ([]uint32, error) {
+	var code []uint32
+	switch ty := shader.GetType(); ty {
+	case api.ShaderType_Spirv:
+		if code = shadertools.AssembleSpirvText(shader.GetSource()); len(code) == 0 {
+			return nil, compileError(service.ShaderDiagnostic_COMPILE, 0, "Failed to assemble the SPIR-V text")
+		}
+	case api.ShaderType_SpirvBinary:
+		source := []byte(shader.GetSource())
+		if len(source) == 0 || len(source)%4 != 0 {
+			return nil, compileError(service.ShaderDiagnostic_COMPILE, 0,
+				fmt.Sprintf("Invalid SPIR-V, the number of bytes (%d) is not a multiple of 4", len(source)))
+		}
+		code = make([]uint32, len(source)/4)
+		for i := range code {
+			code[i] = binary.LittleEndian.Uint32(source[i*4:])
+		}
+	default:
+		shaderType, ok := glslShaderTypes[ty]
+		if !ok {
+			return nil, compileError(service.ShaderDiagnostic_COMPILE, 0, fmt.Sprintf("Unsupported shader type %v", ty))
+		}
+		var err error
+		code, err = shadertools.CompileGlsl(shader.GetSource(), shadertools.CompileOptions{
+			ShaderType: shaderType,
+			ClientType: shadertools.Vulkan,
+		})
+		if err != nil {
+			return nil, glslCompileError(err)
+		}
+	}
+
+	if diagnostics := shaderInterfaceDiagnostics(code, original); len(diagnostics) > 0 {
+		return nil, &service.ErrShaderCompile{Diagnostics: diagnostics}
+	}
+	return code, nil
+}
+
+func compileError(stage service.ShaderDiagnostic_Stage, line uint32, msg string) error {
+	return &service.ErrShaderCompile{
+		Diagnostics: []*service.ShaderDiagnostic{{Stage: stage, Line: line, Message: msg}},
+	}
+}
+
+// glslCompileError returns the error of the GLSL compiler as a
+// *service.ErrShaderCompile with a diagnostic per reported error.
+func glslCompileError(err error) error {
+	diagnostics := []*service.ShaderDiagnostic{}
+	for _, m := range glslDiagnostic.FindAllStringSubmatch(err.Error(), -1) {
+		line, _ := strconv.ParseUint(m[1], 10, 32)
+		diagnostics = append(diagnostics, &service.ShaderDiagnostic{
+			Stage:   service.ShaderDiagnostic_COMPILE,
+			Line:    uint32(line),
+			Message: strings.TrimSpace(m[2]),
+		})
+	}
+	if len(diagnostics) == 0 {
+		// Report the summary line of the error, the rest is the source.
+		return compileError(service.ShaderDiagnostic_COMPILE, 0, strings.SplitN(err.Error(), "\n", 2)[0])
+	}
+	return &service.ErrShaderCompile{Diagnostics: diagnostics}
+}
+
+// shaderInterfaceDiagnostics returns the problems with the descriptor
+// bindings used by the entry points of code that are not compatible with the
+// ones used by the same entry points of original.
+func shaderInterfaceDiagnostics(code, original []uint32) []*service.ShaderDiagnostic {
+	link := func(format string, args ...interface{}) *service.ShaderDiagnostic {
+		return &service.ShaderDiagnostic{
+			Stage:   service.ShaderDiagnostic_LINK,
+			Message: fmt.Sprintf(format, args...),
+		}
+	}
+
+	sets, err := shadertools.ParseAllDescriptorSets(code)
+	if err != nil {
+		return []*service.ShaderDiagnostic{link("Could not parse the descriptor sets of the shader: %v", err)}
+	}
+	originalSets, err := shadertools.ParseAllDescriptorSets(original)
+	if err != nil {
+		return []*service.ShaderDiagnostic{link("Could not parse the descriptor sets of the original shader: %v", err)}
+	}
+
+	entryPoints := make([]string, 0, len(sets))
+	for name := range sets {
+		entryPoints = append(entryPoints, name)
+	}
+	sort.Strings(entryPoints)
+
+	diagnostics := []*service.ShaderDiagnostic{}
+	for _, name := range entryPoints {
+		originalEntry, ok := originalSets[name]
+		if !ok {
+			diagnostics = append(diagnostics, link("Entry point %v is not in the original shader", name))
+			continue
+		}
+		setIndices := make([]uint32, 0, len(sets[name]))
+		for set := range sets[name] {
+			setIndices = append(setIndices, set)
+		}
+		sort.Slice(setIndices, func(i, j int) bool { return setIndices[i] < setIndices[j] })
+
+		for _, set := range setIndices {
+			for _, binding := range sets[name][set] {
+				var originalBinding *shadertools.DescriptorBinding
+				for i, b := range originalEntry[set] {
+					if b.Binding == binding.Binding {
+						originalBinding = &originalEntry[set][i]
+						break
+					}
+				}
+				switch {
+				case originalBinding == nil:
+					diagnostics = append(diagnostics, link("%v: set %d, binding %d is not used by the original shader",
+						name, set, binding.Binding))
+				case originalBinding.DescriptorType != binding.DescriptorType:
+					diagnostics = append(diagnostics, link("%v: set %d, binding %d is a %v, but a %v in the original shader",
+						name, set, binding.Binding, VkDescriptorType(binding.DescriptorType), VkDescriptorType(originalBinding.DescriptorType)))
+				case originalBinding.DescriptorCount < binding.DescriptorCount:
+					diagnostics = append(diagnostics, link("%v: set %d, binding %d has %d descriptors, but %d in the original shader",
+						name, set, binding.Binding, binding.DescriptorCount, originalBinding.DescriptorCount))
+				}
+			}
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/shadertools"
+)
+
+func TestReplacementShaderCode(t *testing.T) {
+	ctx := log.Testing(t)
+	compile := func(source string) []uint32 {
+		words, err := shadertools.CompileGlsl(source, shadertools.CompileOptions{
+			ShaderType: shadertools.TypeFragment,
+			ClientType: shadertools.Vulkan,
+		})
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		return words
+	}
+	original := compile(`#version 450
+layout(set = 0, binding = 0) uniform sampler2D tex;
+layout(location = 0) out vec4 color;
+void main() { color = texture(tex, vec2(0.5)); }
+`)
+
+	for _, test := range []struct {
+		name   string
+		source string
+		stage  service.ShaderDiagnostic_Stage
+		line   uint32
+	}{
+		{"valid", `#version 450
+layout(location = 0) out vec4 color;
+void main() { color = vec4(1.0); }
+`, 0, 0},
+		{"compile", `#version 450
+layout(location = 0) out vec4 color;
+void main() { color = undeclared; }
+`, service.ShaderDiagnostic_COMPILE, 3},
+		{"link", `#version 450
+layout(set = 1, binding = 0) uniform sampler2D tex;
+layout(location = 0) out vec4 color;
+void main() { color = texture(tex, vec2(0.5)); }
+`, service.ShaderDiagnostic_LINK, 0},
+	} {
+		shader := &api.Shader{Type: api.ShaderType_Fragment, Source: test.source}
+		code, err := replacementShaderCode(shader, original)
+		if test.name == "valid" {
+			assert.For(ctx, "%v err", test.name).ThatError(err).Succeeded()
+			assert.For(ctx, "%v code", test.name).That(len(code) > 0).Equals(true)
+			continue
+		}
+		compileErr, ok := err.(*service.ErrShaderCompile)
+		assert.For(ctx, "%v error type", test.name).That(ok).Equals(true)
+		if !ok {
+			continue
+		}
+		assert.For(ctx, "%v diagnostics", test.name).That(len(compileErr.Diagnostics)).Equals(1)
+		assert.For(ctx, "%v stage", test.name).That(compileErr.Diagnostics[0].Stage).Equals(test.stage)
+		assert.For(ctx, "%v line", test.name).That(compileErr.Diagnostics[0].Line).Equals(test.line)
+	}
+}
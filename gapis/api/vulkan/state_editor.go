@@ -0,0 +1,288 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/memory"
+)
+
+// Interface compliance test
+var (
+	_ = api.StateEditor(API{})
+)
+
+// EditState implements api.StateEditor. The object is destroyed and created
+// again from its edited value, then the descriptor sets and command buffers
+// referencing it are rewritten and re-recorded.
+// Edits to buffers and device memories recreate the buffers with the edited
+// memory contents, and edits to command buffers, such as changes to their
+// dynamic viewports and scissors, record the command buffers again.
+// Immutable samplers of descriptor set layouts are not updated.
+func (API) EditState(ctx context.Context, edited, state *api.GlobalState, object string, key interface{}) ([]api.Cmd, error) {
+	s := GetState(edited)
+	out := &initialStateOutput{oldState: edited, newState: state, cmds: []api.Cmd{}}
+	sb := s.newStateBuilder(ctx, out)
+
+	var sets []DescriptorSetObjectʳ
+	var uses func(args interface{}) bool
+	rerecord := map[VkCommandBuffer]bool{}
+
+	switch object {
+	case "Samplers":
+		smp := s.Samplers().Get(key.(VkSampler))
+		if smp.IsNil() {
+			return nil, fmt.Errorf("Sampler %v does not exist", key)
+		}
+		sb.write(sb.cb.VkDeviceWaitIdle(smp.Device(), VkResult_VK_SUCCESS))
+		sb.write(sb.cb.VkDestroySampler(smp.Device(), smp.VulkanHandle(), memory.Nullptr))
+		sb.createSampler(smp)
+
+		for _, h := range s.DescriptorSets().Keys() {
+			if ds := s.DescriptorSets().Get(h); descriptorSetUsesSampler(ds, smp.VulkanHandle()) {
+				sets = append(sets, ds)
+			}
+		}
+		uses = func(args interface{}) bool {
+			return bindsDescriptorSets(args, sets)
+		}
+
+	case "DescriptorSets":
+		ds := s.DescriptorSets().Get(key.(VkDescriptorSet))
+		if ds.IsNil() {
+			return nil, fmt.Errorf("Descriptor set %v does not exist", key)
+		}
+		sb.write(sb.cb.VkDeviceWaitIdle(ds.Device(), VkResult_VK_SUCCESS))
+		sets = append(sets, ds)
+		uses = func(args interface{}) bool {
+			return bindsDescriptorSets(args, sets)
+		}
+
+	case "GraphicsPipelines":
+		gp := s.GraphicsPipelines().Get(key.(VkPipeline))
+		if gp.IsNil() {
+			return nil, fmt.Errorf("Graphics pipeline %v does not exist", key)
+		}
+		sb.write(sb.cb.VkDeviceWaitIdle(gp.Device(), VkResult_VK_SUCCESS))
+		sb.write(sb.cb.VkDestroyPipeline(gp.Device(), gp.VulkanHandle(), memory.Nullptr))
+		sb.createGraphicsPipeline(gp)
+		uses = func(args interface{}) bool {
+			return bindsPipeline(args, gp.VulkanHandle())
+		}
+
+	case "ComputePipelines":
+		cp := s.ComputePipelines().Get(key.(VkPipeline))
+		if cp.IsNil() {
+			return nil, fmt.Errorf("Compute pipeline %v does not exist", key)
+		}
+		sb.write(sb.cb.VkDeviceWaitIdle(cp.Device(), VkResult_VK_SUCCESS))
+		sb.write(sb.cb.VkDestroyPipeline(cp.Device(), cp.VulkanHandle(), memory.Nullptr))
+		sb.createComputePipeline(cp)
+		uses = func(args interface{}) bool {
+			return bindsPipeline(args, cp.VulkanHandle())
+		}
+
+	case "Buffers", "DeviceMemories":
+		var buffers []BufferObjectʳ
+		if object == "Buffers" {
+			buf := s.Buffers().Get(key.(VkBuffer))
+			if buf.IsNil() {
+				return nil, fmt.Errorf("Buffer %v does not exist", key)
+			}
+			buffers = append(buffers, buf)
+		} else {
+			mem := s.DeviceMemories().Get(key.(VkDeviceMemory))
+			if mem.IsNil() {
+				return nil, fmt.Errorf("Device memory %v does not exist", key)
+			}
+			for _, h := range s.Buffers().Keys() {
+				if buf := s.Buffers().Get(h); !buf.Memory().IsNil() && buf.Memory().VulkanHandle() == mem.VulkanHandle() {
+					buffers = append(buffers, buf)
+				}
+			}
+			if len(buffers) == 0 {
+				return nil, fmt.Errorf("Device memory %v is not bound to any buffer, only buffer contents can be edited", key)
+			}
+		}
+		sb.write(sb.cb.VkDeviceWaitIdle(buffers[0].Device(), VkResult_VK_SUCCESS))
+		var err error
+		if sets, err = recreateBuffers(sb, s, buffers); err != nil {
+			return nil, err
+		}
+		// Destroying the buffers invalidates the command buffers referencing
+		// them. Rather than matching every command that takes a buffer, record
+		// all the command buffers again.
+		uses = func(args interface{}) bool { return true }
+
+	case "CommandBuffers":
+		cb := s.CommandBuffers().Get(key.(VkCommandBuffer))
+		if cb.IsNil() {
+			return nil, fmt.Errorf("Command buffer %v does not exist", key)
+		}
+		sb.write(sb.cb.VkDeviceWaitIdle(cb.Device(), VkResult_VK_SUCCESS))
+		rerecord[cb.VulkanHandle()] = true
+		uses = func(args interface{}) bool { return false }
+
+	default:
+		return nil, fmt.Errorf("Editing %v is not supported", object)
+	}
+
+	for _, ds := range sets {
+		sb.writeDescriptorSet(ds)
+	}
+
+	// Updating a descriptor set or destroying a pipeline invalidates the
+	// command buffers using them, so record them again. Primary command
+	// buffers that execute an invalidated secondary are invalidated too.
+	invalid := map[VkCommandBuffer]bool{}
+	for _, level := range []VkCommandBufferLevel{
+		VkCommandBufferLevel_VK_COMMAND_BUFFER_LEVEL_SECONDARY,
+		VkCommandBufferLevel_VK_COMMAND_BUFFER_LEVEL_PRIMARY,
+	} {
+		for _, h := range s.CommandBuffers().Keys() {
+			cb := s.CommandBuffers().Get(h)
+			if cb.Level() != level || !(rerecord[h] || commandBufferUses(ctx, s, cb, invalid, uses)) {
+				continue
+			}
+			invalid[h] = true
+			sb.write(sb.cb.VkFreeCommandBuffers(
+				cb.Device(),
+				cb.Pool(),
+				1,
+				sb.MustAllocReadData(cb.VulkanHandle()).Ptr(),
+			))
+			sb.createCommandBuffer(cb, level)
+			sb.recordCommandBuffer(cb, level, sb.oldState)
+		}
+	}
+
+	sb.scratchRes.Free(sb)
+	return out.cmds, nil
+}
+
+// recreateBuffers destroys the buffers and their buffer views, then creates
+// them again with the contents of the buffers' memory. It returns the
+// descriptor sets referencing the buffers or their views.
+func recreateBuffers(sb *stateBuilder, s *State, buffers []BufferObjectʳ) ([]DescriptorSetObjectʳ, error) {
+	handles := map[VkBuffer]bool{}
+	for _, buf := range buffers {
+		mem := buf.Memory()
+		if mem.IsNil() || buf.SparseMemoryBindings().Len() > 0 {
+			return nil, fmt.Errorf("Editing the contents of sparse or unbound buffer %v is not supported", buf.VulkanHandle())
+		}
+		if !buf.Info().DedicatedAllocationNV().IsNil() || !mem.DedicatedAllocationNV().IsNil() || !mem.DedicatedAllocationKHR().IsNil() {
+			return nil, fmt.Errorf("Editing the contents of dedicated buffer %v is not supported", buf.VulkanHandle())
+		}
+		handles[buf.VulkanHandle()] = true
+	}
+
+	views := map[VkBufferView]bool{}
+	var bufferViews []BufferViewObjectʳ
+	for _, h := range s.BufferViews().Keys() {
+		bv := s.BufferViews().Get(h)
+		if bv.Buffer().IsNil() || !handles[bv.Buffer().VulkanHandle()] {
+			continue
+		}
+		views[h] = true
+		bufferViews = append(bufferViews, bv)
+		sb.write(sb.cb.VkDestroyBufferView(bv.Device(), h, memory.Nullptr))
+	}
+	for _, buf := range buffers {
+		sb.write(sb.cb.VkDestroyBuffer(buf.Device(), buf.VulkanHandle(), memory.Nullptr))
+		sb.createBuffer(buf)
+	}
+	for _, bv := range bufferViews {
+		sb.createBufferView(bv)
+	}
+
+	var sets []DescriptorSetObjectʳ
+	for _, h := range s.DescriptorSets().Keys() {
+		if ds := s.DescriptorSets().Get(h); descriptorSetUsesBuffers(ds, handles, views) {
+			sets = append(sets, ds)
+		}
+	}
+	return sets, nil
+}
+
+// commandBufferUses returns true if any of the commands recorded in cb
+// satisfy uses, or execute one of the invalid secondary command buffers.
+func commandBufferUses(ctx context.Context, s *State, cb CommandBufferObjectʳ, invalid map[VkCommandBuffer]bool, uses func(args interface{}) bool) bool {
+	for i := uint32(0); i < uint32(cb.CommandReferences().Len()); i++ {
+		args := GetCommandArgs(ctx, cb.CommandReferences().Get(i), s)
+		if uses(args) {
+			return true
+		}
+		if ar, ok := args.(VkCmdExecuteCommandsArgsʳ); ok {
+			for j := uint32(0); j < uint32(ar.CommandBuffers().Len()); j++ {
+				if invalid[ar.CommandBuffers().Get(j)] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func bindsPipeline(args interface{}, pipeline VkPipeline) bool {
+	ar, ok := args.(VkCmdBindPipelineArgsʳ)
+	return ok && ar.Pipeline() == pipeline
+}
+
+func bindsDescriptorSets(args interface{}, sets []DescriptorSetObjectʳ) bool {
+	ar, ok := args.(VkCmdBindDescriptorSetsArgsʳ)
+	if !ok {
+		return false
+	}
+	for i := uint32(0); i < uint32(ar.DescriptorSets().Len()); i++ {
+		for _, ds := range sets {
+			if ar.DescriptorSets().Get(i) == ds.VulkanHandle() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func descriptorSetUsesSampler(ds DescriptorSetObjectʳ, sampler VkSampler) bool {
+	for _, k := range ds.Bindings().Keys() {
+		binding := ds.Bindings().Get(k)
+		for _, i := range binding.ImageBinding().Keys() {
+			if binding.ImageBinding().Get(i).Sampler() == sampler {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func descriptorSetUsesBuffers(ds DescriptorSetObjectʳ, buffers map[VkBuffer]bool, views map[VkBufferView]bool) bool {
+	for _, k := range ds.Bindings().Keys() {
+		binding := ds.Bindings().Get(k)
+		for _, i := range binding.BufferBinding().Keys() {
+			if buffers[binding.BufferBinding().Get(i).Buffer()] {
+				return true
+			}
+		}
+		for _, i := range binding.BufferViewBindings().Keys() {
+			if views[binding.BufferViewBindings().Get(i)] {
+				return true
+			}
+		}
+	}
+	return false
+}
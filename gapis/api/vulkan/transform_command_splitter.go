@@ -34,6 +34,51 @@ type subpassSplitters struct {
 
 type renderPassSplitters []subpassSplitters
 
+// insertedCommand is a command extra marking the commands that a transform
+// records into a command buffer in addition to the commands of the capture.
+// The command splitter does not count them in the subcommand indices, so that
+// the requested indices keep referring to the commands of the capture.
+type insertedCommand struct{}
+
+// captureCommandIndices returns the subcommand index in the capture of each
+// command recorded into the command buffer. Inserted commands share the index
+// of the command preceding them, so that a split requested after a command
+// happens after the commands inserted along with it.
+func captureCommandIndices(inputState *api.GlobalState, commandBuffer CommandBufferObjectʳ) []uint64 {
+	recorded := GetState(inputState).initialCommands[commandBuffer.VulkanHandle()]
+	indices := make([]uint64, commandBuffer.CommandReferences().Len())
+	next := uint64(0)
+	for i := range indices {
+		if i < len(recorded) && isInsertedCommand(recorded[i]) {
+			if next > 0 {
+				indices[i] = next - 1
+			}
+			continue
+		}
+		indices[i] = next
+		next++
+	}
+	return indices
+}
+
+// isLastOfCaptureCommand returns true if the i-th recorded command is the
+// last one with its capture subcommand index.
+func isLastOfCaptureCommand(indices []uint64, i uint32) bool {
+	return int(i)+1 >= len(indices) || indices[i+1] != indices[i]
+}
+
+func isInsertedCommand(cmd api.Cmd) bool {
+	if cmd == nil {
+		return false
+	}
+	for _, e := range cmd.Extras().All() {
+		if _, ok := e.(insertedCommand); ok {
+			return true
+		}
+	}
+	return false
+}
+
 type commandSplitter struct {
 	requestedCmds   []api.SubCmdIdx
 	cmdsOffset      uint64
@@ -311,6 +356,7 @@ func (splitter *commandSplitter) rewriteCommandBuffer(
 	cb := CommandBuilder{Thread: queueSubmit.Thread()}
 
 	existingCommandBufferObject := GetState(inputState).CommandBuffers().Get(existingCommandBuffer)
+	indices := captureCommandIndices(inputState, existingCommandBufferObject)
 	for i := uint32(0); i < uint32(existingCommandBufferObject.CommandReferences().Len()); i++ {
 		currentCmd := existingCommandBufferObject.CommandReferences().Get(uint32(i))
 		currentCmdArgs := GetCommandArgs(ctx, currentCmd, GetState(inputState))
@@ -333,11 +379,11 @@ func (splitter *commandSplitter) rewriteCommandBuffer(
 		// https://go.dev/blog/slices-intro
 		beginIndex := api.SubCmdIdx{}
 		beginIndex = append(beginIndex, idx...)
-		beginIndex = append(beginIndex, uint64(beginRenderPassIndex))
+		beginIndex = append(beginIndex, indices[beginRenderPassIndex])
 
 		endIndex := api.SubCmdIdx{}
 		endIndex = append(endIndex, idx...)
-		endIndex = append(endIndex, uint64(endRenderPassIndex))
+		endIndex = append(endIndex, indices[endRenderPassIndex])
 
 		// If the current renderPassIndex is not requested copy the commands without modifying
 		// and jump to the end of the renderpass and continue
@@ -385,6 +431,7 @@ func (splitter *commandSplitter) rewriteRenderPass(
 	currentSubpass := 0
 	currentRenderPassSplitters := renderPassSplitters{}
 	currentRenderPassArgs := NilVkCmdBeginRenderPassXArgsʳ
+	indices := captureCommandIndices(inputState, existingCommandBufferObject)
 
 	for i := beginRenderPassIndex; i <= endRenderPassIndex; i++ {
 		currentCmd := existingCommandBufferObject.CommandReferences().Get(i)
@@ -491,7 +538,7 @@ func (splitter *commandSplitter) rewriteRenderPass(
 				}
 			}
 		case VkCmdExecuteCommandsArgsʳ:
-			currentSubCmdID := append(idx, uint64(i))
+			currentSubCmdID := append(idx, indices[i])
 			// If there is any framebuffer is requested in a command buffer executed by a VkCmdExecuteCommands
 			// flatten the all command buffers.
 			if splitter.isSubCmdRequestedNext(currentSubCmdID) {
@@ -529,8 +576,8 @@ func (splitter *commandSplitter) rewriteRenderPass(
 			}
 		}
 
-		currentSubCmdID := append(idx, uint64(i))
-		if splitter.isCmdRequestedNext(currentSubCmdID) {
+		currentSubCmdID := append(idx, indices[i])
+		if isLastOfCaptureCommand(indices, i) && splitter.isCmdRequestedNext(currentSubCmdID) {
 			insertionCmd := splitter.createInsertionCommand(ctx, newCommandBuffer, currentSubCmdID, queueSubmit)
 			insertedCmdsArgs := splitter.insertInsertionCommand(ctx, currentRenderPassArgs,
 				currentRenderPassSplitters[currentSubpass].intermediate, insertionCmd)
@@ -569,6 +616,7 @@ func (splitter *commandSplitter) flattenSecondaryCommandBuffer(
 	cb := CommandBuilder{Thread: queueSubmit.Thread()}
 	stateObject := GetState(inputState)
 	secondaryCommandBufferObject := stateObject.CommandBuffers().Get(secondaryCommandBuffer)
+	indices := captureCommandIndices(inputState, secondaryCommandBufferObject)
 	for i := uint32(0); i < uint32(secondaryCommandBufferObject.CommandReferences().Len()); i++ {
 		currentCmd := secondaryCommandBufferObject.CommandReferences().Get(i)
 		currentCommandArgs := GetCommandArgs(ctx, currentCmd, stateObject)
@@ -587,8 +635,8 @@ func (splitter *commandSplitter) flattenSecondaryCommandBuffer(
 			return err
 		}
 
-		currentSubCmdID := append(idx, uint64(i))
-		if splitter.isCmdRequestedNext(currentSubCmdID) {
+		currentSubCmdID := append(idx, indices[i])
+		if isLastOfCaptureCommand(indices, i) && splitter.isCmdRequestedNext(currentSubCmdID) {
 			insertionCmd := splitter.createInsertionCommand(ctx, newCommandBuffer, currentSubCmdID, queueSubmit)
 			insertedCmdsArgs := splitter.insertInsertionCommand(ctx, currentRenderPassArgs, newRenderpass, insertionCmd)
 
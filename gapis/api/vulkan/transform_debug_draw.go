@@ -0,0 +1,788 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/shadertools"
+)
+
+const (
+	// drawIDMultiplier is used to spread consecutive command identifiers over
+	// the 24 bit colour space. It is odd, so the mapping is invertible.
+	drawIDMultiplier = uint32(0x9E3779)
+	// depthComplexityStep is the amount added to each colour channel per
+	// fragment in DrawMode_DEPTH_COMPLEXITY.
+	depthComplexityStep = 1.0 / 16.0
+	// shaderCostScale is the static fragment shader cost that maps to the
+	// hottest colour in DrawMode_SHADER_COST.
+	shaderCostScale = 256.0
+	// drawIDBackground is the identifier coloured like the cleared background.
+	// It is used for the draw calls recorded by the initial state, which have
+	// no command in the capture.
+	drawIDBackground = api.CmdID(0xffffff)
+)
+
+// drawIDInverse is the multiplicative inverse of drawIDMultiplier modulo 2^24.
+var drawIDInverse = func() uint32 {
+	inv := drawIDMultiplier
+	for i := 0; i < 5; i++ {
+		inv *= 2 - drawIDMultiplier*inv
+	}
+	return inv & 0xffffff
+}()
+
+// textureQueryPreamble redirects the texture sampling functions of a fragment
+// shader to gapidTextureColor, passing it the component of textureQueryLod
+// selected by the format argument: x is the accessed mip level and y the
+// level of detail computed from the derivatives, before any clamping.
+const textureQueryPreamble = `
+vec4 gapidSample(sampler1D s, float c) { return gapidTextureColor(textureQueryLod(s, c).%[1]s); }
+vec4 gapidSample(sampler2D s, vec2 c) { return gapidTextureColor(textureQueryLod(s, c).%[1]s); }
+vec4 gapidSample(sampler3D s, vec3 c) { return gapidTextureColor(textureQueryLod(s, c).%[1]s); }
+vec4 gapidSample(samplerCube s, vec3 c) { return gapidTextureColor(textureQueryLod(s, c).%[1]s); }
+vec4 gapidSample(sampler1DArray s, vec2 c) { return gapidTextureColor(textureQueryLod(s, c.x).%[1]s); }
+vec4 gapidSample(sampler2DArray s, vec3 c) { return gapidTextureColor(textureQueryLod(s, c.xy).%[1]s); }
+vec4 gapidSample(samplerCubeArray s, vec4 c) { return gapidTextureColor(textureQueryLod(s, c.xyz).%[1]s); }
+#define texture(s, c) gapidSample(s, c)
+`
+
+// mipLevelPreamble colours each texture sample by the sampled mip level, from
+// blue for the base level to red for the fifth level and above.
+var mipLevelPreamble = `
+vec4 gapidTextureColor(float lod) {
+	const vec4 colors[6] = vec4[6](
+		vec4(0.0, 0.0, 1.0, 1.0),
+		vec4(0.0, 1.0, 1.0, 1.0),
+		vec4(0.0, 1.0, 0.0, 1.0),
+		vec4(1.0, 1.0, 0.0, 1.0),
+		vec4(1.0, 0.5, 0.0, 1.0),
+		vec4(1.0, 0.0, 0.0, 1.0));
+	return colors[clamp(int(lod + 0.5), 0, 5)];
+}
+` + fmt.Sprintf(textureQueryPreamble, "x")
+
+// texelDensityPreamble colours each texture sample by the number of texels
+// covered by the pixel: green for one texel per pixel, cyan and blue when the
+// texture is magnified by two and four times or more, yellow and red when it
+// is minified by two and four times or more.
+var texelDensityPreamble = `
+vec4 gapidTextureColor(float lod) {
+	const vec4 colors[5] = vec4[5](
+		vec4(0.0, 0.0, 1.0, 1.0),
+		vec4(0.0, 1.0, 1.0, 1.0),
+		vec4(0.0, 1.0, 0.0, 1.0),
+		vec4(1.0, 1.0, 0.0, 1.0),
+		vec4(1.0, 0.0, 0.0, 1.0));
+	return colors[clamp(int(floor(lod + 0.5)) + 2, 0, 4)];
+}
+` + fmt.Sprintf(textureQueryPreamble, "y")
+
+// DrawIDFromColor returns the identifier of the command that recorded the
+// draw call which rendered a pixel of the given colour in a
+// DrawMode_DRAW_ID replay. The colour is the one stored in the attachment,
+// for sRGB attachments that is the encoded value. It returns false for the
+// cleared background. Only the lowest 24 bits of the identifier are
+// recoverable.
+func DrawIDFromColor(r, g, b uint8) (api.CmdID, bool) {
+	v := uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+	if v == 0 {
+		return 0, false
+	}
+	return api.CmdID((v*drawIDInverse - 1) & 0xffffff), true
+}
+
+// drawIDColor returns the blend constants used to colour the draw call
+// recorded by the command id. Blending happens in linear space, so for sRGB
+// attachments the constants are decoded from sRGB first, for the encoding
+// on write to store the exact bytes expected by DrawIDFromColor.
+func drawIDColor(id api.CmdID, srgb bool) F32ː4ᵃ {
+	v := ((uint32(id) + 1) * drawIDMultiplier) & 0xffffff
+	channel := func(c uint32) float32 {
+		f := float32(c&0xff) / 255.0
+		if srgb {
+			f = srgbToLinear(f)
+		}
+		return f
+	}
+	return NewF32ː4ᵃ(channel(v>>16), channel(v>>8), channel(v), 1.0)
+}
+
+// srgbToLinear applies the sRGB electro-optical transfer function to v.
+func srgbToLinear(v float32) float32 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return float32(math.Pow((float64(v)+0.055)/1.055, 2.4))
+}
+
+// isSRGBFormat returns true if the format is a colour attachment format
+// encoding its values with the sRGB transfer function.
+func isSRGBFormat(format VkFormat) bool {
+	switch format {
+	case VkFormat_VK_FORMAT_R8_SRGB,
+		VkFormat_VK_FORMAT_R8G8_SRGB,
+		VkFormat_VK_FORMAT_R8G8B8_SRGB,
+		VkFormat_VK_FORMAT_B8G8R8_SRGB,
+		VkFormat_VK_FORMAT_R8G8B8A8_SRGB,
+		VkFormat_VK_FORMAT_B8G8R8A8_SRGB,
+		VkFormat_VK_FORMAT_A8B8G8R8_SRGB_PACK32:
+		return true
+	default:
+		return false
+	}
+}
+
+// shaderCostColor maps the static analysis counters of a fragment shader to a
+// colour ranging from blue (cheap) over green to red (expensive).
+func shaderCostColor(c shadertools.StaticAnalysisCounters) [4]float32 {
+	cost := float32(c.ALUInstructions) + 4*float32(c.TexInstructions) + 2*float32(c.BranchInstructions)
+	t := cost / shaderCostScale
+	if t > 1 {
+		t = 1
+	}
+	if t < 0.5 {
+		return [4]float32{0, 2 * t, 1 - 2*t, 1}
+	}
+	return [4]float32{2*t - 1, 2 - 2*t, 0, 1}
+}
+
+// debugDrawOutputType returns the GLSL type of a fragment shader output
+// writing to an attachment of the given format.
+func debugDrawOutputType(format VkFormat) string {
+	switch format {
+	case VkFormat_VK_FORMAT_R8_UINT,
+		VkFormat_VK_FORMAT_R8G8_UINT,
+		VkFormat_VK_FORMAT_R8G8B8_UINT,
+		VkFormat_VK_FORMAT_R8G8B8A8_UINT,
+		VkFormat_VK_FORMAT_B8G8R8_UINT,
+		VkFormat_VK_FORMAT_B8G8R8A8_UINT,
+		VkFormat_VK_FORMAT_R16_UINT,
+		VkFormat_VK_FORMAT_R16G16_UINT,
+		VkFormat_VK_FORMAT_R16G16B16_UINT,
+		VkFormat_VK_FORMAT_R16G16B16A16_UINT,
+		VkFormat_VK_FORMAT_R32_UINT,
+		VkFormat_VK_FORMAT_R32G32_UINT,
+		VkFormat_VK_FORMAT_R32G32B32_UINT,
+		VkFormat_VK_FORMAT_R32G32B32A32_UINT,
+		VkFormat_VK_FORMAT_A8B8G8R8_UINT_PACK32,
+		VkFormat_VK_FORMAT_A2R10G10B10_UINT_PACK32,
+		VkFormat_VK_FORMAT_A2B10G10R10_UINT_PACK32:
+		return "uvec4"
+	case VkFormat_VK_FORMAT_R8_SINT,
+		VkFormat_VK_FORMAT_R8G8_SINT,
+		VkFormat_VK_FORMAT_R8G8B8_SINT,
+		VkFormat_VK_FORMAT_R8G8B8A8_SINT,
+		VkFormat_VK_FORMAT_B8G8R8_SINT,
+		VkFormat_VK_FORMAT_B8G8R8A8_SINT,
+		VkFormat_VK_FORMAT_R16_SINT,
+		VkFormat_VK_FORMAT_R16G16_SINT,
+		VkFormat_VK_FORMAT_R16G16B16_SINT,
+		VkFormat_VK_FORMAT_R16G16B16A16_SINT,
+		VkFormat_VK_FORMAT_R32_SINT,
+		VkFormat_VK_FORMAT_R32G32_SINT,
+		VkFormat_VK_FORMAT_R32G32B32_SINT,
+		VkFormat_VK_FORMAT_R32G32B32A32_SINT,
+		VkFormat_VK_FORMAT_A8B8G8R8_SINT_PACK32,
+		VkFormat_VK_FORMAT_A2R10G10B10_SINT_PACK32,
+		VkFormat_VK_FORMAT_A2B10G10R10_SINT_PACK32:
+		return "ivec4"
+	default:
+		return "vec4"
+	}
+}
+
+// debugDrawColorShaderSource returns the source of a fragment shader writing
+// the given colour to every float attachment and zero to every integer one.
+// Unused attachments are given VK_FORMAT_UNDEFINED and are not written.
+func debugDrawColorShaderSource(formats []VkFormat, color [4]float32) string {
+	decls := &strings.Builder{}
+	body := &strings.Builder{}
+	for i, f := range formats {
+		if f == VkFormat_VK_FORMAT_UNDEFINED {
+			continue
+		}
+		ty := debugDrawOutputType(f)
+		fmt.Fprintf(decls, "layout(location = %d) out %s out_color_%d;\n", i, ty, i)
+		if ty == "vec4" {
+			fmt.Fprintf(body, "\tout_color_%d = vec4(%f, %f, %f, %f);\n", i, color[0], color[1], color[2], color[3])
+		} else {
+			fmt.Fprintf(body, "\tout_color_%d = %s(0);\n", i, ty)
+		}
+	}
+	return fmt.Sprintf("#version 450\n%svoid main() {\n%s}\n", decls, body)
+}
+
+// debugDrawTransform implements a transform that replaces the fragment
+// shading of every graphics pipeline to visualize one of the debug draw modes:
+//   - NORMAL writes a constant colour, keeping the blend state of the
+//     pipeline. It is used by the constant fragment shader profiling
+//     experiment.
+//   - DRAW_ID colours each draw call with a colour derived from the id of the
+//     capture command that recorded it, see DrawIDFromColor.
+//   - DEPTH_COMPLEXITY additively blends a constant colour for each fragment,
+//     ignoring the depth and stencil tests.
+//   - SHADER_COST colours each draw call by the static cost of its fragment
+//     shader.
+//   - MIP_LEVEL replaces texture samples with a colour per sampled mip level.
+//   - TEXEL_DENSITY replaces texture samples with a colour per number of
+//     texels covered by the pixel.
+//
+// MIP_LEVEL and TEXEL_DENSITY decompile the fragment shader to GLSL, so they
+// do not need the shader to carry debug source. Only float textures sampled
+// with texture(sampler, coord) are recoloured. A pipeline whose fragment
+// shader can not be rewritten fails the replay rather than being rendered
+// unmodified, which would be mistaken for the debug view.
+type debugDrawTransform struct {
+	mode       path.DrawMode
+	cmdsOffset api.CmdID
+	// disableFragmentTests disables the depth and stencil tests of every
+	// graphics pipeline, as DEPTH_COMPLEXITY does, in the other modes.
+	disableFragmentTests bool
+	allocations          *allocationTracker
+	shaders              map[string][]uint32
+}
+
+// newDebugDrawTransform returns a debug draw transform for the given mode.
+// cmdsOffset is the number of initial commands preceding the commands of the
+// capture in the replay.
+func newDebugDrawTransform(mode path.DrawMode, cmdsOffset api.CmdID) *debugDrawTransform {
+	return &debugDrawTransform{
+		mode:        mode,
+		cmdsOffset:  cmdsOffset,
+		allocations: nil,
+		shaders:     map[string][]uint32{},
+	}
+}
+
+func (debugDraw *debugDrawTransform) RequiresAccurateState() bool {
+	return false
+}
+
+func (debugDraw *debugDrawTransform) RequiresInnerStateMutation() bool {
+	return false
+}
+
+func (debugDraw *debugDrawTransform) SetInnerStateMutationFunction(mutator transform.StateMutator) {
+	// This transform do not require inner state mutation
+}
+
+func (debugDraw *debugDrawTransform) BeginTransform(ctx context.Context, inputState *api.GlobalState) error {
+	debugDraw.allocations = NewAllocationTracker(inputState)
+	return nil
+}
+
+func (debugDraw *debugDrawTransform) EndTransform(ctx context.Context, inputState *api.GlobalState) ([]api.Cmd, error) {
+	return nil, nil
+}
+
+func (debugDraw *debugDrawTransform) ClearTransformResources(ctx context.Context) {
+	debugDraw.allocations.FreeAllocations()
+}
+
+func (debugDraw *debugDrawTransform) TransformCommand(ctx context.Context, id transform.CommandID, inputCommands []api.Cmd, inputState *api.GlobalState) ([]api.Cmd, error) {
+	clearsAttachments := debugDraw.mode == path.DrawMode_DRAW_ID || debugDraw.mode == path.DrawMode_DEPTH_COMPLEXITY
+	colorsDraws := debugDraw.mode == path.DrawMode_DRAW_ID && id.GetCommandType() == transform.TransformCommand
+	drawID := drawIDBackground
+	if colorsDraws && id.GetID() >= debugDraw.cmdsOffset {
+		drawID = id.GetID() - debugDraw.cmdsOffset
+	}
+
+	outputCmds := make([]api.Cmd, 0, len(inputCommands))
+	for _, cmd := range inputCommands {
+		switch cmd := cmd.(type) {
+		case *VkCreateGraphicsPipelines:
+			cmds, err := debugDraw.updateGraphicsPipelines(ctx, cmd, inputState)
+			if err != nil {
+				return nil, err
+			}
+			outputCmds = append(outputCmds, cmds...)
+			continue
+		case *VkCmdBeginRenderPass:
+			outputCmds = append(outputCmds, cmd)
+			if clearsAttachments {
+				clearCmd, err := debugDraw.clearColorAttachments(ctx, cmd, inputState)
+				if err != nil {
+					return nil, err
+				}
+				if clearCmd != nil {
+					outputCmds = append(outputCmds, clearCmd)
+				}
+			}
+			continue
+		case *VkCmdDraw:
+			if colorsDraws {
+				outputCmds = append(outputCmds, debugDraw.setDrawColor(inputState, cmd.Thread(), cmd.CommandBuffer(), drawID))
+			}
+		case *VkCmdDrawIndexed:
+			if colorsDraws {
+				outputCmds = append(outputCmds, debugDraw.setDrawColor(inputState, cmd.Thread(), cmd.CommandBuffer(), drawID))
+			}
+		case *VkCmdDrawIndirect:
+			if colorsDraws {
+				outputCmds = append(outputCmds, debugDraw.setDrawColor(inputState, cmd.Thread(), cmd.CommandBuffer(), drawID))
+			}
+		case *VkCmdDrawIndexedIndirect:
+			if colorsDraws {
+				outputCmds = append(outputCmds, debugDraw.setDrawColor(inputState, cmd.Thread(), cmd.CommandBuffer(), drawID))
+			}
+		}
+		outputCmds = append(outputCmds, cmd)
+	}
+
+	return outputCmds, nil
+}
+
+func (debugDraw *debugDrawTransform) setDrawColor(inputState *api.GlobalState, thread uint64, commandBuffer VkCommandBuffer, id api.CmdID) api.Cmd {
+	cb := CommandBuilder{Thread: thread}
+	return api.WithExtras(cb.VkCmdSetBlendConstants(commandBuffer, drawIDColor(id, drawIDAttachmentIsSRGB(inputState, commandBuffer))),
+		insertedCommand{})
+}
+
+// drawIDAttachmentIsSRGB returns true if the first color attachment of the
+// subpass being recorded into commandBuffer has an sRGB format. Secondary
+// command buffers use the subpass they inherit.
+func drawIDAttachmentIsSRGB(inputState *api.GlobalState, commandBuffer VkCommandBuffer) bool {
+	cmdBuf, ok := GetState(inputState).CommandBuffers().Lookup(commandBuffer)
+	if !ok {
+		return false
+	}
+	renderPass, subpass := VkRenderPass(0), cmdBuf.CurrentRecordingSubpass()
+	if !cmdBuf.CurrentRecordingRenderpass().IsNil() {
+		renderPass = cmdBuf.CurrentRecordingRenderpass().VulkanHandle()
+	} else if !cmdBuf.BeginInfo().IsNil() && cmdBuf.BeginInfo().Inherited() {
+		renderPass, subpass = cmdBuf.BeginInfo().InheritedRenderPass(), cmdBuf.BeginInfo().InheritedSubpass()
+	}
+	rp, ok := GetState(inputState).RenderPasses().Lookup(renderPass)
+	if !ok || !rp.SubpassDescriptions().Contains(subpass) {
+		return false
+	}
+	formats := colorAttachmentFormats(inputState, renderPass, subpass, uint32(rp.SubpassDescriptions().Get(subpass).ColorAttachments().Len()))
+	for _, f := range formats {
+		if f != VkFormat_VK_FORMAT_UNDEFINED {
+			return isSRGBFormat(f)
+		}
+	}
+	return false
+}
+
+// clearColorAttachments returns a command clearing the color attachments of
+// the first subpass of the render pass begun by cmd that are not loaded, so
+// that the clear colour of the application does not show in the debug view.
+func (debugDraw *debugDrawTransform) clearColorAttachments(ctx context.Context, cmd *VkCmdBeginRenderPass, inputState *api.GlobalState) (api.Cmd, error) {
+	if cmd.Contents() == VkSubpassContents_VK_SUBPASS_CONTENTS_SECONDARY_COMMAND_BUFFERS {
+		// Clears can not be recorded into the primary command buffer.
+		return nil, nil
+	}
+
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+	beginInfo, err := cmd.PRenderPassBegin().Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	renderPass, ok := GetState(inputState).RenderPasses().Lookup(beginInfo.RenderPass())
+	if !ok || !renderPass.SubpassDescriptions().Contains(0) {
+		return nil, nil
+	}
+
+	colorAttachments := renderPass.SubpassDescriptions().Get(0).ColorAttachments()
+	clears := []VkClearAttachment{}
+	for i := uint32(0); i < uint32(colorAttachments.Len()); i++ {
+		idx := colorAttachments.Get(i).Attachment()
+		if idx == VK_ATTACHMENT_UNUSED ||
+			renderPass.AttachmentDescriptions().Get(idx).LoadOp() == VkAttachmentLoadOp_VK_ATTACHMENT_LOAD_OP_LOAD {
+			// Loaded attachments keep the debug colours of earlier passes.
+			continue
+		}
+		clears = append(clears, NewVkClearAttachment(
+			VkImageAspectFlags(VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT), // aspectMask
+			i,                  // colorAttachment
+			MakeVkClearValue(), // clearValue
+		))
+	}
+	if len(clears) == 0 {
+		return nil, nil
+	}
+
+	clearData := debugDraw.allocations.AllocDataOrPanic(ctx, clears)
+	rectData := debugDraw.allocations.AllocDataOrPanic(ctx, []VkClearRect{
+		NewVkClearRect(
+			beginInfo.RenderArea(), // rect
+			0,                      // baseArrayLayer
+			1,                      // layerCount
+		),
+	})
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	return api.WithExtras(cb.VkCmdClearAttachments(cmd.CommandBuffer(),
+		uint32(len(clears)),
+		clearData.Ptr(),
+		1,
+		rectData.Ptr(),
+	).AddRead(clearData.Data()).AddRead(rectData.Data()), insertedCommand{}), nil
+}
+
+// updateGraphicsPipelines returns the commands replacing cmd: the creation of
+// the debug fragment shader modules, the modified pipeline creation and the
+// destruction of the shader modules.
+func (debugDraw *debugDrawTransform) updateGraphicsPipelines(ctx context.Context, cmd *VkCreateGraphicsPipelines, inputState *api.GlobalState) ([]api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	reads := []api.AllocResult{}
+	allocAndRead := func(v ...interface{}) api.AllocResult {
+		res := debugDraw.allocations.AllocDataOrPanic(ctx, v...)
+		reads = append(reads, res)
+		return res
+	}
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	createModules := []api.Cmd{}
+	destroyModules := []api.Cmd{}
+
+	count := uint64(cmd.CreateInfoCount())
+	infos := cmd.PCreateInfos().Slice(0, count, inputState.MemoryLayout)
+	newInfos := make([]VkGraphicsPipelineCreateInfo, count)
+	for i := uint64(0); i < count; i++ {
+		pInfo, err := infos.Index(i).Read(ctx, cmd, inputState, nil)
+		if err != nil {
+			return nil, err
+		}
+		info := pInfo[0]
+		newInfos[i] = info
+
+		if info.PColorBlendState().IsNullptr() {
+			// Rasterization is disabled.
+			continue
+		}
+		blendState, err := info.PColorBlendState().Read(ctx, cmd, inputState, nil)
+		if err != nil {
+			return nil, err
+		}
+		formats := colorAttachmentFormats(inputState, info.RenderPass(), info.Subpass(), blendState.AttachmentCount())
+		if len(formats) == 0 {
+			continue
+		}
+
+		stages, err := info.PStages().Slice(0, uint64(info.StageCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+		if err != nil {
+			return nil, err
+		}
+		fragment := -1
+		for j, stage := range stages {
+			if stage.Stage() == VkShaderStageFlagBits_VK_SHADER_STAGE_FRAGMENT_BIT {
+				fragment = j
+			}
+		}
+
+		if fragment < 0 && debugDraw.samplesTextures() {
+			// Nothing is sampled, there is nothing to visualize.
+			continue
+		}
+
+		words, err := debugDraw.fragmentShader(ctx, inputState, stages, fragment, formats)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Replacing the fragment shader of pipeline %v of %v", i, cmd)
+		}
+
+		module := VkShaderModule(newUnusedID(false, func(id uint64) bool {
+			return GetState(inputState).ShaderModules().Contains(VkShaderModule(id))
+		}))
+		createModules = append(createModules, debugDraw.createShaderModule(ctx, cb, cmd.Device(), module, words))
+		destroyModules = append(destroyModules, cb.VkDestroyShaderModule(cmd.Device(), module, memory.Nullptr))
+
+		specialization := NewVkSpecializationInfoᶜᵖ(memory.Nullptr)
+		if debugDraw.samplesTextures() {
+			specialization = stages[fragment].PSpecializationInfo()
+		}
+		stage := NewVkPipelineShaderStageCreateInfo(
+			VkStructureType_VK_STRUCTURE_TYPE_PIPELINE_SHADER_STAGE_CREATE_INFO, // sType
+			0, // pNext
+			0, // flags
+			VkShaderStageFlagBits_VK_SHADER_STAGE_FRAGMENT_BIT, // stage
+			module, // module
+			NewCharᶜᵖ(allocAndRead("main").Ptr()), // pName
+			specialization, // pSpecializationInfo
+		)
+		if fragment < 0 {
+			stages = append(stages, stage)
+		} else {
+			stages[fragment] = stage
+		}
+		info.SetStageCount(uint32(len(stages)))
+		info.SetPStages(NewVkPipelineShaderStageCreateInfoᶜᵖ(allocAndRead(stages).Ptr()))
+
+		if debugDraw.mode != path.DrawMode_NORMAL {
+			attachments, err := blendState.PAttachments().Slice(0, uint64(blendState.AttachmentCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			for j := range attachments {
+				debugDraw.updateBlendAttachment(&attachments[j], formats[j])
+			}
+			blendState.SetLogicOpEnable(0)
+			blendState.SetPAttachments(NewVkPipelineColorBlendAttachmentStateᶜᵖ(allocAndRead(attachments).Ptr()))
+			info.SetPColorBlendState(NewVkPipelineColorBlendStateCreateInfoᶜᵖ(allocAndRead(blendState).Ptr()))
+		}
+
+		disableFragmentTests := debugDraw.disableFragmentTests || debugDraw.mode == path.DrawMode_DEPTH_COMPLEXITY
+		if disableFragmentTests && !info.PDepthStencilState().IsNullptr() {
+			depthStencilState, err := info.PDepthStencilState().Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			depthStencilState.SetDepthTestEnable(0)
+			depthStencilState.SetDepthWriteEnable(0)
+			depthStencilState.SetDepthBoundsTestEnable(0)
+			depthStencilState.SetStencilTestEnable(0)
+			info.SetPDepthStencilState(NewVkPipelineDepthStencilStateCreateInfoᶜᵖ(allocAndRead(depthStencilState).Ptr()))
+		}
+
+		if debugDraw.mode == path.DrawMode_DRAW_ID {
+			dynamicInfo, err := debugDraw.addBlendConstantsDynamicState(ctx, cmd, inputState, info, allocAndRead)
+			if err != nil {
+				return nil, err
+			}
+			info.SetPDynamicState(NewVkPipelineDynamicStateCreateInfoᶜᵖ(allocAndRead(dynamicInfo).Ptr()))
+		}
+
+		newInfos[i] = info
+	}
+	newInfosData := allocAndRead(newInfos)
+
+	newCmd := cb.VkCreateGraphicsPipelines(cmd.Device(),
+		cmd.PipelineCache(), cmd.CreateInfoCount(), newInfosData.Ptr(),
+		cmd.PAllocator(), cmd.PPipelines(), cmd.Result())
+	for _, r := range reads {
+		newCmd.AddRead(r.Data())
+	}
+	for _, w := range cmd.Extras().Observations().Writes {
+		newCmd.AddWrite(w.Range, w.ID)
+	}
+
+	outputCmds := append(createModules, newCmd)
+	return append(outputCmds, destroyModules...), nil
+}
+
+// colorAttachmentFormats returns the formats of the color attachments of the
+// given subpass, using VK_FORMAT_UNDEFINED for unused attachments.
+func colorAttachmentFormats(inputState *api.GlobalState, rp VkRenderPass, subpass uint32, count uint32) []VkFormat {
+	renderPass, ok := GetState(inputState).RenderPasses().Lookup(rp)
+	if !ok || !renderPass.SubpassDescriptions().Contains(subpass) {
+		return nil
+	}
+	colorAttachments := renderPass.SubpassDescriptions().Get(subpass).ColorAttachments()
+	formats := make([]VkFormat, count)
+	for i := uint32(0); i < count; i++ {
+		formats[i] = VkFormat_VK_FORMAT_UNDEFINED
+		if !colorAttachments.Contains(i) {
+			continue
+		}
+		if idx := colorAttachments.Get(i).Attachment(); idx != VK_ATTACHMENT_UNUSED {
+			formats[i] = renderPass.AttachmentDescriptions().Get(idx).Fmt()
+		}
+	}
+	return formats
+}
+
+func (debugDraw *debugDrawTransform) updateBlendAttachment(attachment *VkPipelineColorBlendAttachmentState, format VkFormat) {
+	attachment.SetColorWriteMask(VkColorComponentFlags(
+		VkColorComponentFlagBits_VK_COLOR_COMPONENT_R_BIT |
+			VkColorComponentFlagBits_VK_COLOR_COMPONENT_G_BIT |
+			VkColorComponentFlagBits_VK_COLOR_COMPONENT_B_BIT |
+			VkColorComponentFlagBits_VK_COLOR_COMPONENT_A_BIT))
+	attachment.SetBlendEnable(0)
+	if debugDrawOutputType(format) != "vec4" {
+		// Integer attachments can not be blended, leave them untouched.
+		attachment.SetColorWriteMask(0)
+		return
+	}
+
+	switch debugDraw.mode {
+	case path.DrawMode_DRAW_ID:
+		attachment.SetBlendEnable(1)
+		attachment.SetSrcColorBlendFactor(VkBlendFactor_VK_BLEND_FACTOR_CONSTANT_COLOR)
+		attachment.SetDstColorBlendFactor(VkBlendFactor_VK_BLEND_FACTOR_ZERO)
+		attachment.SetColorBlendOp(VkBlendOp_VK_BLEND_OP_ADD)
+		attachment.SetSrcAlphaBlendFactor(VkBlendFactor_VK_BLEND_FACTOR_ONE)
+		attachment.SetDstAlphaBlendFactor(VkBlendFactor_VK_BLEND_FACTOR_ZERO)
+		attachment.SetAlphaBlendOp(VkBlendOp_VK_BLEND_OP_ADD)
+	case path.DrawMode_DEPTH_COMPLEXITY:
+		attachment.SetBlendEnable(1)
+		attachment.SetSrcColorBlendFactor(VkBlendFactor_VK_BLEND_FACTOR_ONE)
+		attachment.SetDstColorBlendFactor(VkBlendFactor_VK_BLEND_FACTOR_ONE)
+		attachment.SetColorBlendOp(VkBlendOp_VK_BLEND_OP_ADD)
+		attachment.SetSrcAlphaBlendFactor(VkBlendFactor_VK_BLEND_FACTOR_ONE)
+		attachment.SetDstAlphaBlendFactor(VkBlendFactor_VK_BLEND_FACTOR_ZERO)
+		attachment.SetAlphaBlendOp(VkBlendOp_VK_BLEND_OP_ADD)
+	}
+}
+
+// addBlendConstantsDynamicState returns the dynamic state of info with the
+// blend constants added to it.
+func (debugDraw *debugDrawTransform) addBlendConstantsDynamicState(ctx context.Context,
+	cmd *VkCreateGraphicsPipelines,
+	inputState *api.GlobalState,
+	info VkGraphicsPipelineCreateInfo,
+	allocAndRead func(v ...interface{}) api.AllocResult) (VkPipelineDynamicStateCreateInfo, error) {
+
+	dynamicInfo := NewVkPipelineDynamicStateCreateInfo(
+		VkStructureType_VK_STRUCTURE_TYPE_PIPELINE_DYNAMIC_STATE_CREATE_INFO, // sType
+		0,                                   // pNext
+		0,                                   // flags
+		0,                                   // dynamicStateCount
+		NewVkDynamicStateᶜᵖ(memory.Nullptr), // pDynamicStates
+	)
+	dynamicStates := []VkDynamicState{}
+	if !info.PDynamicState().IsNullptr() {
+		var err error
+		dynamicInfo, err = info.PDynamicState().Read(ctx, cmd, inputState, nil)
+		if err != nil {
+			return NilVkPipelineDynamicStateCreateInfo, err
+		}
+		dynamicStates, err = dynamicInfo.PDynamicStates().Slice(0, uint64(dynamicInfo.DynamicStateCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+		if err != nil {
+			return NilVkPipelineDynamicStateCreateInfo, err
+		}
+	}
+
+	for _, s := range dynamicStates {
+		if s == VkDynamicState_VK_DYNAMIC_STATE_BLEND_CONSTANTS {
+			return dynamicInfo, nil
+		}
+	}
+	dynamicStates = append(dynamicStates, VkDynamicState_VK_DYNAMIC_STATE_BLEND_CONSTANTS)
+	dynamicInfo.SetDynamicStateCount(uint32(len(dynamicStates)))
+	dynamicInfo.SetPDynamicStates(NewVkDynamicStateᶜᵖ(allocAndRead(dynamicStates).Ptr()))
+	return dynamicInfo, nil
+}
+
+// samplesTextures returns true if the draw mode visualizes the texture
+// samples of the original fragment shader.
+func (debugDraw *debugDrawTransform) samplesTextures() bool {
+	return debugDraw.mode == path.DrawMode_MIP_LEVEL || debugDraw.mode == path.DrawMode_TEXEL_DENSITY
+}
+
+// fragmentShader returns the SPIR-V of the debug fragment shader replacing
+// the fragment stage at index fragment of stages, or -1 if there is none.
+func (debugDraw *debugDrawTransform) fragmentShader(ctx context.Context,
+	inputState *api.GlobalState,
+	stages []VkPipelineShaderStageCreateInfo,
+	fragment int,
+	formats []VkFormat) ([]uint32, error) {
+
+	original := func() ([]uint32, error) {
+		if fragment < 0 {
+			return nil, fmt.Errorf("Pipeline has no fragment shader")
+		}
+		module, ok := GetState(inputState).ShaderModules().Lookup(stages[fragment].Module())
+		if !ok {
+			return nil, fmt.Errorf("Invalid shader module %v", stages[fragment].Module())
+		}
+		return module.Words().Read(ctx, nil, inputState, nil)
+	}
+
+	source, preamble := "", ""
+	switch debugDraw.mode {
+	case path.DrawMode_NORMAL:
+		source = debugDrawColorShaderSource(formats, [4]float32{0.5, 0.5, 0.5, 1})
+	case path.DrawMode_DRAW_ID:
+		source = debugDrawColorShaderSource(formats, [4]float32{1, 1, 1, 1})
+	case path.DrawMode_DEPTH_COMPLEXITY:
+		source = debugDrawColorShaderSource(formats, [4]float32{depthComplexityStep, depthComplexityStep, depthComplexityStep, 1})
+	case path.DrawMode_SHADER_COST:
+		counters := shadertools.StaticAnalysisCounters{}
+		if fragment >= 0 {
+			words, err := original()
+			if err != nil {
+				return nil, err
+			}
+			if counters, err = shadertools.Analyze(words); err != nil {
+				return nil, err
+			}
+		}
+		source = debugDrawColorShaderSource(formats, shaderCostColor(counters))
+	case path.DrawMode_MIP_LEVEL, path.DrawMode_TEXEL_DENSITY:
+		words, err := original()
+		if err != nil {
+			return nil, err
+		}
+		if source, err = shadertools.DecompileGlsl(words); err != nil {
+			return nil, err
+		}
+		preamble = mipLevelPreamble
+		if debugDraw.mode == path.DrawMode_TEXEL_DENSITY {
+			preamble = texelDensityPreamble
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported draw mode %v", debugDraw.mode)
+	}
+
+	key := preamble + source
+	if words, ok := debugDraw.shaders[key]; ok {
+		return words, nil
+	}
+	words, err := shadertools.CompileGlsl(source, shadertools.CompileOptions{
+		ShaderType: shadertools.TypeFragment,
+		ClientType: shadertools.Vulkan,
+		Preamble:   preamble,
+	})
+	if err != nil {
+		return nil, err
+	}
+	debugDraw.shaders[key] = words
+	return words, nil
+}
+
+func (debugDraw *debugDrawTransform) createShaderModule(ctx context.Context,
+	cb CommandBuilder,
+	device VkDevice,
+	module VkShaderModule,
+	words []uint32) api.Cmd {
+
+	moduleData := debugDraw.allocations.AllocDataOrPanic(ctx, module)
+	wordsData := debugDraw.allocations.AllocDataOrPanic(ctx, words)
+	createInfoData := debugDraw.allocations.AllocDataOrPanic(ctx,
+		NewVkShaderModuleCreateInfo(
+			VkStructureType_VK_STRUCTURE_TYPE_SHADER_MODULE_CREATE_INFO, // sType
+			0, // pNext
+			0, // flags
+			memory.Size(len(words)*4),
+			NewU32ᶜᵖ(wordsData.Ptr()),
+		))
+
+	return cb.VkCreateShaderModule(
+		device,
+		createInfoData.Ptr(),
+		memory.Nullptr,
+		moduleData.Ptr(),
+		VkResult_VK_SUCCESS,
+	).AddRead(
+		createInfoData.Data(),
+	).AddRead(
+		wordsData.Data(),
+	).AddWrite(
+		moduleData.Data(),
+	)
+}
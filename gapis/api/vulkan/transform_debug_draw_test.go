@@ -0,0 +1,188 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/shadertools"
+)
+
+// storedByte returns the byte stored by the hardware when writing v to an
+// 8 bit UNORM or sRGB channel.
+func storedByte(v float32, srgb bool) uint8 {
+	if srgb {
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = float32(1.055*math.Pow(float64(v), 1/2.4) - 0.055)
+		}
+	}
+	return uint8(v*255 + 0.5)
+}
+
+func TestDrawIDColorRoundTrip(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, id := range []api.CmdID{0, 1, 2, 255, 256, 12345, 0xfffffe} {
+		for _, srgb := range []bool{false, true} {
+			c := drawIDColor(id, srgb)
+			got, ok := DrawIDFromColor(storedByte(c.Get(0), srgb), storedByte(c.Get(1), srgb), storedByte(c.Get(2), srgb))
+			assert.For(ctx, "ok %v srgb %v", id, srgb).That(ok).Equals(true)
+			assert.For(ctx, "id srgb %v", srgb).That(got).Equals(id)
+		}
+	}
+	_, ok := DrawIDFromColor(0, 0, 0)
+	assert.For(ctx, "background").That(ok).Equals(false)
+}
+
+func TestDebugDrawColorShader(t *testing.T) {
+	ctx := log.Testing(t)
+	formats := []VkFormat{
+		VkFormat_VK_FORMAT_R8G8B8A8_UNORM,
+		VkFormat_VK_FORMAT_UNDEFINED,
+		VkFormat_VK_FORMAT_R32_UINT,
+		VkFormat_VK_FORMAT_R16G16_SINT,
+	}
+	_, err := shadertools.CompileGlsl(debugDrawColorShaderSource(formats, [4]float32{1, 0.5, 0, 1}),
+		shadertools.CompileOptions{
+			ShaderType: shadertools.TypeFragment,
+			ClientType: shadertools.Vulkan,
+		})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+}
+
+func TestDebugDrawIDBlendConstants(t *testing.T) {
+	ctx := log.Testing(t)
+	for _, format := range []VkFormat{
+		VkFormat_VK_FORMAT_R8G8B8A8_UNORM,
+		VkFormat_VK_FORMAT_B8G8R8A8_SRGB,
+	} {
+		s := api.NewStateWithEmptyAllocator(device.Little32)
+		attachment := MakeAttachmentDescription()
+		attachment.SetFmt(format)
+		reference := MakeAttachmentReference()
+		reference.SetAttachment(0)
+		subpass := MakeSubpassDescription()
+		subpass.ColorAttachments().Add(0, reference)
+		renderPass := MakeRenderPassObjectʳ()
+		renderPass.SetVulkanHandle(1)
+		renderPass.AttachmentDescriptions().Add(0, attachment)
+		renderPass.SubpassDescriptions().Add(0, subpass)
+		GetState(s).RenderPasses().Add(1, renderPass)
+		commandBuffer := MakeCommandBufferObjectʳ()
+		commandBuffer.SetCurrentRecordingRenderpass(renderPass)
+		GetState(s).CommandBuffers().Add(2, commandBuffer)
+
+		cb := CommandBuilder{}
+		draw := cb.VkCmdDraw(2, 3, 1, 0, 0)
+		// The identifiers are the capture command identifiers, after the
+		// commands recreating the initial state.
+		debugDraw := newDebugDrawTransform(path.DrawMode_DRAW_ID, 10)
+		out, err := debugDraw.TransformCommand(ctx, transform.NewTransformCommandID(52), []api.Cmd{draw}, s)
+		if !assert.For(ctx, "%v err", format).ThatError(err).Succeeded() {
+			continue
+		}
+		if !assert.For(ctx, "%v commands", format).That(len(out)).Equals(2) {
+			continue
+		}
+		setColor, ok := out[0].(*VkCmdSetBlendConstants)
+		if !assert.For(ctx, "%v set blend constants", format).That(ok).Equals(true) {
+			continue
+		}
+		srgb := format == VkFormat_VK_FORMAT_B8G8R8A8_SRGB
+		c := setColor.BlendConstants()
+		id, ok := DrawIDFromColor(storedByte(c.Get(0), srgb), storedByte(c.Get(1), srgb), storedByte(c.Get(2), srgb))
+		assert.For(ctx, "%v ok", format).That(ok).Equals(true)
+		assert.For(ctx, "%v id", format).That(id).Equals(api.CmdID(42))
+		assert.For(ctx, "%v inserted", format).That(isInsertedCommand(setColor)).Equals(true)
+		assert.For(ctx, "%v draw", format).That(out[1]).Equals(draw)
+	}
+}
+
+func TestDebugDrawTextureShaders(t *testing.T) {
+	ctx := log.Testing(t)
+	// The shader is compiled without debug source, as in release builds.
+	words, err := shadertools.CompileGlsl(`#version 450
+layout(set = 0, binding = 0) uniform sampler2D tex;
+layout(location = 0) in vec2 uv;
+layout(location = 0) out vec4 color;
+void main() { color = texture(tex, uv); }
+`, shadertools.CompileOptions{
+		ShaderType: shadertools.TypeFragment,
+		ClientType: shadertools.Vulkan,
+	})
+	if !assert.For(ctx, "compile").ThatError(err).Succeeded() {
+		return
+	}
+
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+	module := MakeShaderModuleObjectʳ()
+	module.SetWords(MakeU32ˢ(uint64(len(words)), s))
+	module.Words().MustWrite(ctx, words, nil, s, nil)
+	GetState(s).ShaderModules().Add(3, module)
+
+	stage := MakeVkPipelineShaderStageCreateInfo()
+	stage.SetStage(VkShaderStageFlagBits_VK_SHADER_STAGE_FRAGMENT_BIT)
+	stage.SetModule(3)
+	missing := MakeVkPipelineShaderStageCreateInfo()
+	missing.SetStage(VkShaderStageFlagBits_VK_SHADER_STAGE_FRAGMENT_BIT)
+	missing.SetModule(4)
+	formats := []VkFormat{VkFormat_VK_FORMAT_R8G8B8A8_UNORM}
+
+	for _, mode := range []path.DrawMode{path.DrawMode_MIP_LEVEL, path.DrawMode_TEXEL_DENSITY} {
+		debugDraw := newDebugDrawTransform(mode, 0)
+		out, err := debugDraw.fragmentShader(ctx, s, []VkPipelineShaderStageCreateInfo{stage}, 0, formats)
+		if assert.For(ctx, "%v err", mode).ThatError(err).Succeeded() {
+			src, err := shadertools.DecompileGlsl(out)
+			assert.For(ctx, "%v decompile", mode).ThatError(err).Succeeded()
+			assert.For(ctx, "%v samples replaced", mode).That(strings.Contains(src, "textureQueryLod")).Equals(true)
+		}
+
+		_, err = debugDraw.fragmentShader(ctx, s, []VkPipelineShaderStageCreateInfo{missing}, 0, formats)
+		assert.For(ctx, "%v missing module", mode).ThatError(err).Failed()
+	}
+}
+
+func TestCaptureCommandIndices(t *testing.T) {
+	ctx := log.Testing(t)
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+	cb := CommandBuilder{}
+	inserted := func() api.Cmd {
+		return api.WithExtras(cb.VkCmdSetBlendConstants(2, NewF32ː4ᵃ()), insertedCommand{})
+	}
+	draw := func() api.Cmd { return cb.VkCmdDraw(2, 3, 1, 0, 0) }
+
+	recorded := []api.Cmd{inserted(), draw(), draw(), inserted(), inserted(), draw()}
+	commandBuffer := MakeCommandBufferObjectʳ()
+	commandBuffer.SetVulkanHandle(2)
+	for i := range recorded {
+		commandBuffer.CommandReferences().Add(uint32(i), MakeCommandReferenceʳ())
+	}
+	GetState(s).initialCommands[2] = recorded
+
+	indices := captureCommandIndices(s, commandBuffer)
+	assert.For(ctx, "indices").ThatSlice(indices).Equals([]uint64{0, 0, 1, 1, 1, 2})
+	for i, expected := range []bool{false, true, false, false, true, true} {
+		assert.For(ctx, "last %v", i).That(isLastOfCaptureCommand(indices, uint32(i))).Equals(expected)
+	}
+}
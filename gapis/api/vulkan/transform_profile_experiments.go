@@ -0,0 +1,297 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay"
+)
+
+// profileExperimentsTransform implements the Transform interface to apply the
+// profiling experiments that modify the creation of samplers, image views and
+// pipelines, or the dynamic viewport and scissor state:
+//   - SampleSmallestMip restricts the views of sampled images to their
+//     smallest mip level. Images with a single mip level are left unchanged.
+//   - ForceBaseMipLevel clamps the level of detail of every sampler to the
+//     base, most detailed, mip level of the sampled view.
+//   - NullRasterization forces all viewports and scissors to 1x1.
+//   - DisableBlending disables blending on all color attachments.
+type profileExperimentsTransform struct {
+	experiments replay.ProfileExperiments
+	allocations *allocationTracker
+}
+
+func newProfileExperimentsTransform(experiments replay.ProfileExperiments) *profileExperimentsTransform {
+	return &profileExperimentsTransform{
+		experiments: experiments,
+		allocations: nil,
+	}
+}
+
+func (experiments *profileExperimentsTransform) RequiresAccurateState() bool {
+	return false
+}
+
+func (experiments *profileExperimentsTransform) RequiresInnerStateMutation() bool {
+	return false
+}
+
+func (experiments *profileExperimentsTransform) SetInnerStateMutationFunction(mutator transform.StateMutator) {
+	// This transform does not require inner state mutation
+}
+
+func (experiments *profileExperimentsTransform) BeginTransform(ctx context.Context, inputState *api.GlobalState) error {
+	experiments.allocations = NewAllocationTracker(inputState)
+	return nil
+}
+
+func (experiments *profileExperimentsTransform) EndTransform(ctx context.Context, inputState *api.GlobalState) ([]api.Cmd, error) {
+	return nil, nil
+}
+
+func (experiments *profileExperimentsTransform) ClearTransformResources(ctx context.Context) {
+	experiments.allocations.FreeAllocations()
+}
+
+func (experiments *profileExperimentsTransform) TransformCommand(ctx context.Context, id transform.CommandID, inputCommands []api.Cmd, inputState *api.GlobalState) ([]api.Cmd, error) {
+	for i, cmd := range inputCommands {
+		var newCmd api.Cmd
+		var err error
+		switch cmd := cmd.(type) {
+		case *VkCreateImageView:
+			if experiments.experiments.SampleSmallestMip {
+				newCmd, err = experiments.updateImageView(ctx, cmd, inputState)
+			}
+		case *VkCreateSampler:
+			if experiments.experiments.ForceBaseMipLevel {
+				newCmd, err = experiments.updateSampler(ctx, cmd, inputState)
+			}
+		case *VkCreateGraphicsPipelines:
+			if experiments.experiments.NullRasterization || experiments.experiments.DisableBlending {
+				newCmd, err = experiments.updateGraphicsPipelines(ctx, cmd, inputState)
+			}
+		case *VkCmdSetViewport:
+			if experiments.experiments.NullRasterization {
+				newCmd, err = experiments.updateViewports(ctx, cmd, inputState)
+			}
+		case *VkCmdSetScissor:
+			if experiments.experiments.NullRasterization {
+				newCmd, err = experiments.updateScissors(ctx, cmd, inputState)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if newCmd != nil {
+			inputCommands[i] = newCmd
+		}
+	}
+
+	return inputCommands, nil
+}
+
+// updateImageView returns cmd with the view restricted to the smallest mip
+// level of its range, if the viewed image is only used as a texture.
+func (experiments *profileExperimentsTransform) updateImageView(ctx context.Context, cmd *VkCreateImageView, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	info, err := cmd.PCreateInfo().Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	image, ok := GetState(inputState).Images().Lookup(info.Image())
+	if !ok {
+		return nil, nil
+	}
+	usage := uint32(image.Info().Usage())
+	attachmentUsage := uint32(VkImageUsageFlagBits_VK_IMAGE_USAGE_COLOR_ATTACHMENT_BIT |
+		VkImageUsageFlagBits_VK_IMAGE_USAGE_DEPTH_STENCIL_ATTACHMENT_BIT |
+		VkImageUsageFlagBits_VK_IMAGE_USAGE_INPUT_ATTACHMENT_BIT |
+		VkImageUsageFlagBits_VK_IMAGE_USAGE_STORAGE_BIT)
+	if usage&uint32(VkImageUsageFlagBits_VK_IMAGE_USAGE_SAMPLED_BIT) == 0 || usage&attachmentUsage != 0 {
+		// Reducing rendered or stored images would change what is rendered
+		// rather than what is sampled.
+		return nil, nil
+	}
+
+	subresourceRange := info.SubresourceRange()
+	lastLevel := image.Info().MipLevels() - 1
+	if count := subresourceRange.LevelCount(); count != VK_REMAINING_MIP_LEVELS {
+		lastLevel = subresourceRange.BaseMipLevel() + count - 1
+	}
+	if lastLevel == subresourceRange.BaseMipLevel() {
+		// The view has a single mip level, which is already the smallest.
+		return nil, nil
+	}
+	subresourceRange.SetBaseMipLevel(lastLevel)
+	subresourceRange.SetLevelCount(1)
+	info.SetSubresourceRange(subresourceRange)
+	newInfo := experiments.allocations.AllocDataOrPanic(ctx, info)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateImageView(cmd.Device(), newInfo.Ptr(), memory.Pointer(cmd.PAllocator()), memory.Pointer(cmd.PView()), cmd.Result())
+	newCmd.AddRead(newInfo.Data())
+	for _, w := range cmd.Extras().Observations().Writes {
+		newCmd.AddWrite(w.Range, w.ID)
+	}
+	return newCmd, nil
+}
+
+// updateSampler returns cmd with the level of detail clamped to zero.
+func (experiments *profileExperimentsTransform) updateSampler(ctx context.Context, cmd *VkCreateSampler, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	info, err := cmd.PCreateInfo().Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	info.SetMipLodBias(0)
+	info.SetMinLod(0)
+	info.SetMaxLod(0)
+	newInfo := experiments.allocations.AllocDataOrPanic(ctx, info)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateSampler(cmd.Device(), newInfo.Ptr(), memory.Pointer(cmd.PAllocator()), memory.Pointer(cmd.PSampler()), cmd.Result())
+	newCmd.AddRead(newInfo.Data())
+	for _, w := range cmd.Extras().Observations().Writes {
+		newCmd.AddWrite(w.Range, w.ID)
+	}
+	return newCmd, nil
+}
+
+// updateGraphicsPipelines returns cmd with the static viewports and scissors
+// of every pipeline reduced to 1x1 and blending disabled, as requested by the
+// experiments.
+func (experiments *profileExperimentsTransform) updateGraphicsPipelines(ctx context.Context, cmd *VkCreateGraphicsPipelines, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	reads := []api.AllocResult{}
+	allocAndRead := func(v ...interface{}) api.AllocResult {
+		res := experiments.allocations.AllocDataOrPanic(ctx, v...)
+		reads = append(reads, res)
+		return res
+	}
+
+	count := uint64(cmd.CreateInfoCount())
+	infos, err := cmd.PCreateInfos().Slice(0, count, inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range infos {
+		info := &infos[i]
+
+		if experiments.experiments.NullRasterization && !info.PViewportState().IsNullptr() {
+			viewportState, err := info.PViewportState().Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			// Dynamic viewports and scissors are reduced by updateViewports
+			// and updateScissors.
+			if !viewportState.PViewports().IsNullptr() {
+				viewports, err := viewportState.PViewports().Slice(0, uint64(viewportState.ViewportCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+				if err != nil {
+					return nil, err
+				}
+				nullViewports(viewports)
+				viewportState.SetPViewports(NewVkViewportᶜᵖ(allocAndRead(viewports).Ptr()))
+			}
+			if !viewportState.PScissors().IsNullptr() {
+				scissors, err := viewportState.PScissors().Slice(0, uint64(viewportState.ScissorCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+				if err != nil {
+					return nil, err
+				}
+				nullScissors(scissors)
+				viewportState.SetPScissors(NewVkRect2Dᶜᵖ(allocAndRead(scissors).Ptr()))
+			}
+			info.SetPViewportState(NewVkPipelineViewportStateCreateInfoᶜᵖ(allocAndRead(viewportState).Ptr()))
+		}
+
+		if experiments.experiments.DisableBlending && !info.PColorBlendState().IsNullptr() {
+			blendState, err := info.PColorBlendState().Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			attachments, err := blendState.PAttachments().Slice(0, uint64(blendState.AttachmentCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			for j := range attachments {
+				attachments[j].SetBlendEnable(0)
+			}
+			blendState.SetPAttachments(NewVkPipelineColorBlendAttachmentStateᶜᵖ(allocAndRead(attachments).Ptr()))
+			info.SetPColorBlendState(NewVkPipelineColorBlendStateCreateInfoᶜᵖ(allocAndRead(blendState).Ptr()))
+		}
+	}
+	newInfos := allocAndRead(infos)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateGraphicsPipelines(cmd.Device(),
+		cmd.PipelineCache(), cmd.CreateInfoCount(), newInfos.Ptr(),
+		cmd.PAllocator(), cmd.PPipelines(), cmd.Result())
+	for _, r := range reads {
+		newCmd.AddRead(r.Data())
+	}
+	for _, w := range cmd.Extras().Observations().Writes {
+		newCmd.AddWrite(w.Range, w.ID)
+	}
+	return newCmd, nil
+}
+
+func (experiments *profileExperimentsTransform) updateViewports(ctx context.Context, cmd *VkCmdSetViewport, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	viewports, err := cmd.PViewports().Slice(0, uint64(cmd.ViewportCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	nullViewports(viewports)
+	newViewports := experiments.allocations.AllocDataOrPanic(ctx, viewports)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	return cb.VkCmdSetViewport(cmd.CommandBuffer(), cmd.FirstViewport(), cmd.ViewportCount(),
+		newViewports.Ptr()).AddRead(newViewports.Data()), nil
+}
+
+func (experiments *profileExperimentsTransform) updateScissors(ctx context.Context, cmd *VkCmdSetScissor, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	scissors, err := cmd.PScissors().Slice(0, uint64(cmd.ScissorCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	nullScissors(scissors)
+	newScissors := experiments.allocations.AllocDataOrPanic(ctx, scissors)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	return cb.VkCmdSetScissor(cmd.CommandBuffer(), cmd.FirstScissor(), cmd.ScissorCount(),
+		newScissors.Ptr()).AddRead(newScissors.Data()), nil
+}
+
+func nullViewports(viewports []VkViewport) {
+	for i := range viewports {
+		viewports[i].SetWidth(1)
+		viewports[i].SetHeight(1)
+	}
+}
+
+func nullScissors(scissors []VkRect2D) {
+	for i := range scissors {
+		scissors[i].SetExtent(NewVkExtent2D(1, 1))
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay"
+)
+
+// runProfileExperiments applies the experiments to cmd and returns the
+// resulting command, with its reads applied to the state.
+func runProfileExperiments(ctx context.Context, s *api.GlobalState, experiments replay.ProfileExperiments, cmd api.Cmd) api.Cmd {
+	experimentsTransform := newProfileExperimentsTransform(experiments)
+	experimentsTransform.BeginTransform(ctx, s)
+	out, err := experimentsTransform.TransformCommand(ctx, transform.NewTransformCommandID(0), []api.Cmd{cmd}, s)
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() || !assert.For(ctx, "commands").That(len(out)).Equals(1) {
+		return nil
+	}
+	out[0].Extras().Observations().ApplyReads(s.Memory.ApplicationPool())
+	return out[0]
+}
+
+func TestSampleSmallestMipExperiment(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	sampled := VkImageUsageFlagBits_VK_IMAGE_USAGE_SAMPLED_BIT | VkImageUsageFlagBits_VK_IMAGE_USAGE_TRANSFER_DST_BIT
+	for _, test := range []struct {
+		name        string
+		usage       VkImageUsageFlagBits
+		mipLevels   uint32
+		base, count uint32
+		expected    uint32
+		unchanged   bool
+	}{
+		{"all levels", sampled, 5, 0, VK_REMAINING_MIP_LEVELS, 4, false},
+		{"level range", sampled, 5, 1, 2, 2, false},
+		{"single level image", sampled, 1, 0, VK_REMAINING_MIP_LEVELS, 0, true},
+		{"single level view", sampled, 5, 2, 1, 2, true},
+		{"color attachment", sampled | VkImageUsageFlagBits_VK_IMAGE_USAGE_COLOR_ATTACHMENT_BIT, 5, 0, 5, 0, true},
+		{"storage", sampled | VkImageUsageFlagBits_VK_IMAGE_USAGE_STORAGE_BIT, 5, 0, 5, 0, true},
+	} {
+		s := api.NewStateWithEmptyAllocator(device.Little32)
+		image := MakeImageObjectʳ()
+		image.Info().SetUsage(VkImageUsageFlags(test.usage))
+		image.Info().SetMipLevels(test.mipLevels)
+		GetState(s).Images().Add(1, image)
+
+		info := MakeVkImageViewCreateInfo()
+		info.SetImage(1)
+		info.SetSubresourceRange(NewVkImageSubresourceRange(
+			VkImageAspectFlags(VkImageAspectFlagBits_VK_IMAGE_ASPECT_COLOR_BIT), // aspectMask
+			test.base,  // baseMipLevel
+			test.count, // levelCount
+			0,          // baseArrayLayer
+			1,          // layerCount
+		))
+		infoData := s.AllocDataOrPanic(ctx, info)
+		cb := CommandBuilder{}
+		cmd := cb.VkCreateImageView(2, infoData.Ptr(), memory.Nullptr, s.AllocOrPanic(ctx, 8).Ptr(), VkResult_VK_SUCCESS).
+			AddRead(infoData.Data())
+
+		out := runProfileExperiments(ctx, s, replay.ProfileExperiments{SampleSmallestMip: true}, cmd)
+		if test.unchanged {
+			assert.For(ctx, "%v unchanged", test.name).That(out).Equals(api.Cmd(cmd))
+			continue
+		}
+		newCmd, ok := out.(*VkCreateImageView)
+		if !assert.For(ctx, "%v create image view", test.name).That(ok).Equals(true) {
+			continue
+		}
+		newInfo, err := newCmd.PCreateInfo().Read(ctx, newCmd, s, nil)
+		if assert.For(ctx, "%v read", test.name).ThatError(err).Succeeded() {
+			assert.For(ctx, "%v base level", test.name).That(newInfo.SubresourceRange().BaseMipLevel()).Equals(test.expected)
+			assert.For(ctx, "%v level count", test.name).That(newInfo.SubresourceRange().LevelCount()).Equals(uint32(1))
+		}
+	}
+}
+
+func TestForceBaseMipLevelExperiment(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+
+	info := MakeVkSamplerCreateInfo()
+	info.SetMipLodBias(1.5)
+	info.SetMinLod(2)
+	info.SetMaxLod(10)
+	info.SetMagFilter(VkFilter_VK_FILTER_LINEAR)
+	infoData := s.AllocDataOrPanic(ctx, info)
+	cb := CommandBuilder{}
+	cmd := cb.VkCreateSampler(2, infoData.Ptr(), memory.Nullptr, s.AllocOrPanic(ctx, 8).Ptr(), VkResult_VK_SUCCESS).
+		AddRead(infoData.Data())
+
+	out := runProfileExperiments(ctx, s, replay.ProfileExperiments{ForceBaseMipLevel: true}, cmd)
+	newCmd, ok := out.(*VkCreateSampler)
+	if !assert.For(ctx, "create sampler").That(ok).Equals(true) {
+		return
+	}
+	newInfo, err := newCmd.PCreateInfo().Read(ctx, newCmd, s, nil)
+	if assert.For(ctx, "read").ThatError(err).Succeeded() {
+		assert.For(ctx, "lod bias").That(newInfo.MipLodBias()).Equals(float32(0))
+		assert.For(ctx, "min lod").That(newInfo.MinLod()).Equals(float32(0))
+		assert.For(ctx, "max lod").That(newInfo.MaxLod()).Equals(float32(0))
+		assert.For(ctx, "mag filter").That(newInfo.MagFilter()).Equals(VkFilter_VK_FILTER_LINEAR)
+	}
+
+	// Samplers are left untouched by the other experiments.
+	out = runProfileExperiments(ctx, s, replay.ProfileExperiments{DisableBlending: true}, cmd)
+	assert.For(ctx, "unchanged").That(out).Equals(api.Cmd(cmd))
+}
+
+func TestNullRasterizationAndDisableBlendingExperiments(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	for _, experiments := range []replay.ProfileExperiments{
+		{NullRasterization: true},
+		{DisableBlending: true},
+		{NullRasterization: true, DisableBlending: true},
+	} {
+		s := api.NewStateWithEmptyAllocator(device.Little32)
+		viewports := s.AllocDataOrPanic(ctx, []VkViewport{NewVkViewport(0, 0, 640, 480, 0, 1)})
+		scissors := s.AllocDataOrPanic(ctx, []VkRect2D{NewVkRect2D(NewVkOffset2D(0, 0), NewVkExtent2D(640, 480))})
+		viewportState := MakeVkPipelineViewportStateCreateInfo()
+		viewportState.SetViewportCount(1)
+		viewportState.SetPViewports(NewVkViewportᶜᵖ(viewports.Ptr()))
+		viewportState.SetScissorCount(1)
+		viewportState.SetPScissors(NewVkRect2Dᶜᵖ(scissors.Ptr()))
+		viewportStateData := s.AllocDataOrPanic(ctx, viewportState)
+
+		attachment := MakeVkPipelineColorBlendAttachmentState()
+		attachment.SetBlendEnable(1)
+		attachments := s.AllocDataOrPanic(ctx, []VkPipelineColorBlendAttachmentState{attachment, attachment})
+		blendState := MakeVkPipelineColorBlendStateCreateInfo()
+		blendState.SetAttachmentCount(2)
+		blendState.SetPAttachments(NewVkPipelineColorBlendAttachmentStateᶜᵖ(attachments.Ptr()))
+		blendStateData := s.AllocDataOrPanic(ctx, blendState)
+
+		info := MakeVkGraphicsPipelineCreateInfo()
+		info.SetPViewportState(NewVkPipelineViewportStateCreateInfoᶜᵖ(viewportStateData.Ptr()))
+		info.SetPColorBlendState(NewVkPipelineColorBlendStateCreateInfoᶜᵖ(blendStateData.Ptr()))
+		infoData := s.AllocDataOrPanic(ctx, []VkGraphicsPipelineCreateInfo{info})
+
+		cb := CommandBuilder{}
+		cmd := cb.VkCreateGraphicsPipelines(2, 0, 1, infoData.Ptr(), memory.Nullptr, s.AllocOrPanic(ctx, 8).Ptr(), VkResult_VK_SUCCESS)
+		for _, data := range []api.AllocResult{viewports, scissors, viewportStateData, attachments, blendStateData, infoData} {
+			cmd.AddRead(data.Data())
+		}
+
+		out := runProfileExperiments(ctx, s, experiments, cmd)
+		newCmd, ok := out.(*VkCreateGraphicsPipelines)
+		if !assert.For(ctx, "%+v create pipelines", experiments).That(ok).Equals(true) {
+			continue
+		}
+		newInfos, err := newCmd.PCreateInfos().Slice(0, 1, s.MemoryLayout).Read(ctx, newCmd, s, nil)
+		if !assert.For(ctx, "%+v read", experiments).ThatError(err).Succeeded() {
+			continue
+		}
+
+		expectedSize := float32(640)
+		if experiments.NullRasterization {
+			expectedSize = 1
+		}
+		newViewportState, err := newInfos[0].PViewportState().Read(ctx, newCmd, s, nil)
+		assert.For(ctx, "%+v read viewport state", experiments).ThatError(err).Succeeded()
+		newViewports, err := newViewportState.PViewports().Slice(0, 1, s.MemoryLayout).Read(ctx, newCmd, s, nil)
+		if assert.For(ctx, "%+v read viewports", experiments).ThatError(err).Succeeded() {
+			assert.For(ctx, "%+v viewport width", experiments).That(newViewports[0].Width()).Equals(expectedSize)
+		}
+		newScissors, err := newViewportState.PScissors().Slice(0, 1, s.MemoryLayout).Read(ctx, newCmd, s, nil)
+		if assert.For(ctx, "%+v read scissors", experiments).ThatError(err).Succeeded() {
+			assert.For(ctx, "%+v scissor width", experiments).That(float32(newScissors[0].Extent().Width())).Equals(expectedSize)
+		}
+
+		expectedBlend := VkBool32(1)
+		if experiments.DisableBlending {
+			expectedBlend = 0
+		}
+		newBlendState, err := newInfos[0].PColorBlendState().Read(ctx, newCmd, s, nil)
+		assert.For(ctx, "%+v read blend state", experiments).ThatError(err).Succeeded()
+		newAttachments, err := newBlendState.PAttachments().Slice(0, 2, s.MemoryLayout).Read(ctx, newCmd, s, nil)
+		if assert.For(ctx, "%+v read attachments", experiments).ThatError(err).Succeeded() {
+			for i, a := range newAttachments {
+				assert.For(ctx, "%+v blend %v", experiments, i).That(a.BlendEnable()).Equals(expectedBlend)
+			}
+		}
+	}
+}
+
+func TestNullRasterizationDynamicState(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+	experiments := replay.ProfileExperiments{NullRasterization: true}
+	cb := CommandBuilder{}
+
+	viewports := s.AllocDataOrPanic(ctx, []VkViewport{
+		NewVkViewport(0, 0, 640, 480, 0, 1),
+		NewVkViewport(10, 20, 320, 240, 0, 1),
+	})
+	out := runProfileExperiments(ctx, s, experiments,
+		cb.VkCmdSetViewport(3, 1, 2, viewports.Ptr()).AddRead(viewports.Data()))
+	if setViewport, ok := out.(*VkCmdSetViewport); assert.For(ctx, "set viewport").That(ok).Equals(true) {
+		assert.For(ctx, "first viewport").That(setViewport.FirstViewport()).Equals(uint32(1))
+		newViewports, err := setViewport.PViewports().Slice(0, 2, s.MemoryLayout).Read(ctx, setViewport, s, nil)
+		if assert.For(ctx, "read viewports").ThatError(err).Succeeded() {
+			for i, v := range newViewports {
+				assert.For(ctx, "viewport %v size", i).That([]float32{v.Width(), v.Height()}).DeepEquals([]float32{1, 1})
+			}
+			assert.For(ctx, "viewport offset").That(newViewports[1].X()).Equals(float32(10))
+		}
+	}
+
+	scissors := s.AllocDataOrPanic(ctx, []VkRect2D{NewVkRect2D(NewVkOffset2D(5, 6), NewVkExtent2D(640, 480))})
+	out = runProfileExperiments(ctx, s, experiments,
+		cb.VkCmdSetScissor(3, 0, 1, scissors.Ptr()).AddRead(scissors.Data()))
+	if setScissor, ok := out.(*VkCmdSetScissor); assert.For(ctx, "set scissor").That(ok).Equals(true) {
+		newScissors, err := setScissor.PScissors().Slice(0, 1, s.MemoryLayout).Read(ctx, setScissor, s, nil)
+		if assert.For(ctx, "read scissors").ThatError(err).Succeeded() {
+			extent, offset := newScissors[0].Extent(), newScissors[0].Offset()
+			assert.For(ctx, "scissor extent").That([]uint32{extent.Width(), extent.Height()}).DeepEquals([]uint32{1, 1})
+			assert.For(ctx, "scissor offset").That([]int32{offset.X(), offset.Y()}).DeepEquals([]int32{5, 6})
+		}
+	}
+}
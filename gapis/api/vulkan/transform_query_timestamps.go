@@ -66,15 +66,20 @@ type queryTimestamps struct {
 	handler         service.TimeStampsHandler
 	results         map[uint64]queryResults
 	allocations     *allocationTracker
+	// readResultsAfter are the commands after which the results of all the
+	// queries are read. It holds the end of the loop for looping replays, so
+	// that the results of every iteration are reported.
+	readResultsAfter map[api.CmdID]bool
 }
 
 func newQueryTimestamps(ctx context.Context, handler service.TimeStampsHandler) *queryTimestamps {
 	transform := &queryTimestamps{
-		commandPools: make(map[commandPoolKey]VkCommandPool),
-		queryPools:   make(map[VkQueue]*queryPoolInfo),
-		handler:      handler,
-		results:      make(map[uint64]queryResults),
-		allocations:  nil,
+		commandPools:     make(map[commandPoolKey]VkCommandPool),
+		queryPools:       make(map[VkQueue]*queryPoolInfo),
+		handler:          handler,
+		results:          make(map[uint64]queryResults),
+		allocations:      nil,
+		readResultsAfter: make(map[api.CmdID]bool),
 	}
 	return transform
 }
@@ -130,6 +135,14 @@ func (timestampTransform *queryTimestamps) TransformCommand(ctx context.Context,
 		outputCmds = append(outputCmds, newCommands...)
 	}
 
+	if id.GetCommandType() == transform.TransformCommand &&
+		timestampTransform.readResultsAfter[id.GetID()] {
+		cb := CommandBuilder{Thread: 0}
+		for _, queryPoolInfo := range timestampTransform.queryPools {
+			outputCmds = append(outputCmds, timestampTransform.getQueryResults(ctx, cb, inputState, queryPoolInfo)...)
+		}
+	}
+
 	return outputCmds, nil
 }
 
@@ -605,6 +618,8 @@ func (timestampTransform *queryTimestamps) processNotification(ctx context.Conte
 		tEnd := r.Uint64()
 		record := res[resIdx]
 		record.timestamp.TimeInNanoseconds = uint64(float32(tEnd-tStart) * timestampTransform.timestampPeriod)
+		record.timestamp.BeginTimestampInNanoseconds = uint64(float64(tStart) * float64(timestampTransform.timestampPeriod))
+		record.timestamp.EndTimestampInNanoseconds = uint64(float64(tEnd) * float64(timestampTransform.timestampPeriod))
 		if record.IsEoC {
 			tStart = r.Uint64()
 			i++
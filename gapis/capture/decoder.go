@@ -205,6 +205,10 @@ func (d *decoder) decode(ctx context.Context, in proto.Message) (interface{}, er
 		d.builder.addMessage(ctx, obj)
 		return in, nil
 
+	case *LogcatMessage:
+		d.builder.addLogcat(ctx, obj)
+		return in, nil
+
 	case api.Cmd:
 		return &cmdGroup{cmd: obj}, nil
 
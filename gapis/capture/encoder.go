@@ -66,6 +66,17 @@ func (e *encoder) encode(ctx context.Context) error {
 			return err
 		}
 	}
+
+	for _, m := range e.c.Messages {
+		if err := e.w.Object(ctx, m); err != nil {
+			return err
+		}
+	}
+	for _, m := range e.c.Logcat {
+		if err := e.w.Object(ctx, m); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -57,6 +57,7 @@ type GraphicsCapture struct {
 	Observed     interval.U64RangeList
 	InitialState *InitialState
 	Messages     []*TraceMessage
+	Logcat       []*LogcatMessage
 }
 
 // Name returns the capture's name.
@@ -301,6 +302,7 @@ type builder struct {
 	resIDs       []id.ID
 	initialState *InitialState
 	messages     []*TraceMessage
+	logcat       []*LogcatMessage
 }
 
 func newBuilder() *builder {
@@ -333,6 +335,10 @@ func (b *builder) addMessage(ctx context.Context, t *TraceMessage) {
 	b.messages = append(b.messages, &TraceMessage{Timestamp: t.Timestamp, Message: t.Message})
 }
 
+func (b *builder) addLogcat(ctx context.Context, m *LogcatMessage) {
+	b.logcat = append(b.logcat, m)
+}
+
 func (b *builder) addAPI(ctx context.Context, api api.API) {
 	if api != nil {
 		apiID := api.ID()
@@ -388,5 +394,6 @@ func (b *builder) build(name string, header *Header) *GraphicsCapture {
 		APIs:         b.apis,
 		InitialState: b.initialState,
 		Messages:     b.messages,
+		Logcat:       b.logcat,
 	}
 }
@@ -19,11 +19,13 @@ import (
 	"io"
 	"time"
 
+	"github.com/google/gapid/core/app/status"
 	"github.com/google/gapid/core/event"
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/log/log_pb"
 	"github.com/google/gapid/core/net/grpcutil"
+	"github.com/google/gapid/gapis/api"
 	perfetto "github.com/google/gapid/gapis/perfetto/service"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
@@ -129,6 +131,37 @@ func (c *client) Delete(ctx context.Context, p *path.Any, r *path.ResolveConfig)
 	return res.GetPath(), nil
 }
 
+func (c *client) Insert(ctx context.Context, p *path.Command, cmd *api.Command, obs []*service.CommandObservation, r *path.ResolveConfig) (*path.Command, error) {
+	res, err := c.client.Insert(ctx, &service.InsertRequest{
+		Path:         p,
+		Command:      cmd,
+		Observations: obs,
+		Config:       r,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetCommand(), nil
+}
+
+func (c *client) Move(ctx context.Context, from, to *path.Command, r *path.ResolveConfig) (*path.Command, error) {
+	res, err := c.client.Move(ctx, &service.MoveRequest{
+		From:   from,
+		To:     to,
+		Config: r,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetCommand(), nil
+}
+
 func (c *client) Follow(ctx context.Context, p *path.Any, r *path.ResolveConfig) (*path.Any, error) {
 	res, err := c.client.Follow(ctx, &service.FollowRequest{
 		Path:   p,
@@ -149,11 +182,6 @@ func (c *client) Profile(
 	memorySnapshotInterval uint32,
 ) (stop func() error, err error) {
 
-	stream, err := c.client.Profile(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	req := &service.ProfileRequest{MemorySnapshotInterval: memorySnapshotInterval}
 	if pprof != nil {
 		req.Pprof = true
@@ -161,6 +189,32 @@ func (c *client) Profile(
 	if trace != nil {
 		req.Trace = true
 	}
+	return c.profile(ctx, req, pprof, trace)
+}
+
+func (c *client) TraceRequests(
+	ctx context.Context,
+	id status.TraceID,
+	trace io.Writer,
+) (stop func() error, err error) {
+	// The tracing stream is not part of the traced requests.
+	ctx = status.PutTraceID(ctx, status.NoTraceID)
+	req := &service.ProfileRequest{Trace: true, TraceId: string(id)}
+	return c.profile(ctx, req, nil, trace)
+}
+
+// profile starts the profile of the server requested by req, writing the
+// profile data to pprof and trace until stop is called.
+func (c *client) profile(
+	ctx context.Context,
+	req *service.ProfileRequest,
+	pprof, trace io.Writer,
+) (stop func() error, err error) {
+
+	stream, err := c.client.Profile(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	if err := stream.Send(req); err != nil {
 		return nil, err
@@ -518,6 +572,46 @@ func (c *client) TrimCaptureInitialState(ctx context.Context, p *path.Capture) (
 	return res.GetCapture(), nil
 }
 
+func (c *client) GetCaptureHistory(ctx context.Context, p *path.Capture) (*service.CaptureHistory, error) {
+	res, err := c.client.GetCaptureHistory(ctx, &service.GetCaptureHistoryRequest{
+		Capture: p,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetHistory(), nil
+}
+
+func (c *client) DiffCapture(ctx context.Context, p *path.Capture) (*service.CaptureDiff, error) {
+	res, err := c.client.DiffCapture(ctx, &service.DiffCaptureRequest{
+		Capture: p,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetDiff(), nil
+}
+
+func (c *client) ApplyEdits(ctx context.Context, p *path.Capture, edits []*service.EditOperation) (*path.Capture, error) {
+	res, err := c.client.ApplyEdits(ctx, &service.ApplyEditsRequest{
+		Capture: p,
+		Edits:   edits,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetCapture(), nil
+}
+
 func (c *client) UpdateSettings(ctx context.Context, req *service.UpdateSettingsRequest) error {
 	res, err := c.client.UpdateSettings(ctx, req)
 	if err != nil {
@@ -540,6 +634,42 @@ func (c *client) GpuProfile(ctx context.Context, req *service.GpuProfileRequest)
 	return res.GetProfilingData(), nil
 }
 
+func (c *client) GpuProfileFromBundle(ctx context.Context, req *service.GpuProfileFromBundleRequest) (*service.ProfilingData, error) {
+	res, err := c.client.GpuProfileFromBundle(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetProfilingData(), nil
+}
+
+func (c *client) CompareProfiles(ctx context.Context, baseline, current *service.ProfilingData) (*service.ProfileComparison, error) {
+	res, err := c.client.CompareProfiles(ctx, &service.CompareProfilesRequest{
+		Baseline: baseline,
+		Current:  current,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetComparison(), nil
+}
+
+func (c *client) LoopReplay(ctx context.Context, req *service.LoopReplayRequest) (*service.LoopReplayResult, error) {
+	res, err := c.client.LoopReplay(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetResult(), nil
+}
+
 func (c *client) GetTimestamps(ctx context.Context, req *service.GetTimestampsRequest, handler service.TimeStampsHandler) error {
 	stream, err := c.client.GetTimestamps(ctx, req)
 	if err != nil {
@@ -16,16 +16,21 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/google/gapid/core/app/auth"
 	"github.com/google/gapid/core/app/layout"
+	"github.com/google/gapid/core/app/status"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/net/grpcutil"
 	"github.com/google/gapid/core/os/device/bind"
 	"github.com/google/gapid/core/os/file"
 	"github.com/google/gapid/core/os/process"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -33,15 +38,27 @@ const (
 )
 
 type Config struct {
-	Path  *file.Path
+	Path *file.Path
+	// Host is the host name or IP address of the machine running the GAPIS
+	// process to connect to on Port, localhost if empty. It is also the name
+	// expected in the server certificate, unless TLS.ServerName is set.
+	Host  string
 	Port  int
 	Args  []string
 	Token auth.Token
+	// Socket is the path of the Unix domain socket of the GAPIS process to
+	// connect to. If not empty, it is used instead of Port.
+	Socket string
+	// TLS is the TLS configuration of the connection, nil for plain text.
+	TLS *tls.Config
+	// TraceID is the trace identifier sent with the requests whose context
+	// has none, identifying them on the server. No identifier is sent if empty.
+	TraceID status.TraceID
 }
 
 // Connect attempts to connect to a GAPIS process.
-// If port is zero, a new GAPIS server will be started, otherwise a connection
-// will be made to the specified port.
+// If both socket and port are unset, a new GAPIS server will be started,
+// otherwise a connection will be made to the specified socket or host and port.
 func Connect(ctx context.Context, cfg Config) (Client, error) {
 	var err error
 	if cfg.Path == nil {
@@ -50,7 +67,7 @@ func Connect(ctx context.Context, cfg Config) (Client, error) {
 		}
 	}
 
-	if cfg.Port == 0 {
+	if cfg.Socket == "" && cfg.Port == 0 {
 		cfg.Args = append(cfg.Args,
 			"--log-level", logLevel(ctx).String(),
 			"--log-style", log.Brief.String(),
@@ -69,12 +86,35 @@ func Connect(ctx context.Context, cfg Config) (Client, error) {
 		}
 	}
 
-	target := fmt.Sprintf("localhost:%d", cfg.Port)
+	host := cfg.Host
+	if host == "" {
+		host = "localhost"
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+	if cfg.Socket != "" {
+		target = grpcutil.UnixAddress(cfg.Socket)
+	}
+
+	transport := grpc.WithInsecure()
+	if cfg.TLS != nil {
+		tlsConfig := cfg.TLS
+		if tlsConfig.ServerName == "" && cfg.Socket == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = host
+		}
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
 
 	conn, err := grpcutil.Dial(ctx, target,
-		grpc.WithInsecure(),
-		grpc.WithUnaryInterceptor(auth.UnaryClientInterceptor(cfg.Token)),
-		grpc.WithStreamInterceptor(auth.StreamClientInterceptor(cfg.Token)))
+		transport,
+		grpc.WithChainUnaryInterceptor(
+			auth.UnaryClientInterceptor(cfg.Token),
+			grpcutil.UnaryClientTraceInterceptor(cfg.TraceID),
+		),
+		grpc.WithChainStreamInterceptor(
+			auth.StreamClientInterceptor(cfg.Token),
+			grpcutil.StreamClientTraceInterceptor(cfg.TraceID),
+		))
 	if err != nil {
 		return nil, log.Err(ctx, err, "Dialing GAPIS")
 	}
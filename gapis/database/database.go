@@ -40,6 +40,29 @@ type Database interface {
 	Contains(context.Context, id.ID) bool
 }
 
+// Stats holds statistics about the content of a database.
+type Stats struct {
+	// Records is the number of records stored.
+	Records int
+	// Size is the total size in bytes of the encoded records held in memory.
+	Size int64
+}
+
+// StatsProvider is the interface implemented by databases that can report
+// statistics about their content.
+type StatsProvider interface {
+	Stats() Stats
+}
+
+// GetStats returns the statistics of the database d, and false if d does not
+// report any.
+func GetStats(d Database) (Stats, bool) {
+	if p, ok := d.(StatsProvider); ok {
+		return p.Stats(), true
+	}
+	return Stats{}, false
+}
+
 // Store stores v to the database held by the context.
 func Store(ctx context.Context, v interface{}) (id.ID, error) {
 	return Get(ctx).Store(ctx, v)
@@ -145,6 +145,7 @@ func (r *record) resolve(ctx context.Context) error {
 type memory struct {
 	mutex      sync.Mutex
 	records    map[id.ID]*record
+	size       int64 // sum of the sizes of the records' encoded data
 	resolveCtx context.Context
 }
 
@@ -187,6 +188,7 @@ func (d *memory) Store(ctx context.Context, val interface{}) (id.ID, error) {
 			d.records[id] = &record{data: nil, ty: ty, object: val, created: getCallstack(4)}
 		} else {
 			d.records[id] = &record{data: data, ty: ty, object: val, created: getCallstack(4)}
+			d.size += int64(len(data))
 		}
 	}
 
@@ -303,6 +305,13 @@ func (d *memory) resolveLocked(ctx context.Context, id id.ID) (interface{}, erro
 	return r.object, nil // Done.
 }
 
+// Implements StatsProvider
+func (d *memory) Stats() Stats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return Stats{Records: len(d.records), Size: d.size}
+}
+
 // Implements Database
 func (d *memory) Contains(ctx context.Context, id id.ID) (res bool) {
 	d.mutex.Lock()
@@ -75,10 +75,12 @@ func getPerfettoConfig(ctx context.Context, device *path.Device) (*perfetto_pb.T
 	return conf, nil
 }
 
-// GpuProfile replays the trace and writes a Perfetto trace of the replay
+// GpuProfile replays the trace and writes a Perfetto trace of the replay.
+// If bundlePath is not empty, the raw profiling data is also saved to a
+// profiling bundle at that path.
 func GpuProfile(ctx context.Context, staticAnalysisResult chan *api.StaticAnalysisProfileData,
 	capturePath *path.Capture, device *path.Device, experiments *service.ProfileExperiments,
-	loopCount int32) (*service.ProfilingData, error) {
+	loopCount int32, bundlePath string) (*service.ProfilingData, error) {
 
 	if device == nil {
 		return nil, errors.New("Replay device is required.")
@@ -120,18 +122,26 @@ func GpuProfile(ctx context.Context, staticAnalysisResult chan *api.StaticAnalys
 		}
 		profilingExperiments.DisabledCmds = disabledCmdsIndices
 		profilingExperiments.DisableAnisotropicFiltering = experiments.DisableAnisotropicFiltering
+		profilingExperiments.SampleSmallestMip = experiments.SampleSmallestMip
+		profilingExperiments.ConstantFragmentShaders = experiments.ConstantFragmentShaders
+		profilingExperiments.NullRasterization = experiments.NullRasterization
+		profilingExperiments.DisableBlending = experiments.DisableBlending
+		profilingExperiments.ForceBaseMipLevel = experiments.ForceBaseMipLevel
 	}
 
 	mgr := GetManager(ctx)
 	hints := &path.UsageHints{Background: true}
 	for _, a := range c.APIs {
 		if pf, ok := a.(Profiler); ok {
-			data, err := pf.QueryProfile(ctx, intent, mgr, staticAnalysisResult, hints, opts, profilingExperiments, loopCount)
+			data, err := pf.QueryProfile(ctx, intent, mgr, staticAnalysisResult, hints, opts, profilingExperiments, loopCount, bundlePath)
 			if err != nil {
 				log.E(ctx, "Replay profiling failed:", err)
 				return nil, log.Err(ctx, err, "Failed to profile the replay.")
 			}
 			log.I(ctx, "Replay profiling finished.")
+			// Report the experiments, so that the data can be told apart from
+			// the baseline.
+			data.Experiments = experiments
 			return data, nil
 		}
 	}
@@ -58,6 +58,21 @@ type QueryTimestamps interface {
 		ctx context.Context,
 		intent Intent,
 		mgr Manager,
+		loopCount int32,
+		handler service.TimeStampsHandler,
+		hints *path.UsageHints) error
+}
+
+// QueryLoopedTimestamps is the interface implemented by types that can
+// replay a range of commands repeatedly and return the timestamps of the
+// execution of the commands of every repetition.
+type QueryLoopedTimestamps interface {
+	QueryLoopedTimestamps(
+		ctx context.Context,
+		intent Intent,
+		mgr Manager,
+		begin, end api.CmdID,
+		loopCount int32,
 		handler service.TimeStampsHandler,
 		hints *path.UsageHints) error
 }
@@ -80,6 +95,18 @@ type QueryFramebufferAttachment interface {
 		hints *path.UsageHints) (*image.Data, error)
 }
 
+// QueryPixelHistory is the interface implemented by types that can return
+// the effect of each draw call over a range of commands on a single pixel of a
+// framebuffer attachment.
+type QueryPixelHistory interface {
+	QueryPixelHistory(
+		ctx context.Context,
+		intent Intent,
+		mgr Manager,
+		p *path.PixelHistory,
+		r *path.ResolveConfig) (*service.PixelHistory, error)
+}
+
 // Profiler is the interface implemented by replays that can be performed
 // in a profiling mode while capturing profiling data.
 type Profiler interface {
@@ -92,7 +119,8 @@ type Profiler interface {
 		hints *path.UsageHints,
 		traceOptions *service.TraceOptions,
 		experiments ProfileExperiments,
-		loopCount int32) (*service.ProfilingData, error)
+		loopCount int32,
+		bundlePath string) (*service.ProfilingData, error)
 }
 
 // Issue represents a single replay issue reported by QueryIssues.
@@ -106,4 +134,9 @@ type Issue struct {
 type ProfileExperiments struct {
 	DisabledCmds                [][]uint64
 	DisableAnisotropicFiltering bool
+	SampleSmallestMip           bool
+	ConstantFragmentShaders     bool
+	NullRasterization           bool
+	DisableBlending             bool
+	ForceBaseMipLevel           bool
 }
@@ -0,0 +1,171 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// LoopReplay replays the capture up to the start of startFrame once, then
+// replays the frames from startFrame to endFrame (inclusive) loopCount times,
+// returning the GPU span of the looped frames in each of the repetitions.
+func LoopReplay(ctx context.Context, capturePath *path.Capture, device *path.Device, startFrame, endFrame uint32, loopCount int32) (*service.LoopReplayResult, error) {
+	c, err := capture.ResolveGraphicsFromPath(ctx, capturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	frameEnds := []api.CmdID{}
+	for i, cmd := range c.Commands {
+		if cmd.CmdFlags().IsEndOfFrame() {
+			frameEnds = append(frameEnds, api.CmdID(i))
+		}
+	}
+	begin, end, err := loopedCommands(ctx, frameEnds, startFrame, endFrame)
+	if err != nil {
+		return nil, err
+	}
+	if loopCount < 1 {
+		loopCount = 1
+	}
+
+	times := newFrameLoopTimes(begin, frameEnds[startFrame:endFrame+1])
+	intent := Intent{
+		Capture: capturePath,
+		Device:  device,
+	}
+	mgr := GetManager(ctx)
+	hints := &path.UsageHints{Background: true}
+	found := false
+	for _, a := range c.APIs {
+		if qi, ok := a.(QueryLoopedTimestamps); ok {
+			found = true
+			if err := qi.QueryLoopedTimestamps(ctx, intent, mgr, begin, end, loopCount, times.add, hints); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !found {
+		return nil, log.Err(ctx, nil, "No API of the capture supports looping replays")
+	}
+
+	return &service.LoopReplayResult{
+		Begin:      capturePath.Command(uint64(begin)),
+		End:        capturePath.Command(uint64(end)),
+		Iterations: times.iterations,
+	}, nil
+}
+
+// loopedCommands returns the first and last commands of the frames from
+// startFrame to endFrame (inclusive), given the last command of every frame
+// of the capture.
+func loopedCommands(ctx context.Context, frameEnds []api.CmdID, startFrame, endFrame uint32) (begin, end api.CmdID, err error) {
+	if startFrame > endFrame {
+		return 0, 0, log.Errf(ctx, nil, "Start frame %v is after end frame %v", startFrame, endFrame)
+	}
+	if int(endFrame) >= len(frameEnds) {
+		return 0, 0, log.Errf(ctx, nil, "End frame %v is out of range, the capture has %v frames", endFrame, len(frameEnds))
+	}
+
+	begin, end = api.CmdID(0), frameEnds[endFrame]
+	if startFrame > 0 {
+		begin = frameEnds[startFrame-1] + 1
+	}
+	if begin >= end {
+		return 0, 0, log.Errf(ctx, nil, "Frames %v to %v have too few commands to be looped", startFrame, endFrame)
+	}
+	return begin, end, nil
+}
+
+// frameLoopTimes turns the command buffer timestamps reported by a looping
+// replay into the GPU span of the frames of each repetition: the time from
+// the earliest begin timestamp to the latest end timestamp of the command
+// buffers submitted in the frame, on any of the queues.
+type frameLoopTimes struct {
+	mutex      sync.Mutex
+	begin      api.CmdID
+	frameEnds  []api.CmdID
+	ranges     *commandRanges
+	seen       []int         // range index -> number of times reported
+	spans      [][]frameSpan // iteration -> frame -> span
+	iterations []*service.LoopIteration
+}
+
+// frameSpan holds the earliest and latest GPU timestamps of a frame.
+type frameSpan struct {
+	first, last uint64
+	valid       bool
+}
+
+func newFrameLoopTimes(begin api.CmdID, frameEnds []api.CmdID) *frameLoopTimes {
+	return &frameLoopTimes{
+		begin:     begin,
+		frameEnds: frameEnds,
+		ranges:    newCommandRanges(),
+	}
+}
+
+// add records the timestamps of r that are within the looped frames. The
+// repetition of a command range is given by the number of times it was
+// reported before, as the results of the different queues may be reported in
+// any order.
+func (l *frameLoopTimes) add(r *service.GetTimestampsResponse) error {
+	ts := r.GetTimestamps()
+	if ts == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, item := range ts.Timestamps {
+		id := api.CmdID(item.GetBegin().GetIndices()[0])
+		if id < l.begin || id > l.frameEnds[len(l.frameEnds)-1] {
+			continue
+		}
+		frame := sort.Search(len(l.frameEnds), func(i int) bool { return l.frameEnds[i] >= id })
+
+		index := l.ranges.index(item)
+		if index == len(l.seen) {
+			l.seen = append(l.seen, 0)
+		}
+		iteration := l.seen[index]
+		l.seen[index]++
+		for len(l.iterations) <= iteration {
+			l.spans = append(l.spans, make([]frameSpan, len(l.frameEnds)))
+			l.iterations = append(l.iterations, &service.LoopIteration{
+				FrameSpanInNanoseconds: make([]uint64, len(l.frameEnds)),
+			})
+		}
+
+		span := &l.spans[iteration][frame]
+		if !span.valid || item.BeginTimestampInNanoseconds < span.first {
+			span.first = item.BeginTimestampInNanoseconds
+		}
+		if !span.valid || item.EndTimestampInNanoseconds > span.last {
+			span.last = item.EndTimestampInNanoseconds
+		}
+		span.valid = true
+		l.iterations[iteration].FrameSpanInNanoseconds[frame] = span.last - span.first
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestLoopedCommands(t *testing.T) {
+	ctx := log.Testing(t)
+	// Frames 0 to 3 end at commands 4, 9, 10 and 15.
+	frameEnds := []api.CmdID{4, 9, 10, 15}
+	for _, test := range []struct {
+		start, end  uint32
+		begin, last api.CmdID
+	}{
+		{0, 0, 0, 4},
+		{1, 1, 5, 9},
+		{1, 3, 5, 15},
+		{3, 3, 11, 15},
+	} {
+		begin, end, err := loopedCommands(ctx, frameEnds, test.start, test.end)
+		if assert.For(ctx, "frames %v to %v", test.start, test.end).ThatError(err).Succeeded() {
+			assert.For(ctx, "frames %v to %v begin", test.start, test.end).That(begin).Equals(test.begin)
+			assert.For(ctx, "frames %v to %v end", test.start, test.end).That(end).Equals(test.last)
+		}
+	}
+
+	for _, test := range []struct {
+		name       string
+		start, end uint32
+	}{
+		{"reversed", 2, 1},
+		{"out of range", 3, 4},
+		{"single command", 2, 2},
+	} {
+		_, _, err := loopedCommands(ctx, frameEnds, test.start, test.end)
+		assert.For(ctx, test.name).ThatError(err).Failed()
+	}
+}
+
+func TestFrameLoopTimes(t *testing.T) {
+	ctx := log.Testing(t)
+	c := &path.Capture{}
+	response := func(items ...*service.TimestampsItem) *service.GetTimestampsResponse {
+		return &service.GetTimestampsResponse{
+			Res: &service.GetTimestampsResponse_Timestamps{Timestamps: &service.Timestamps{Timestamps: items}},
+		}
+	}
+	item := func(id uint64, begin, end uint64) *service.TimestampsItem {
+		return &service.TimestampsItem{
+			Begin:                       c.Command(id, 0, 0, 0),
+			End:                         c.Command(id, 0, 0, 1),
+			TimeInNanoseconds:           end - begin,
+			BeginTimestampInNanoseconds: begin,
+			EndTimestampInNanoseconds:   end,
+		}
+	}
+
+	// Frames 0 and 1 of the range end at commands 14 and 19.
+	times := newFrameLoopTimes(10, []api.CmdID{14, 19})
+	for _, r := range []*service.GetTimestampsResponse{
+		// The commands before the range are ignored.
+		response(item(5, 0, 1000)),
+		// The command buffers of commands 11 and 12 overlap on two queues,
+		// with the GPU idle before the one of command 13.
+		response(item(11, 1000, 1010), item(13, 1050, 1060)),
+		response(item(12, 1005, 1025)),
+		response(item(17, 1100, 1130)),
+		// The second repetition, with a queue reported out of order.
+		response(item(17, 2100, 2135)),
+		response(item(11, 2000, 2012), item(12, 2012, 2034), item(13, 2034, 2040)),
+	} {
+		assert.For(ctx, "add").ThatError(times.add(r)).Succeeded()
+	}
+
+	assert.For(ctx, "iterations").That(len(times.iterations)).Equals(2)
+	assert.For(ctx, "first").ThatSlice(times.iterations[0].FrameSpanInNanoseconds).Equals([]uint64{60, 30})
+	assert.For(ctx, "second").ThatSlice(times.iterations[1].FrameSpanInNanoseconds).Equals([]uint64{40, 35})
+}
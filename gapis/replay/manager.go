@@ -137,6 +137,22 @@ func (m *manager) Replay(
 	return s.Schedule(ctx, req, b)
 }
 
+// QueuedReplays returns the number of replay tasks queued on each device by
+// the manager m, or nil if m does not schedule the replays itself.
+func QueuedReplays(m Manager) map[id.ID]int {
+	mgr, ok := m.(*manager)
+	if !ok {
+		return nil
+	}
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	out := make(map[id.ID]int, len(mgr.schedulers))
+	for device, s := range mgr.schedulers {
+		out[device] = s.NumTasksQueued()
+	}
+	return out
+}
+
 func (m *manager) scheduler(ctx context.Context, deviceID id.ID) (*scheduler.Scheduler, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -80,7 +80,7 @@ func New(ctx context.Context, device id.ID, exec Executor) *Scheduler {
 }
 
 // NumTasksQueued returns the number of queued tasks.
-func (s *Scheduler) NumTasksQueued() int { return int(s.queueLen) }
+func (s *Scheduler) NumTasksQueued() int { return int(atomic.LoadUint32(&s.queueLen)) }
 
 // Schedule schedules t to be executed on s. Tasks with compatible batches may
 // be executed together.
@@ -95,7 +95,7 @@ func (s *Scheduler) Schedule(ctx context.Context, t Task, b Batch) (val interfac
 	r := func(val interface{}, err error) { out <- res{val, err} }
 
 	select {
-	case s.pending <- &job{executable: Executable{t, c, r}, batch: b}:
+	case s.pending <- &job{executable: Executable{t, c, r}, batch: b, traceID: status.GetTraceID(ctx)}:
 	case <-c: // cancelled
 		return nil, task.StopReason(ctx)
 	}
@@ -137,6 +137,7 @@ func (s *Scheduler) run(ctx context.Context) {
 
 		if b, ok := bins[j.batch]; ok {
 			b.jobs = append(b.jobs, j)
+			b.status.AddTraceID(j.traceID)
 		} else {
 			interrupt := reflect.SelectCase{
 				Dir:  reflect.SelectRecv,
@@ -146,7 +147,7 @@ func (s *Scheduler) run(ctx context.Context) {
 				batch:     j.batch,
 				jobs:      []*job{j},
 				interrupt: interrupt,
-				status:    status.ReplayQueued(ctx, atomic.AddUint32(&lastTaskID, 1), s.device),
+				status:    status.ReplayQueued(status.PutTraceID(ctx, j.traceID), atomic.AddUint32(&lastTaskID, 1), s.device),
 			}
 			interrupts = append(interrupts, interrupt)
 		}
@@ -276,6 +277,13 @@ func (b *bin) exec(ctx context.Context, exec Executor) {
 			l = append(l, j.executable)
 		}
 	}
+	// A task, and so the work it starts, belongs to a single trace: the batch
+	// is run, and sent to gapir, as part of the trace of the first request it
+	// serves. The replay status reported to the status listeners lists the
+	// trace IDs of all the batched requests, see status.Replay.TraceIDs.
+	if ids := b.status.TraceIDs(); len(ids) > 0 {
+		ctx = status.PutTraceID(ctx, ids[0])
+	}
 	b.status.Start(ctx)
 	exec(ctx, b.status, l, b.batch)
 	b.status.Finish(ctx)
@@ -285,4 +293,5 @@ type job struct {
 	mutex      sync.Mutex
 	executable Executable
 	batch      Batch
+	traceID    status.TraceID
 }
@@ -16,15 +16,21 @@ package replay
 
 import (
 	"context"
+	"math"
+	"sort"
+	"sync"
 
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
 )
 
-// GetTimestamps replays the trace and return the start and end timestamps for each commandbuffers
-func GetTimestamps(ctx context.Context, capturePath *path.Capture, device *path.Device, handler service.TimeStampsHandler) error {
+// GetTimestamps replays the trace and return the start and end timestamps for each commandbuffers.
+// If loopCount is greater than one, the trace is replayed loopCount times and
+// the timestamps are reported once, with the statistics of all the replays.
+func GetTimestamps(ctx context.Context, capturePath *path.Capture, device *path.Device, loopCount int32, handler service.TimeStampsHandler) error {
 	c, err := capture.ResolveGraphicsFromPath(ctx, capturePath)
 	if err != nil {
 		return err
@@ -40,7 +46,14 @@ func GetTimestamps(ctx context.Context, capturePath *path.Capture, device *path.
 		hints := &path.UsageHints{Background: true}
 		for _, a := range c.APIs {
 			if qi, ok := a.(QueryTimestamps); ok {
-				err = qi.QueryTimestamps(ctx, intent, mgr, handler, hints)
+				if loopCount <= 1 {
+					err = qi.QueryTimestamps(ctx, intent, mgr, loopCount, handler, hints)
+				} else {
+					samples := newTimestampSamples(handler)
+					if err = qi.QueryTimestamps(ctx, intent, mgr, loopCount, samples.add, hints); err == nil {
+						err = handler(samples.response())
+					}
+				}
 				if err != nil {
 					log.E(ctx, "Query timestamps failed.")
 					continue
@@ -51,3 +64,151 @@ func GetTimestamps(ctx context.Context, capturePath *path.Capture, device *path.
 
 	return err
 }
+
+// commandRanges assigns an index to each distinct command range reported
+// by the timestamp queries, in the order they were first reported.
+type commandRanges struct {
+	items     []*service.TimestampsItem // first item reported for each range
+	byCommand map[uint64][]int          // first begin index -> range indices
+}
+
+func newCommandRanges() *commandRanges {
+	return &commandRanges{byCommand: map[uint64][]int{}}
+}
+
+// index returns the index of the command range of item, adding the range if
+// it was not reported before.
+func (r *commandRanges) index(item *service.TimestampsItem) int {
+	begin, end := item.GetBegin().GetIndices(), item.GetEnd().GetIndices()
+	var first uint64
+	if len(begin) > 0 {
+		first = begin[0]
+	}
+	for _, i := range r.byCommand[first] {
+		if api.SubCmdIdx(r.items[i].GetBegin().GetIndices()).Equals(begin) &&
+			api.SubCmdIdx(r.items[i].GetEnd().GetIndices()).Equals(end) {
+			return i
+		}
+	}
+	i := len(r.items)
+	r.items = append(r.items, item)
+	r.byCommand[first] = append(r.byCommand[first], i)
+	return i
+}
+
+// timestampSamples collects the durations of the command ranges reported by
+// repeated replays.
+type timestampSamples struct {
+	handler   service.TimeStampsHandler
+	mutex     sync.Mutex
+	ranges    *commandRanges
+	durations [][]uint64 // range index -> durations
+}
+
+func newTimestampSamples(handler service.TimeStampsHandler) *timestampSamples {
+	return &timestampSamples{
+		handler: handler,
+		ranges:  newCommandRanges(),
+	}
+}
+
+// add records the durations of r. Responses without timestamps are passed on
+// to the handler.
+func (s *timestampSamples) add(r *service.GetTimestampsResponse) error {
+	ts := r.GetTimestamps()
+	if ts == nil {
+		return s.handler(r)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, item := range ts.Timestamps {
+		i := s.ranges.index(item)
+		if i == len(s.durations) {
+			s.durations = append(s.durations, nil)
+		}
+		s.durations[i] = append(s.durations[i], item.TimeInNanoseconds)
+	}
+	return nil
+}
+
+// response returns the command ranges in the order they were first reported,
+// with the statistics of their durations.
+func (s *timestampSamples) response() *service.GetTimestampsResponse {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	timestamps := &service.Timestamps{}
+	for i, item := range s.ranges.items {
+		stats := timestampStatistics(s.durations[i])
+		timestamps.Timestamps = append(timestamps.Timestamps, &service.TimestampsItem{
+			Begin:             item.Begin,
+			End:               item.End,
+			TimeInNanoseconds: stats.MedianInNanoseconds,
+			Statistics:        stats,
+		})
+	}
+	return &service.GetTimestampsResponse{
+		Res: &service.GetTimestampsResponse_Timestamps{Timestamps: timestamps},
+	}
+}
+
+// timestampStatistics returns the statistics of the given durations, after
+// rejecting the outliers outside of Tukey's fences.
+func timestampStatistics(durations []uint64) *service.TimestampsStatistics {
+	if len(durations) == 0 {
+		return &service.TimestampsStatistics{}
+	}
+
+	sorted := append([]uint64{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+	low, high := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+	kept := make([]uint64, 0, len(sorted))
+	for _, d := range sorted {
+		if float64(d) >= low && float64(d) <= high {
+			kept = append(kept, d)
+		}
+	}
+	if len(kept) == 0 {
+		// The median is always within the fences, but keep all the samples
+		// rather than rely on the rounding of the fences.
+		kept = sorted
+	}
+
+	mean := 0.0
+	for _, d := range kept {
+		mean += float64(d)
+	}
+	mean /= float64(len(kept))
+	variance := 0.0
+	for _, d := range kept {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	if len(kept) > 1 {
+		variance /= float64(len(kept) - 1)
+	}
+
+	return &service.TimestampsStatistics{
+		Samples:             uint32(len(kept)),
+		Outliers:            uint32(len(sorted) - len(kept)),
+		MinInNanoseconds:    kept[0],
+		MedianInNanoseconds: uint64(math.Round(quantile(kept, 0.5))),
+		MaxInNanoseconds:    kept[len(kept)-1],
+		MeanInNanoseconds:   mean,
+		StddevInNanoseconds: math.Sqrt(variance),
+	}
+}
+
+// quantile returns the q-th quantile of the sorted values, interpolating
+// linearly between the closest ranks.
+func quantile(sorted []uint64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return float64(sorted[len(sorted)-1])
+	}
+	frac := pos - float64(i)
+	return float64(sorted[i]) + frac*(float64(sorted[i+1])-float64(sorted[i]))
+}
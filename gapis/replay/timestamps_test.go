@@ -0,0 +1,87 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestTimestampStatistics(t *testing.T) {
+	ctx := log.Testing(t)
+	stats := timestampStatistics([]uint64{104, 100, 1000, 102, 101, 103})
+	assert.For(ctx, "samples").That(stats.Samples).Equals(uint32(5))
+	assert.For(ctx, "outliers").That(stats.Outliers).Equals(uint32(1))
+	assert.For(ctx, "min").That(stats.MinInNanoseconds).Equals(uint64(100))
+	assert.For(ctx, "median").That(stats.MedianInNanoseconds).Equals(uint64(102))
+	assert.For(ctx, "max").That(stats.MaxInNanoseconds).Equals(uint64(104))
+	assert.For(ctx, "mean").That(stats.MeanInNanoseconds).Equals(102.0)
+	assert.For(ctx, "stddev").ThatFloat(stats.StddevInNanoseconds).IsAtMost(1.59)
+	assert.For(ctx, "stddev").ThatFloat(stats.StddevInNanoseconds).IsAtLeast(1.58)
+
+	single := timestampStatistics([]uint64{42})
+	assert.For(ctx, "single median").That(single.MedianInNanoseconds).Equals(uint64(42))
+	assert.For(ctx, "single stddev").That(single.StddevInNanoseconds).Equals(0.0)
+
+	empty := timestampStatistics(nil)
+	assert.For(ctx, "empty samples").That(empty.Samples).Equals(uint32(0))
+}
+
+func TestTimestampSamples(t *testing.T) {
+	ctx := log.Testing(t)
+	c := &path.Capture{}
+	response := func(durations ...uint64) *service.GetTimestampsResponse {
+		ts := &service.Timestamps{}
+		for i, d := range durations {
+			ts.Timestamps = append(ts.Timestamps, &service.TimestampsItem{
+				Begin:             c.Command(uint64(i)),
+				End:               c.Command(uint64(i + 1)),
+				TimeInNanoseconds: d,
+			})
+		}
+		return &service.GetTimestampsResponse{Res: &service.GetTimestampsResponse_Timestamps{Timestamps: ts}}
+	}
+
+	samples := newTimestampSamples(nil)
+	for _, r := range []*service.GetTimestampsResponse{response(10, 20), response(12, 22), response(11, 21)} {
+		assert.For(ctx, "add").ThatError(samples.add(r)).Succeeded()
+	}
+	items := samples.response().GetTimestamps().Timestamps
+	assert.For(ctx, "items").That(len(items)).Equals(2)
+	assert.For(ctx, "first").That(items[0].TimeInNanoseconds).Equals(uint64(11))
+	assert.For(ctx, "second").That(items[1].TimeInNanoseconds).Equals(uint64(21))
+	assert.For(ctx, "samples").That(items[1].Statistics.Samples).Equals(uint32(3))
+}
+
+func TestCommandRanges(t *testing.T) {
+	ctx := log.Testing(t)
+	c := &path.Capture{}
+	item := func(begin, end *path.Command) *service.TimestampsItem {
+		return &service.TimestampsItem{Begin: begin, End: end}
+	}
+
+	ranges := newCommandRanges()
+	assert.For(ctx, "first").That(ranges.index(item(c.Command(1, 0), c.Command(1, 2)))).Equals(0)
+	assert.For(ctx, "other end").That(ranges.index(item(c.Command(1, 0), c.Command(1, 3)))).Equals(1)
+	// Ranges of the same first command differ by their other indices.
+	assert.For(ctx, "other depth").That(ranges.index(item(c.Command(1), c.Command(0, 1, 2)))).Equals(2)
+	assert.For(ctx, "other command").That(ranges.index(item(c.Command(2, 0), c.Command(2, 2)))).Equals(3)
+	assert.For(ctx, "repeated").That(ranges.index(item(c.Command(1, 0), c.Command(1, 3)))).Equals(1)
+	assert.For(ctx, "ranges").That(len(ranges.items)).Equals(4)
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// DiffCaptures returns the differences between the capture child and the
+// capture parent it was derived from.
+//
+// Edits share the unchanged commands and initial state of the parent capture,
+// so commands and initial states are compared by identity.
+func DiffCaptures(ctx context.Context, parent, child *path.Capture) (*service.CaptureDiff, error) {
+	pc, err := capture.ResolveGraphicsFromPath(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := capture.ResolveGraphicsFromPath(ctx, child)
+	if err != nil {
+		return nil, err
+	}
+
+	keptParent, keptChild := commonCommands(pc.Commands, cc.Commands)
+
+	out := &service.CaptureDiff{
+		Parent:              parent,
+		Child:               child,
+		InitialStateChanged: pc.InitialState != cc.InitialState,
+	}
+	for i := range pc.Commands {
+		if !keptParent[i] {
+			out.Removed = append(out.Removed, parent.Command(uint64(i)))
+		}
+	}
+	for i := range cc.Commands {
+		if !keptChild[i] {
+			out.Added = append(out.Added, child.Command(uint64(i)))
+		}
+	}
+	return out, nil
+}
+
+// commonCommands returns the indices of the longest sequence of commands
+// present in the same order in both a and b.
+func commonCommands(a, b []api.Cmd) (keptA, keptB map[int]bool) {
+	indices := make(map[api.Cmd]int, len(a))
+	for i, cmd := range a {
+		indices[cmd] = i
+	}
+
+	// Find the longest increasing subsequence of the indices in a of the
+	// commands of b.
+	type pair struct{ a, b, prev int }
+	pairs := []pair{}
+	tails := []int{} // Index in pairs of the smallest tail of each length.
+	for j, cmd := range b {
+		i, ok := indices[cmd]
+		if !ok {
+			continue
+		}
+		n := sort.Search(len(tails), func(k int) bool { return pairs[tails[k]].a >= i })
+		prev := -1
+		if n > 0 {
+			prev = tails[n-1]
+		}
+		pairs = append(pairs, pair{i, j, prev})
+		if n == len(tails) {
+			tails = append(tails, len(pairs)-1)
+		} else {
+			tails[n] = len(pairs) - 1
+		}
+	}
+
+	keptA, keptB = map[int]bool{}, map[int]bool{}
+	if len(tails) > 0 {
+		for k := tails[len(tails)-1]; k >= 0; k = pairs[k].prev {
+			keptA[pairs[k].a], keptB[pairs[k].b] = true, true
+		}
+	}
+	return keptA, keptB
+}
@@ -0,0 +1,57 @@
+// Copyright (C) 2019 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License")
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestDiffCaptures(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = bind.PutRegistry(ctx, bind.NewRegistry())
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	p := createMultipleCommandTrace(ctx)
+	ctx = capture.Put(ctx, p)
+
+	deleted, err := Delete(ctx, p.Command(1).Path(), nil)
+	assert.For(ctx, "Delete").ThatError(err).Succeeded()
+	moved, err := Move(ctx, p.Command(0), p.Command(2), nil)
+	assert.For(ctx, "Move").ThatError(err).Succeeded()
+
+	for _, test := range []struct {
+		name    string
+		child   *path.Capture
+		removed []*path.Command
+		added   []*path.Command
+	}{
+		{"Unchanged", p, nil, nil},
+		{"Delete", deleted.GetCapture(), []*path.Command{p.Command(1)}, nil},
+		{"Move", moved.Capture, []*path.Command{p.Command(0)}, []*path.Command{moved.Capture.Command(2)}},
+	} {
+		diff, err := DiffCaptures(ctx, p, test.child)
+		assert.For(ctx, "%v: DiffCaptures", test.name).ThatError(err).Succeeded()
+		assert.For(ctx, "%v: Removed", test.name).That(diff.Removed).DeepEquals(test.removed)
+		assert.For(ctx, "%v: Added", test.name).That(diff.Added).DeepEquals(test.added)
+		assert.For(ctx, "%v: InitialStateChanged", test.name).That(diff.InitialStateChanged).Equals(false)
+	}
+}
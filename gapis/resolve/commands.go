@@ -81,47 +81,30 @@ func NCmds(ctx context.Context, p *path.Capture, n uint64) ([]api.Cmd, error) {
 func Cmd(ctx context.Context, p *path.Command, r *path.ResolveConfig) (api.Cmd, error) {
 	cmdIdx := p.Indices[0]
 	if len(p.Indices) > 1 {
-		snc, err := SyncData(ctx, p.Capture)
+		ref, err := subcommandReference(ctx, p)
 		if err != nil {
 			return nil, err
 		}
+		cmdIdx = uint64(ref.GeneratingCmd)
+		if cmdIdx == uint64(api.CmdNoID) {
+			capture, err := capture.ResolveGraphicsFromPath(ctx, p.Capture)
+			if err != nil {
+				return nil, err
+			}
 
-		sg, ok := snc.SubcommandReferences[api.CmdID(cmdIdx)]
-		if !ok {
-			return nil, log.Errf(ctx, nil, "Could not find any subcommands on %v", cmdIdx)
-		}
-
-		idx := append(api.SubCmdIdx{}, p.Indices[1:]...)
-		found := false
-		for _, v := range sg {
-			if v.Index.Equals(idx) {
-				found = true
-				cmdIdx = uint64(v.GeneratingCmd)
-				if cmdIdx == uint64(api.CmdNoID) {
-					capture, err := capture.ResolveGraphicsFromPath(ctx, p.Capture)
+			for _, api := range capture.APIs {
+				if snc, ok := api.(sync.SynchronizedAPI); ok {
+					a, err := snc.RecoverMidExecutionCommand(ctx, p.Capture, ref.MidExecutionCommandData)
 					if err != nil {
-						return nil, err
-					}
-
-					for _, api := range capture.APIs {
-						if snc, ok := api.(sync.SynchronizedAPI); ok {
-							a, err := snc.RecoverMidExecutionCommand(ctx, p.Capture, v.MidExecutionCommandData)
-							if err != nil {
-								if _, ok := err.(sync.NoMECSubcommandsError); !ok {
-									return nil, err
-								}
-							} else {
-								return a, nil
-							}
+						if _, ok := err.(sync.NoMECSubcommandsError); !ok {
+							return nil, err
 						}
+					} else {
+						return a, nil
 					}
-					cmdIdx = 0
 				}
-				break
 			}
-		}
-		if !found {
-			return nil, &service.ErrDataUnavailable{Reason: messages.ErrMessage("Not a valid subcommand")}
+			cmdIdx = 0
 		}
 	}
 	cmds, err := NCmds(ctx, p.Capture, cmdIdx+1)
@@ -131,6 +114,53 @@ func Cmd(ctx context.Context, p *path.Command, r *path.ResolveConfig) (api.Cmd,
 	return cmds[cmdIdx], nil
 }
 
+// subcommandReference returns the reference to the subcommand at p, which
+// has more than one index.
+func subcommandReference(ctx context.Context, p *path.Command) (sync.SubcommandReference, error) {
+	cmdIdx := p.Indices[0]
+	snc, err := SyncData(ctx, p.Capture)
+	if err != nil {
+		return sync.SubcommandReference{}, err
+	}
+
+	sg, ok := snc.SubcommandReferences[api.CmdID(cmdIdx)]
+	if !ok {
+		return sync.SubcommandReference{}, log.Errf(ctx, nil, "Could not find any subcommands on %v", cmdIdx)
+	}
+
+	idx := append(api.SubCmdIdx{}, p.Indices[1:]...)
+	for _, v := range sg {
+		if v.Index.Equals(idx) {
+			return v, nil
+		}
+	}
+	return sync.SubcommandReference{}, &service.ErrDataUnavailable{Reason: messages.ErrMessage("Not a valid subcommand")}
+}
+
+// recordingCmdIndex returns the index in the capture of the command that
+// holds the command at p. For a top-level command, this is the command
+// itself. For a subcommand, this is the command that recorded it into its
+// command buffer, such as a vkCmdDraw. Editing this command affects every
+// execution of the command buffer. Subcommands of command buffers recorded
+// before the start of the capture are part of the initial state, and have no
+// such command.
+func recordingCmdIndex(ctx context.Context, p *path.Command) (uint64, error) {
+	if len(p.Indices) == 1 {
+		return p.Indices[0], nil
+	}
+	ref, err := subcommandReference(ctx, p)
+	if err != nil {
+		return 0, err
+	}
+	if ref.GeneratingCmd == api.CmdNoID {
+		return 0, &service.ErrInvalidPath{
+			Reason: messages.ErrMessage("Cannot modify a subcommand recorded before the start of the capture"),
+			Path:   p.Path(),
+		}
+	}
+	return uint64(ref.GeneratingCmd), nil
+}
+
 // Parameter resolves and returns the parameter from the path p.
 func Parameter(ctx context.Context, p *path.Parameter, r *path.ResolveConfig) (interface{}, error) {
 	obj, err := ResolveInternal(ctx, p.Parent(), r)
@@ -28,6 +28,9 @@ import (
 // Delete creates a copy of the capture referenced by p, but without the object, value
 // or memory at p. The path returned is identical to p, but with
 // the base changed to refer to the new capture.
+// Deleting a subcommand deletes the command that recorded it, such as a
+// vkCmdDraw, which removes it from every submission of its command buffer.
+// Subcommands recorded before the start of the capture cannot be deleted.
 func Delete(ctx context.Context, p *path.Any, r *path.ResolveConfig) (*path.Any, error) {
 	obj, err := database.Build(ctx, &DeleteResolvable{Path: p, Config: r})
 	if err != nil {
@@ -52,12 +55,14 @@ func (r *DeleteResolvable) Resolve(ctx context.Context) (interface{}, error) {
 func deleteCommand(ctx context.Context, p path.Node) (*path.Capture, error) {
 	switch p := p.(type) {
 	case *path.Command:
-		if len(p.Indices) > 1 {
-			return nil, fmt.Errorf("Cannot modify subcommands") // TODO: Subcommands
+		// Subcommands are deleted by removing the command that recorded them.
+		// The synchronization data of the new capture no longer references
+		// them.
+		cmdIdx, err := recordingCmdIndex(ctx, p)
+		if err != nil {
+			return nil, err
 		}
 
-		cmdIdx := p.Indices[0]
-
 		// Resolve the command list
 		oldCmds, err := NCmds(ctx, p.Capture, cmdIdx+1)
 		if err != nil {
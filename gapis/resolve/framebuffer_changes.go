@@ -46,6 +46,9 @@ type AttachmentFramebufferChanges struct {
 // Get returns the framebuffer dimensions and format after a given command in
 // the given capture, command and attachment.
 func (c AttachmentFramebufferChanges) Get(ctx context.Context, after *path.Command, att uint32) (FramebufferAttachmentInfo, error) {
+	if att >= uint32(len(c.attachments)) {
+		return FramebufferAttachmentInfo{}, &service.ErrDataUnavailable{Reason: messages.ErrFramebufferUnavailable()}
+	}
 	info, err := c.attachments[att].after(ctx, api.SubCmdIdx(after.Indices))
 	if err != nil {
 		return FramebufferAttachmentInfo{}, err
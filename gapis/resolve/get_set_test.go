@@ -212,8 +212,10 @@ func TestSet(t *testing.T) {
 		{cB.Parameter("Ptr"), test.Voidᵖ(0x2222222), nil},
 		// {cB.Result(), uint32(7), nil}, // TODO: 'Unknown path type *path.Result'
 
-		// Test the state cannot be mutated (current restriction)
-		{cA.StateAfter(), nil, fmt.Errorf("State can not currently be mutated")},
+		// Test the state cannot be replaced as a whole
+		{cA.StateAfter(), nil, fmt.Errorf("State can not be replaced, set its fields instead")},
+		// Test the state can only be edited by APIs that implement StateEditor
+		{sB.Field("Map").MapIndex("cat").Field("Object").Field("value"), uint32(300), fmt.Errorf("The test API does not support state edits")},
 
 		// Test invalid paths
 		{p.Command(5), nil, &service.ErrInvalidPath{
@@ -290,3 +292,67 @@ func TestSet(t *testing.T) {
 		}
 	}
 }
+
+func newInitialStateTest(ctx context.Context) *path.Capture {
+	cb := test.CommandBuilder{}
+	s := api.NewStateWithEmptyAllocator(device.WindowsX86_64.MemoryLayout)
+	err := api.MutateCmds(ctx, s, nil, nil, cb.CmdMake(4), cb.PrimeState(test.U8ᵖ(0x89abcdef)))
+	if err != nil {
+		log.F(ctx, true, "Couldn't build the initial state: %v", err)
+	}
+	is := &capture.InitialState{APIs: map[api.API]api.State{test.API{}: s.APIs[test.API{}.ID()]}}
+
+	h := &capture.Header{ABI: device.WindowsX86_64}
+	cmds := []api.Cmd{
+		cb.CmdTypeMix(0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, true, test.Voidᵖ(0x12345678), 2),
+	}
+	c, err := capture.NewGraphicsCapture(ctx, "test", h, is, cmds)
+	if err != nil {
+		log.F(ctx, true, "Couldn't create capture: %v", err)
+	}
+	path, err := c.Path(ctx)
+	if err != nil {
+		log.F(ctx, true, "Couldn't get capture path: %v", err)
+	}
+	return path
+}
+
+func TestSetInitialState(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = bind.PutRegistry(ctx, bind.NewRegistry())
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	p := newInitialStateTest(ctx)
+	ctx = capture.Put(ctx, p)
+	initial := func(c *path.Capture) *path.State {
+		return (&path.Command{Capture: c, Indices: []uint64{uint64(api.CmdNoID)}}).StateAfter()
+	}
+
+	// Edit a field and the contents of a memory slice of the initial state.
+	changed, err := Set(ctx, initial(p).Field("Map").MapIndex("cat").Field("Object").Field("value").Path(), uint32(300), nil)
+	assert.For(ctx, "Set field").ThatError(err).Succeeded()
+	changed, err = Set(ctx, initial(path.FindCapture(changed.Node())).Field("U8s").ArrayIndex(1).Path(), []byte{7, 8}, nil)
+	assert.For(ctx, "Set memory").ThatError(err).Succeeded()
+	c := path.FindCapture(changed.Node())
+
+	// Check the state resolved after the first command reflects the edits.
+	value := func(c *path.Capture) *path.Field {
+		return c.Command(0).StateAfter().Field("Map").MapIndex("cat").Field("Object").Field("value")
+	}
+	got, err := Get(ctx, value(c).Path(), nil)
+	assert.For(ctx, "Get field").ThatError(err).Succeeded()
+	assert.For(ctx, "Edited field").That(got).Equals(uint32(300))
+	got, err = Get(ctx, value(p).Path(), nil)
+	assert.For(ctx, "Get old field").ThatError(err).Succeeded()
+	assert.For(ctx, "Old field").That(got).Equals(uint32(100))
+
+	s, err := GlobalState(ctx, c.Command(0).GlobalStateAfter(), nil)
+	assert.For(ctx, "GlobalState").ThatError(err).Succeeded()
+	data, err := test.GetState(s).U8s().Read(ctx, nil, s, nil)
+	assert.For(ctx, "Read memory").ThatError(err).Succeeded()
+	assert.For(ctx, "Edited memory").ThatSlice(data).Equals([]byte{0, 7, 8, 0})
+
+	// Check the memory edits are bounded by the slice.
+	_, err = Set(ctx, initial(c).Field("U8s").ArrayIndex(3).Path(), []byte{1, 2}, nil)
+	assert.For(ctx, "Set past the slice").ThatError(err).Failed()
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Insert creates a copy of the capture referenced by p, but with the command
+// cmd inserted at p. The memory read and written by the command's pointer
+// parameters is described by obs. The path returned refers to the inserted
+// command in the new capture.
+func Insert(ctx context.Context, p *path.Command, cmd *api.Command, obs []*service.CommandObservation, r *path.ResolveConfig) (*path.Command, error) {
+	obj, err := database.Build(ctx, &InsertResolvable{Path: p, Command: cmd, Observations: obs, Config: r})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*path.Command), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *InsertResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = SetupContext(ctx, r.Path.Capture, r.Config)
+
+	if len(r.Path.Indices) != 1 {
+		return nil, fmt.Errorf("Commands can only be inserted at the top level")
+	}
+
+	cmd, err := serviceToCmd(r.Command)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range r.Observations {
+		id, err := database.Store(ctx, o.Data)
+		if err != nil {
+			return nil, err
+		}
+		rng := memory.Range{Base: o.Base, Size: uint64(len(o.Data))}
+		if o.Write {
+			cmd.Extras().GetOrAppendObservations().AddWrite(rng, id)
+		} else {
+			cmd.Extras().GetOrAppendObservations().AddRead(rng, id)
+		}
+	}
+
+	oldCmds, err := Cmds(ctx, r.Path.Capture)
+	if err != nil {
+		return nil, err
+	}
+
+	// Inserting at the end of the command list appends the command.
+	cmdIdx := r.Path.Indices[0]
+	if count := uint64(len(oldCmds)); cmdIdx > count {
+		return nil, errPathOOB(cmdIdx, "Index", 0, count, r.Path)
+	}
+
+	cmds := make([]api.Cmd, 0, len(oldCmds)+1)
+	cmds = append(cmds, oldCmds[:cmdIdx]...)
+	cmds = append(cmds, cmd)
+	cmds = append(cmds, oldCmds[cmdIdx:]...)
+
+	c, err := changeCommands(ctx, r.Path.Capture, cmds)
+	if err != nil {
+		return nil, err
+	}
+	return &path.Command{Capture: c, Indices: []uint64{cmdIdx}}, nil
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2019 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License")
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestInsertCommand(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = bind.PutRegistry(ctx, bind.NewRegistry())
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	p := createMultipleCommandTrace(ctx)
+	ctx = capture.Put(ctx, p)
+
+	commandPathsBoxed, _ := Get(ctx, p.Commands().Path(), nil)
+	commandPaths := commandPathsBoxed.(*service.Commands).List
+
+	var commands []*api.Command
+
+	for i := 0; i < len(commandPaths); i++ {
+		command, _ := Get(ctx, commandPaths[i].Path(), nil)
+		commands = append(commands, command.(*api.Command))
+	}
+
+	obs := []*service.CommandObservation{
+		{Base: 0x12345678, Data: []byte{1, 2, 3, 4}},
+	}
+	newCommandPath, err := Insert(ctx, p.Command(1), commands[2], obs, nil)
+	assert.For(ctx, "Insert").ThatError(err).DeepEquals(nil)
+	assert.For(ctx, "Inserted index").That(newCommandPath.Indices).DeepEquals([]uint64{1})
+
+	newCapture := newCommandPath.Capture
+	newBoxedCommands, err := Get(ctx, newCapture.Commands().Path(), nil)
+	newCommands := newBoxedCommands.(*service.Commands).List
+
+	assert.For(ctx, "Inserted Commands").That(len(newCommands)).DeepEquals(len(commandPaths) + 1)
+
+	expected := []*api.Command{commands[0], commands[2], commands[1], commands[2]}
+	for i, test := range newCommands {
+		boxedCommand, err := Get(ctx, test.Path(), nil)
+		command := boxedCommand.(*api.Command)
+		assert.For(ctx, "Get(%v) value", test).That(command).DeepEquals(expected[i])
+		assert.For(ctx, "Get(%v) error", test).That(err).DeepEquals(nil)
+	}
+
+	cmd, err := Cmd(ctx, newCommandPath, nil)
+	assert.For(ctx, "Cmd").ThatError(err).DeepEquals(nil)
+	reads := cmd.Extras().Observations().Reads
+	assert.For(ctx, "Reads").That(len(reads)).Equals(1)
+	assert.For(ctx, "Read range").That(reads[0].Range).Equals(memory.Range{Base: 0x12345678, Size: 4})
+}
+
+func TestInsertCommandOutOfBounds(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = bind.PutRegistry(ctx, bind.NewRegistry())
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	p := createSingleCommandTrace(ctx)
+	ctx = capture.Put(ctx, p)
+
+	command, _ := Get(ctx, p.Command(0).Path(), nil)
+
+	_, err := Insert(ctx, p.Command(1), command.(*api.Command), nil, nil)
+	assert.For(ctx, "Append").ThatError(err).DeepEquals(nil)
+
+	_, err = Insert(ctx, p.Command(2), command.(*api.Command), nil, nil)
+	assert.For(ctx, "Insert").ThatError(err).DeepEquals(
+		errPathOOB(2, "Index", 0, 1, p.Command(2)))
+
+	_, err = Insert(ctx, &path.Command{Capture: p, Indices: []uint64{0, 1}}, command.(*api.Command), nil, nil)
+	assert.For(ctx, "Insert subcommand").ThatError(err).Failed()
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Move creates a copy of the capture referenced by from, but with the command
+// at from moved to the index of to. The path returned refers to the moved
+// command in the new capture.
+func Move(ctx context.Context, from, to *path.Command, r *path.ResolveConfig) (*path.Command, error) {
+	obj, err := database.Build(ctx, &MoveResolvable{From: from, To: to, Config: r})
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*path.Command), nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *MoveResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	ctx = SetupContext(ctx, r.From.Capture, r.Config)
+
+	if len(r.From.Indices) != 1 || len(r.To.Indices) != 1 {
+		return nil, fmt.Errorf("Only top-level commands can be moved")
+	}
+	if r.From.Capture.ID.ID() != r.To.Capture.ID.ID() {
+		return nil, fmt.Errorf("Commands can only be moved within a capture")
+	}
+
+	oldCmds, err := Cmds(ctx, r.From.Capture)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := r.From.Indices[0], r.To.Indices[0]
+	count := uint64(len(oldCmds))
+	if from >= count {
+		return nil, errPathOOB(from, "Index", 0, count-1, r.From)
+	}
+	if to >= count {
+		return nil, errPathOOB(to, "Index", 0, count-1, r.To)
+	}
+
+	cmds := removeCommandFromList(from, oldCmds)
+	cmds = append(cmds[:to], append([]api.Cmd{oldCmds[from]}, cmds[to:]...)...)
+
+	c, err := changeCommands(ctx, r.From.Capture, cmds)
+	if err != nil {
+		return nil, err
+	}
+	return &path.Command{Capture: c, Indices: []uint64{to}}, nil
+}
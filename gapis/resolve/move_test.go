@@ -0,0 +1,75 @@
+// Copyright (C) 2019 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License")
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestMoveCommand(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = bind.PutRegistry(ctx, bind.NewRegistry())
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+
+	p := createMultipleCommandTrace(ctx)
+	ctx = capture.Put(ctx, p)
+
+	commandPathsBoxed, _ := Get(ctx, p.Commands().Path(), nil)
+	commandPaths := commandPathsBoxed.(*service.Commands).List
+
+	var commands []*api.Command
+
+	for i := 0; i < len(commandPaths); i++ {
+		command, _ := Get(ctx, commandPaths[i].Path(), nil)
+		commands = append(commands, command.(*api.Command))
+	}
+
+	for _, test := range []struct {
+		from, to uint64
+		expected []*api.Command
+	}{
+		{0, 2, []*api.Command{commands[1], commands[2], commands[0]}},
+		{2, 0, []*api.Command{commands[2], commands[0], commands[1]}},
+		{1, 1, []*api.Command{commands[0], commands[1], commands[2]}},
+	} {
+		newCommandPath, err := Move(ctx, p.Command(test.from), p.Command(test.to), nil)
+		assert.For(ctx, "Move(%v, %v)", test.from, test.to).ThatError(err).DeepEquals(nil)
+		assert.For(ctx, "Moved index").That(newCommandPath.Indices).DeepEquals([]uint64{test.to})
+
+		newBoxedCommands, err := Get(ctx, newCommandPath.Capture.Commands().Path(), nil)
+		newCommands := newBoxedCommands.(*service.Commands).List
+
+		assert.For(ctx, "Moved Commands").That(len(newCommands)).DeepEquals(len(commandPaths))
+
+		for i, c := range newCommands {
+			boxedCommand, err := Get(ctx, c.Path(), nil)
+			command := boxedCommand.(*api.Command)
+			assert.For(ctx, "Get(%v) value", c).That(command).DeepEquals(test.expected[i])
+			assert.For(ctx, "Get(%v) error", c).That(err).DeepEquals(nil)
+		}
+	}
+
+	_, err := Move(ctx, p.Command(0), p.Command(3), nil)
+	assert.For(ctx, "Move out of bounds").ThatError(err).DeepEquals(
+		errPathOOB(3, "Index", 0, 2, p.Command(3)))
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/replay/devices"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// PixelHistory resolves the effect of each draw call in a range of commands
+// on a single pixel of a framebuffer attachment.
+func PixelHistory(ctx context.Context, p *path.PixelHistory, r *path.ResolveConfig) (interface{}, error) {
+	if r.ReplayDevice == nil {
+		devices, compatibilities, _, err := devices.ForReplay(ctx, p.Commands.Capture)
+		if err != nil {
+			return nil, err
+		}
+		if len(compatibilities) == 0 || !compatibilities[0] {
+			return nil, fmt.Errorf("No compatible device found")
+		}
+		r.ReplayDevice = devices[0]
+	}
+
+	obj, err := database.Build(ctx, &PixelHistoryResolvable{Path: p, Config: r})
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Resolve implements the database.Resolver interface.
+func (r *PixelHistoryResolvable) Resolve(ctx context.Context) (interface{}, error) {
+	c := r.Path.Commands.Capture
+	ctx = SetupContext(ctx, c, r.Config)
+
+	last, err := Cmd(ctx, r.Path.Commands.Last(), r.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	a := last.API()
+	if a == nil {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrFramebufferUnavailable()}
+	}
+
+	query, ok := a.(replay.QueryPixelHistory)
+	if !ok {
+		log.E(ctx, "API %s does not implement QueryPixelHistory", a.Name())
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrFramebufferUnavailable()}
+	}
+
+	intent := replay.Intent{
+		Device:  r.Config.ReplayDevice,
+		Capture: c,
+	}
+	res, err := query.QueryPixelHistory(ctx, intent, replay.GetManager(ctx), r.Path, r.Config)
+	if err != nil {
+		if _, ok := err.(*service.ErrDataUnavailable); ok {
+			return nil, err
+		}
+		return nil, log.Err(ctx, err, "Couldn't get pixel history")
+	}
+	return res, nil
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/trace/android/profile"
+)
+
+// sameProfileGroup returns whether the groups a and b of profiles of
+// different replays, which may have different group ids and capture ids,
+// are the same group.
+func sameProfileGroup(a, b *service.ProfilingData_Group) bool {
+	return a.Name == b.Name &&
+		reflect.DeepEqual(a.GetLink().GetFrom(), b.GetLink().GetFrom()) &&
+		reflect.DeepEqual(a.GetLink().GetTo(), b.GetLink().GetTo())
+}
+
+// groupValues holds the estimated metric values of a profiling group.
+type groupValues struct {
+	gpuTime    float64
+	hasGpuTime bool
+	counters   map[string]float64 // metric name -> value
+}
+
+// profileValues returns the estimated metric values of each group of the
+// profile, keyed by group id.
+func profileValues(data *service.ProfilingData) map[int32]*groupValues {
+	names := map[int32]string{}
+	for _, m := range data.GetGpuCounters().GetMetrics() {
+		names[m.Id] = m.Name
+	}
+	out := map[int32]*groupValues{}
+	for _, e := range data.GetGpuCounters().GetEntries() {
+		values, ok := out[e.GroupId]
+		if !ok {
+			values = &groupValues{counters: map[string]float64{}}
+			out[e.GroupId] = values
+		}
+		for id, perf := range e.MetricToValue {
+			if id == profile.GpuTimeMetricId {
+				values.gpuTime, values.hasGpuTime = perf.Estimate, true
+			} else if name, ok := names[id]; ok {
+				values.counters[name] = perf.Estimate
+			}
+		}
+	}
+	return out
+}
+
+// gpuTimeMetricName returns the name of the built-in GPU time metric of the
+// profile.
+func gpuTimeMetricName(data *service.ProfilingData) string {
+	for _, m := range data.GetGpuCounters().GetMetrics() {
+		if m.Id == profile.GpuTimeMetricId {
+			return m.Name
+		}
+	}
+	return ""
+}
+
+func newMetricDelta(name, unit string, baseline, current float64) *service.ProfileComparison_MetricDelta {
+	d := &service.ProfileComparison_MetricDelta{
+		Name:     name,
+		Unit:     unit,
+		Baseline: baseline,
+		Current:  current,
+		Delta:    current - baseline,
+	}
+	if baseline != 0 {
+		d.RelativeDelta = d.Delta / baseline
+	}
+	return d
+}
+
+// CompareProfiles resolves the differences between two profiling results.
+// Groups are matched by their name and command indices, the GPU time by its
+// metric id and the other metrics by their name. Metrics that only have a
+// value in one of the two profiles are ignored.
+func CompareProfiles(ctx context.Context, baseline, current *service.ProfilingData) (*service.ProfileComparison, error) {
+	if baseline == nil || current == nil {
+		return nil, log.Err(ctx, nil, "Two profiles are required for a comparison")
+	}
+
+	baselineGroups := map[string][]*service.ProfilingData_Group{}
+	for _, g := range baseline.Groups {
+		baselineGroups[g.Name] = append(baselineGroups[g.Name], g)
+	}
+
+	units := map[string]string{}
+	for _, m := range current.GetGpuCounters().GetMetrics() {
+		units[m.Name] = m.Unit
+	}
+	gpuTime := gpuTimeMetricName(current)
+
+	baselineValues, currentValues := profileValues(baseline), profileValues(current)
+	out := &service.ProfileComparison{}
+	matched := map[*service.ProfilingData_Group]bool{}
+	for _, g := range current.Groups {
+		var b *service.ProfilingData_Group
+		for _, candidate := range baselineGroups[g.Name] {
+			if !matched[candidate] && sameProfileGroup(candidate, g) {
+				b = candidate
+				break
+			}
+		}
+		if b == nil {
+			out.CurrentOnly = append(out.CurrentOnly, g)
+			continue
+		}
+		matched[b] = true
+
+		delta := &service.ProfileComparison_GroupDelta{
+			Name:            g.Name,
+			Link:            g.Link,
+			BaselineGroupId: b.Id,
+			CurrentGroupId:  g.Id,
+		}
+		bv, cv := baselineValues[b.Id], currentValues[g.Id]
+		if bv == nil || cv == nil {
+			out.Groups = append(out.Groups, delta)
+			continue
+		}
+		if bv.hasGpuTime && cv.hasGpuTime {
+			delta.GpuTime = newMetricDelta(gpuTime, units[gpuTime], bv.gpuTime, cv.gpuTime)
+		}
+		names := make([]string, 0, len(cv.counters))
+		for name := range cv.counters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			before, ok := bv.counters[name]
+			if !ok {
+				continue
+			}
+			delta.Counters = append(delta.Counters, newMetricDelta(name, units[name], before, cv.counters[name]))
+		}
+		out.Groups = append(out.Groups, delta)
+	}
+
+	for _, g := range baseline.Groups {
+		if !matched[g] {
+			out.BaselineOnly = append(out.BaselineOnly, g)
+		}
+	}
+
+	sort.SliceStable(out.Groups, func(i, j int) bool {
+		return out.Groups[i].GetGpuTime().GetDelta() > out.Groups[j].GetGpuTime().GetDelta()
+	})
+	return out, nil
+}
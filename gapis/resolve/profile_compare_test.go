@@ -0,0 +1,107 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func testProfile(capture *path.Capture, groups []string, gpuTimes, aluCycles []float64) *service.ProfilingData {
+	data := &service.ProfilingData{
+		GpuCounters: &service.ProfilingData_GpuCounters{
+			Metrics: []*service.ProfilingData_GpuCounters_Metric{
+				{Id: 0, Name: "GPU Time"},
+				{Id: 2, Name: "ALU Cycles"},
+			},
+		},
+	}
+	for i, name := range groups {
+		id := int32(i + 1)
+		data.Groups = append(data.Groups, &service.ProfilingData_Group{
+			Id:   id,
+			Name: name,
+			Link: &path.Commands{Capture: capture, From: []uint64{uint64(i)}, To: []uint64{uint64(i)}},
+		})
+		data.GpuCounters.Entries = append(data.GpuCounters.Entries, &service.ProfilingData_GpuCounters_Entry{
+			GroupId: id,
+			MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+				0: {Estimate: gpuTimes[i]},
+				2: {Estimate: aluCycles[i]},
+			},
+		})
+	}
+	return data
+}
+
+func TestCompareProfiles(t *testing.T) {
+	ctx := log.Testing(t)
+
+	baseline := testProfile(&path.Capture{}, []string{"A", "B", "C"}, []float64{100, 200, 300}, []float64{10, 20, 30})
+	current := testProfile(&path.Capture{}, []string{"A", "B", "D"}, []float64{150, 100, 50}, []float64{10, 40, 5})
+
+	res, err := CompareProfiles(ctx, baseline, current)
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+
+	if assert.For(ctx, "groups").ThatSlice(res.Groups).IsLength(2) {
+		a, b := res.Groups[0], res.Groups[1]
+		assert.For(ctx, "first").ThatString(a.Name).Equals("A")
+		assert.For(ctx, "A gpu time delta").That(a.GpuTime.Delta).Equals(50.0)
+		assert.For(ctx, "A relative delta").That(a.GpuTime.RelativeDelta).Equals(0.5)
+		assert.For(ctx, "second").ThatString(b.Name).Equals("B")
+		assert.For(ctx, "B gpu time delta").That(b.GpuTime.Delta).Equals(-100.0)
+		if assert.For(ctx, "B counters").ThatSlice(b.Counters).IsLength(1) {
+			assert.For(ctx, "B counter").ThatString(b.Counters[0].Name).Equals("ALU Cycles")
+			assert.For(ctx, "B counter delta").That(b.Counters[0].Delta).Equals(20.0)
+		}
+	}
+	if assert.For(ctx, "baseline only").ThatSlice(res.BaselineOnly).IsLength(1) {
+		assert.For(ctx, "baseline only").ThatString(res.BaselineOnly[0].Name).Equals("C")
+	}
+	if assert.For(ctx, "current only").ThatSlice(res.CurrentOnly).IsLength(1) {
+		assert.For(ctx, "current only").ThatString(res.CurrentOnly[0].Name).Equals("D")
+	}
+}
+
+func TestCompareProfilesMatchesCommandIndices(t *testing.T) {
+	ctx := log.Testing(t)
+
+	baseline := testProfile(&path.Capture{}, []string{"Draw", "Draw"}, []float64{100, 200}, []float64{10, 20})
+	current := testProfile(&path.Capture{}, []string{"Draw", "Draw"}, []float64{150, 300}, []float64{10, 20})
+	// The second draw of the current profile is a subcommand of the first
+	// command, rather than the second command.
+	current.Groups[1].Link.From = []uint64{0, 1}
+	current.Groups[1].Link.To = []uint64{0, 1}
+	// The GPU time is found by its id, whatever its name.
+	current.GpuCounters.Metrics[0].Name = "GPU Duration"
+
+	res, err := CompareProfiles(ctx, baseline, current)
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	if assert.For(ctx, "groups").ThatSlice(res.Groups).IsLength(1) {
+		assert.For(ctx, "baseline group").That(res.Groups[0].BaselineGroupId).Equals(int32(1))
+		assert.For(ctx, "gpu time").ThatString(res.Groups[0].GpuTime.Name).Equals("GPU Duration")
+		assert.For(ctx, "gpu time delta").That(res.Groups[0].GpuTime.Delta).Equals(50.0)
+	}
+	assert.For(ctx, "baseline only").ThatSlice(res.BaselineOnly).IsLength(1)
+	assert.For(ctx, "current only").ThatSlice(res.CurrentOnly).IsLength(1)
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/box"
 	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/service/severity"
 	"github.com/google/gapid/gapis/service/types"
 	"github.com/google/gapid/gapis/trace"
 )
@@ -122,6 +123,29 @@ func Messages(ctx context.Context, p *path.Messages) (interface{}, error) {
 	return m, nil
 }
 
+// Logcat resolves the logcat messages of the traced process stored in the
+// capture.
+func Logcat(ctx context.Context, p *path.Logcat) (interface{}, error) {
+	c, err := capture.ResolveGraphicsFromPath(ctx, p.Capture)
+	if err != nil {
+		return nil, err
+	}
+	m := &service.LogcatMessages{List: []*service.LogcatMessage{}}
+	for _, message := range c.Logcat {
+		// The logcat priorities and severities have the same values.
+		m.List = append(m.List, &service.LogcatMessage{
+			Timestamp: message.Timestamp,
+			WallTime:  message.WallTime,
+			Severity:  severity.Severity(message.Priority),
+			Tag:       message.Tag,
+			Pid:       message.Pid,
+			Tid:       message.Tid,
+			Message:   message.Message,
+		})
+	}
+	return m, nil
+}
+
 func field(ctx context.Context, s reflect.Value, name string, p path.Node) (reflect.Value, error) {
 	for {
 		if isNil(s) {
@@ -329,6 +353,8 @@ func ResolveInternal(ctx context.Context, p path.Node, r *path.ResolveConfig) (i
 		return GlobalState(ctx, p, r)
 	case *path.ImageInfo:
 		return ImageInfo(ctx, p, r)
+	case *path.Logcat:
+		return Logcat(ctx, p)
 	case *path.MapIndex:
 		return MapIndex(ctx, p, r)
 	case *path.Memory:
@@ -345,6 +371,8 @@ func ResolveInternal(ctx context.Context, p path.Node, r *path.ResolveConfig) (i
 		return Parameter(ctx, p, r)
 	case *path.Pipelines:
 		return Pipelines(ctx, p, r)
+	case *path.PixelHistory:
+		return PixelHistory(ctx, p, r)
 	case *path.Report:
 		return Report(ctx, p, r)
 	case *path.ResourceData:
@@ -19,6 +19,8 @@ import (
 
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/box"
 	"github.com/google/gapid/gapis/service/path"
 	"github.com/google/gapid/gapis/service/types"
@@ -102,7 +104,15 @@ func serviceToCmd(c *api.Command) (api.Cmd, error) {
 	cmd.SetThread(c.Thread)
 
 	for _, s := range c.Parameters {
-		api.SetParameter(cmd, s.Name, s.Value.Get())
+		switch err := api.SetParameter(cmd, s.Name, s.Value.Get()); err {
+		case nil:
+		case api.ErrParameterNotFound:
+			return nil, &service.ErrInvalidArgument{
+				Reason: messages.ErrParameterDoesNotExist(cmd.CmdName(), s.Name),
+			}
+		default:
+			return nil, err
+		}
 	}
 
 	if p := cmd.CmdResult(); p != nil && c.Result != nil {
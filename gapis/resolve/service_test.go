@@ -21,6 +21,8 @@ import (
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/api/test"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
 )
 
 func TestToServiceToCmd(t *testing.T) {
@@ -37,3 +39,16 @@ func TestToServiceToCmd(t *testing.T) {
 		assert.For(ctx, "CmdToService(%v) -> ServiceToCmd", n).That(g).DeepEquals(cmd)
 	}
 }
+
+func TestServiceToCmdUnknownParameter(t *testing.T) {
+	ctx := log.Testing(t)
+	s, err := cmdToService(test.Cmds.A)
+	if !assert.For(ctx, "CmdToService").ThatError(err).Succeeded() {
+		return
+	}
+	s.Parameters = append(s.Parameters, &api.Parameter{Name: "doesnotexist", Value: s.Parameters[0].Value})
+	_, err = serviceToCmd(s)
+	assert.For(ctx, "ServiceToCmd").ThatError(err).DeepEquals(&service.ErrInvalidArgument{
+		Reason: messages.ErrParameterDoesNotExist("cmdTypeMix", "doesnotexist"),
+	})
+}
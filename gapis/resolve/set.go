@@ -32,6 +32,9 @@ import (
 // Set creates a copy of the capture referenced by the request's path, but
 // with the object, value or memory at p replaced with v. The path returned is
 // identical to p, but with the base changed to refer to the new capture.
+// Changing a subcommand changes the command that recorded it, such as a
+// vkCmdDraw, which changes every submission of its command buffer.
+// Subcommands recorded before the start of the capture cannot be changed.
 func Set(ctx context.Context, p *path.Any, v interface{}, r *path.ResolveConfig) (*path.Any, error) {
 	obj, err := database.Build(ctx, &SetResolvable{Path: p, Value: service.NewValue(v), Config: r})
 	if err != nil {
@@ -108,9 +111,10 @@ func change(ctx context.Context, p path.Node, val interface{}, r *path.ResolveCo
 		}, nil
 
 	case *path.Command:
-		cmdIdx := p.Indices[0]
-		if len(p.Indices) > 1 {
-			return nil, fmt.Errorf("Cannot modify subcommands") // TODO: Subcommands
+		// Subcommands are changed by replacing the command that recorded them.
+		cmdIdx, err := recordingCmdIndex(ctx, p)
+		if err != nil {
+			return nil, err
 		}
 
 		// Resolve the command list
@@ -156,9 +160,13 @@ func change(ctx context.Context, p path.Node, val interface{}, r *path.ResolveCo
 		return nil, fmt.Errorf("Commands can not be changed directly")
 
 	case *path.State:
-		return nil, fmt.Errorf("State can not currently be mutated")
+		return nil, fmt.Errorf("State can not be replaced, set its fields instead")
 
 	case *path.Field, *path.Parameter, *path.ArrayIndex, *path.MapIndex:
+		if stateRoot(p) != nil {
+			return changeState(ctx, p, val, r)
+		}
+
 		oldObj, err := ResolveInternal(ctx, p.Parent(), r)
 		if err != nil {
 			return nil, err
@@ -171,7 +179,6 @@ func change(ctx context.Context, p path.Node, val interface{}, r *path.ResolveCo
 
 		switch p := p.(type) {
 		case *path.Parameter:
-			// TODO: Deal with parameters belonging to sub-commands.
 			cmd := obj.Interface().(api.Cmd)
 			err := api.SetParameter(cmd, p.Name, val)
 			switch err {
@@ -192,7 +199,6 @@ func change(ctx context.Context, p path.Node, val interface{}, r *path.ResolveCo
 			return parent.(*path.Command).Parameter(p.Name), nil
 
 		case *path.Result:
-			// TODO: Deal with parameters belonging to sub-commands.
 			cmd := obj.Interface().(api.Cmd)
 			err := api.SetResult(cmd, val)
 			switch err {
@@ -0,0 +1,418 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/google/gapid/core/data/dictionary"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/box"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// stateRoot returns the path.State at the root of p, or nil if p is not a
+// path into the API state.
+func stateRoot(p path.Node) *path.State {
+	for n := p; n != nil; n = n.Parent() {
+		if s, ok := n.(*path.State); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// changeState returns a path to a new capture where the value in the API
+// state at p is replaced with val.
+//
+// If p.After refers to a command, the edit is made by inserting the commands
+// synthesized by the API's StateEditor after that command. If p.After has the
+// index api.CmdNoID the edit is applied to the capture's initial state.
+func changeState(ctx context.Context, p path.Node, val interface{}, r *path.ResolveConfig) (path.Node, error) {
+	root := stateRoot(p)
+	steps := []path.Node{}
+	for n := p; n != root; n = n.Parent() {
+		steps = append([]path.Node{n}, steps...)
+	}
+
+	after := root.After
+	if len(after.Indices) != 1 {
+		return nil, fmt.Errorf("State can only be edited after top-level commands")
+	}
+
+	if after.Indices[0] == uint64(api.CmdNoID) {
+		c, err := changeInitialState(ctx, after.Capture, steps, val)
+		if err != nil {
+			return nil, err
+		}
+		return statePath(&path.Command{Capture: c, Indices: after.Indices}, steps), nil
+	}
+
+	cmd, err := Cmd(ctx, after, r)
+	if err != nil {
+		return nil, err
+	}
+	a := cmd.API()
+	if a == nil {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrStateUnavailable()}
+	}
+
+	// Build two independent copies of the state: one to hold the edit and one
+	// for the synthesized commands to mutate.
+	state, err := uncachedGlobalState(ctx, after, r)
+	if err != nil {
+		return nil, err
+	}
+	c, err := capture.ResolveGraphicsFromPath(ctx, after.Capture)
+	if err != nil {
+		return nil, err
+	}
+	edited := cloneGlobalState(ctx, c, state)
+
+	s := edited.APIs[a.ID()]
+	if s == nil {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrStateUnavailable()}
+	}
+	write := func(ctx context.Context, pool memory.PoolID, base uint64, data []byte) error {
+		m, err := edited.Memory.Get(pool)
+		if err != nil {
+			return err
+		}
+		m.Write(base, memory.Blob(data))
+		return nil
+	}
+	if err := editValue(ctx, reflect.ValueOf(s), steps, val, write); err != nil {
+		return nil, err
+	}
+
+	editor, ok := a.(api.StateEditor)
+	if !ok {
+		return nil, fmt.Errorf("The %v API does not support state edits", a.Name())
+	}
+	object, key, err := editedObject(ctx, s, steps)
+	if err != nil {
+		return nil, err
+	}
+	cmds, err := editor.EditState(ctx, edited, state, object, key)
+	if err != nil {
+		return nil, err
+	}
+
+	oldCmds, err := Cmds(ctx, after.Capture)
+	if err != nil {
+		return nil, err
+	}
+	idx := after.Indices[0]
+	newCmds := make([]api.Cmd, 0, len(oldCmds)+len(cmds))
+	newCmds = append(newCmds, oldCmds[:idx+1]...)
+	newCmds = append(newCmds, cmds...)
+	newCmds = append(newCmds, oldCmds[idx+1:]...)
+
+	newCapture, err := changeCommands(ctx, after.Capture, newCmds)
+	if err != nil {
+		return nil, err
+	}
+	return statePath(&path.Command{Capture: newCapture, Indices: []uint64{idx + uint64(len(cmds))}}, steps), nil
+}
+
+// changeInitialState returns a new capture with the value at steps in the
+// initial state of the capture at p replaced with val.
+func changeInitialState(ctx context.Context, p *path.Capture, steps []path.Node, val interface{}) (*path.Capture, error) {
+	old, err := capture.ResolveGraphicsFromPath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(old.Commands) == 0 || old.Commands[0].API() == nil {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrStateUnavailable()}
+	}
+
+	is := old.CloneInitialState()
+	if is == nil {
+		return nil, fmt.Errorf("The capture has no initial state to edit")
+	}
+	s := is.APIs[old.Commands[0].API()]
+	if s == nil {
+		return nil, &service.ErrDataUnavailable{Reason: messages.ErrStateUnavailable()}
+	}
+	write := func(ctx context.Context, pool memory.PoolID, base uint64, data []byte) error {
+		id, err := database.Store(ctx, data)
+		if err != nil {
+			return err
+		}
+		// The observations are shared with the old capture, so always copy
+		// them rather than appending in place.
+		mem := is.Memory[:len(is.Memory):len(is.Memory)]
+		is.Memory = append(mem, api.CmdObservation{
+			Pool:  pool,
+			Range: memory.Range{Base: base, Size: uint64(len(data))},
+			ID:    id,
+		})
+		return nil
+	}
+	if err := editValue(ctx, reflect.ValueOf(s), steps, val, write); err != nil {
+		return nil, err
+	}
+
+	c, err := capture.NewGraphicsCapture(ctx, old.Name()+"*", old.Header, is, old.Commands)
+	if err != nil {
+		return nil, err
+	}
+	return capture.New(ctx, c)
+}
+
+// uncachedGlobalState returns a new global state after the command c. Unlike
+// GlobalState, the returned state is not shared and so can be modified.
+func uncachedGlobalState(ctx context.Context, c *path.Command, r *path.ResolveConfig) (*api.GlobalState, error) {
+	obj, err := (&GlobalStateResolvable{Path: c.GlobalStateAfter(), Config: r}).Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*api.GlobalState), nil
+}
+
+// cloneGlobalState returns a copy of the state s of the capture c, sharing the
+// allocator of s.
+func cloneGlobalState(ctx context.Context, c *capture.GraphicsCapture, s *api.GlobalState) *api.GlobalState {
+	out := c.NewUninitializedStateSharingAllocator(ctx, s)
+	out.Memory = s.Memory.Clone()
+	for id, state := range s.APIs {
+		clone := state.Clone()
+		clone.SetupInitialState(ctx, out)
+		out.APIs[id] = clone
+	}
+	return out
+}
+
+// editedObject returns the name and key of the top-level state object that
+// contains the value at steps.
+func editedObject(ctx context.Context, s api.State, steps []path.Node) (string, interface{}, error) {
+	if len(steps) < 2 {
+		return "", nil, fmt.Errorf("Only the fields of state objects can be edited")
+	}
+	f, ok := steps[0].(*path.Field)
+	if !ok {
+		return "", nil, fmt.Errorf("Only the fields of state objects can be edited")
+	}
+	m, ok := steps[1].(*path.MapIndex)
+	if !ok {
+		return "", nil, fmt.Errorf("Only the fields of state objects can be edited")
+	}
+	obj, err := field(ctx, reflect.ValueOf(s), f.Name, f)
+	if err != nil {
+		return "", nil, err
+	}
+	d := dictionary.From(obj.Interface())
+	if d == nil {
+		return "", nil, &service.ErrInvalidPath{
+			Reason: messages.ErrTypeNotMapIndexable(typename(obj.Type())),
+			Path:   m.Path(),
+		}
+	}
+	key, ok := convert(reflect.ValueOf(m.KeyValue()), d.KeyTy())
+	if !ok {
+		return "", nil, &service.ErrInvalidPath{
+			Reason: messages.ErrIncorrectMapKeyType(
+				typename(reflect.TypeOf(m.KeyValue())), // got
+				typename(d.KeyTy())),                   // expected
+			Path: m.Path(),
+		}
+	}
+	return f.Name, key.Interface(), nil
+}
+
+// memoryWriter writes data at base in the pool of the edited state.
+type memoryWriter func(ctx context.Context, pool memory.PoolID, base uint64, data []byte) error
+
+// editValue replaces the value at steps relative to obj with val.
+// The state objects are modified in place, and the bytes written to memory
+// slices are written with write.
+func editValue(ctx context.Context, obj reflect.Value, steps []path.Node, val interface{}, write memoryWriter) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("State can not be replaced, set its fields instead")
+	}
+	last := len(steps) == 1
+
+	switch p := steps[0].(type) {
+	case *path.Field:
+		if last && !isNil(obj) {
+			if pp, ok := obj.Interface().(api.PropertyProvider); ok {
+				if prop := pp.Properties().Find(p.Name); prop != nil {
+					if slice, ok := prop.Get().(memory.Slice); ok {
+						return writeSlice(ctx, slice, 0, val, write)
+					}
+					if prop.Set == nil {
+						return fmt.Errorf("Field %v is read-only", p.Name)
+					}
+					ty := reflect.TypeOf(prop.Get())
+					v, ok := convert(reflect.ValueOf(val), ty)
+					if !ok {
+						return fmt.Errorf("Field %s has type %v, got type %v",
+							p, ty, reflect.TypeOf(val))
+					}
+					prop.Set(v.Interface())
+					return nil
+				}
+			}
+		}
+		f, err := field(ctx, obj, p.Name, p)
+		if err != nil {
+			return err
+		}
+		if !last {
+			return editValue(ctx, f, steps[1:], val, write)
+		}
+		v, ok := convert(reflect.ValueOf(val), f.Type())
+		if !ok {
+			return fmt.Errorf("Field %s has type %v, got type %v",
+				p, f.Type(), reflect.TypeOf(val))
+		}
+		return assign(f, v)
+
+	case *path.ArrayIndex:
+		if slice, ok := memorySlice(obj); ok {
+			if !last {
+				return fmt.Errorf("Only the bytes of memory slices can be set")
+			}
+			if count := slice.Count(); p.Index >= count {
+				return errPathOOB(p.Index, "Index", 0, count-1, p)
+			}
+			return writeSlice(ctx, slice, p.Index, val, write)
+		}
+		ty := obj.Type()
+		switch obj.Kind() {
+		case reflect.Array, reflect.Slice:
+			ty = ty.Elem()
+		case reflect.String:
+		default:
+			return &service.ErrInvalidPath{
+				Reason: messages.ErrTypeNotArrayIndexable(typename(obj.Type())),
+				Path:   p.Path(),
+			}
+		}
+		if count := uint64(obj.Len()); p.Index >= count {
+			return errPathOOB(p.Index, "Index", 0, count-1, p)
+		}
+		elem := obj.Index(int(p.Index))
+		if !last {
+			return editValue(ctx, elem, steps[1:], val, write)
+		}
+		v, ok := convert(reflect.ValueOf(val), ty)
+		if !ok {
+			return fmt.Errorf("Slice or array at %s has element of type %v, got type %v",
+				p.Parent(), ty, reflect.TypeOf(val))
+		}
+		return assign(elem, v)
+
+	case *path.MapIndex:
+		d := dictionary.From(obj.Interface())
+		if d == nil {
+			return &service.ErrInvalidPath{
+				Reason: messages.ErrTypeNotMapIndexable(typename(obj.Type())),
+				Path:   p.Path(),
+			}
+		}
+		keyTy, valTy := d.KeyTy(), d.ValTy()
+		key, ok := convert(reflect.ValueOf(p.KeyValue()), keyTy)
+		if !ok {
+			return &service.ErrInvalidPath{
+				Reason: messages.ErrIncorrectMapKeyType(
+					typename(reflect.TypeOf(p.KeyValue())), // got
+					typename(keyTy)),                       // expected
+				Path: p.Path(),
+			}
+		}
+		if last {
+			v, ok := convert(reflect.ValueOf(val), valTy)
+			if !ok {
+				return fmt.Errorf("Map at %s has value of type %v, got type %v",
+					p.Parent(), valTy, reflect.TypeOf(val))
+			}
+			d.Add(key.Interface(), v.Interface())
+			return nil
+		}
+		elem, ok := d.Lookup(key.Interface())
+		if !ok {
+			return &service.ErrInvalidPath{
+				Reason: messages.ErrMapKeyDoesNotExist(key.Interface()),
+				Path:   p.Path(),
+			}
+		}
+		// Copy the element so that it can be modified, then store it back in
+		// case the map holds values rather than references.
+		e, err := clone(reflect.ValueOf(elem))
+		if err != nil {
+			return err
+		}
+		if err := editValue(ctx, e, steps[1:], val, write); err != nil {
+			return err
+		}
+		d.Add(key.Interface(), e.Interface())
+		return nil
+	}
+	return fmt.Errorf("Unknown path type %T", steps[0])
+}
+
+// memorySlice returns v as a memory.Slice if it holds one.
+func memorySlice(v reflect.Value) (memory.Slice, bool) {
+	if !v.IsValid() || !v.CanInterface() || !box.IsMemorySlice(v.Type()) {
+		return nil, false
+	}
+	return box.AsMemorySlice(v), true
+}
+
+// writeSlice writes val, which must hold bytes, to the memory of the slice s
+// starting at the element with the given index.
+func writeSlice(ctx context.Context, s memory.Slice, index uint64, val interface{}, write memoryWriter) error {
+	data, ok := val.([]byte)
+	if !ok {
+		return fmt.Errorf("Memory slices can only be set to bytes, got type %v", reflect.TypeOf(val))
+	}
+	offset := uint64(0)
+	if index > 0 {
+		offset = index * (s.Size() / s.Count())
+	}
+	if offset+uint64(len(data)) > s.Size() {
+		return fmt.Errorf("Cannot write %d bytes at offset %d of a slice of %d bytes",
+			len(data), offset, s.Size())
+	}
+	return write(ctx, s.Pool(), s.Base()+offset, data)
+}
+
+// statePath returns a copy of the state path steps, rooted at the state after
+// the command c.
+func statePath(c *path.Command, steps []path.Node) path.Node {
+	var out path.Node = c.StateAfter()
+	for _, s := range steps {
+		var n path.Node
+		switch s := s.(type) {
+		case *path.Field:
+			n = &path.Field{Name: s.Name}
+		case *path.ArrayIndex:
+			n = &path.ArrayIndex{Index: s.Index}
+		case *path.MapIndex:
+			n = &path.MapIndex{Key: s.Key}
+		}
+		n.SetParent(out)
+		out = n
+	}
+	return out
+}
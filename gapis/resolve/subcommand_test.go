@@ -0,0 +1,121 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/messages"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// syncDatabase is a database resolving the synchronization data of captures
+// to fixed data, as the test API has no synchronization. The fixed data is
+// only seen by the resolves started with the database of the context, not by
+// the resolvables built by the underlying database: the tests call
+// deleteCommand and change instead of Delete and Set.
+type syncDatabase struct {
+	database.Database
+	data map[id.ID]*sync.Data
+}
+
+func (d *syncDatabase) Resolve(ctx context.Context, id id.ID) (interface{}, error) {
+	if data, ok := d.data[id]; ok {
+		return data, nil
+	}
+	return d.Database.Resolve(ctx, id)
+}
+
+func (d *syncDatabase) put(ctx context.Context, p *path.Capture, data *sync.Data) {
+	id, err := d.Store(ctx, &SynchronizationResolvable{Capture: p})
+	if err != nil {
+		log.F(ctx, true, "Couldn't store the synchronization resolvable: %v", err)
+	}
+	d.data[id] = data
+}
+
+// newSubcommandTrace returns a capture of three commands, where the last one
+// submits two subcommands: the first recorded by the second command, and the
+// second recorded before the start of the capture.
+func newSubcommandTrace(ctx context.Context) (context.Context, *path.Capture) {
+	db := &syncDatabase{database.NewInMemory(ctx), map[id.ID]*sync.Data{}}
+	ctx = bind.PutRegistry(ctx, bind.NewRegistry())
+	ctx = database.Put(ctx, db)
+
+	p := createMultipleCommandTrace(ctx)
+	data := sync.NewData()
+	data.SubcommandReferences[2] = []sync.SubcommandReference{
+		{Index: api.SubCmdIdx{0}, GeneratingCmd: 1},
+		{Index: api.SubCmdIdx{1}, GeneratingCmd: api.CmdNoID},
+	}
+	db.put(ctx, p, data)
+	return capture.Put(ctx, p), p
+}
+
+func TestDeleteSubcommand(t *testing.T) {
+	ctx, p := newSubcommandTrace(log.Testing(t))
+
+	cmds, err := NCmds(ctx, p, 3)
+	assert.For(ctx, "NCmds").ThatError(err).Succeeded()
+
+	// Deleting the subcommand deletes the command that recorded it.
+	newCapture, err := deleteCommand(ctx, p.Command(2, 0))
+	assert.For(ctx, "Delete").ThatError(err).Succeeded()
+	newCmds, err := NCmds(ctx, newCapture, 2)
+	assert.For(ctx, "NCmds").ThatError(err).Succeeded()
+	assert.For(ctx, "Commands").ThatSlice(newCmds).DeepEquals([]api.Cmd{cmds[0], cmds[2]})
+
+	sub := p.Command(2, 1)
+	_, err = deleteCommand(ctx, sub)
+	assert.For(ctx, "Delete before capture").ThatError(err).DeepEquals(&service.ErrInvalidPath{
+		Reason: messages.ErrMessage("Cannot modify a subcommand recorded before the start of the capture"),
+		Path:   sub.Path(),
+	})
+
+	_, err = deleteCommand(ctx, p.Command(2, 5))
+	assert.For(ctx, "Delete missing").ThatError(err).Failed()
+}
+
+func TestSetSubcommand(t *testing.T) {
+	ctx, p := newSubcommandTrace(log.Testing(t))
+
+	// Changing the subcommand changes the command that recorded it.
+	newPath, err := change(ctx, p.Command(2, 0).Parameter("U8"), uint8(99), nil)
+	assert.For(ctx, "Set").ThatError(err).Succeeded()
+	newCapture := path.FindCapture(newPath)
+	got, err := Get(ctx, newCapture.Command(1).Parameter("U8").Path(), nil)
+	assert.For(ctx, "Get").ThatError(err).Succeeded()
+	assert.For(ctx, "U8").That(got).Equals(uint8(99))
+	got, err = Get(ctx, newCapture.Command(2).Parameter("U8").Path(), nil)
+	assert.For(ctx, "Get submit").ThatError(err).Succeeded()
+	assert.For(ctx, "Submit U8").That(got).Equals(uint8(20))
+
+	sub := p.Command(2, 1)
+	_, err = change(ctx, sub.Parameter("U8"), uint8(99), nil)
+	assert.For(ctx, "Set before capture").ThatError(err).DeepEquals(&service.ErrInvalidPath{
+		Reason: messages.ErrMessage("Cannot modify a subcommand recorded before the start of the capture"),
+		Path:   sub.Path(),
+	})
+}
@@ -36,14 +36,22 @@ import (
 	"github.com/google/gapid/gapis/service"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	xctx "golang.org/x/net/context"
 )
 
-// Listen starts a new GRPC server listening on addr.
+// Listen starts a new GRPC server listening on addr, which is either a TCP
+// host:port or the path of a Unix domain socket prefixed with "unix:".
 // This is a blocking call.
 func Listen(ctx context.Context, addr string, cfg Config) error {
-	listener, err := net.Listen("tcp", addr)
+	var listener net.Listener
+	var err error
+	if path, ok := grpcutil.UnixSocketPath(addr); ok {
+		listener, err = grpcutil.ListenUnix(path, cfg.SocketMode)
+	} else {
+		listener, err = net.Listen("tcp", addr)
+	}
 	if err != nil {
 		log.F(ctx, true, "Could not start grpc server at %v: %s", addr, err.Error())
 	}
@@ -60,6 +68,20 @@ func NewWithListener(ctx context.Context, l net.Listener, cfg Config, srvChan ch
 		interrupters: map[int]func(){},
 	}
 
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			auth.UnaryServerInterceptor(cfg.AuthToken),
+			grpcutil.UnaryServerTraceInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			auth.StreamServerInterceptor(cfg.AuthToken),
+			grpcutil.StreamServerTraceInterceptor(),
+		),
+	}
+	if cfg.TLS != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(cfg.TLS)))
+	}
+
 	done := make(chan error)
 	ctx, stop := task.WithCancel(ctx)
 	crash.Go(func() {
@@ -78,8 +100,7 @@ func NewWithListener(ctx context.Context, l net.Listener, cfg Config, srvChan ch
 				crash.Go(func() { s.stopOnInterrupt(ctx, server, stop) })
 			}
 			return nil
-		}, grpc.UnaryInterceptor(auth.UnaryServerInterceptor(cfg.AuthToken)),
-			grpc.StreamInterceptor(auth.StreamServerInterceptor(cfg.AuthToken)))
+		}, options...)
 	})
 
 	select {
@@ -234,7 +255,7 @@ func (s *grpcServer) Get(ctx xctx.Context, req *service.GetRequest) (*service.Ge
 
 func (s *grpcServer) Set(ctx xctx.Context, req *service.SetRequest) (*service.SetResponse, error) {
 	defer s.inRPC()()
-	res, err := s.handler.Set(s.bindCtx(ctx), req.Path, req.Value.Get(), req.Config)
+	res, err := s.handler.Set(s.bindCtx(ctx), req.Path, req.Value, req.Config)
 	if err := service.NewError(err); err != nil {
 		return &service.SetResponse{Res: &service.SetResponse_Error{Error: err}}, nil
 	}
@@ -250,6 +271,24 @@ func (s *grpcServer) Delete(ctx xctx.Context, req *service.DeleteRequest) (*serv
 	return &service.DeleteResponse{Res: &service.DeleteResponse_Path{Path: res}}, nil
 }
 
+func (s *grpcServer) Insert(ctx xctx.Context, req *service.InsertRequest) (*service.InsertResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.Insert(s.bindCtx(ctx), req.Path, req.Command, req.Observations, req.Config)
+	if err := service.NewError(err); err != nil {
+		return &service.InsertResponse{Res: &service.InsertResponse_Error{Error: err}}, nil
+	}
+	return &service.InsertResponse{Res: &service.InsertResponse_Command{Command: res}}, nil
+}
+
+func (s *grpcServer) Move(ctx xctx.Context, req *service.MoveRequest) (*service.MoveResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.Move(s.bindCtx(ctx), req.From, req.To, req.Config)
+	if err := service.NewError(err); err != nil {
+		return &service.MoveResponse{Res: &service.MoveResponse_Error{Error: err}}, nil
+	}
+	return &service.MoveResponse{Res: &service.MoveResponse_Command{Command: res}}, nil
+}
+
 func (s *grpcServer) Follow(ctx xctx.Context, req *service.FollowRequest) (*service.FollowResponse, error) {
 	defer s.inRPC()()
 	res, err := s.handler.Follow(s.bindCtx(ctx), req.Path, req.Config)
@@ -362,7 +401,14 @@ func (s *grpcServer) Profile(stream service.Gapid_ProfileServer) error {
 		}
 
 		// Start the profile.
-		stop, err = s.handler.Profile(ctx, pprof, trace, req.MemorySnapshotInterval)
+		if req.TraceId != "" {
+			if pprof != nil {
+				return sendErr(fmt.Errorf("Cannot profile with pprof when tracing requests"))
+			}
+			stop, err = s.handler.TraceRequests(ctx, status.TraceID(req.TraceId), trace)
+		} else {
+			stop, err = s.handler.Profile(ctx, pprof, trace, req.MemorySnapshotInterval)
+		}
 		if err != nil {
 			return err
 		}
@@ -565,6 +611,33 @@ func (s *grpcServer) GpuProfile(ctx xctx.Context, req *service.GpuProfileRequest
 	return &service.GpuProfileResponse{Res: &service.GpuProfileResponse_ProfilingData{ProfilingData: res}}, nil
 }
 
+func (s *grpcServer) GpuProfileFromBundle(ctx xctx.Context, req *service.GpuProfileFromBundleRequest) (*service.GpuProfileResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.GpuProfileFromBundle(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.GpuProfileResponse{Res: &service.GpuProfileResponse_Error{Error: err}}, nil
+	}
+	return &service.GpuProfileResponse{Res: &service.GpuProfileResponse_ProfilingData{ProfilingData: res}}, nil
+}
+
+func (s *grpcServer) CompareProfiles(ctx xctx.Context, req *service.CompareProfilesRequest) (*service.CompareProfilesResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.CompareProfiles(s.bindCtx(ctx), req.Baseline, req.Current)
+	if err := service.NewError(err); err != nil {
+		return &service.CompareProfilesResponse{Res: &service.CompareProfilesResponse_Error{Error: err}}, nil
+	}
+	return &service.CompareProfilesResponse{Res: &service.CompareProfilesResponse_Comparison{Comparison: res}}, nil
+}
+
+func (s *grpcServer) LoopReplay(ctx xctx.Context, req *service.LoopReplayRequest) (*service.LoopReplayResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.LoopReplay(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.LoopReplayResponse{Res: &service.LoopReplayResponse_Error{Error: err}}, nil
+	}
+	return &service.LoopReplayResponse{Res: &service.LoopReplayResponse_Result{Result: res}}, nil
+}
+
 func (s *grpcServer) UpdateSettings(ctx xctx.Context, req *service.UpdateSettingsRequest) (*service.UpdateSettingsResponse, error) {
 	defer s.inRPC()()
 	err := s.handler.UpdateSettings(s.bindCtx(ctx), req)
@@ -601,6 +674,33 @@ func (s *grpcServer) TrimCaptureInitialState(ctx xctx.Context, req *service.Trim
 	return &service.TrimCaptureInitialStateResponse{Res: &service.TrimCaptureInitialStateResponse_Capture{Capture: res}}, nil
 }
 
+func (s *grpcServer) GetCaptureHistory(ctx xctx.Context, req *service.GetCaptureHistoryRequest) (*service.GetCaptureHistoryResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.GetCaptureHistory(s.bindCtx(ctx), req.Capture)
+	if err := service.NewError(err); err != nil {
+		return &service.GetCaptureHistoryResponse{Res: &service.GetCaptureHistoryResponse_Error{Error: err}}, nil
+	}
+	return &service.GetCaptureHistoryResponse{Res: &service.GetCaptureHistoryResponse_History{History: res}}, nil
+}
+
+func (s *grpcServer) DiffCapture(ctx xctx.Context, req *service.DiffCaptureRequest) (*service.DiffCaptureResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.DiffCapture(s.bindCtx(ctx), req.Capture)
+	if err := service.NewError(err); err != nil {
+		return &service.DiffCaptureResponse{Res: &service.DiffCaptureResponse_Error{Error: err}}, nil
+	}
+	return &service.DiffCaptureResponse{Res: &service.DiffCaptureResponse_Diff{Diff: res}}, nil
+}
+
+func (s *grpcServer) ApplyEdits(ctx xctx.Context, req *service.ApplyEditsRequest) (*service.ApplyEditsResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.ApplyEdits(s.bindCtx(ctx), req.Capture, req.Edits)
+	if err := service.NewError(err); err != nil {
+		return &service.ApplyEditsResponse{Res: &service.ApplyEditsResponse_Error{Error: err}}, nil
+	}
+	return &service.ApplyEditsResponse{Res: &service.ApplyEditsResponse_Capture{Capture: res}}, nil
+}
+
 func (s *grpcServer) TraceTargetTreeNode(ctx xctx.Context, req *service.TraceTargetTreeNodeRequest) (*service.TraceTargetTreeNodeResponse, error) {
 	defer s.inRPC()()
 	res, err := s.handler.TraceTargetTreeNode(s.bindCtx(ctx), req)
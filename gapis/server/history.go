@@ -0,0 +1,131 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// editHistory records the edits that derived captures from other captures.
+type editHistory struct {
+	sync.Mutex
+	edits map[id.ID]*service.CaptureEdit // Keyed by the child capture.
+}
+
+func newEditHistory() *editHistory {
+	return &editHistory{edits: map[id.ID]*service.CaptureEdit{}}
+}
+
+// record records that the capture child was derived from parent by op.
+func (h *editHistory) record(parent, child *path.Capture, op *service.EditOperation) {
+	if parent == nil || child == nil || parent.ID.ID() == child.ID.ID() {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.edits[child.ID.ID()] = &service.CaptureEdit{
+		Parent:    parent,
+		Child:     child,
+		Operation: op,
+	}
+}
+
+// history returns the edits that produced the capture c, oldest first.
+func (h *editHistory) history(c *path.Capture) *service.CaptureHistory {
+	h.Lock()
+	defer h.Unlock()
+	out := &service.CaptureHistory{}
+	seen := map[id.ID]bool{}
+	for e, ok := h.edits[c.ID.ID()]; ok && !seen[e.Child.ID.ID()]; e, ok = h.edits[e.Parent.ID.ID()] {
+		seen[e.Child.ID.ID()] = true
+		out.Edits = append([]*service.CaptureEdit{e}, out.Edits...)
+	}
+	return out
+}
+
+// script returns the edit script that produced the capture c from the
+// capture it was originally loaded from.
+func (h *editHistory) script(c *path.Capture) *service.EditScript {
+	out := &service.EditScript{}
+	for _, e := range h.history(c).Edits {
+		out.Edits = append(out.Edits, e.Operation)
+	}
+	return out
+}
+
+// applyEdit applies the edit op to the capture c, returning the new capture.
+// The capture paths of op are changed to refer to c.
+func (s *server) applyEdit(ctx context.Context, c *path.Capture, op *service.EditOperation) (*path.Capture, error) {
+	op = proto.Clone(op).(*service.EditOperation)
+	rebase := func(n path.Node) path.Node {
+		return path.Transform(n, func(n path.Node) path.Node {
+			if _, ok := n.(*path.Capture); ok {
+				return proto.Clone(c).(*path.Capture)
+			}
+			return n
+		})
+	}
+
+	switch op := op.Op.(type) {
+	case *service.EditOperation_Set:
+		res, err := s.Set(ctx, rebase(op.Set.Path.Node()).Path(), op.Set.Value, op.Set.Config)
+		if err != nil {
+			return nil, err
+		}
+		return path.FindCapture(res.Node()), nil
+
+	case *service.EditOperation_Delete:
+		res, err := s.Delete(ctx, rebase(op.Delete.Path.Node()).Path(), op.Delete.Config)
+		if err != nil {
+			return nil, err
+		}
+		return path.FindCapture(res.Node()), nil
+
+	case *service.EditOperation_Insert:
+		res, err := s.Insert(ctx, rebase(op.Insert.Path).(*path.Command), op.Insert.Command, op.Insert.Observations, op.Insert.Config)
+		if err != nil {
+			return nil, err
+		}
+		return res.Capture, nil
+
+	case *service.EditOperation_Move:
+		res, err := s.Move(ctx, rebase(op.Move.From).(*path.Command), rebase(op.Move.To).(*path.Command), op.Move.Config)
+		if err != nil {
+			return nil, err
+		}
+		return res.Capture, nil
+
+	case *service.EditOperation_Dce:
+		requested := make([]*path.Command, len(op.Dce.Commands))
+		for i, cmd := range op.Dce.Commands {
+			requested[i] = rebase(cmd).(*path.Command)
+		}
+		return s.DCECapture(ctx, c, requested)
+
+	case *service.EditOperation_Split:
+		return s.SplitCapture(ctx, rebase(op.Split.Commands).(*path.Commands))
+
+	case *service.EditOperation_TrimInitialState:
+		return s.TrimCaptureInitialState(ctx, c)
+	}
+	return nil, fmt.Errorf("Unknown edit operation %T", op.Op)
+}
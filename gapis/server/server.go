@@ -19,8 +19,10 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"runtime"
 	"runtime/pprof"
@@ -28,6 +30,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/app/crash"
 	"github.com/google/gapid/core/app/crash/reporting"
 	"github.com/google/gapid/core/context/keys"
@@ -56,6 +59,7 @@ import (
 	"github.com/google/gapid/gapis/service/path"
 	"github.com/google/gapid/gapis/stringtable"
 	"github.com/google/gapid/gapis/trace"
+	"github.com/google/gapid/gapis/trace/android/profile"
 
 	// Register all the apis
 	_ "github.com/google/gapid/gapis/api/all"
@@ -70,11 +74,14 @@ type Config struct {
 	Info             *service.ServerInfo
 	StringTables     []*stringtable.StringTable
 	EnableLocalFiles bool
+	BundleDir        string // Directory of the profiling bundles, only relative paths are allowed if empty.
 	PreloadDepGraph  bool
 	AuthToken        auth.Token
 	DeviceScanDone   task.Signal
 	LogBroadcaster   *log.Broadcaster
 	IdleTimeout      time.Duration
+	SocketMode       os.FileMode // Permissions of the Unix domain socket listened on.
+	TLS              *tls.Config // TLS configuration of the connections, nil for plain text.
 }
 
 // Server is the server interface to GAPIS.
@@ -88,9 +95,11 @@ func New(ctx context.Context, cfg Config) Server {
 		cfg.Info,
 		cfg.StringTables,
 		cfg.EnableLocalFiles,
+		cfg.BundleDir,
 		cfg.PreloadDepGraph,
 		cfg.DeviceScanDone,
 		cfg.LogBroadcaster,
+		newEditHistory(),
 	}
 }
 
@@ -98,9 +107,11 @@ type server struct {
 	info             *service.ServerInfo
 	stbs             []*stringtable.StringTable
 	enableLocalFiles bool
+	bundleDir        string
 	preloadDepGraph  bool
 	deviceScanDone   task.Signal
 	logBroadcaster   *log.Broadcaster
+	history          *editHistory
 }
 
 func (s *server) Ping(ctx context.Context) error {
@@ -245,12 +256,26 @@ func (s *server) SaveCapture(ctx context.Context, c *path.Capture, path string)
 	if !s.enableLocalFiles {
 		return fmt.Errorf("Server not configured to allow writing of local files")
 	}
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0666)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	return capture.Export(ctx, c, f)
+	if err := capture.Export(ctx, c, f); err != nil {
+		return err
+	}
+
+	// Save the edits that produced the capture alongside it.
+	if script := s.history.script(c); len(script.Edits) > 0 {
+		data, err := proto.Marshal(script)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path+".edits", data, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 func (s *server) ExportReplay(ctx context.Context, c *path.Capture, d *path.Device, out string, opts *service.ExportReplayOptions) error {
 	ctx = status.Start(ctx, "RPC ExportReplay")
@@ -272,6 +297,9 @@ func (s *server) DCECapture(ctx context.Context, p *path.Capture, requested []*p
 	if err != nil {
 		return nil, err
 	}
+	s.history.record(p, trimmed, &service.EditOperation{Op: &service.EditOperation_Dce{
+		Dce: &service.DCECaptureRequest{Capture: p, Commands: requested},
+	}})
 	return trimmed, nil
 }
 
@@ -297,11 +325,18 @@ func (s *server) SplitCapture(ctx context.Context, rng *path.Commands) (*path.Ca
 	}
 
 	name := fmt.Sprintf("%s [%d,%d)", c.Name(), from, to)
-	if gc, err := capture.NewGraphicsCapture(ctx, name, c.Header, c.InitialState, c.Commands[from:to]); err != nil {
+	gc, err := capture.NewGraphicsCapture(ctx, name, c.Header, c.InitialState, c.Commands[from:to])
+	if err != nil {
 		return nil, err
-	} else {
-		return capture.New(ctx, gc)
 	}
+	split, err := capture.New(ctx, gc)
+	if err != nil {
+		return nil, err
+	}
+	s.history.record(rng.Capture, split, &service.EditOperation{Op: &service.EditOperation_Split{
+		Split: &service.SplitCaptureRequest{Commands: rng},
+	}})
+	return split, nil
 }
 
 func (s *server) TrimCaptureInitialState(ctx context.Context, p *path.Capture) (*path.Capture, error) {
@@ -321,7 +356,45 @@ func (s *server) TrimCaptureInitialState(ctx context.Context, p *path.Capture) (
 		return nil, err
 	}
 
-	return newCapture.Path(ctx)
+	trimmed, err := newCapture.Path(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.history.record(p, trimmed, &service.EditOperation{Op: &service.EditOperation_TrimInitialState{
+		TrimInitialState: &service.TrimCaptureInitialStateRequest{Capture: p},
+	}})
+	return trimmed, nil
+}
+
+func (s *server) GetCaptureHistory(ctx context.Context, c *path.Capture) (*service.CaptureHistory, error) {
+	ctx = status.Start(ctx, "RPC GetCaptureHistory")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetCaptureHistory")
+	return s.history.history(c), nil
+}
+
+func (s *server) DiffCapture(ctx context.Context, c *path.Capture) (*service.CaptureDiff, error) {
+	ctx = status.Start(ctx, "RPC DiffCapture")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "DiffCapture")
+	edits := s.history.history(c).Edits
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("Capture %v was not derived from another capture", c.ID)
+	}
+	return resolve.DiffCaptures(ctx, edits[len(edits)-1].Parent, c)
+}
+
+func (s *server) ApplyEdits(ctx context.Context, c *path.Capture, edits []*service.EditOperation) (*path.Capture, error) {
+	ctx = status.Start(ctx, "RPC ApplyEdits")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "ApplyEdits")
+	for i, op := range edits {
+		var err error
+		if c, err = s.applyEdit(ctx, c, op); err != nil {
+			return nil, log.Errf(ctx, err, "Applying edit %d", i)
+		}
+	}
+	return c, nil
 }
 
 func (s *server) GetGraphVisualization(ctx context.Context, p *path.Capture, format service.GraphFormat) ([]byte, error) {
@@ -398,7 +471,23 @@ func (s *server) Set(ctx context.Context, p *path.Any, v interface{}, r *path.Re
 	if err := p.Validate(); err != nil {
 		return nil, log.Errf(ctx, err, "Invalid path: %v", p)
 	}
-	return resolve.Set(ctx, p, v, r)
+	// Keep the value as sent by the client for the edit history, as boxing
+	// the unboxed value again can fail.
+	value, boxed := v.(*service.Value)
+	if boxed {
+		v = value.Get()
+	}
+	res, err := resolve.Set(ctx, p, v, r)
+	if err != nil {
+		return nil, err
+	}
+	if !boxed {
+		value = service.NewValue(v)
+	}
+	s.history.record(path.FindCapture(p.Node()), path.FindCapture(res.Node()), &service.EditOperation{Op: &service.EditOperation_Set{
+		Set: &service.SetRequest{Path: p, Value: value, Config: r},
+	}})
+	return res, nil
 }
 
 func (s *server) Delete(ctx context.Context, p *path.Any, r *path.ResolveConfig) (*path.Any, error) {
@@ -408,7 +497,51 @@ func (s *server) Delete(ctx context.Context, p *path.Any, r *path.ResolveConfig)
 	if err := p.Validate(); err != nil {
 		return nil, log.Errf(ctx, err, "Invalid path: %v", p)
 	}
-	return resolve.Delete(ctx, p, r)
+	res, err := resolve.Delete(ctx, p, r)
+	if err != nil {
+		return nil, err
+	}
+	s.history.record(path.FindCapture(p.Node()), path.FindCapture(res.Node()), &service.EditOperation{Op: &service.EditOperation_Delete{
+		Delete: &service.DeleteRequest{Path: p, Config: r},
+	}})
+	return res, nil
+}
+
+func (s *server) Insert(ctx context.Context, p *path.Command, cmd *api.Command, obs []*service.CommandObservation, r *path.ResolveConfig) (*path.Command, error) {
+	ctx = status.Start(ctx, "RPC Insert<%v>", p)
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "Insert")
+	if err := p.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", p)
+	}
+	res, err := resolve.Insert(ctx, p, cmd, obs, r)
+	if err != nil {
+		return nil, err
+	}
+	s.history.record(p.Capture, res.Capture, &service.EditOperation{Op: &service.EditOperation_Insert{
+		Insert: &service.InsertRequest{Path: p, Command: cmd, Observations: obs, Config: r},
+	}})
+	return res, nil
+}
+
+func (s *server) Move(ctx context.Context, from, to *path.Command, r *path.ResolveConfig) (*path.Command, error) {
+	ctx = status.Start(ctx, "RPC Move<%v, %v>", from, to)
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "Move")
+	if err := from.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", from)
+	}
+	if err := to.Validate(); err != nil {
+		return nil, log.Errf(ctx, err, "Invalid path: %v", to)
+	}
+	res, err := resolve.Move(ctx, from, to, r)
+	if err != nil {
+		return nil, err
+	}
+	s.history.record(from.Capture, res.Capture, &service.EditOperation{Op: &service.EditOperation_Move{
+		Move: &service.MoveRequest{From: from, To: to, Config: r},
+	}})
+	return res, nil
 }
 
 func (s *server) Follow(ctx context.Context, p *path.Any, r *path.ResolveConfig) (*path.Any, error) {
@@ -486,6 +619,25 @@ func (s *server) Profile(ctx context.Context, pprofW, traceW io.Writer, memorySn
 	return stop, nil
 }
 
+func (s *server) TraceRequests(ctx context.Context, id status.TraceID, traceW io.Writer) (stop func() error, err error) {
+	// The tracing itself is not part of the traced requests.
+	ctx = status.PutTraceID(ctx, status.NoTraceID)
+	ctx = status.Start(ctx, "RPC TraceRequests")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "TraceRequests")
+
+	if id == status.NoTraceID {
+		return nil, log.Err(ctx, nil, "No trace identifier")
+	}
+	unregister := status.RegisterRequestTracer(traceW, id)
+	stop = task.Async(ctx, func(ctx context.Context) error {
+		defer unregister()
+		<-task.ShouldStop(ctx)
+		return nil
+	})
+	return stop, nil
+}
+
 type statusListener struct {
 	f                  func(*service.TaskUpdate)
 	m                  func(*service.MemoryStatus)
@@ -876,7 +1028,7 @@ func (s *server) GetTimestamps(ctx context.Context, req *service.GetTimestampsRe
 	ctx = status.Start(ctx, "RPC GetTimestamps")
 	defer status.Finish(ctx)
 	ctx = log.Enter(ctx, "GetTimestamps")
-	return replay.GetTimestamps(ctx, req.Capture, req.Device, h)
+	return replay.GetTimestamps(ctx, req.Capture, req.Device, req.LoopCount, h)
 }
 
 func (s *server) GpuProfile(ctx context.Context, req *service.GpuProfileRequest) (*service.ProfilingData, error) {
@@ -884,6 +1036,14 @@ func (s *server) GpuProfile(ctx context.Context, req *service.GpuProfileRequest)
 	defer status.Finish(ctx)
 	ctx = log.Enter(ctx, "GpuProfile")
 
+	bundlePath := ""
+	if req.BundlePath != "" {
+		var err error
+		if bundlePath, err = s.bundlePath(req.BundlePath); err != nil {
+			return nil, err
+		}
+	}
+
 	var replayErr, analysisErr error
 	var result *service.ProfilingData
 	var wg sync.WaitGroup
@@ -895,7 +1055,7 @@ func (s *server) GpuProfile(ctx context.Context, req *service.GpuProfileRequest)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		result, replayErr = replay.GpuProfile(ctx, staticAnalysisResult, req.Capture, req.Device, req.Experiments, req.LoopCount)
+		result, replayErr = replay.GpuProfile(ctx, staticAnalysisResult, req.Capture, req.Device, req.Experiments, req.LoopCount, bundlePath)
 	}()
 
 	wg.Add(1)
@@ -913,9 +1073,71 @@ func (s *server) GpuProfile(ctx context.Context, req *service.GpuProfileRequest)
 		return nil, analysisErr
 	}
 
+	if err := profile.AddDerivedMetrics(ctx, result, req.DerivedMetrics); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
+func (s *server) GpuProfileFromBundle(ctx context.Context, req *service.GpuProfileFromBundleRequest) (*service.ProfilingData, error) {
+	ctx = status.Start(ctx, "RPC GpuProfileFromBundle")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GpuProfileFromBundle")
+
+	bundlePath, err := s.bundlePath(req.BundlePath)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := trace.LoadProfilingBundle(ctx, bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The static analysis requires the capture to be loaded, and is skipped if
+	// it is not.
+	staticAnalysisResult := make(chan *api.StaticAnalysisProfileData, 1)
+	if analysisResult, err := resolve.ProfileStaticAnalysis(ctx, bundle.Capture); err == nil {
+		staticAnalysisResult <- analysisResult
+	} else {
+		log.W(ctx, "Static analysis unavailable for the profiling bundle: %v", err)
+	}
+	close(staticAnalysisResult)
+
+	result, err := trace.ProcessProfilingBundle(ctx, bundle, staticAnalysisResult)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := profile.AddDerivedMetrics(ctx, result, req.DerivedMetrics); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// bundlePath validates the path of a profiling bundle requested by a client.
+func (s *server) bundlePath(p string) (string, error) {
+	if !s.enableLocalFiles {
+		return "", fmt.Errorf("Server not configured to allow access to local files")
+	}
+	return trace.BundlePath(s.bundleDir, p)
+}
+
+func (s *server) CompareProfiles(ctx context.Context, baseline, current *service.ProfilingData) (*service.ProfileComparison, error) {
+	ctx = status.Start(ctx, "RPC CompareProfiles")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "CompareProfiles")
+	return resolve.CompareProfiles(ctx, baseline, current)
+}
+
+func (s *server) LoopReplay(ctx context.Context, req *service.LoopReplayRequest) (*service.LoopReplayResult, error) {
+	ctx = status.Start(ctx, "RPC LoopReplay")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "LoopReplay")
+	return replay.LoopReplay(ctx, req.Capture, req.Device, req.StartFrame, req.EndFrame, req.LoopCount)
+}
+
 func (s *server) PerfettoQuery(ctx context.Context, c *path.Capture, query string) (*perfetto.QueryResult, error) {
 	ctx = status.Start(ctx, "RPC PerfettoQuery")
 	defer status.Finish(ctx)
@@ -14,7 +14,10 @@
 
 package service
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 func (e *ErrDataUnavailable) Error() string {
 	return fmt.Sprintf("The requested data is unavailable. Reason: %v", e.Reason.Text(nil))
@@ -39,3 +42,15 @@ func (e *ErrInternal) Error() string {
 func (e *ErrUnsupportedVersion) Error() string {
 	return fmt.Sprintf("Unsupported version: %v", e.Reason.Text(nil))
 }
+
+func (e *ErrShaderCompile) Error() string {
+	msgs := []string{"The shader failed to compile:"}
+	for _, d := range e.Diagnostics {
+		if d.Line == 0 {
+			msgs = append(msgs, fmt.Sprintf("%v: %s", d.Stage, d.Message))
+		} else {
+			msgs = append(msgs, fmt.Sprintf("%v:%d: %s", d.Stage, d.Line, d.Message))
+		}
+	}
+	return strings.Join(msgs, "\n")
+}
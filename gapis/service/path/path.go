@@ -77,6 +77,7 @@ func (n *Field) Path() *Any                     { return &Any{Path: &Any_Field{n
 func (n *Framegraph) Path() *Any                { return &Any{Path: &Any_Framegraph{n}} }
 func (n *GlobalState) Path() *Any               { return &Any{Path: &Any_GlobalState{n}} }
 func (n *ImageInfo) Path() *Any                 { return &Any{Path: &Any_ImageInfo{n}} }
+func (n *Logcat) Path() *Any                    { return &Any{Path: &Any_Logcat{n}} }
 func (n *MapIndex) Path() *Any                  { return &Any{Path: &Any_MapIndex{n}} }
 func (n *Memory) Path() *Any                    { return &Any{Path: &Any_Memory{n}} }
 func (n *MemoryAsType) Path() *Any              { return &Any{Path: &Any_MemoryAsType{n}} }
@@ -84,6 +85,7 @@ func (n *Mesh) Path() *Any                      { return &Any{Path: &Any_Mesh{n}
 func (n *Metrics) Path() *Any                   { return &Any{Path: &Any_Metrics{n}} }
 func (n *Parameter) Path() *Any                 { return &Any{Path: &Any_Parameter{n}} }
 func (n *Pipelines) Path() *Any                 { return &Any{Path: &Any_Pipelines{n}} }
+func (n *PixelHistory) Path() *Any              { return &Any{Path: &Any_PixelHistory{n}} }
 func (n *Report) Path() *Any                    { return &Any{Path: &Any_Report{n}} }
 func (n *ResourceData) Path() *Any              { return &Any{Path: &Any_ResourceData{n}} }
 func (n *Messages) Path() *Any                  { return &Any{Path: &Any_Messages{n}} }
@@ -120,6 +122,7 @@ func (n Field) Parent() Node                     { return oneOfNode(n.Struct) }
 func (n Framegraph) Parent() Node                { return n.Capture }
 func (n GlobalState) Parent() Node               { return n.After }
 func (n ImageInfo) Parent() Node                 { return nil }
+func (n Logcat) Parent() Node                    { return n.Capture }
 func (n MapIndex) Parent() Node                  { return oneOfNode(n.Map) }
 func (n Memory) Parent() Node                    { return n.After }
 func (n MemoryAsType) Parent() Node              { return n.After }
@@ -128,6 +131,7 @@ func (n Metrics) Parent() Node                   { return n.Command }
 func (n Messages) Parent() Node                  { return n.Capture }
 func (n Parameter) Parent() Node                 { return n.Command }
 func (n Pipelines) Parent() Node                 { return oneOfNode(n.Object) }
+func (n PixelHistory) Parent() Node              { return n.Commands }
 func (n Report) Parent() Node                    { return n.Capture }
 func (n ResourceData) Parent() Node              { return n.After }
 func (n ResourceExtras) Parent() Node            { return n.After }
@@ -160,11 +164,13 @@ func (n *FramebufferAttachment) SetParent(p Node)     { n.After, _ = p.(*Command
 func (n *Framegraph) SetParent(p Node)                { n.Capture, _ = p.(*Capture) }
 func (n *GlobalState) SetParent(p Node)               { n.After, _ = p.(*Command) }
 func (n *ImageInfo) SetParent(p Node)                 {}
+func (n *Logcat) SetParent(p Node)                    { n.Capture, _ = p.(*Capture) }
 func (n *Memory) SetParent(p Node)                    { n.After, _ = p.(*Command) }
 func (n *MemoryAsType) SetParent(p Node)              { n.After, _ = p.(*Command) }
 func (n *Metrics) SetParent(p Node)                   { n.Command, _ = p.(*Command) }
 func (n *Messages) SetParent(p Node)                  { n.Capture, _ = p.(*Capture) }
 func (n *Parameter) SetParent(p Node)                 { n.Command, _ = p.(*Command) }
+func (n *PixelHistory) SetParent(p Node)              { n.Commands, _ = p.(*Commands) }
 func (n *Report) SetParent(p Node)                    { n.Capture, _ = p.(*Capture) }
 func (n *ResourceData) SetParent(p Node)              { n.After, _ = p.(*Command) }
 func (n *ResourceExtras) SetParent(p Node)            { n.After, _ = p.(*Command) }
@@ -264,6 +270,9 @@ func (n MemoryAsType) Format(f fmt.State, c rune) {
 // Format implements fmt.Formatter to print the message path.
 func (n Messages) Format(f fmt.State, c rune) { fmt.Fprintf(f, "%v.messages", n.Parent()) }
 
+// Format implements fmt.Formatter to print the logcat path.
+func (n Logcat) Format(f fmt.State, c rune) { fmt.Fprintf(f, "%v.logcat", n.Parent()) }
+
 // Format implements fmt.Formatter to print the path.
 func (n Mesh) Format(f fmt.State, c rune) { fmt.Fprintf(f, "%v.mesh", n.Parent()) }
 
@@ -297,6 +306,11 @@ func (n MultiResourceData) Format(f fmt.State, c rune) {
 // Format implements fmt.Formatter to print the path.
 func (n Pipelines) Format(f fmt.State, c rune) { fmt.Fprintf(f, "%v.pipelines", n.Parent()) }
 
+// Format implements fmt.Formatter to print the path.
+func (n PixelHistory) Format(f fmt.State, c rune) {
+	fmt.Fprintf(f, "%v.pixel-history<%d, %d, %d>", n.Parent(), n.Attachment, n.X, n.Y)
+}
+
 // Format implements fmt.Formatter to print the path.
 func (n Resources) Format(f fmt.State, c rune) { fmt.Fprintf(f, "%v.resources", n.Parent()) }
 
@@ -599,6 +613,11 @@ func (n *Capture) Messages() *Messages {
 	return &Messages{Capture: n}
 }
 
+// Logcat returns the path node to the capture's logcat messages.
+func (n *Capture) Logcat() *Logcat {
+	return &Logcat{Capture: n}
+}
+
 // Commands returns the path node to the capture's commands.
 func (n *Capture) Commands() *Commands {
 	return &Commands{
@@ -815,6 +834,12 @@ func (n *Commands) Last() *Command {
 	return &Command{Capture: n.Capture, Indices: n.To}
 }
 
+// PixelHistory returns the path node to the history of the pixel (x, y) of the
+// given framebuffer attachment over this range of commands.
+func (n *Commands) PixelHistory(attachment, x, y uint32) *PixelHistory {
+	return &PixelHistory{Commands: n, Attachment: attachment, X: x, Y: y}
+}
+
 // Index returns the path to the i'th child of the StateTreeNode.
 func (n *StateTreeNode) Index(i ...uint64) *StateTreeNode {
 	newIndices := make([]uint64, len(n.Indices)+len(i))
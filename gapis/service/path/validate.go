@@ -230,6 +230,11 @@ func (n *Mesh) Validate() error {
 	return checkNotNilAndValidate(n, protoutil.OneOf(n.Object), "object")
 }
 
+// Validate checks the path is valid.
+func (n *Logcat) Validate() error {
+	return checkNotNilAndValidate(n, n.Capture, "capture")
+}
+
 // Validate checks the path is valid.
 func (n *Messages) Validate() error {
 	return checkNotNilAndValidate(n, n.Capture, "capture")
@@ -253,6 +258,11 @@ func (n *Pipelines) Validate() error {
 	return checkNotNilAndValidate(n, protoutil.OneOf(n.Object), "object")
 }
 
+// Validate checks the path is valid.
+func (n *PixelHistory) Validate() error {
+	return checkNotNilAndValidate(n, n.Commands, "commands")
+}
+
 // Validate checks the path is valid.
 func (n *Report) Validate() error {
 	return checkNotNilAndValidate(n, n.Capture, "capture")
@@ -0,0 +1,271 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/gapis/service/path"
+)
+
+const (
+	chromeTraceGpuPid     = 1
+	chromeTraceCounterPid = 2
+)
+
+// chromeTraceEvent is a single event in the Chrome trace event format.
+// See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type chromeTraceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Dur  *float64               `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int32                  `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type chromeTrace struct {
+	TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string             `json:"displayTimeUnit"`
+}
+
+// nsToUs converts a perfetto nanosecond timestamp to the microseconds used by
+// the Chrome trace event format.
+func nsToUs(ns uint64) float64 {
+	return float64(ns) / 1000
+}
+
+// CommandRange returns a human readable representation of the command range of the
+// group, or an empty string if the group has no link.
+func (g *ProfilingData_Group) CommandRange() string {
+	return formatCommandRange(g.GetLink())
+}
+
+// CommandRange returns a human readable representation of the command range of the
+// compared group, or an empty string if the group has no link.
+func (g *ProfileComparison_GroupDelta) CommandRange() string {
+	return formatCommandRange(g.GetLink())
+}
+
+func formatCommandRange(link *path.Commands) string {
+	if link == nil {
+		return ""
+	}
+	if reflect.DeepEqual(link.From, link.To) {
+		return fmt.Sprint(link.From)
+	}
+	return fmt.Sprint(link.From) + "-" + fmt.Sprint(link.To)
+}
+
+// WriteChromeTrace writes the GPU slices and counters of the profiling data
+// to w in the Chrome trace event JSON format, which can be loaded by
+// chrome://tracing and the Perfetto UI. Slices that belong to a command group
+// are labeled with the group's name.
+func (d *ProfilingData) WriteChromeTrace(w io.Writer) error {
+	groups := map[int32]*ProfilingData_Group{}
+	for _, g := range d.GetGroups() {
+		groups[g.Id] = g
+	}
+
+	events := []chromeTraceEvent{
+		{Name: "process_name", Ph: "M", Pid: chromeTraceGpuPid, Args: map[string]interface{}{"name": "GPU"}},
+	}
+	for _, t := range d.GetSlices().GetTracks() {
+		events = append(events, chromeTraceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  chromeTraceGpuPid,
+			Tid:  t.Id,
+			Args: map[string]interface{}{"name": t.Name},
+		})
+	}
+
+	for _, s := range d.GetSlices().GetSlices() {
+		name := s.Label
+		args := map[string]interface{}{"label": s.Label}
+		if g, ok := groups[s.GroupId]; ok {
+			name = g.Name
+			if r := g.CommandRange(); r != "" {
+				args["commands"] = r
+			}
+		}
+		for _, e := range s.Extras {
+			switch v := e.Value.(type) {
+			case *ProfilingData_GpuSlices_Slice_Extra_IntValue:
+				args[e.Name] = v.IntValue
+			case *ProfilingData_GpuSlices_Slice_Extra_DoubleValue:
+				args[e.Name] = v.DoubleValue
+			case *ProfilingData_GpuSlices_Slice_Extra_StringValue:
+				args[e.Name] = v.StringValue
+			}
+		}
+		dur := nsToUs(s.Dur)
+		events = append(events, chromeTraceEvent{
+			Name: name,
+			Cat:  "gpu",
+			Ph:   "X",
+			Ts:   nsToUs(s.Ts),
+			Dur:  &dur,
+			Pid:  chromeTraceGpuPid,
+			Tid:  s.TrackId,
+			Args: args,
+		})
+	}
+
+	if len(d.GetCounters()) > 0 {
+		events = append(events, chromeTraceEvent{
+			Name: "process_name",
+			Ph:   "M",
+			Pid:  chromeTraceCounterPid,
+			Args: map[string]interface{}{"name": "GPU Counters"},
+		})
+	}
+	for _, c := range d.GetCounters() {
+		for i, ts := range c.Timestamps {
+			if i >= len(c.Values) {
+				break
+			}
+			events = append(events, chromeTraceEvent{
+				Name: c.Name,
+				Cat:  "counter",
+				Ph:   "C",
+				Ts:   nsToUs(ts),
+				Pid:  chromeTraceCounterPid,
+				Args: map[string]interface{}{"value": c.Values[i]},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(chromeTrace{TraceEvents: events, DisplayTimeUnit: "ns"})
+}
+
+// WriteCounterCSV writes the aggregated GPU counter metrics of the profiling
+// data to w as CSV, with one row per command group and one column per metric.
+// The metric values are the best guess estimates.
+func (d *ProfilingData) WriteCounterCSV(w io.Writer) error {
+	metrics := d.GetGpuCounters().GetMetrics()
+	groups := map[int32]*ProfilingData_Group{}
+	for _, g := range d.GetGroups() {
+		groups[g.Id] = g
+	}
+
+	out := csv.NewWriter(w)
+	header := []string{"Group ID", "Parent ID", "Name", "Commands"}
+	for _, m := range metrics {
+		header = append(header, m.Name)
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	entries := append([]*ProfilingData_GpuCounters_Entry{}, d.GetGpuCounters().GetEntries()...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].GroupId < entries[j].GroupId })
+	for _, e := range entries {
+		row := []string{strconv.Itoa(int(e.GroupId)), "", "", ""}
+		if g, ok := groups[e.GroupId]; ok {
+			row[1] = strconv.Itoa(int(g.ParentId))
+			row[2] = g.Name
+			row[3] = g.CommandRange()
+		}
+		for _, m := range metrics {
+			if v, ok := e.MetricToValue[m.Id]; ok {
+				row = append(row, strconv.FormatFloat(v.Estimate, 'g', -1, 64))
+			} else {
+				row = append(row, "")
+			}
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// ParseDerivedMetrics parses derived metric definitions from r. Each line
+// defines one metric in the form 'Name [aggregation] = expression', as parsed
+// by ParseDerivedMetric. Empty lines and lines
+// starting with '#' are ignored. The expressions are validated by the server
+// when profiling.
+func ParseDerivedMetrics(r io.Reader) ([]*DerivedMetric, error) {
+	out := []*DerivedMetric{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		metric, err := ParseDerivedMetric(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		out = append(out, metric)
+	}
+	return out, scanner.Err()
+}
+
+// derivedMetricAggregations maps the aggregations of derived metric
+// definitions to their value.
+var derivedMetricAggregations = map[string]DerivedMetric_Aggregation{
+	"none": DerivedMetric_None,
+	"sum":  DerivedMetric_Summation,
+	"avg":  DerivedMetric_TimeWeightedAvg,
+}
+
+// ParseDerivedMetric parses a single derived metric definition of the form
+// 'Name = expression'. The name may be followed by the aggregation of the
+// metric across groups in brackets, one of '[none]', the default, '[sum]' or
+// '[avg]' for a time weighted average.
+func ParseDerivedMetric(def string) (*DerivedMetric, error) {
+	eq := strings.IndexByte(def, '=')
+	if eq < 0 {
+		return nil, fmt.Errorf("expected 'name = expression', got '%s'", def)
+	}
+	metric := &DerivedMetric{
+		Name:       strings.TrimSpace(def[:eq]),
+		Expression: strings.TrimSpace(def[eq+1:]),
+	}
+	if strings.HasSuffix(metric.Name, "]") {
+		open := strings.LastIndexByte(metric.Name, '[')
+		if open < 0 {
+			return nil, fmt.Errorf("missing '[' before the aggregation in '%s'", def)
+		}
+		aggregation, ok := derivedMetricAggregations[strings.TrimSpace(metric.Name[open+1:len(metric.Name)-1])]
+		if !ok {
+			return nil, fmt.Errorf("unknown aggregation in '%s', expected none, sum or avg", def)
+		}
+		metric.Name = strings.TrimSpace(metric.Name[:open])
+		metric.Aggregation = aggregation
+	}
+	if metric.Name == "" {
+		return nil, fmt.Errorf("missing metric name in '%s'", def)
+	}
+	if metric.Expression == "" {
+		return nil, fmt.Errorf("missing expression in '%s'", def)
+	}
+	return metric, nil
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func testProfilingData() *service.ProfilingData {
+	c := &path.Capture{}
+	return &service.ProfilingData{
+		Groups: []*service.ProfilingData_Group{
+			{Id: 1, Name: "RenderPass", Link: &path.Commands{From: []uint64{10, 0}, To: []uint64{10, 0}}},
+			{Id: 2, Name: "Draw", ParentId: 1, Link: c.CommandRange(10, 12)},
+		},
+		Slices: &service.ProfilingData_GpuSlices{
+			Tracks: []*service.ProfilingData_GpuSlices_Track{{Id: 3, Name: "Queue"}},
+			Slices: []*service.ProfilingData_GpuSlices_Slice{
+				{Ts: 2000, Dur: 500, Label: "draw", TrackId: 3, GroupId: 2, Extras: []*service.ProfilingData_GpuSlices_Slice_Extra{
+					{Name: "submission", Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: 4}},
+				}},
+			},
+		},
+		Counters: []*service.ProfilingData_Counter{
+			{Name: "Cycles", Timestamps: []uint64{1000, 3000}, Values: []float64{5, 7}},
+		},
+		GpuCounters: &service.ProfilingData_GpuCounters{
+			Metrics: []*service.ProfilingData_GpuCounters_Metric{
+				{Id: 0, Name: "GPU Time"},
+				{Id: 1, Name: "Cycles"},
+			},
+			Entries: []*service.ProfilingData_GpuCounters_Entry{
+				{GroupId: 2, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+					0: {Estimate: 500},
+				}},
+				{GroupId: 1, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+					0: {Estimate: 500},
+					1: {Estimate: 2.5},
+				}},
+			},
+		},
+	}
+}
+
+func TestCommandRange(t *testing.T) {
+	ctx := log.Testing(t)
+	groups := testProfilingData().Groups
+	assert.For(ctx, "single").ThatString(groups[0].CommandRange()).Equals("[10 0]")
+	assert.For(ctx, "range").ThatString(groups[1].CommandRange()).Equals("[10]-[12]")
+	assert.For(ctx, "no link").ThatString((&service.ProfilingData_Group{}).CommandRange()).Equals("")
+}
+
+func TestWriteChromeTrace(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	assert.For(ctx, "err").ThatError(testProfilingData().WriteChromeTrace(buf)).Succeeded()
+
+	var trace struct {
+		TraceEvents []struct {
+			Name string                 `json:"name"`
+			Ph   string                 `json:"ph"`
+			Ts   float64                `json:"ts"`
+			Dur  float64                `json:"dur"`
+			Pid  int                    `json:"pid"`
+			Tid  int32                  `json:"tid"`
+			Args map[string]interface{} `json:"args"`
+		} `json:"traceEvents"`
+		DisplayTimeUnit string `json:"displayTimeUnit"`
+	}
+	assert.For(ctx, "unmarshal").ThatError(json.Unmarshal(buf.Bytes(), &trace)).Succeeded()
+	assert.For(ctx, "unit").ThatString(trace.DisplayTimeUnit).Equals("ns")
+
+	phases := []string{}
+	for _, e := range trace.TraceEvents {
+		phases = append(phases, e.Ph)
+	}
+	assert.For(ctx, "phases").ThatSlice(phases).Equals([]string{"M", "M", "X", "M", "C", "C"})
+
+	slice := trace.TraceEvents[2]
+	assert.For(ctx, "slice name").ThatString(slice.Name).Equals("Draw")
+	assert.For(ctx, "slice ts").That(slice.Ts).Equals(2.0)
+	assert.For(ctx, "slice dur").That(slice.Dur).Equals(0.5)
+	assert.For(ctx, "slice tid").That(slice.Tid).Equals(int32(3))
+	assert.For(ctx, "slice commands").That(slice.Args["commands"]).Equals("[10]-[12]")
+	assert.For(ctx, "slice extra").That(slice.Args["submission"]).Equals(4.0)
+
+	counter := trace.TraceEvents[5]
+	assert.For(ctx, "counter name").ThatString(counter.Name).Equals("Cycles")
+	assert.For(ctx, "counter ts").That(counter.Ts).Equals(3.0)
+	assert.For(ctx, "counter value").That(counter.Args["value"]).Equals(7.0)
+}
+
+func TestWriteCounterCSV(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	assert.For(ctx, "err").ThatError(testProfilingData().WriteCounterCSV(buf)).Succeeded()
+	assert.For(ctx, "csv").ThatString(buf.String()).Equals(
+		"Group ID,Parent ID,Name,Commands,GPU Time,Cycles\n" +
+			"1,0,RenderPass,[10 0],500,2.5\n" +
+			"2,1,Draw,[10]-[12],500,\n")
+}
+
+func TestParseDerivedMetric(t *testing.T) {
+	assert := assert.To(t)
+	for _, test := range []struct {
+		def         string
+		name        string
+		aggregation service.DerivedMetric_Aggregation
+	}{
+		{"ALU Utilization = 100 * alu_cycles / gpu_cycles", "ALU Utilization", service.DerivedMetric_None},
+		{"Cycles [sum] = alu_cycles + tex_cycles", "Cycles", service.DerivedMetric_Summation},
+		{"Load [ avg ]= alu_cycles / gpu_cycles", "Load", service.DerivedMetric_TimeWeightedAvg},
+		{"Ratio [none] = a / b", "Ratio", service.DerivedMetric_None},
+	} {
+		metric, err := service.ParseDerivedMetric(test.def)
+		if !assert.For("%v err", test.def).ThatError(err).Succeeded() {
+			continue
+		}
+		assert.For("%v name", test.def).ThatString(metric.Name).Equals(test.name)
+		assert.For("%v aggregation", test.def).That(metric.Aggregation).Equals(test.aggregation)
+	}
+
+	for _, def := range []string{"Cycles [max] = a + b", "Cycles] = a + b", "[sum] = a + b", "Cycles [sum]"} {
+		_, err := service.ParseDerivedMetric(def)
+		assert.For("%v err", def).ThatError(err).Failed()
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/google/gapid/core/app/status"
 	"github.com/google/gapid/core/data/id"
 	"github.com/google/gapid/core/data/protoutil"
 	"github.com/google/gapid/core/image"
@@ -114,7 +115,8 @@ type Service interface {
 
 	// Set creates a copy of the capture referenced by p, but with the object, value
 	// or memory at p replaced with v. The path returned is identical to p, but with
-	// the base changed to refer to the new capture.
+	// the base changed to refer to the new capture. v may also be the *Value
+	// boxing the value.
 	Set(ctx context.Context, p *path.Any, v interface{}, c *path.ResolveConfig) (*path.Any, error)
 
 	// Delete creates a copy of the capture referenced by p, but without the object, value
@@ -122,6 +124,17 @@ type Service interface {
 	// the base changed to refer to the new capture.
 	Delete(ctx context.Context, p *path.Any, c *path.ResolveConfig) (*path.Any, error)
 
+	// Insert creates a copy of the capture referenced by p, but with the command
+	// cmd inserted at p. The memory read and written by the command's pointer
+	// parameters is described by obs. The path returned refers to the inserted
+	// command in the new capture.
+	Insert(ctx context.Context, p *path.Command, cmd *api.Command, obs []*CommandObservation, c *path.ResolveConfig) (*path.Command, error)
+
+	// Move creates a copy of the capture referenced by from, but with the command
+	// at from moved to the index of to. The path returned refers to the moved
+	// command in the new capture.
+	Move(ctx context.Context, from, to *path.Command, c *path.ResolveConfig) (*path.Command, error)
+
 	// Follow returns the path to the object that the value at p links to.
 	// If the value at p does not link to anything then nil is returned.
 	Follow(ctx context.Context, p *path.Any, c *path.ResolveConfig) (*path.Any, error)
@@ -134,6 +147,11 @@ type Service interface {
 	// This is a debug API, and may be removed in the future.
 	Profile(ctx context.Context, pprof, trace io.Writer, memorySnapshotInterval uint32) (stop func() error, err error)
 
+	// TraceRequests starts tracing the tasks and replays run by the server for
+	// the requests with the trace identifier id. Chrome trace data of their
+	// spans will be written to trace until stop is called.
+	TraceRequests(ctx context.Context, id status.TraceID, trace io.Writer) (stop func() error, err error)
+
 	// Status starts resolving status events. It calls f for every update and m for every memory update.
 	Status(ctx context.Context,
 		snapshotInterval time.Duration,
@@ -178,6 +196,17 @@ type Service interface {
 	// Get timestamps from GPU for commands.
 	GpuProfile(ctx context.Context, req *GpuProfileRequest) (*ProfilingData, error)
 
+	// GpuProfileFromBundle processes the raw profiling data saved by a
+	// previous GpuProfile call, without requiring a device.
+	GpuProfileFromBundle(ctx context.Context, req *GpuProfileFromBundleRequest) (*ProfilingData, error)
+
+	// CompareProfiles compares two results of GpuProfile.
+	CompareProfiles(ctx context.Context, baseline, current *ProfilingData) (*ProfileComparison, error)
+
+	// LoopReplay replays a range of frames repeatedly, returning the frame
+	// times of each repetition.
+	LoopReplay(ctx context.Context, req *LoopReplayRequest) (*LoopReplayResult, error)
+
 	// Run a perfetto query
 	PerfettoQuery(ctx context.Context, c *path.Capture, query string) (*perfetto.QueryResult, error)
 
@@ -188,6 +217,18 @@ type Service interface {
 	// trimmed from resources not needed by the capture commands.
 	TrimCaptureInitialState(ctx context.Context, p *path.Capture) (*path.Capture, error)
 
+	// GetCaptureHistory returns the edits that derived the capture c from the
+	// capture it was originally loaded from.
+	GetCaptureHistory(ctx context.Context, c *path.Capture) (*CaptureHistory, error)
+
+	// DiffCapture returns the differences between the capture c and the capture
+	// it was derived from.
+	DiffCapture(ctx context.Context, c *path.Capture) (*CaptureDiff, error)
+
+	// ApplyEdits applies the sequence of edits to the capture c, returning the
+	// path to the capture produced by the last edit.
+	ApplyEdits(ctx context.Context, c *path.Capture, edits []*EditOperation) (*path.Capture, error)
+
 	// ValidateDevice validates the GPU profiling capabilities of the given device and returns
 	// an error if validation failed or the GPU profiling data is invalid.
 	ValidateDevice(ctx context.Context, d *path.Device) (*DeviceValidationResult, error)
@@ -230,6 +271,8 @@ func NewError(err error) *Error {
 			return &Error{Err: &Error_ErrPathNotFollowable{err}}
 		case *ErrUnsupportedVersion:
 			return &Error{Err: &Error_ErrUnsupportedVersion{err}}
+		case *ErrShaderCompile:
+			return &Error{Err: &Error_ErrShaderCompile{err}}
 		}
 
 		causer, ok := cause.(causer)
@@ -272,6 +315,8 @@ func NewValue(v interface{}) *Value {
 		return &Value{Val: &Value_Resources{v}}
 	case *Messages:
 		return &Value{Val: &Value_Messages{v}}
+	case *LogcatMessages:
+		return &Value{Val: &Value_Logcat{v}}
 	case *StateTree:
 		return &Value{Val: &Value_StateTree{v}}
 	case *StateTreeNode:
@@ -300,6 +345,8 @@ func NewValue(v interface{}) *Value {
 		return &Value{Val: &Value_FramebufferAttachments{v}}
 	case *FramebufferAttachment:
 		return &Value{Val: &Value_FramebufferAttachment{v}}
+	case *PixelHistory:
+		return &Value{Val: &Value_PixelHistory{v}}
 	case *api.Framegraph:
 		return &Value{Val: &Value_Framegraph{v}}
 	case *DeviceTraceConfiguration:
@@ -298,6 +298,41 @@ func ExtractDebugSource(shader []uint32) (string, string, bool, error) {
 	return retSource, sourceLanguage, isCrossCompiled, retError
 }
 
+// DecompileGlsl returns the shader decompiled to Vulkan GLSL by SPIRV-Cross,
+// whatever its source language. Unlike ExtractDebugSource it does not need
+// the shader to carry any debug information, and the result can be compiled
+// again with CompileGlsl.
+func DecompileGlsl(shader []uint32) (string, error) {
+	if len(shader) == 0 {
+		return "", errors.New("Empty Shader")
+	}
+
+	var context C.spvc_context = nil
+	var ir C.spvc_parsed_ir = nil
+	var compiler C.spvc_compiler = nil
+	var options C.spvc_compiler_options = nil
+	var result *C.char = nil
+
+	C.spvc_context_create(&context)
+	defer C.spvc_context_destroy(context)
+
+	if C.spvc_context_parse_spirv(context, (*C.uint)(unsafe.Pointer(&shader[0])), (C.size_t)(len(shader)), &ir) != C.SPVC_SUCCESS {
+		return "", errors.New("Could not parse the SPIR-V shader")
+	}
+	if C.spvc_context_create_compiler(context, C.SPVC_BACKEND_GLSL, ir, C.SPVC_CAPTURE_MODE_TAKE_OWNERSHIP, &compiler) != C.SPVC_SUCCESS {
+		return "", errors.New("Could not create GLSL compiler")
+	}
+	C.spvc_compiler_create_compiler_options(compiler, &options)
+	C.spvc_compiler_options_set_uint(options, C.SPVC_COMPILER_OPTION_GLSL_VERSION, 450)
+	C.spvc_compiler_options_set_bool(options, C.SPVC_COMPILER_OPTION_GLSL_VULKAN_SEMANTICS, C.SPVC_TRUE)
+	C.spvc_compiler_install_compiler_options(compiler, options)
+
+	if C.spvc_compiler_compile(compiler, &result) != C.SPVC_SUCCESS {
+		return "", fmt.Errorf("Could not decompile the shader: %v", C.GoString(C.spvc_context_get_last_error_string(context)))
+	}
+	return C.GoString(result), nil
+}
+
 // ParseAllDescriptorSets determines what descriptor sets are implied by the
 // shader, for all entry points of the shader.
 func ParseAllDescriptorSets(shader []uint32) (map[string]DescriptorSets, error) {
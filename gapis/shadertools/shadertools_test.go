@@ -603,3 +603,47 @@ var (
                OpReturn
                OpFunctionEnd`
 )
+
+func TestDecompileGlsl(t *testing.T) {
+	ctx := log.Testing(t)
+	// A fragment shader without any OpSource debug information, as found in
+	// release builds.
+	shader := shadertools.AssembleSpirvText(`
+               OpCapability Shader
+               OpMemoryModel Logical GLSL450
+               OpEntryPoint Fragment %main "main" %color
+               OpExecutionMode %main OriginUpperLeft
+               OpDecorate %color Location 0
+       %void = OpTypeVoid
+         %fn = OpTypeFunction %void
+      %float = OpTypeFloat 32
+    %v4float = OpTypeVector %float 4
+  %ptr_color = OpTypePointer Output %v4float
+      %color = OpVariable %ptr_color Output
+    %float_1 = OpConstant %float 1
+      %white = OpConstantComposite %v4float %float_1 %float_1 %float_1 %float_1
+       %main = OpFunction %void None %fn
+      %entry = OpLabel
+               OpStore %color %white
+               OpReturn
+               OpFunctionEnd
+`)
+
+	_, _, _, err := shadertools.ExtractDebugSource(shader)
+	assert.For(ctx, "ExtractDebugSource").ThatError(err).Failed()
+
+	src, err := shadertools.DecompileGlsl(shader)
+	if !assert.For(ctx, "DecompileGlsl").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "src").ThatString(src).Contains("void main()")
+
+	_, err = shadertools.CompileGlsl(src, shadertools.CompileOptions{
+		ShaderType: shadertools.TypeFragment,
+		ClientType: shadertools.Vulkan,
+	})
+	assert.For(ctx, "CompileGlsl").ThatError(err).Succeeded()
+
+	_, err = shadertools.DecompileGlsl(nil)
+	assert.For(ctx, "empty").ThatError(err).Failed()
+}
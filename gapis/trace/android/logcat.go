@@ -0,0 +1,161 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android"
+	"github.com/google/gapid/core/os/android/adb"
+	gapii "github.com/google/gapid/gapii/client"
+	"github.com/google/gapid/gapis/capture"
+)
+
+const (
+	// logcatFlushDelay is how long logcat keeps being recorded once the
+	// capture is complete, for the last messages to reach the host.
+	logcatFlushDelay = time.Second
+
+	// logcatUIDMinAPI is the first API level supporting the logcat --uid
+	// option.
+	logcatUIDMinAPI = 28
+)
+
+// deviceClocks returns the current wall clock time of the device, and the
+// wall clock time at which its boot time clock, used for the capture
+// timestamps, was zero. The latter is only accurate to about 10ms.
+func deviceClocks(ctx context.Context, d adb.Device) (now, boot time.Time, err error) {
+	out, err := d.Shell("cat", "/proc/uptime", ";", "date", "+%s%N").Call(ctx)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	// "<uptime> <idle time>\n<nanoseconds since epoch>"
+	fields := strings.Fields(out)
+	if len(fields) != 3 {
+		return time.Time{}, time.Time{}, fmt.Errorf("Unexpected device clocks: %s", out)
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("Unexpected device uptime: %s", fields[0])
+	}
+	wall, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("Unexpected device time: %s", fields[2])
+	}
+	now = time.Unix(0, wall)
+	return now, now.Add(-time.Duration(uptime * float64(time.Second))), nil
+}
+
+// logcatProcess is a gapii process recording the logcat messages of the
+// traced application while it is captured.
+type logcatProcess struct {
+	*gapii.Process
+	// boot is the device wall clock time at which its boot time clock was zero.
+	boot   time.Time
+	cancel task.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+	msgs   []android.LogcatMessage
+}
+
+// recordLogcat starts recording the logcat messages of the application of
+// the package pkg, traced by p, logged since the device time since. It
+// returns nil if the messages of the application cannot be told apart from
+// the others.
+func recordLogcat(ctx context.Context, d adb.Device, p *gapii.Process, pkg *android.InstalledPackage, since, boot time.Time) *logcatProcess {
+	filter := android.LogcatFilter{Since: since}
+	if pkg.UserID != 0 && d.Instance().GetConfiguration().GetOS().GetAPIVersion() >= logcatUIDMinAPI {
+		filter.UserID = pkg.UserID
+	} else if p.PID != 0 {
+		filter.ProcessID = p.PID
+	} else {
+		log.W(ctx, "Unknown process of %v, not recording logcat", pkg.Name)
+		return nil
+	}
+
+	ctx, cancel := task.WithCancel(ctx)
+	lp := &logcatProcess{
+		Process: p,
+		boot:    boot,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	msgs := make(chan android.LogcatMessage, 64)
+	crash.Go(func() {
+		if err := d.LogcatFiltered(ctx, filter, msgs); err != nil && !task.Stopped(ctx) {
+			log.W(ctx, "Recording logcat failed: %v", err)
+		}
+	})
+	crash.Go(func() {
+		defer close(lp.done)
+		for m := range msgs {
+			lp.msgs = append(lp.msgs, m)
+		}
+	})
+	return lp
+}
+
+// Capture captures the traced application, then stops recording logcat.
+func (p *logcatProcess) Capture(ctx context.Context, start task.Signal, stop task.Signal, ready task.Task, w io.Writer, written *int64) (int64, error) {
+	size, err := p.Process.Capture(ctx, start, stop, ready, w, written)
+	p.stop(ctx)
+	return size, err
+}
+
+// stop stops recording logcat, once the last messages had a chance to be
+// received.
+func (p *logcatProcess) stop(ctx context.Context) {
+	p.once.Do(func() {
+		select {
+		case <-p.done:
+		case <-time.After(logcatFlushDelay):
+		}
+		p.cancel()
+		<-p.done
+	})
+}
+
+// CaptureExtras returns the recorded logcat messages.
+func (p *logcatProcess) CaptureExtras(ctx context.Context) []proto.Message {
+	p.stop(ctx)
+	out := make([]proto.Message, 0, len(p.msgs))
+	for _, m := range p.msgs {
+		timestamp := m.Timestamp.Sub(p.boot)
+		if timestamp < 0 {
+			timestamp = 0
+		}
+		// The logcat priorities have the same values in both enums.
+		out = append(out, &capture.LogcatMessage{
+			Timestamp: uint64(timestamp),
+			WallTime:  m.Timestamp.UnixNano(),
+			Priority:  capture.LogcatMessage_Priority(m.Priority),
+			Tag:       m.Tag,
+			Pid:       int32(m.ProcessID),
+			Tid:       int32(m.ThreadID),
+			Message:   m.Message,
+		})
+	}
+	return out
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android"
+	"github.com/google/gapid/core/os/android/adb"
+	"github.com/google/gapid/core/os/android/adb/fake"
+	"github.com/google/gapid/core/os/device/bind"
+	gapii "github.com/google/gapid/gapii/client"
+	"github.com/google/gapid/gapis/capture"
+)
+
+// logcatDevice is an adb.Device whose logcat messages are given by the test.
+type logcatDevice struct {
+	adb.Device
+	filter android.LogcatFilter
+	msgs   []android.LogcatMessage
+}
+
+func (d *logcatDevice) LogcatFiltered(ctx context.Context, filter android.LogcatFilter, msgs chan<- android.LogcatMessage) error {
+	defer close(msgs)
+	d.filter = filter
+	for _, m := range d.msgs {
+		msgs <- m
+	}
+	return nil
+}
+
+// startFakeDevice starts a fake adb server serving a device of API level 30,
+// and returns the device with a function to stop the server.
+func startFakeDevice(t *testing.T) (adb.Device, func()) {
+	ctx := log.Testing(t)
+	server, err := fake.NewServer(&fake.Script{Devices: []*fake.Device{{
+		Serial:     "fake-device",
+		Properties: map[string]string{"ro.build.version.sdk": "30"},
+		Commands: []*fake.Command{
+			{Regex: `cat /proc/uptime.*`, Stdout: "100.5 300.25\n1648566990000000000\n"},
+		},
+	}}})
+	if err != nil {
+		t.Fatalf("Failed to start fake adb server: %v", err)
+	}
+	r := bind.NewRegistry()
+	// The registry is used by the device info provider of gapidapk.
+	ctx = bind.PutRegistry(ctx, r)
+	cleanup, err := fake.Register(ctx, server, r)
+	if err != nil {
+		server.Close()
+		t.Fatalf("Failed to register devices: %v", err)
+	}
+	return r.Devices()[0].(adb.Device), func() {
+		cleanup(ctx)
+		server.Close()
+	}
+}
+
+func TestDeviceClocks(t *testing.T) {
+	ctx := log.Testing(t)
+	d, stop := startFakeDevice(t)
+	defer stop()
+
+	now, boot, err := deviceClocks(ctx, d)
+	if assert.For(ctx, "err").ThatError(err).Succeeded() {
+		assert.For(ctx, "now").That(now).Equals(time.Unix(1648566990, 0))
+		assert.For(ctx, "boot").That(boot).Equals(time.Unix(1648566889, 500*1e6))
+	}
+}
+
+func TestRecordLogcat(t *testing.T) {
+	ctx := log.Testing(t)
+	device, stop := startFakeDevice(t)
+	defer stop()
+
+	since := time.Unix(1648566989, 0)
+	boot := time.Unix(1648566889, 500*1e6)
+	d := &logcatDevice{
+		Device: device,
+		msgs: []android.LogcatMessage{
+			{
+				Timestamp: time.Unix(1648566989, 761*1e6),
+				ProcessID: 31608,
+				ThreadID:  31608,
+				Priority:  android.Info,
+				Tag:       "Finsky",
+				Message:   "Verification requested",
+			},
+			{
+				Timestamp: time.Unix(1648566992, 205123*1e3),
+				ProcessID: 31608,
+				ThreadID:  31655,
+				Priority:  android.Error,
+				Tag:       "vulkan",
+				Message:   "Loaded layer VkGraphicsSpy\nsecond line",
+			},
+		},
+	}
+	expected := []*capture.LogcatMessage{
+		{
+			Timestamp: uint64(100261 * time.Millisecond),
+			WallTime:  time.Unix(1648566989, 761*1e6).UnixNano(),
+			Priority:  capture.LogcatMessage_Info,
+			Tag:       "Finsky",
+			Pid:       31608,
+			Tid:       31608,
+			Message:   "Verification requested",
+		},
+		{
+			Timestamp: uint64(102705123 * time.Microsecond),
+			WallTime:  time.Unix(1648566992, 205123*1e3).UnixNano(),
+			Priority:  capture.LogcatMessage_Error,
+			Tag:       "vulkan",
+			Pid:       31608,
+			Tid:       31655,
+			Message:   "Loaded layer VkGraphicsSpy\nsecond line",
+		},
+	}
+
+	for _, test := range []struct {
+		name   string
+		pid    int
+		userID int
+		filter android.LogcatFilter
+	}{
+		// The device supports filtering by user.
+		{"user", 31608, 10123, android.LogcatFilter{Since: since, UserID: 10123}},
+		{"process", 31608, 0, android.LogcatFilter{Since: since, ProcessID: 31608}},
+	} {
+		pkg := &android.InstalledPackage{Name: "com.example.game", UserID: test.userID}
+		lp := recordLogcat(ctx, d, &gapii.Process{PID: test.pid}, pkg, since, boot)
+		if !assert.For(ctx, "%v recording", test.name).That(lp).IsNotNil() {
+			continue
+		}
+
+		msgs := lp.CaptureExtras(ctx)
+		assert.For(ctx, "%v filter", test.name).That(d.filter).Equals(test.filter)
+		if !assert.For(ctx, "%v messages", test.name).That(len(msgs)).Equals(len(expected)) {
+			continue
+		}
+		for i, msg := range msgs {
+			if !proto.Equal(msg, expected[i]) {
+				log.E(ctx, "%v message %v: got %v, expected %v", test.name, i, msg, expected[i])
+			}
+		}
+	}
+
+	// Without a user or process, the messages of the application cannot be
+	// told apart.
+	lp := recordLogcat(ctx, d, &gapii.Process{}, &android.InstalledPackage{Name: "com.example.game"}, since, boot)
+	assert.For(ctx, "unknown process").That(lp).IsNil()
+}
+
+func TestLogcatTimestampBeforeBoot(t *testing.T) {
+	ctx := log.Testing(t)
+	boot := time.Unix(1648566889, 0)
+	lp := &logcatProcess{boot: boot, cancel: func() {}, done: make(chan struct{})}
+	close(lp.done)
+	lp.msgs = []android.LogcatMessage{{Timestamp: boot.Add(-time.Second), Tag: "early"}}
+
+	msgs := lp.CaptureExtras(ctx)
+	if assert.For(ctx, "messages").That(len(msgs)).Equals(1) {
+		assert.For(ctx, "timestamp").That(msgs[0].(*capture.LogcatMessage).Timestamp).Equals(uint64(0))
+	}
+}
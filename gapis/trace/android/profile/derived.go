@@ -0,0 +1,254 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+// groupScope is the metricScope of a single profiling group.
+type groupScope struct {
+	values   map[int32]*service.ProfilingData_GpuCounters_Perf
+	children []*groupScope
+	metrics  map[string]int32                         // normalized metric name -> metric id
+	counters map[int32]*service.ProfilingData_Counter // metric id -> sampled counter
+}
+
+func (s *groupScope) value(name string) (float64, bool) {
+	id, ok := s.metrics[name]
+	if !ok || s.values == nil {
+		return 0, false
+	}
+	perf, ok := s.values[id]
+	if !ok {
+		return 0, false
+	}
+	return perf.Estimate, true
+}
+
+func (s *groupScope) leaves() []metricScope {
+	out := []metricScope{}
+	var visit func(*groupScope)
+	visit = func(g *groupScope) {
+		if len(g.children) == 0 {
+			if g.values != nil {
+				out = append(out, g)
+			}
+			return
+		}
+		for _, c := range g.children {
+			visit(c)
+		}
+	}
+	visit(s)
+	return out
+}
+
+// evaluate evaluates e over the counter samples of the group. The expression
+// is evaluated for each sample of the first sampled counter it references,
+// and the results are aggregated with a time weighted average, like the
+// built-in counter metrics. Expressions that reference no sampled counter are
+// evaluated over the metric values of the group.
+func (s *groupScope) evaluate(e expr) (float64, bool) {
+	ref := int32(-1)
+	for _, name := range referencedMetrics(e) {
+		if id, ok := s.metrics[name]; ok && len(s.samples(id)) > 0 {
+			ref = id
+			break
+		}
+	}
+	if ref < 0 {
+		return e.eval(s)
+	}
+
+	counter := s.counters[ref]
+	valueSum, timeSum := 0.0, 0.0
+	for idx, weight := range s.samples(ref) {
+		v, ok := e.eval(sampleScope{s, counter.Timestamps[idx]})
+		if !ok {
+			continue
+		}
+		duration := float64(counter.Timestamps[idx]-counter.Timestamps[idx-1]) * weight
+		valueSum += v * duration
+		timeSum += duration
+	}
+	if timeSum == 0 {
+		return 0, false
+	}
+	return valueSum / timeSum, true
+}
+
+// samples returns the counter samples attributed to the group for the given
+// metric, mapping the sample index to its weight.
+func (s *groupScope) samples(id int32) map[int32]float64 {
+	if _, ok := s.counters[id]; !ok || s.values == nil {
+		return nil
+	}
+	return s.values[id].GetEstimateSamples()
+}
+
+// sampleScope is the metricScope of a single counter sample of a group. The
+// sampled counters have their value at the time of the sample, all the other
+// metrics have the value of the group.
+type sampleScope struct {
+	group *groupScope
+	ts    uint64
+}
+
+func (s sampleScope) value(name string) (float64, bool) {
+	id, ok := s.group.metrics[name]
+	if !ok {
+		return 0, false
+	}
+	if len(s.group.samples(id)) == 0 {
+		return s.group.value(name)
+	}
+	counter := s.group.counters[id]
+	idx := sort.Search(len(counter.Timestamps), func(i int) bool { return counter.Timestamps[i] >= s.ts })
+	if idx == 0 || idx >= len(counter.Values) {
+		return 0, false
+	}
+	return counter.Values[idx], true
+}
+
+func (s sampleScope) leaves() []metricScope {
+	return s.group.leaves()
+}
+
+// derivedMetricOps maps the aggregation of derived metrics to the aggregation
+// operator of their metric.
+var derivedMetricOps = map[service.DerivedMetric_Aggregation]service.ProfilingData_GpuCounters_Metric_AggregationOperator{
+	service.DerivedMetric_None:            service.ProfilingData_GpuCounters_Metric_None,
+	service.DerivedMetric_Summation:       service.ProfilingData_GpuCounters_Metric_Summation,
+	service.DerivedMetric_TimeWeightedAvg: service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg,
+}
+
+// AddDerivedMetrics evaluates the derived metrics for each group of the
+// profiling data and adds them to its GPU counter metrics. Metrics are
+// evaluated in order, so a derived metric can reference the ones before it.
+// The entries of each group are replaced by a single entry holding both the
+// built-in and the derived metrics.
+func AddDerivedMetrics(ctx context.Context, data *service.ProfilingData, derived []*service.DerivedMetric) error {
+	if len(derived) == 0 {
+		return nil
+	}
+	if data.GpuCounters == nil {
+		data.GpuCounters = &service.ProfilingData_GpuCounters{}
+	}
+
+	countersByID := map[uint32]*service.ProfilingData_Counter{}
+	for _, c := range data.Counters {
+		countersByID[c.Id] = c
+	}
+	metrics := map[string]int32{}
+	counters := map[int32]*service.ProfilingData_Counter{}
+	nextID := int32(0)
+	for _, m := range data.GpuCounters.Metrics {
+		metrics[normalizeMetricName(m.Name)] = m.Id
+		if m.Id >= nextID {
+			nextID = m.Id + 1
+		}
+		if c, ok := countersByID[m.CounterId]; ok && m.Id >= counterMetricIdOffset && len(c.Timestamps) > 0 {
+			counters[m.Id] = c
+		}
+	}
+
+	scopes := map[int32]*groupScope{}
+	getScope := func(id int32) *groupScope {
+		s, ok := scopes[id]
+		if !ok {
+			s = &groupScope{metrics: metrics, counters: counters}
+			scopes[id] = s
+		}
+		return s
+	}
+	for _, g := range data.Groups {
+		s := getScope(g.Id)
+		if g.ParentId != g.Id {
+			parent := getScope(g.ParentId)
+			parent.children = append(parent.children, s)
+		}
+	}
+	// Merge split entries of the same group (e.g. static analysis results)
+	// into a new entry.
+	entries := []*service.ProfilingData_GpuCounters_Entry{}
+	for _, e := range data.GpuCounters.Entries {
+		s := getScope(e.GroupId)
+		if s.values == nil {
+			s.values = map[int32]*service.ProfilingData_GpuCounters_Perf{}
+			entries = append(entries, &service.ProfilingData_GpuCounters_Entry{
+				GroupId:       e.GroupId,
+				MetricToValue: s.values,
+			})
+		}
+		for id, perf := range e.MetricToValue {
+			s.values[id] = perf
+		}
+	}
+
+	for _, d := range derived {
+		e, err := parseExpression(d.Expression)
+		if err != nil {
+			return log.Errf(ctx, err, "Invalid expression for derived metric '%v'", d.Name)
+		}
+		op, ok := derivedMetricOps[d.Aggregation]
+		if !ok {
+			return log.Errf(ctx, nil, "Invalid aggregation %v for derived metric '%v'", d.Aggregation, d.Name)
+		}
+		metric := &service.ProfilingData_GpuCounters_Metric{
+			Id:          nextID,
+			Name:        d.Name,
+			Unit:        d.Unit,
+			Op:          op,
+			Description: d.Description,
+			Type:        service.ProfilingData_GpuCounters_Metric_Derived,
+		}
+		if metric.Description == "" {
+			metric.Description = d.Expression
+		}
+		nextID++
+
+		sum, count := 0.0, 0
+		for _, s := range scopes {
+			if s.values == nil {
+				continue
+			}
+			v, ok := s.evaluate(e)
+			if !ok {
+				continue
+			}
+			s.values[metric.Id] = &service.ProfilingData_GpuCounters_Perf{
+				Estimate: v,
+				Min:      v,
+				Max:      v,
+			}
+			sum += v
+			count++
+		}
+		metric.Average = -1
+		if count > 0 {
+			metric.Average = sum / float64(count)
+		}
+
+		data.GpuCounters.Metrics = append(data.GpuCounters.Metrics, metric)
+		metrics[normalizeMetricName(d.Name)] = metric.Id
+	}
+	data.GpuCounters.Entries = entries
+	return nil
+}
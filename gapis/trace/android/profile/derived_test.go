@@ -0,0 +1,87 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestAddDerivedMetrics(t *testing.T) {
+	ctx := log.Testing(t)
+	samples := map[int32]float64{1: 1, 2: 1}
+	hardware := &service.ProfilingData_GpuCounters_Entry{
+		GroupId: 0,
+		MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+			GpuTimeMetricId: {Estimate: 1000},
+			2:               {Estimate: 50, EstimateSamples: samples},
+			3:               {Estimate: 60, EstimateSamples: samples},
+		},
+	}
+	static := &service.ProfilingData_GpuCounters_Entry{
+		GroupId: 0,
+		MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+			4: {Estimate: 7},
+		},
+	}
+	data := &service.ProfilingData{
+		Groups: []*service.ProfilingData_Group{{Id: 0, Name: "Frame"}},
+		Counters: []*service.ProfilingData_Counter{
+			{Id: 1, Name: "ALU Cycles", Timestamps: []uint64{0, 10, 20}, Values: []float64{0, 10, 90}},
+			{Id: 2, Name: "GPU Cycles", Timestamps: []uint64{0, 10, 20}, Values: []float64{0, 20, 100}},
+			{Id: 3, Name: "Static"},
+		},
+		GpuCounters: &service.ProfilingData_GpuCounters{
+			Metrics: []*service.ProfilingData_GpuCounters_Metric{
+				{Id: GpuTimeMetricId, Name: "GPU Time"},
+				{Id: 2, CounterId: 1, Name: "ALU Cycles"},
+				{Id: 3, CounterId: 2, Name: "GPU Cycles"},
+				{Id: 4, CounterId: 3, Name: "Static"},
+			},
+			Entries: []*service.ProfilingData_GpuCounters_Entry{hardware, static},
+		},
+	}
+
+	err := AddDerivedMetrics(ctx, data, []*service.DerivedMetric{
+		{Name: "ALU Ratio", Expression: "alu_cycles / gpu_cycles"},
+		{Name: "Per Static", Expression: "gpu_time / static"},
+		{Name: "Scaled Ratio", Expression: "alu_ratio * 10"},
+		{Name: "Total Cycles", Expression: "alu_cycles + gpu_cycles", Aggregation: service.DerivedMetric_Summation},
+	})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	entries := data.GpuCounters.Entries
+	assert.For(ctx, "entries").That(len(entries)).Equals(1)
+	values := entries[0].MetricToValue
+	// The ratio of each sample, 0.5 and 0.9, averaged over the samples,
+	// rather than the ratio of the group estimates, 50 / 60.
+	assert.For(ctx, "ratio").ThatFloat(values[5].Estimate).IsAtLeast(0.6999)
+	assert.For(ctx, "ratio").ThatFloat(values[5].Estimate).IsAtMost(0.7001)
+	assert.For(ctx, "per static").That(values[6].Estimate).Equals(1000.0 / 7)
+	assert.For(ctx, "scaled ratio").ThatFloat(values[7].Estimate).IsAtLeast(6.999)
+	assert.For(ctx, "scaled ratio").ThatFloat(values[7].Estimate).IsAtMost(7.001)
+	assert.For(ctx, "static kept").That(values[4].Estimate).Equals(7.0)
+
+	// Derived metrics are not aggregated across groups unless requested.
+	metrics := data.GpuCounters.Metrics
+	assert.For(ctx, "ratio op").That(metrics[4].Op).Equals(service.ProfilingData_GpuCounters_Metric_None)
+	assert.For(ctx, "sum op").That(metrics[7].Op).Equals(service.ProfilingData_GpuCounters_Metric_Summation)
+
+	assert.For(ctx, "hardware entry").That(len(hardware.MetricToValue)).Equals(3)
+	assert.For(ctx, "static entry").That(len(static.MetricToValue)).Equals(1)
+}
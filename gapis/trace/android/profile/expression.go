@@ -0,0 +1,462 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// metricScope provides the metric values an expression is evaluated against.
+type metricScope interface {
+	// value returns the value of the named metric, or false if the metric has
+	// no value in this scope.
+	value(name string) (float64, bool)
+	// leaves returns the scopes to aggregate over for aggregation functions.
+	leaves() []metricScope
+}
+
+// evaluator is implemented by the metric scopes that evaluate expressions in
+// their own way, for example over their counter samples.
+type evaluator interface {
+	evaluate(e expr) (float64, bool)
+}
+
+// evalIn evaluates e in the scope s.
+func evalIn(e expr, s metricScope) (float64, bool) {
+	if ev, ok := s.(evaluator); ok {
+		return ev.evaluate(e)
+	}
+	return e.eval(s)
+}
+
+// expr is a node of a parsed derived metric expression.
+type expr interface {
+	// eval evaluates the expression, returning false if it is undefined in the
+	// given scope, for example because a referenced metric has no value.
+	eval(s metricScope) (float64, bool)
+}
+
+type numberExpr float64
+
+type metricExpr string
+
+type unaryExpr struct {
+	op rune
+	x  expr
+}
+
+type binaryExpr struct {
+	op   rune
+	l, r expr
+}
+
+type callExpr struct {
+	fn   string
+	args []expr
+}
+
+func (e numberExpr) eval(metricScope) (float64, bool) { return float64(e), true }
+
+func (e metricExpr) eval(s metricScope) (float64, bool) { return s.value(string(e)) }
+
+func (e unaryExpr) eval(s metricScope) (float64, bool) {
+	x, ok := e.x.eval(s)
+	return -x, ok
+}
+
+func (e binaryExpr) eval(s metricScope) (float64, bool) {
+	l, ok := e.l.eval(s)
+	if !ok {
+		return 0, false
+	}
+	r, ok := e.r.eval(s)
+	if !ok {
+		return 0, false
+	}
+	switch e.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	case '/':
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+	return 0, false
+}
+
+func (e callExpr) eval(s metricScope) (float64, bool) {
+	if len(e.args) == 2 && (e.fn == "min" || e.fn == "max") {
+		a, ok := e.args[0].eval(s)
+		if !ok {
+			return 0, false
+		}
+		b, ok := e.args[1].eval(s)
+		if !ok {
+			return 0, false
+		}
+		if e.fn == "min" {
+			return math.Min(a, b), true
+		}
+		return math.Max(a, b), true
+	}
+
+	leaves := s.leaves()
+	if e.fn == "count" {
+		return float64(len(leaves)), true
+	}
+
+	values := make([]float64, 0, len(leaves))
+	for _, leaf := range leaves {
+		if v, ok := evalIn(e.args[0], leaf); ok {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return 0, false
+	}
+
+	switch e.fn {
+	case "sum", "avg":
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		if e.fn == "avg" {
+			return sum / float64(len(values)), true
+		}
+		return sum, true
+	case "min", "max":
+		sort.Float64s(values)
+		if e.fn == "min" {
+			return values[0], true
+		}
+		return values[len(values)-1], true
+	case "median":
+		return percentile(values, 50), true
+	case "percentile":
+		p, ok := e.args[1].eval(s)
+		if !ok {
+			return 0, false
+		}
+		return percentile(values, p), true
+	}
+	return 0, false
+}
+
+// referencedMetrics returns the metrics referenced by e, excluding the ones
+// only referenced by the arguments of aggregation functions, which are
+// evaluated in the scopes of the leaf groups.
+func referencedMetrics(e expr) []string {
+	switch e := e.(type) {
+	case metricExpr:
+		return []string{string(e)}
+	case unaryExpr:
+		return referencedMetrics(e.x)
+	case binaryExpr:
+		return append(referencedMetrics(e.l), referencedMetrics(e.r)...)
+	case callExpr:
+		if len(e.args) == 2 && (e.fn == "min" || e.fn == "max") {
+			return append(referencedMetrics(e.args[0]), referencedMetrics(e.args[1])...)
+		}
+	}
+	return nil
+}
+
+// percentile returns the p-th percentile of values, using linear
+// interpolation between the closest ranks.
+func percentile(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	p = math.Max(0, math.Min(100, p))
+	rank := p / 100 * float64(len(values)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return values[lo] + (values[hi]-values[lo])*(rank-float64(lo))
+}
+
+// functionArgs lists the supported functions and their allowed argument
+// counts.
+var functionArgs = map[string][]int{
+	"sum":        {1},
+	"avg":        {1},
+	"min":        {1, 2},
+	"max":        {1, 2},
+	"median":     {1},
+	"percentile": {2},
+	"count":      {0},
+}
+
+// normalizeMetricName returns the name of a metric as it can be referenced by
+// an unquoted identifier in an expression: lower case, with runs of
+// non-alphanumeric characters replaced by a single '_'.
+func normalizeMetricName(name string) string {
+	sb := strings.Builder{}
+	sep := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if sep && sb.Len() > 0 {
+				sb.WriteRune('_')
+			}
+			sb.WriteRune(r)
+			sep = false
+		} else {
+			sep = true
+		}
+	}
+	return sb.String()
+}
+
+// parseExpression parses a derived metric expression.
+func parseExpression(s string) (expr, error) {
+	p := &exprParser{src: s}
+	p.next()
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != tokEOF {
+		return nil, p.errorf("unexpected %s", p.describe())
+	}
+	return e, nil
+}
+
+type exprToken int
+
+const (
+	tokEOF exprToken = iota
+	tokNumber
+	tokIdent
+	tokString
+	tokPunct
+)
+
+type exprParser struct {
+	src string
+	pos int // offset of the next unread character.
+	tok exprToken
+	val string
+	at  int // offset of the current token.
+	err error
+}
+
+func (p *exprParser) errorf(msg string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf("%s at offset %d in '%s'", fmt.Sprintf(msg, args...), p.at, p.src)
+}
+
+func (p *exprParser) describe() string {
+	switch p.tok {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("\"%s\"", p.val)
+	default:
+		return fmt.Sprintf("'%s'", p.val)
+	}
+}
+
+// next advances to the next token.
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	p.at = p.pos
+	if p.pos >= len(p.src) {
+		p.tok, p.val = tokEOF, ""
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		// Exponent.
+		if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+			p.pos++
+			if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+				p.pos++
+			}
+			for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+				p.pos++
+			}
+		}
+		p.tok, p.val = tokNumber, p.src[start:p.pos]
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isDigit(p.src[p.pos]) || unicode.IsLetter(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		p.tok, p.val = tokIdent, p.src[start:p.pos]
+	case c == '"':
+		end := strings.IndexByte(p.src[p.pos+1:], '"')
+		if end < 0 {
+			p.err = p.errorf("unterminated metric name")
+			p.tok, p.val = tokEOF, ""
+			return
+		}
+		p.tok, p.val = tokString, p.src[p.pos+1:p.pos+1+end]
+		p.pos += end + 2
+	default:
+		p.tok, p.val = tokPunct, string(c)
+		p.pos++
+	}
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func (p *exprParser) isPunct(s string) bool {
+	return p.tok == tokPunct && p.val == s
+}
+
+func (p *exprParser) expect(s string) error {
+	if !p.isPunct(s) {
+		return p.errorf("expected '%s', got %s", s, p.describe())
+	}
+	p.next()
+	return nil
+}
+
+// parseSum parses: product (('+' | '-') product)*
+func (p *exprParser) parseSum() (expr, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("+") || p.isPunct("-") {
+		op := rune(p.val[0])
+		p.next()
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op, l, r}
+	}
+	return l, nil
+}
+
+// parseProduct parses: unary (('*' | '/') unary)*
+func (p *exprParser) parseProduct() (expr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("*") || p.isPunct("/") {
+		op := rune(p.val[0])
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op, l, r}
+	}
+	return l, nil
+}
+
+// parseUnary parses: '-' unary | '+' unary | primary
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.isPunct("-") || p.isPunct("+") {
+		op := rune(p.val[0])
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == '+' {
+			return x, nil
+		}
+		return unaryExpr{op, x}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses: number | metric | call | '(' sum ')'
+func (p *exprParser) parsePrimary() (expr, error) {
+	switch p.tok {
+	case tokNumber:
+		v, err := strconv.ParseFloat(p.val, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number '%s'", p.val)
+		}
+		p.next()
+		return numberExpr(v), nil
+	case tokString:
+		name := normalizeMetricName(p.val)
+		p.next()
+		return metricExpr(name), nil
+	case tokIdent:
+		name := p.val
+		p.next()
+		if p.isPunct("(") {
+			return p.parseCall(strings.ToLower(name))
+		}
+		return metricExpr(normalizeMetricName(name)), nil
+	case tokPunct:
+		if p.isPunct("(") {
+			p.next()
+			e, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+	}
+	return nil, p.errorf("unexpected %s", p.describe())
+}
+
+// parseCall parses the argument list of a call to the function fn.
+func (p *exprParser) parseCall(fn string) (expr, error) {
+	counts, ok := functionArgs[fn]
+	if !ok {
+		return nil, p.errorf("unknown function '%s'", fn)
+	}
+	p.next() // '('
+	args := []expr{}
+	for !p.isPunct(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next() // ')'
+	for _, c := range counts {
+		if c == len(args) {
+			return callExpr{fn, args}, nil
+		}
+	}
+	return nil, p.errorf("wrong number of arguments to '%s': %d", fn, len(args))
+}
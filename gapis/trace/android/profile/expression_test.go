@@ -0,0 +1,137 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+)
+
+type testScope struct {
+	values   map[string]float64
+	children []metricScope
+}
+
+func (s testScope) value(name string) (float64, bool) {
+	v, ok := s.values[name]
+	return v, ok
+}
+
+func (s testScope) leaves() []metricScope {
+	if len(s.children) == 0 {
+		return []metricScope{s}
+	}
+	return s.children
+}
+
+func TestNormalizeMetricName(t *testing.T) {
+	assert := assert.To(t)
+	for name, expected := range map[string]string{
+		"GPU Time":            "gpu_time",
+		"ALU Cycles":          "alu_cycles",
+		"  % Shader ALU Busy": "shader_alu_busy",
+		"L2 Read (Bytes)":     "l2_read_bytes",
+		"alu_cycles":          "alu_cycles",
+	} {
+		assert.For(name).ThatString(normalizeMetricName(name)).Equals(expected)
+	}
+}
+
+func TestExpressionEval(t *testing.T) {
+	assert := assert.To(t)
+	draws := []metricScope{
+		testScope{values: map[string]float64{"gpu_time": 10, "alu_cycles": 5}},
+		testScope{values: map[string]float64{"gpu_time": 20, "alu_cycles": 5}},
+		testScope{values: map[string]float64{"gpu_time": 30}},
+		testScope{values: map[string]float64{"gpu_time": 40, "alu_cycles": 20}},
+	}
+	scope := testScope{
+		values: map[string]float64{
+			"gpu_time":   100,
+			"gpu_cycles": 200,
+			"alu_cycles": 50,
+		},
+		children: draws,
+	}
+
+	for _, test := range []struct {
+		expr     string
+		expected float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"-gpu_time + 1", -99},
+		{"100 * alu_cycles / gpu_cycles", 25},
+		{`100 * "ALU Cycles" / "GPU Cycles"`, 25},
+		{"1.5e2", 150},
+		{"min(gpu_time, gpu_cycles)", 100},
+		{"max(gpu_time, gpu_cycles)", 200},
+		{"sum(gpu_time)", 100},
+		{"sum(alu_cycles)", 30},
+		{"avg(gpu_time)", 25},
+		{"min(gpu_time)", 10},
+		{"max(gpu_time)", 40},
+		{"count()", 4},
+		{"median(gpu_time)", 25},
+		{"percentile(gpu_time, 0)", 10},
+		{"percentile(gpu_time, 100)", 40},
+		{"percentile(gpu_time, 50)", 25},
+		{"sum(gpu_time / 10)", 10},
+	} {
+		e, err := parseExpression(test.expr)
+		if !assert.For("parse %v", test.expr).ThatError(err).Succeeded() {
+			continue
+		}
+		v, ok := e.eval(scope)
+		assert.For("%v ok", test.expr).That(ok).Equals(true)
+		assert.For("%v", test.expr).That(v).Equals(test.expected)
+	}
+}
+
+func TestExpressionUndefined(t *testing.T) {
+	assert := assert.To(t)
+	scope := testScope{values: map[string]float64{"gpu_time": 100, "zero": 0}}
+	for _, expr := range []string{
+		"unknown_counter",
+		"gpu_time / zero",
+		"1 + unknown_counter",
+	} {
+		e, err := parseExpression(expr)
+		if !assert.For("parse %v", expr).ThatError(err).Succeeded() {
+			continue
+		}
+		_, ok := e.eval(scope)
+		assert.For("%v ok", expr).That(ok).Equals(false)
+	}
+}
+
+func TestExpressionParseErrors(t *testing.T) {
+	assert := assert.To(t)
+	for _, expr := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 2",
+		"foo(gpu_time)",
+		"percentile(gpu_time)",
+		"count(gpu_time)",
+		`"GPU Time`,
+		"sum(gpu_time,)",
+	} {
+		_, err := parseExpression(expr)
+		assert.For("%v", expr).ThatError(err).Failed()
+	}
+}
@@ -28,7 +28,8 @@ import (
 )
 
 const (
-	gpuTimeMetricId       int32 = 0
+	// GpuTimeMetricId is the id of the built-in GPU time metric.
+	GpuTimeMetricId       int32 = 0
 	gpuWallTimeMetricId   int32 = 1
 	counterMetricIdOffset int32 = 2
 )
@@ -109,7 +110,7 @@ func setTimeMetrics(ctx context.Context, groupToSlices map[int32][]*Slice,
 	groupToEntry map[int32]*service.ProfilingData_GpuCounters_Entry) {
 
 	gpuTimeMetric := &service.ProfilingData_GpuCounters_Metric{
-		Id:              gpuTimeMetricId,
+		Id:              GpuTimeMetricId,
 		Name:            "GPU Time",
 		Unit:            strconv.Itoa(int(device.GpuCounterDescriptor_NANOSECOND)),
 		Op:              service.ProfilingData_GpuCounters_Metric_Summation,
@@ -139,7 +140,7 @@ func setTimeMetrics(ctx context.Context, groupToSlices map[int32][]*Slice,
 			log.W(ctx, "Didn't find corresponding counter performance entry for GPU slice group %v.", groupId)
 			continue
 		}
-		entry.MetricToValue[gpuTimeMetricId] = &service.ProfilingData_GpuCounters_Perf{
+		entry.MetricToValue[GpuTimeMetricId] = &service.ProfilingData_GpuCounters_Perf{
 			Estimate: gpuTime,
 			Min:      gpuTime,
 			Max:      gpuTime,
@@ -144,6 +144,17 @@ func (t *androidTracer) ProcessProfilingData(ctx context.Context, buffer *bytes.
 	if err != nil {
 		return nil, log.Err(ctx, err, "Failed to read trace buffer")
 	}
+
+	conf := t.b.Instance().GetConfiguration()
+	return ProcessProfilingData(ctx, conf, rawData, capture, staticAnalysisResult, handleMappings, syncData)
+}
+
+// ProcessProfilingData translates the raw Perfetto trace of a profiling replay
+// on a device with the given configuration into ProfilingData.
+func ProcessProfilingData(ctx context.Context, conf *device.Configuration, rawData []byte,
+	capture *path.Capture, staticAnalysisResult chan *api.StaticAnalysisProfileData,
+	handleMappings map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData, error) {
+
 	processor, err := perfetto.NewProcessor(ctx, rawData)
 	defer processor.Close()
 	if err != nil {
@@ -151,7 +162,6 @@ func (t *androidTracer) ProcessProfilingData(ctx context.Context, buffer *bytes.
 	}
 
 	data := profile.NewProfilingData()
-	conf := t.b.Instance().GetConfiguration()
 	gpu := conf.GetHardware().GetGPU()
 	desc := conf.GetPerfettoCapability().GetGpuProfiling().GetGpuCounterDescriptor()
 	gpuName := gpu.GetName()
@@ -594,7 +604,7 @@ func (t *androidTracer) InstallPackage(ctx context.Context, o *service.TraceOpti
 	}
 
 	pkg := &android.InstalledPackage{
-		Name:        info.Name,
+		Name:        info.Package,
 		Device:      t.b,
 		ABI:         t.b.Instance().GetConfiguration().PreferredABI(info.ABI),
 		Debuggable:  info.Debuggable,
@@ -763,9 +773,21 @@ func (t *androidTracer) SetupTrace(ctx context.Context, o *service.TraceOptions)
 		cleanup = cleanup.Then(perfettoCleanup)
 	} else {
 		log.I(ctx, "Starting with options %+v", tracer.GapiiOptions(o))
+		now, boot, clockErr := deviceClocks(ctx, t.b)
+		if clockErr != nil {
+			log.W(ctx, "Failed to read the device clocks, not recording logcat: %v", clockErr)
+		}
+		var gapiiProcess *gapii.Process
 		var gapiiCleanup app.Cleanup
-		process, gapiiCleanup, err = gapii.Start(ctx, pkg, a, tracer.GapiiOptions(o))
+		gapiiProcess, gapiiCleanup, err = gapii.Start(ctx, pkg, a, tracer.GapiiOptions(o))
 		cleanup = cleanup.Then(gapiiCleanup)
+		process = gapiiProcess
+		if err == nil && pkg != nil && clockErr == nil {
+			if lp := recordLogcat(ctx, t.b, gapiiProcess, pkg, now, boot); lp != nil {
+				cleanup = cleanup.Then(lp.stop)
+				process = lp
+			}
+		}
 	}
 	if err != nil {
 		return ret, cleanup.Invoke(ctx), err
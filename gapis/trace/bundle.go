@@ -0,0 +1,197 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android"
+)
+
+// BundlePath returns the path of the profiling bundle p requested by a client.
+// If dir is not empty, relative paths are resolved against it and the bundle
+// must be within it. Otherwise the path must be relative and stay within the
+// working directory of the server.
+func BundlePath(dir, p string) (string, error) {
+	if dir == "" {
+		if filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+			return "", fmt.Errorf("Profiling bundle path %v is absolute, but no bundle directory is configured", p)
+		}
+		p = filepath.Clean(p)
+		if escapes(p) {
+			return "", fmt.Errorf("Profiling bundle %v is not within the working directory", p)
+		}
+		return p, nil
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	p = filepath.Clean(p)
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || escapes(rel) {
+		return "", fmt.Errorf("Profiling bundle %v is not within the bundle directory %v", p, dir)
+	}
+	return p, nil
+}
+
+// escapes returns true if the clean relative path rel refers to a parent of
+// the directory it is relative to.
+func escapes(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// SaveProfilingBundle saves the raw data of a profiling run to the given file,
+// so that it can be processed again later with ProcessProfilingBundle.
+func SaveProfilingBundle(ctx context.Context, bundlePath string, dev *path.Device, capture *path.Capture,
+	perfettoTrace []byte, handleMapping map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) error {
+
+	t, err := GetTracer(ctx, dev)
+	if err != nil {
+		return err
+	}
+	bundle := newProfilingBundle(capture, t.GetDevice().Instance(), perfettoTrace, handleMapping, syncData)
+	return writeProfilingBundle(ctx, bundlePath, bundle)
+}
+
+func newProfilingBundle(capture *path.Capture, dev *device.Instance, perfettoTrace []byte,
+	handleMapping map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) *service.ProfilingBundle {
+
+	bundle := &service.ProfilingBundle{
+		Capture:       capture,
+		Device:        dev,
+		PerfettoTrace: perfettoTrace,
+	}
+
+	replayValues := make([]uint64, 0, len(handleMapping))
+	for v := range handleMapping {
+		replayValues = append(replayValues, v)
+	}
+	sort.Slice(replayValues, func(i, j int) bool { return replayValues[i] < replayValues[j] })
+	for _, v := range replayValues {
+		m := &service.ProfilingBundle_HandleMapping{ReplayValue: v}
+		for i := range handleMapping[v] {
+			m.Items = append(m.Items, &handleMapping[v][i])
+		}
+		bundle.HandleMappings = append(bundle.HandleMappings, m)
+	}
+
+	if syncData != nil && syncData.RenderPassLookup != nil {
+		cbs, rps := syncData.RenderPassLookup.Mappings()
+		for _, cb := range cbs {
+			bundle.CommandBuffers = append(bundle.CommandBuffers, &service.ProfilingBundle_CommandBuffer{
+				Submission:    int64(cb.Submission),
+				CommandBuffer: cb.CommandBuffer,
+				Index:         cb.Idx,
+			})
+		}
+		for _, rp := range rps {
+			bundle.RenderPasses = append(bundle.RenderPasses, &service.ProfilingBundle_RenderPass{
+				Submission:    int64(rp.Key.Submission),
+				CommandBuffer: rp.Key.CommandBuffer,
+				RenderPass:    rp.Key.RenderPass,
+				Framebuffer:   rp.Key.Framebuffer,
+				From:          rp.Range.From,
+				To:            rp.Range.To,
+			})
+		}
+	}
+	return bundle
+}
+
+func writeProfilingBundle(ctx context.Context, bundlePath string, bundle *service.ProfilingBundle) error {
+	data, err := proto.Marshal(bundle)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to encode the profiling bundle")
+	}
+	if err := os.MkdirAll(filepath.Dir(bundlePath), 0755); err != nil {
+		return log.Errf(ctx, err, "Failed to create the directory for %v", bundlePath)
+	}
+	if err := ioutil.WriteFile(bundlePath, data, 0644); err != nil {
+		return log.Errf(ctx, err, "Failed to write the profiling bundle %v", bundlePath)
+	}
+	log.I(ctx, "Saved profiling bundle %v", bundlePath)
+	return nil
+}
+
+// LoadProfilingBundle loads a profiling bundle saved by SaveProfilingBundle.
+func LoadProfilingBundle(ctx context.Context, bundlePath string) (*service.ProfilingBundle, error) {
+	data, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to read the profiling bundle %v", bundlePath)
+	}
+	bundle := &service.ProfilingBundle{}
+	if err := proto.Unmarshal(data, bundle); err != nil {
+		return nil, log.Errf(ctx, err, "Failed to decode the profiling bundle %v", bundlePath)
+	}
+	return bundle, nil
+}
+
+// bundleSyncData returns the synchronization data saved in the bundle.
+func bundleSyncData(ctx context.Context, bundle *service.ProfilingBundle) *sync.Data {
+	syncData := sync.NewData()
+	for _, cb := range bundle.CommandBuffers {
+		syncData.RenderPassLookup.AddCommandBuffer(ctx, int(cb.Submission), cb.CommandBuffer, cb.Index)
+	}
+	for _, rp := range bundle.RenderPasses {
+		syncData.RenderPassLookup.AddRenderPass(ctx, sync.RenderPassKey{
+			Submission:    int(rp.Submission),
+			CommandBuffer: rp.CommandBuffer,
+			RenderPass:    rp.RenderPass,
+			Framebuffer:   rp.Framebuffer,
+		}, sync.SubCmdRange{From: rp.From, To: rp.To})
+	}
+	return syncData
+}
+
+// ProcessProfilingBundle translates the raw data of a profiling bundle into
+// ProfilingData, without requiring the device the data was collected on.
+func ProcessProfilingBundle(ctx context.Context, bundle *service.ProfilingBundle,
+	staticAnalysisResult chan *api.StaticAnalysisProfileData) (*service.ProfilingData, error) {
+
+	handleMapping := map[uint64][]service.VulkanHandleMappingItem{}
+	for _, m := range bundle.HandleMappings {
+		items := make([]service.VulkanHandleMappingItem, len(m.Items))
+		for i, item := range m.Items {
+			items[i] = *item
+		}
+		handleMapping[m.ReplayValue] = items
+	}
+
+	syncData := bundleSyncData(ctx, bundle)
+
+	switch kind := bundle.Device.GetConfiguration().GetOS().GetKind(); kind {
+	case device.Android:
+		return android.ProcessProfilingData(ctx, bundle.Device.GetConfiguration(), bundle.PerfettoTrace,
+			bundle.Capture, staticAnalysisResult, handleMapping, syncData)
+	default:
+		return nil, log.Errf(ctx, nil, "Offline profile processing is not supported for %v devices", kind)
+	}
+}
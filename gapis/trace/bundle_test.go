@@ -0,0 +1,108 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestProfilingBundleRoundTrip(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "bundle")
+	if !assert.For(ctx, "temp dir").ThatError(err).Succeeded() {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	syncData := sync.NewData()
+	syncData.RenderPassLookup.AddCommandBuffer(ctx, 1, 100, api.SubCmdIdx{5, 0, 0})
+	syncData.RenderPassLookup.AddRenderPass(ctx, sync.RenderPassKey{
+		Submission:    1,
+		CommandBuffer: 100,
+		RenderPass:    10,
+		Framebuffer:   20,
+	}, sync.SubCmdRange{From: api.SubCmdIdx{5, 0, 0, 1}, To: api.SubCmdIdx{5, 0, 0, 3}})
+	handleMapping := map[uint64][]service.VulkanHandleMappingItem{
+		7: {{HandleType: "VkCommandBuffer", TraceValue: 100, ReplayValue: 7}},
+	}
+	dev := &device.Instance{
+		Name:          "phone",
+		Configuration: &device.Configuration{OS: &device.OS{Kind: device.Android}},
+	}
+
+	bundle := newProfilingBundle(&path.Capture{}, dev, []byte("trace"), handleMapping, syncData)
+	bundlePath := filepath.Join(dir, "sub", "profile.bundle")
+	if !assert.For(ctx, "write").ThatError(writeProfilingBundle(ctx, bundlePath, bundle)).Succeeded() {
+		return
+	}
+	loaded, err := LoadProfilingBundle(ctx, bundlePath)
+	if !assert.For(ctx, "load").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "bundle").That(proto.Equal(loaded, bundle)).Equals(true)
+	assert.For(ctx, "handle mappings").ThatSlice(loaded.HandleMappings).IsLength(1)
+
+	cbs, rps := syncData.RenderPassLookup.Mappings()
+	loadedCbs, loadedRps := bundleSyncData(ctx, loaded).RenderPassLookup.Mappings()
+	assert.For(ctx, "command buffers").That(loadedCbs).DeepEquals(cbs)
+	assert.For(ctx, "render passes").That(loadedRps).DeepEquals(rps)
+
+	_, err = LoadProfilingBundle(ctx, filepath.Join(dir, "missing.bundle"))
+	assert.For(ctx, "missing").ThatError(err).Failed()
+}
+
+func TestBundlePath(t *testing.T) {
+	ctx := log.Testing(t)
+	root := string(filepath.Separator)
+	dir := filepath.Join(root, "bundles")
+	for _, test := range []struct {
+		dir      string
+		path     string
+		expected string
+	}{
+		{"", "a.bundle", "a.bundle"},
+		{"", filepath.Join("x", "..", "a.bundle"), "a.bundle"},
+		{"", filepath.Join(root, "tmp", "a.bundle"), ""},
+		{"", filepath.Join("..", "a.bundle"), ""},
+		{"", filepath.Join("x", "..", "..", "etc", "passwd"), ""},
+		{dir, "a.bundle", filepath.Join(dir, "a.bundle")},
+		{dir, filepath.Join("x", "..", "a.bundle"), filepath.Join(dir, "a.bundle")},
+		{dir, filepath.Join(dir, "x", "a.bundle"), filepath.Join(dir, "x", "a.bundle")},
+		{dir, filepath.Join("..", "a.bundle"), ""},
+		{dir, filepath.Join("x", "..", "..", "etc", "passwd"), ""},
+		{dir, filepath.Join(root, "tmp", "a.bundle"), ""},
+		{dir, filepath.Join(root, "bundles2", "a.bundle"), ""},
+	} {
+		got, err := BundlePath(test.dir, test.path)
+		if test.expected == "" {
+			assert.For(ctx, "%v in '%v'", test.path, test.dir).ThatError(err).Failed()
+		} else {
+			assert.For(ctx, "%v in '%v'", test.path, test.dir).ThatError(err).Succeeded()
+			assert.For(ctx, "%v in '%v'", test.path, test.dir).ThatString(got).Equals(test.expected)
+		}
+	}
+}
@@ -21,7 +21,9 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/data/pack"
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
 	gapii "github.com/google/gapid/gapii/client"
@@ -66,22 +68,75 @@ func trace(ctx context.Context, device *path.Device, start task.Signal, stop tas
 	defer cleanup.Invoke(ctx)
 
 	var writer io.Writer
+	var file *os.File
 	if buffer != nil {
 		writer = buffer
 	} else {
 		os.MkdirAll(filepath.Dir(options.ServerLocalSavePath), 0755)
-		writer, err = os.Create(options.ServerLocalSavePath)
+		file, err = os.Create(options.ServerLocalSavePath)
 		if err != nil {
 			return err
 		}
-		defer writer.(*os.File).Close()
+		defer file.Close()
+		writer = file
+	}
+
+	// Follow the chunks of the capture while it is written, so that the
+	// extras can be appended without reading the capture back.
+	extras, hasExtras := process.(tracer.CaptureExtras)
+	var scanner *pack.Scanner
+	if hasExtras {
+		scanner = pack.NewScanner()
+		writer = io.MultiWriter(writer, scanner)
 	}
 
 	_, err = process.Capture(ctx, start, stop, ready, writer, written)
 
+	// Add the extras even if the capture failed, as they may help understand
+	// why it did.
+	if hasExtras {
+		if msgs := extras.CaptureExtras(ctx); len(msgs) > 0 {
+			if err := appendToCapture(ctx, msgs, scanner, file, buffer); err != nil {
+				log.W(ctx, "Failed to add %d messages to the capture: %v", len(msgs), err)
+			}
+		}
+	}
+
 	return err
 }
 
+// appendToCapture appends the messages to the capture followed by scanner,
+// written to buffer, or to file if buffer is nil.
+func appendToCapture(ctx context.Context, msgs []proto.Message, scanner *pack.Scanner, file *os.File, buffer *bytes.Buffer) error {
+	var to io.Writer
+	if buffer != nil {
+		to = buffer
+	} else {
+		to = file
+	}
+	w, size, err := scanner.Appender(to)
+	if err != nil {
+		return err
+	}
+	// Drop any partially written chunk before appending.
+	if buffer != nil {
+		buffer.Truncate(int(size))
+	} else {
+		if err := file.Truncate(size); err != nil {
+			return err
+		}
+		if _, err := file.Seek(size, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	for _, msg := range msgs {
+		if err := w.Object(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func Trace(ctx context.Context, device *path.Device, start task.Signal, stop task.Signal, ready task.Task, options *service.TraceOptions, written *int64) error {
 	return trace(ctx, device, start, stop, ready, options, written, nil)
 }
@@ -0,0 +1,107 @@
+// Copyright (C) 2022 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/pack"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/capture"
+)
+
+// packObjects collects the root objects of a pack file.
+type packObjects []proto.Message
+
+func (o *packObjects) BeginGroup(ctx context.Context, msg proto.Message, id uint64) error {
+	return nil
+}
+func (o *packObjects) BeginChildGroup(ctx context.Context, msg proto.Message, id, parentID uint64) error {
+	return nil
+}
+func (o *packObjects) EndGroup(ctx context.Context, id uint64) error { return nil }
+func (o *packObjects) Object(ctx context.Context, msg proto.Message) error {
+	*o = append(*o, msg)
+	return nil
+}
+func (o *packObjects) ChildObject(ctx context.Context, msg proto.Message, parentID uint64) error {
+	return nil
+}
+
+// writeCapture writes a capture interrupted in the middle of a chunk to to,
+// returning the scanner that followed it.
+func writeCapture(ctx context.Context, to io.Writer) *pack.Scanner {
+	scanner := pack.NewScanner()
+	to = io.MultiWriter(to, scanner)
+	w, err := pack.NewWriter(to)
+	assert.For(ctx, "NewWriter").ThatError(err).Succeeded()
+	assert.For(ctx, "Object").ThatError(w.Object(ctx, &capture.LogcatMessage{Tag: "capture"})).Succeeded()
+	to.Write([]byte{0x40, 1, 2, 3})
+	return scanner
+}
+
+func checkCapture(ctx context.Context, name string, data []byte) {
+	got := packObjects{}
+	err := pack.Read(ctx, bytes.NewReader(data), &got, false)
+	if !assert.For(ctx, "%v read", name).ThatError(err).Succeeded() {
+		return
+	}
+	tags := []string{}
+	for _, msg := range got {
+		tags = append(tags, msg.(*capture.LogcatMessage).Tag)
+	}
+	assert.For(ctx, "%v messages", name).ThatSlice(tags).Equals([]string{"capture", "first", "second"})
+}
+
+func TestAppendToCapture(t *testing.T) {
+	ctx := log.Testing(t)
+	msgs := []proto.Message{
+		&capture.LogcatMessage{Tag: "first", Message: "hello"},
+		&capture.LogcatMessage{Tag: "second", Priority: capture.LogcatMessage_Error},
+	}
+
+	buffer := &bytes.Buffer{}
+	scanner := writeCapture(ctx, buffer)
+	err := appendToCapture(ctx, msgs, scanner, nil, buffer)
+	if assert.For(ctx, "buffer append").ThatError(err).Succeeded() {
+		checkCapture(ctx, "buffer", buffer.Bytes())
+	}
+
+	dir, err := ioutil.TempDir("", "capture")
+	if !assert.For(ctx, "temp dir").ThatError(err).Succeeded() {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file, err := os.Create(filepath.Join(dir, "capture.gfxtrace"))
+	if !assert.For(ctx, "create").ThatError(err).Succeeded() {
+		return
+	}
+	defer file.Close()
+	scanner = writeCapture(ctx, file)
+	err = appendToCapture(ctx, msgs, scanner, file, nil)
+	if assert.For(ctx, "file append").ThatError(err).Succeeded() {
+		data, err := ioutil.ReadFile(file.Name())
+		assert.For(ctx, "read file").ThatError(err).Succeeded()
+		checkCapture(ctx, "file", data)
+	}
+}
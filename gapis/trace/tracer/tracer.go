@@ -20,6 +20,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/app/layout"
 	"github.com/google/gapid/core/event/task"
@@ -55,6 +56,15 @@ type Process interface {
 	Capture(ctx context.Context, start task.Signal, stop task.Signal, ready task.Task, w io.Writer, written *int64) (size int64, err error)
 }
 
+// CaptureExtras is an optional interface that a Process can implement to add
+// information recorded while tracing, such as the logs of the traced
+// application, to the capture.
+type CaptureExtras interface {
+	// CaptureExtras returns the messages to append to the capture. It is
+	// called once Capture has returned.
+	CaptureExtras(ctx context.Context) []proto.Message
+}
+
 // Tracer is an option interface that a bind.Device can implement.
 // If it exists, it is used to set up and connect to a tracing application.
 type Tracer interface {